@@ -0,0 +1,142 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"rebnb/gateway"
+	"strings"
+	"time"
+)
+
+// Supported blob store backends
+const (
+	BackendLocal  = "local"
+	BackendPinata = "pinata"
+	BackendKubo   = "kubo"
+	BackendZeroG  = "0g"
+)
+
+var (
+	// ErrNotFound is returned when a key doesn't exist in the store
+	ErrNotFound = errors.New("blob not found")
+	// ErrNotSupported is returned for operations a backend can't perform
+	ErrNotSupported = errors.New("operation not supported by this backend")
+)
+
+// BlobInfo represents a stored blob
+type BlobInfo struct {
+	Key         string    `json:"key"`
+	Name        string    `json:"name,omitempty"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	Backend     string    `json:"backend"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	// SHA256 is the hex SHA-256 of the content, when the caller computed it
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// BlobStore stores and retrieves opaque blobs. Keys are chosen by the backend: a file name
+// for the local store, a CID for IPFS backends and a Merkle root for 0G.
+type BlobStore interface {
+	// Backend returns the backend name
+	Backend() string
+	// URL returns the public URL a key can be fetched from
+	URL(key string) string
+	// Put stores the content read from r under a backend-chosen key
+	Put(ctx context.Context, name string, r io.Reader) (*BlobInfo, error)
+	// Get opens a blob for reading, the caller must close it
+	Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error)
+	// Stat returns a blob's metadata without its content
+	Stat(ctx context.Context, key string) (*BlobInfo, error)
+	// List returns every blob in the store
+	List(ctx context.Context) ([]BlobInfo, error)
+	// Delete removes a blob, or unpins it for content-addressed backends
+	Delete(ctx context.Context, key string) error
+}
+
+// Config holds blob store configuration
+type Config struct {
+	Backend string
+
+	// Local filesystem backend
+	LocalDir string
+	LocalURL string
+
+	// Pinata backend
+	PinataJWT        string
+	PinataGatewayURL string
+
+	// Kubo backend
+	KuboAPIURL     string
+	KuboGatewayURL string
+
+	// 0G backend
+	ZeroGGatewayURL string
+}
+
+// NewConfigFromEnv creates a blob store config from environment variables. backendEnv names
+// the variable that selects the backend, and localDir/localPath place the local backend's files
+// on disk and under the public base URL.
+func NewConfigFromEnv(backendEnv, defaultBackend, localDir, localPath string) *Config {
+	publicURL := getEnvOrDefault("PUBLIC_BASE_URL", "https://api.rebnb.sumitdhiman.in")
+
+	config := &Config{
+		Backend:          strings.ToLower(os.Getenv(backendEnv)),
+		LocalDir:         localDir,
+		LocalURL:         publicURL + localPath,
+		PinataJWT:        os.Getenv("PINATA_JWT"),
+		PinataGatewayURL: gateway.PinataGatewayURLFromEnv(),
+		KuboAPIURL:       getEnvOrDefault("KUBO_API_URL", "http://127.0.0.1:5001"),
+		KuboGatewayURL:   getEnvOrDefault("KUBO_GATEWAY_URL", "http://127.0.0.1:8080/ipfs/"),
+		ZeroGGatewayURL:  getEnvOrDefault("ZEROG_GATEWAY_URL", publicURL+"/api/v1/storage/download/"),
+	}
+
+	if config.Backend == "" {
+		config.Backend = defaultBackend
+	}
+
+	return config
+}
+
+// New creates the blob store selected by config. The 0G backend needs a client and fails without one.
+func New(config *Config, zeroG ZeroGClient) (BlobStore, error) {
+	switch config.Backend {
+	case BackendLocal:
+		return NewLocalStore(config.LocalDir, config.LocalURL)
+	case BackendPinata:
+		return NewPinataStore(config.PinataJWT, config.PinataGatewayURL), nil
+	case BackendKubo:
+		return NewKuboStore(config.KuboAPIURL, config.KuboGatewayURL), nil
+	case BackendZeroG:
+		if zeroG == nil {
+			return nil, fmt.Errorf("0G blob store requires a storage client")
+		}
+		return NewZeroGStore(zeroG, config.ZeroGGatewayURL), nil
+	default:
+		return nil, fmt.Errorf("unknown blob store backend '%s'", config.Backend)
+	}
+}
+
+// getEnvOrDefault gets environment variable with default value
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
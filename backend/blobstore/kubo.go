@@ -0,0 +1,116 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	shell "github.com/ipfs/go-ipfs-api"
+)
+
+// KuboStore stores blobs on a Kubo node through its HTTP RPC API, pinning everything it adds
+type KuboStore struct {
+	shell      *shell.Shell
+	gatewayURL string
+}
+
+// NewKuboStore creates a Kubo store
+func NewKuboStore(apiURL, gatewayURL string) *KuboStore {
+	if !strings.HasSuffix(gatewayURL, "/") {
+		gatewayURL += "/"
+	}
+
+	return &KuboStore{
+		shell:      shell.NewShellWithClient(apiURL, &http.Client{Timeout: 5 * time.Minute}),
+		gatewayURL: gatewayURL,
+	}
+}
+
+// Backend returns the backend name
+func (s *KuboStore) Backend() string {
+	return BackendKubo
+}
+
+// URL returns the gateway URL for a CID
+func (s *KuboStore) URL(key string) string {
+	return s.gatewayURL + key
+}
+
+// Put adds and pins the blob as a CIDv1
+func (s *KuboStore) Put(ctx context.Context, name string, r io.Reader) (*BlobInfo, error) {
+	counter := &countingReader{r: r}
+
+	cid, err := s.shell.Add(counter, shell.CidVersion(1), shell.Pin(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add to kubo: %v", err)
+	}
+
+	return &BlobInfo{
+		Key:       cid,
+		Name:      name,
+		Size:      counter.n,
+		URL:       s.URL(cid),
+		Backend:   BackendKubo,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Get reads the blob's content from the node
+func (s *KuboStore) Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := s.shell.Cat("/ipfs/" + key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read from kubo: %v", err)
+	}
+
+	return content, info, nil
+}
+
+// Stat returns the size of the file behind a CID
+func (s *KuboStore) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	stat, err := s.shell.FilesStat(ctx, "/ipfs/"+key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %v", key, err)
+	}
+
+	return &BlobInfo{
+		Key:     key,
+		Size:    int64(stat.Size),
+		URL:     s.URL(key),
+		Backend: BackendKubo,
+	}, nil
+}
+
+// List returns the node's recursive pins
+func (s *KuboStore) List(ctx context.Context) ([]BlobInfo, error) {
+	pins, err := s.shell.PinsOfType(ctx, shell.RecursivePin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pins: %v", err)
+	}
+
+	blobs := make([]BlobInfo, 0, len(pins))
+	for cid := range pins {
+		blobs = append(blobs, BlobInfo{
+			Key:     cid,
+			URL:     s.URL(cid),
+			Backend: BackendKubo,
+		})
+	}
+
+	return blobs, nil
+}
+
+// Delete unpins the CID so the node can garbage collect it
+func (s *KuboStore) Delete(ctx context.Context, key string) error {
+	if err := s.shell.Unpin("/ipfs/" + key); err != nil {
+		return fmt.Errorf("failed to unpin %s: %v", key, err)
+	}
+	return nil
+}
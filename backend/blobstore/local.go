@@ -0,0 +1,165 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore stores blobs as files in a directory served under a public URL
+type LocalStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalStore creates a local store, creating its directory if needed
+func NewLocalStore(dir, baseURL string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %v", err)
+	}
+
+	return &LocalStore{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+// Backend returns the backend name
+func (s *LocalStore) Backend() string {
+	return BackendLocal
+}
+
+// URL returns the public URL for a key
+func (s *LocalStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+// path resolves a key to a file inside the store directory
+func (s *LocalStore) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || strings.HasPrefix(key, ".") {
+		return "", fmt.Errorf("invalid blob key '%s'", key)
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+// Put writes the blob to a file named after name, replacing any existing file
+func (s *LocalStore) Put(ctx context.Context, name string, r io.Reader) (*BlobInfo, error) {
+	key := filepath.Base(name)
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Write to a temporary file first so readers never see a partial blob
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to save file: %v", err)
+	}
+
+	return s.Stat(ctx, key)
+}
+
+// Get opens the file for a key
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path, _ := s.path(key)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %v", err)
+	}
+
+	return file, info, nil
+}
+
+// Stat returns the file's size and a content type guessed from its extension
+func (s *LocalStore) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to stat file: %v", err)
+	}
+
+	return s.info(key, stat), nil
+}
+
+// List returns every file in the store directory
+func (s *LocalStore) List(ctx context.Context) ([]BlobInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob directory: %v", err)
+	}
+
+	blobs := make([]BlobInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		blobs = append(blobs, *s.info(entry.Name(), stat))
+	}
+
+	return blobs, nil
+}
+
+// Delete removes the file for a key
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+
+	return nil
+}
+
+func (s *LocalStore) info(key string, stat os.FileInfo) *BlobInfo {
+	return &BlobInfo{
+		Key:         key,
+		Name:        key,
+		Size:        stat.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+		URL:         s.URL(key),
+		Backend:     BackendLocal,
+		CreatedAt:   stat.ModTime(),
+	}
+}
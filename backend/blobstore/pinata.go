@@ -0,0 +1,260 @@
+package blobstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	pinataUploadURL = "https://uploads.pinata.cloud/v3/files"
+	pinataFilesURL  = "https://api.pinata.cloud/v3/files/public"
+)
+
+// PinataStore stores blobs as public files through Pinata's v3 API
+type PinataStore struct {
+	jwt        string
+	gatewayURL string
+	httpClient *http.Client
+}
+
+// pinataFile represents a file in Pinata's v3 API responses
+type pinataFile struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CID       string `json:"cid"`
+	Size      int64  `json:"size"`
+	MimeType  string `json:"mime_type"`
+	CreatedAt string `json:"created_at"`
+}
+
+// NewPinataStore creates a Pinata store
+func NewPinataStore(jwt, gatewayURL string) *PinataStore {
+	if !strings.HasSuffix(gatewayURL, "/") {
+		gatewayURL += "/"
+	}
+
+	return &PinataStore{
+		jwt:        jwt,
+		gatewayURL: gatewayURL,
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Backend returns the backend name
+func (s *PinataStore) Backend() string {
+	return BackendPinata
+}
+
+// URL returns the gateway URL for a CID
+func (s *PinataStore) URL(key string) string {
+	return s.gatewayURL + key
+}
+
+// Put uploads the blob, streaming the multipart body as it's read
+func (s *PinataStore) Put(ctx context.Context, name string, r io.Reader) (*BlobInfo, error) {
+	if s.jwt == "" {
+		return nil, fmt.Errorf("pinata JWT not configured")
+	}
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+
+	go func() {
+		part, err := form.CreateFormFile("file", name)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = form.WriteField("network", "public")
+		}
+		if err == nil {
+			err = form.WriteField("name", name)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pinataUploadURL, body)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	var resp struct {
+		Data pinataFile `json:"data"`
+	}
+	if err := s.do(req, &resp); err != nil {
+		body.CloseWithError(err)
+		return nil, err
+	}
+
+	return s.info(&resp.Data), nil
+}
+
+// Get fetches the blob through the gateway
+func (s *PinataStore) Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL(key), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch from gateway: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("gateway returned status %d", resp.StatusCode)
+	}
+
+	info := &BlobInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		URL:         s.URL(key),
+		Backend:     BackendPinata,
+	}
+
+	return resp.Body, info, nil
+}
+
+// Stat looks up the file pinned under a CID
+func (s *PinataStore) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	file, err := s.find(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.info(file), nil
+}
+
+// List returns every public file on the account
+func (s *PinataStore) List(ctx context.Context) ([]BlobInfo, error) {
+	var blobs []BlobInfo
+
+	pageToken := ""
+	for {
+		query := url.Values{"limit": {"1000"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		files, next, err := s.list(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for i := range files {
+			blobs = append(blobs, *s.info(&files[i]))
+		}
+
+		if next == "" || len(files) == 0 {
+			return blobs, nil
+		}
+		pageToken = next
+	}
+}
+
+// Delete removes the file pinned under a CID
+func (s *PinataStore) Delete(ctx context.Context, key string) error {
+	file, err := s.find(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, pinataFilesURL+"/"+url.PathEscape(file.ID), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	return s.do(req, nil)
+}
+
+// find returns the first file with the given CID
+func (s *PinataStore) find(ctx context.Context, cid string) (*pinataFile, error) {
+	files, _, err := s.list(ctx, url.Values{"cid": {cid}, "limit": {"1"}})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrNotFound
+	}
+	return &files[0], nil
+}
+
+// list queries one page of the files API
+func (s *PinataStore) list(ctx context.Context, query url.Values) ([]pinataFile, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pinataFilesURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %v", err)
+	}
+
+	var resp struct {
+		Data struct {
+			Files         []pinataFile `json:"files"`
+			NextPageToken string       `json:"next_page_token"`
+		} `json:"data"`
+	}
+	if err := s.do(req, &resp); err != nil {
+		return nil, "", err
+	}
+
+	return resp.Data.Files, resp.Data.NextPageToken, nil
+}
+
+// do sends an authenticated API request and decodes the JSON response into out
+func (s *PinataStore) do(req *http.Request, out interface{}) error {
+	if s.jwt == "" {
+		return fmt.Errorf("pinata JWT not configured")
+	}
+	req.Header.Set("Authorization", "Bearer "+s.jwt)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("pinata API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	return nil
+}
+
+func (s *PinataStore) info(file *pinataFile) *BlobInfo {
+	createdAt, _ := time.Parse(time.RFC3339, file.CreatedAt)
+
+	return &BlobInfo{
+		Key:         file.CID,
+		Name:        file.Name,
+		Size:        file.Size,
+		ContentType: file.MimeType,
+		URL:         s.URL(file.CID),
+		Backend:     BackendPinata,
+		CreatedAt:   createdAt,
+	}
+}
@@ -0,0 +1,108 @@
+package blobstore
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"rebnb/internal/streamtest"
+)
+
+// redirectTransport sends every request to a test server, whatever host it was addressed to
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newFakePinata returns a Pinata store uploading to a fake that checks the file part against the
+// generated content as it streams in
+func newFakePinata(t testing.TB) *PinataStore {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/files" {
+			http.NotFound(w, r)
+			return
+		}
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		file := pinataFile{ID: "file-id", CID: "bafkreitest", CreatedAt: "2026-01-01T00:00:00Z"}
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			if part.FormName() != "file" {
+				continue
+			}
+
+			file.Name = part.FileName()
+			verifier := &streamtest.Verifier{}
+			if _, err := io.Copy(verifier, part); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			file.Size = verifier.Written
+		}
+
+		json.NewEncoder(w).Encode(map[string]pinataFile{"data": file})
+	}))
+	t.Cleanup(server.Close)
+
+	target, _ := url.Parse(server.URL)
+	store := NewPinataStore("test-jwt", "https://gateway.test/ipfs/")
+	store.httpClient = &http.Client{Transport: &redirectTransport{target: target}}
+	return store
+}
+
+func TestPinataPutStreams(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams a 500MB upload")
+	}
+	store := newFakePinata(t)
+
+	var info *BlobInfo
+	var err error
+	growth := streamtest.PeakHeapGrowth(func() {
+		info, err = store.Put(context.Background(), "large.bin", streamtest.NewReader(streamtest.TransferSize))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != streamtest.TransferSize || info.Name != "large.bin" {
+		t.Errorf("Put stored %q with %d bytes", info.Name, info.Size)
+	}
+	if growth > streamtest.MaxHeapGrowth {
+		t.Errorf("heap grew by %d bytes uploading %d", growth, streamtest.TransferSize)
+	}
+}
+
+func BenchmarkPinataPut(b *testing.B) {
+	store := newFakePinata(b)
+	b.ReportAllocs()
+	b.SetBytes(streamtest.TransferSize)
+
+	var peak uint64
+	for i := 0; i < b.N; i++ {
+		growth := streamtest.PeakHeapGrowth(func() {
+			if _, err := store.Put(context.Background(), "large.bin", streamtest.NewReader(streamtest.TransferSize)); err != nil {
+				b.Fatal(err)
+			}
+		})
+		peak = max(peak, growth)
+	}
+	b.ReportMetric(float64(peak), "peak-heap-bytes")
+}
@@ -0,0 +1,104 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+)
+
+// ZeroGClient is the part of a 0G Storage client the blob store needs
+type ZeroGClient interface {
+	// Upload stores the content and returns its Merkle root and size
+	Upload(ctx context.Context, r io.Reader, name string) (root string, size int64, err error)
+	// Download opens the content stored under a Merkle root
+	Download(ctx context.Context, root string) (io.ReadCloser, int64, error)
+	// FileInfo returns the size of the content stored under a Merkle root
+	FileInfo(ctx context.Context, root string) (int64, error)
+}
+
+// ZeroGStore stores blobs on 0G Storage. Files there are immutable and there's no
+// per-account listing, so List and Delete are not supported.
+type ZeroGStore struct {
+	client     ZeroGClient
+	gatewayURL string
+}
+
+// NewZeroGStore creates a 0G store
+func NewZeroGStore(client ZeroGClient, gatewayURL string) *ZeroGStore {
+	if !strings.HasSuffix(gatewayURL, "/") {
+		gatewayURL += "/"
+	}
+
+	return &ZeroGStore{
+		client:     client,
+		gatewayURL: gatewayURL,
+	}
+}
+
+// Backend returns the backend name
+func (s *ZeroGStore) Backend() string {
+	return BackendZeroG
+}
+
+// URL returns the download URL for a Merkle root
+func (s *ZeroGStore) URL(key string) string {
+	return s.gatewayURL + key
+}
+
+// Put uploads the blob and keys it by its Merkle root
+func (s *ZeroGStore) Put(ctx context.Context, name string, r io.Reader) (*BlobInfo, error) {
+	root, size, err := s.client.Upload(ctx, r, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlobInfo{
+		Key:       root,
+		Name:      name,
+		Size:      size,
+		URL:       s.URL(root),
+		Backend:   BackendZeroG,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Get downloads the blob for a Merkle root
+func (s *ZeroGStore) Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	content, size, err := s.client.Download(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return content, &BlobInfo{
+		Key:     key,
+		Size:    size,
+		URL:     s.URL(key),
+		Backend: BackendZeroG,
+	}, nil
+}
+
+// Stat returns the size of the file for a Merkle root
+func (s *ZeroGStore) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	size, err := s.client.FileInfo(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlobInfo{
+		Key:     key,
+		Size:    size,
+		URL:     s.URL(key),
+		Backend: BackendZeroG,
+	}, nil
+}
+
+// List is not supported on 0G Storage
+func (s *ZeroGStore) List(ctx context.Context) ([]BlobInfo, error) {
+	return nil, ErrNotSupported
+}
+
+// Delete is not supported on 0G Storage
+func (s *ZeroGStore) Delete(ctx context.Context, key string) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,43 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// LoadABI loads a contract ABI from abi/<name>.json, which wraps the ABI array in an object
+func LoadABI(name string) (*abi.ABI, error) {
+	abiBytes, err := os.ReadFile(filepath.Join("abi", name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ABI file: %v", err)
+	}
+
+	var wrapper struct {
+		ABI json.RawMessage `json:"abi"`
+	}
+	if err := json.Unmarshal(abiBytes, &wrapper); err != nil {
+		return nil, fmt.Errorf("failed to parse ABI wrapper: %v", err)
+	}
+
+	contractABI, err := abi.JSON(strings.NewReader(string(wrapper.ABI)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ABI: %v", err)
+	}
+
+	return &contractABI, nil
+}
+
+// LoadMarketplaceABI loads the Marketplace contract ABI
+func LoadMarketplaceABI() (*abi.ABI, error) {
+	return LoadABI("marketplace")
+}
+
+// LoadPropertyABI loads the property contract ABI
+func LoadPropertyABI() (*abi.ABI, error) {
+	return LoadABI("property")
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collections backing Sign-In With Ethereum
+const (
+	AuthNoncesCollection = "auth_nonces"
+	SessionsCollection   = "sessions"
+)
+
+// AuthNonce represents a single-use SIWE nonce in MongoDB
+type AuthNonce struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Nonce     string             `bson:"nonce" json:"nonce"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Session represents an authenticated wallet session in MongoDB.
+// Only a hash of the session token is stored.
+type Session struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TokenHash     string             `bson:"token_hash" json:"-"`
+	WalletAddress string             `bson:"wallet_address" json:"wallet_address"`
+	ChainID       string             `bson:"chain_id" json:"chain_id"`
+	ExpiresAt     time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// InsertAuthNonce stores a freshly issued nonce
+func (c *Client) InsertAuthNonce(ctx context.Context, nonce *AuthNonce) error {
+	collection := c.GetCollection(AuthNoncesCollection)
+
+	nonce.CreatedAt = time.Now()
+
+	if _, err := collection.InsertOne(ctx, nonce); err != nil {
+		return fmt.Errorf("failed to insert nonce: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeAuthNonce deletes an unexpired nonce, failing if it was never issued or already used
+func (c *Client) ConsumeAuthNonce(ctx context.Context, nonce string) error {
+	collection := c.GetCollection(AuthNoncesCollection)
+
+	filter := bson.D{
+		{Key: "nonce", Value: nonce},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+
+	if err := collection.FindOneAndDelete(ctx, filter).Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("nonce '%s' is invalid or expired", nonce)
+		}
+		return fmt.Errorf("failed to consume nonce: %w", err)
+	}
+
+	return nil
+}
+
+// InsertSession stores a new wallet session
+func (c *Client) InsertSession(ctx context.Context, session *Session) error {
+	collection := c.GetCollection(SessionsCollection)
+
+	session.CreatedAt = time.Now()
+
+	if _, err := collection.InsertOne(ctx, session); err != nil {
+		return fmt.Errorf("failed to insert session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSession retrieves an unexpired session by token hash
+func (c *Client) GetSession(ctx context.Context, tokenHash string) (*Session, error) {
+	collection := c.GetCollection(SessionsCollection)
+
+	var session Session
+	filter := bson.D{
+		{Key: "token_hash", Value: tokenHash},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+
+	if err := collection.FindOne(ctx, filter).Decode(&session); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("session not found or expired")
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// DeleteSession removes a session by token hash
+func (c *Client) DeleteSession(ctx context.Context, tokenHash string) error {
+	collection := c.GetCollection(SessionsCollection)
+
+	filter := bson.D{{Key: "token_hash", Value: tokenHash}}
+	if _, err := collection.DeleteOne(ctx, filter); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	return nil
+}
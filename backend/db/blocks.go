@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BlocksCollection stores the block hashes seen by each block cursor
+const BlocksCollection = "indexed_blocks"
+
+// IndexedBlock records the provenance of a block processed by a cursor
+type IndexedBlock struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Cursor     string             `bson:"cursor" json:"cursor"`
+	Number     uint64             `bson:"number" json:"number"`
+	Hash       string             `bson:"hash" json:"hash"`
+	ParentHash string             `bson:"parent_hash" json:"parent_hash"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// SaveBlock inserts or replaces the block a cursor saw at a given height
+func (c *Client) SaveBlock(ctx context.Context, block *IndexedBlock) error {
+	collection := c.GetCollection(BlocksCollection)
+
+	block.CreatedAt = time.Now()
+
+	filter := bson.D{{Key: "cursor", Value: block.Cursor}, {Key: "number", Value: block.Number}}
+	opts := options.Replace().SetUpsert(true)
+
+	if _, err := collection.ReplaceOne(ctx, filter, block, opts); err != nil {
+		return fmt.Errorf("failed to save block: %w", err)
+	}
+
+	return nil
+}
+
+// GetBlocksDescending retrieves up to limit blocks recorded by a cursor, newest first
+func (c *Client) GetBlocksDescending(ctx context.Context, cursorName string, limit int64) ([]IndexedBlock, error) {
+	collection := c.GetCollection(BlocksCollection)
+
+	filter := bson.D{{Key: "cursor", Value: cursorName}}
+	opts := options.Find().SetSort(bson.D{{Key: "number", Value: -1}}).SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find blocks: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var blocks []IndexedBlock
+	if err := cursor.All(ctx, &blocks); err != nil {
+		return nil, fmt.Errorf("failed to decode blocks: %w", err)
+	}
+
+	return blocks, nil
+}
+
+// DeleteBlocksAfter removes every block a cursor recorded above the given height
+func (c *Client) DeleteBlocksAfter(ctx context.Context, cursorName string, number uint64) error {
+	collection := c.GetCollection(BlocksCollection)
+
+	filter := bson.D{{Key: "cursor", Value: cursorName}, {Key: "number", Value: bson.D{{Key: "$gt", Value: number}}}}
+	if _, err := collection.DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("failed to delete blocks: %w", err)
+	}
+
+	return nil
+}
+
+// PruneBlocksBefore removes blocks a cursor recorded below the given height
+func (c *Client) PruneBlocksBefore(ctx context.Context, cursorName string, number uint64) error {
+	collection := c.GetCollection(BlocksCollection)
+
+	filter := bson.D{{Key: "cursor", Value: cursorName}, {Key: "number", Value: bson.D{{Key: "$lt", Value: number}}}}
+	if _, err := collection.DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("failed to prune blocks: %w", err)
+	}
+
+	return nil
+}
+
+// RewindDerived deletes documents derived from blocks above the fork point
+func (c *Client) RewindDerived(ctx context.Context, collections []string, forkPoint uint64) (int64, error) {
+	var deleted int64
+
+	filter := bson.D{{Key: "block_number", Value: bson.D{{Key: "$gt", Value: forkPoint}}}}
+	for _, name := range collections {
+		result, err := c.GetCollection(name).DeleteMany(ctx, filter)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to rewind %s: %w", name, err)
+		}
+		deleted += result.DeletedCount
+	}
+
+	return deleted, nil
+}
+
+// ConfirmDerived marks documents derived from blocks at or below the given height as final
+func (c *Client) ConfirmDerived(ctx context.Context, collections []string, number uint64) error {
+	filter := bson.D{
+		{Key: "block_number", Value: bson.D{{Key: "$lte", Value: number}}},
+		{Key: "confirmed", Value: bson.D{{Key: "$ne", Value: true}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "confirmed", Value: true}}}}
+
+	for _, name := range collections {
+		if _, err := c.GetCollection(name).UpdateMany(ctx, filter, update); err != nil {
+			return fmt.Errorf("failed to confirm %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
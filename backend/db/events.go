@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collections holding Marketplace settlement events, keyed by event name
+const (
+	SettlePaymentsCollection   = "settle_payments"
+	SettleSecuritiesCollection = "settle_securities"
+	SettleFeesCollection       = "settle_fees"
+	CheckpointsCollection      = "indexer_checkpoints"
+)
+
+// PropertyTransfersCollection stores the property contract's Transfer events
+const PropertyTransfersCollection = "property_transfers"
+
+// SettlementCollections maps a Marketplace event name to the collection it is stored in
+var SettlementCollections = map[string]string{
+	"SettlePayment":  SettlePaymentsCollection,
+	"SettleSecurity": SettleSecuritiesCollection,
+	"SettleFee":      SettleFeesCollection,
+}
+
+// SettlementEvent represents a Marketplace settlement log stored in MongoDB
+type SettlementEvent struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Event           string             `bson:"event" json:"event"`
+	PropertyID      string             `bson:"property_id" json:"property_id"`
+	Date            string             `bson:"date" json:"date"`
+	Account         string             `bson:"account" json:"account"` // receiver for payments/securities, payer for fees
+	Amount          string             `bson:"amount" json:"amount"`
+	Expected        string             `bson:"expected,omitempty" json:"expected,omitempty"`
+	ContractAddress string             `bson:"contract_address" json:"contract_address"`
+	TxHash          string             `bson:"tx_hash" json:"tx_hash"`
+	LogIndex        uint               `bson:"log_index" json:"log_index"`
+	BlockNumber     uint64             `bson:"block_number" json:"block_number"`
+	BlockHash       string             `bson:"block_hash" json:"block_hash"`
+	BlockTime       time.Time          `bson:"block_time" json:"block_time"`
+	Confirmed       bool               `bson:"confirmed" json:"confirmed"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// PropertyTransfer represents a property token Transfer log stored in MongoDB. Mints are
+// transfers from the zero address.
+type PropertyTransfer struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	PropertyID      string             `bson:"property_id" json:"property_id"`
+	From            string             `bson:"from" json:"from"`
+	To              string             `bson:"to" json:"to"`
+	ContractAddress string             `bson:"contract_address" json:"contract_address"`
+	TxHash          string             `bson:"tx_hash" json:"tx_hash"`
+	LogIndex        uint               `bson:"log_index" json:"log_index"`
+	BlockNumber     uint64             `bson:"block_number" json:"block_number"`
+	BlockHash       string             `bson:"block_hash" json:"block_hash"`
+	BlockTime       time.Time          `bson:"block_time" json:"block_time"`
+	Confirmed       bool               `bson:"confirmed" json:"confirmed"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// IndexerCheckpoint records the last block an indexer has fully processed
+type IndexerCheckpoint struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name        string             `bson:"name" json:"name"`
+	Chain       string             `bson:"chain" json:"chain"`
+	BlockNumber uint64             `bson:"block_number" json:"block_number"`
+	BlockHash   string             `bson:"block_hash" json:"block_hash"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// UpsertSettlementEvent stores a settlement event, ignoring logs that were already indexed
+func (c *Client) UpsertSettlementEvent(ctx context.Context, event *SettlementEvent) error {
+	name, ok := SettlementCollections[event.Event]
+	if !ok {
+		return fmt.Errorf("unknown settlement event '%s'", event.Event)
+	}
+	collection := c.GetCollection(name)
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	filter := bson.D{{Key: "tx_hash", Value: event.TxHash}, {Key: "log_index", Value: event.LogIndex}}
+	update := bson.D{{Key: "$setOnInsert", Value: event}}
+	opts := options.Update().SetUpsert(true)
+
+	if _, err := collection.UpdateOne(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf("failed to upsert %s event: %w", event.Event, err)
+	}
+
+	return nil
+}
+
+// SettlementCollectionNames returns the names of all settlement event collections
+func SettlementCollectionNames() []string {
+	return []string{SettlePaymentsCollection, SettleSecuritiesCollection, SettleFeesCollection}
+}
+
+// GetSettlementEvents retrieves settlement events of one type for a property, optionally filtered by date.
+// Only events past the confirmation depth are returned when confirmed is true, only pending ones otherwise.
+func (c *Client) GetSettlementEvents(ctx context.Context, eventName, propertyID, date string, confirmed bool) ([]SettlementEvent, error) {
+	name, ok := SettlementCollections[eventName]
+	if !ok {
+		return nil, fmt.Errorf("unknown settlement event '%s'", eventName)
+	}
+	collection := c.GetCollection(name)
+
+	filter := bson.D{{Key: "property_id", Value: propertyID}, {Key: "confirmed", Value: confirmed}}
+	if date != "" {
+		filter = append(filter, bson.E{Key: "date", Value: date})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "block_number", Value: 1}, {Key: "log_index", Value: 1}})
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s events: %w", eventName, err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []SettlementEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode %s events: %w", eventName, err)
+	}
+
+	return events, nil
+}
+
+// UpsertPropertyTransfer stores a property transfer, ignoring logs that were already indexed
+func (c *Client) UpsertPropertyTransfer(ctx context.Context, transfer *PropertyTransfer) error {
+	collection := c.GetCollection(PropertyTransfersCollection)
+
+	if transfer.CreatedAt.IsZero() {
+		transfer.CreatedAt = time.Now()
+	}
+
+	filter := bson.D{{Key: "tx_hash", Value: transfer.TxHash}, {Key: "log_index", Value: transfer.LogIndex}}
+	update := bson.D{{Key: "$setOnInsert", Value: transfer}}
+	opts := options.Update().SetUpsert(true)
+
+	if _, err := collection.UpdateOne(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf("failed to upsert property transfer: %w", err)
+	}
+
+	return nil
+}
+
+// GetCheckpoint retrieves an indexer checkpoint by name
+func (c *Client) GetCheckpoint(ctx context.Context, name string) (*IndexerCheckpoint, error) {
+	collection := c.GetCollection(CheckpointsCollection)
+
+	var checkpoint IndexerCheckpoint
+	filter := bson.D{{Key: "name", Value: name}}
+
+	if err := collection.FindOne(ctx, filter).Decode(&checkpoint); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get checkpoint: %w", err)
+	}
+
+	return &checkpoint, nil
+}
+
+// SaveCheckpoint inserts or updates an indexer checkpoint
+func (c *Client) SaveCheckpoint(ctx context.Context, name, chain string, blockNumber uint64, blockHash string) error {
+	collection := c.GetCollection(CheckpointsCollection)
+
+	filter := bson.D{{Key: "name", Value: name}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "name", Value: name},
+			{Key: "chain", Value: chain},
+			{Key: "block_number", Value: blockNumber},
+			{Key: "block_hash", Value: blockHash},
+			{Key: "updated_at", Value: time.Now()},
+		}},
+	}
+	opts := options.Update().SetUpsert(true)
+
+	if _, err := collection.UpdateOne(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	return nil
+}
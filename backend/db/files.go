@@ -0,0 +1,254 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FilesCollection catalogs every object uploaded through the backend
+const FilesCollection = "files"
+
+// Upload paths a cataloged file can come from
+const (
+	FileSourceStorageUpload = "storage_upload"
+	FileSourceIPFSUpload    = "ipfs_upload"
+	FileSourceImage         = "image"
+	FileSourceMetadata      = "metadata"
+	FileSourcePin           = "pin"
+)
+
+// StoredFile represents an uploaded object in the file catalog. Hash is the content address in
+// its backend: a 0G root hash, an IPFS CID or a local store key. ContentHash is the hex SHA-256
+// of the content, recorded where uploads are deduplicated.
+type StoredFile struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Hash           string             `bson:"hash" json:"hash"`
+	Backend        string             `bson:"backend" json:"backend"`
+	Name           string             `bson:"name" json:"name"`
+	Size           int64              `bson:"size" json:"size"`
+	ContentType    string             `bson:"content_type" json:"content_type"`
+	URL            string             `bson:"url,omitempty" json:"url,omitempty"`
+	Source         string             `bson:"source" json:"source"`
+	UploaderWallet string             `bson:"uploader_wallet,omitempty" json:"uploader_wallet,omitempty"`
+	PropertyID     string             `bson:"property_id,omitempty" json:"property_id,omitempty"`
+	TxHash         string             `bson:"tx_hash,omitempty" json:"tx_hash,omitempty"`
+	ContentHash    string             `bson:"content_hash,omitempty" json:"content_hash,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// BackendFileStats summarizes the files stored on one backend
+type BackendFileStats struct {
+	Backend   string `bson:"_id" json:"backend"`
+	FileCount int64  `bson:"file_count" json:"file_count"`
+	TotalSize int64  `bson:"total_size" json:"total_size"`
+}
+
+// FileStats summarizes a set of cataloged files
+type FileStats struct {
+	FileCount int64              `json:"file_count"`
+	TotalSize int64              `json:"total_size"`
+	Backends  []BackendFileStats `json:"backends"`
+}
+
+// SaveFile records an upload in the catalog. Uploading the same content to the same backend
+// again updates the existing entry for that uploader instead of adding a duplicate.
+func (c *Client) SaveFile(ctx context.Context, file *StoredFile) error {
+	collection := c.GetCollection(FilesCollection)
+
+	now := time.Now()
+	file.UpdatedAt = now
+
+	filter := bson.D{
+		{Key: "backend", Value: file.Backend},
+		{Key: "hash", Value: file.Hash},
+		{Key: "uploader_wallet", Value: file.UploaderWallet},
+	}
+	set := bson.D{
+		{Key: "name", Value: file.Name},
+		{Key: "size", Value: file.Size},
+		{Key: "content_type", Value: file.ContentType},
+		{Key: "url", Value: file.URL},
+		{Key: "source", Value: file.Source},
+		{Key: "updated_at", Value: now},
+	}
+	if file.PropertyID != "" {
+		set = append(set, bson.E{Key: "property_id", Value: file.PropertyID})
+	}
+	if file.TxHash != "" {
+		set = append(set, bson.E{Key: "tx_hash", Value: file.TxHash})
+	}
+	if file.ContentHash != "" {
+		set = append(set, bson.E{Key: "content_hash", Value: file.ContentHash})
+	}
+	update := bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "created_at", Value: now}}},
+	}
+
+	if _, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+
+	return nil
+}
+
+// GetFileByHash returns the most recent catalog entry for a hash, or nil if it was never uploaded here
+func (c *Client) GetFileByHash(ctx context.Context, hash string) (*StoredFile, error) {
+	collection := c.GetCollection(FilesCollection)
+
+	var file StoredFile
+	filter := bson.D{{Key: "hash", Value: hash}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	if err := collection.FindOne(ctx, filter, opts).Decode(&file); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	return &file, nil
+}
+
+// GetFileByContentHash returns the most recent catalog entry for content with the given SHA-256
+// on a backend, or nil if it was never stored there
+func (c *Client) GetFileByContentHash(ctx context.Context, backend, contentHash string) (*StoredFile, error) {
+	collection := c.GetCollection(FilesCollection)
+
+	var file StoredFile
+	filter := bson.D{{Key: "content_hash", Value: contentHash}, {Key: "backend", Value: backend}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	if err := collection.FindOne(ctx, filter, opts).Decode(&file); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	return &file, nil
+}
+
+// GetFileUploaders returns the distinct wallets that uploaded or pinned a hash
+func (c *Client) GetFileUploaders(ctx context.Context, hash string) ([]string, error) {
+	collection := c.GetCollection(FilesCollection)
+
+	filter := bson.D{{Key: "hash", Value: hash}}
+	values, err := collection.Distinct(ctx, "uploader_wallet", filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file uploaders: %w", err)
+	}
+
+	wallets := make([]string, 0, len(values))
+	for _, value := range values {
+		if wallet, ok := value.(string); ok && wallet != "" {
+			wallets = append(wallets, wallet)
+		}
+	}
+
+	return wallets, nil
+}
+
+// ListFilesByUploader returns one page of a wallet's uploads, newest first, and the total number of matches.
+// An empty backend matches every backend.
+func (c *Client) ListFilesByUploader(ctx context.Context, wallet, backend string, page, limit int64) ([]StoredFile, int64, error) {
+	collection := c.GetCollection(FilesCollection)
+
+	filter := bson.D{{Key: "uploader_wallet", Value: wallet}}
+	if backend != "" {
+		filter = append(filter, bson.E{Key: "backend", Value: backend})
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count files: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find files: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	files := []StoredFile{}
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode files: %w", err)
+	}
+
+	return files, total, nil
+}
+
+// GetFileStatsByUploader totals a wallet's uploads overall and per backend
+func (c *Client) GetFileStatsByUploader(ctx context.Context, wallet string) (*FileStats, error) {
+	collection := c.GetCollection(FilesCollection)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "uploader_wallet", Value: wallet}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$backend"},
+			{Key: "file_count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "total_size", Value: bson.D{{Key: "$sum", Value: "$size"}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate file stats: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	stats := &FileStats{Backends: []BackendFileStats{}}
+	if err := cursor.All(ctx, &stats.Backends); err != nil {
+		return nil, fmt.Errorf("failed to decode file stats: %w", err)
+	}
+
+	for _, backend := range stats.Backends {
+		stats.FileCount += backend.FileCount
+		stats.TotalSize += backend.TotalSize
+	}
+
+	return stats, nil
+}
+
+// LinkFileToProperty attaches the file stored at url to a property, for uploads made before the property ID existed
+func (c *Client) LinkFileToProperty(ctx context.Context, url, propertyID string) error {
+	collection := c.GetCollection(FilesCollection)
+
+	filter := bson.D{{Key: "url", Value: url}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "property_id", Value: propertyID},
+			{Key: "updated_at", Value: time.Now()},
+		}},
+	}
+
+	if _, err := collection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to link file to property: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFilesByURL removes every catalog entry for the object stored at url
+func (c *Client) DeleteFilesByURL(ctx context.Context, url string) error {
+	collection := c.GetCollection(FilesCollection)
+
+	if _, err := collection.DeleteMany(ctx, bson.D{{Key: "url", Value: url}}); err != nil {
+		return fmt.Errorf("failed to delete files: %w", err)
+	}
+
+	return nil
+}
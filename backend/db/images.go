@@ -0,0 +1,243 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ImagesCollection indexes stored images by content hash so identical uploads share one blob
+const ImagesCollection = "images"
+
+// imageTombstoneLease is how long a garbage collector may hold an image it is deleting, after
+// which another pass takes the deletion over
+const imageTombstoneLease = 10 * time.Minute
+
+// ErrImageDeleting is returned when an image is being deleted by the garbage collector. Its blob
+// can't be reused, and storing the content again has to wait until the deletion is finished.
+var ErrImageDeleting = errors.New("image is being deleted")
+
+// Image represents a content-addressed image in the image store. PropertyRefs counts how many
+// times each property references the image, and RefCount is their total. DeletingAt is set
+// while the garbage collector deletes the image's blob.
+type Image struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Hash         string             `bson:"hash" json:"hash"`
+	Backend      string             `bson:"backend" json:"backend"`
+	Key          string             `bson:"key" json:"key"`
+	URL          string             `bson:"url" json:"url"`
+	Size         int64              `bson:"size" json:"size"`
+	ContentType  string             `bson:"content_type" json:"content_type"`
+	PropertyRefs map[string]int64   `bson:"property_refs,omitempty" json:"property_refs,omitempty"`
+	RefCount     int64              `bson:"ref_count" json:"ref_count"`
+	DeletingAt   *time.Time         `bson:"deleting_at,omitempty" json:"deleting_at,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// TouchImage returns the image stored under a hash on a backend, or nil if there is none.
+// A found image's updated_at is bumped so the garbage collector leaves it alone while it's reused.
+// ErrImageDeleting is returned for an image the garbage collector has already claimed.
+func (c *Client) TouchImage(ctx context.Context, hash, backend string) (*Image, error) {
+	collection := c.GetCollection(ImagesCollection)
+
+	filter := bson.D{
+		{Key: "hash", Value: hash},
+		{Key: "backend", Value: backend},
+		{Key: "deleting_at", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var image Image
+	if err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&image); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("failed to get image: %w", err)
+		}
+
+		// No live image, but a tombstone means the blob is about to go
+		tombstone := bson.D{{Key: "hash", Value: hash}, {Key: "backend", Value: backend}}
+		count, err := collection.CountDocuments(ctx, tombstone, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get image: %w", err)
+		}
+		if count > 0 {
+			return nil, ErrImageDeleting
+		}
+		return nil, nil
+	}
+
+	return &image, nil
+}
+
+// SaveImage records a newly stored image. An image stored concurrently under the same hash is kept.
+// ErrImageDeleting is returned when the garbage collector holds the hash, the blob just stored
+// may be deleted with it and has to be stored again once the deletion is finished.
+func (c *Client) SaveImage(ctx context.Context, image *Image) error {
+	collection := c.GetCollection(ImagesCollection)
+
+	now := time.Now()
+	image.CreatedAt = now
+	image.UpdatedAt = now
+
+	// A tombstone doesn't match, so the upsert collides with it on the unique index instead
+	filter := bson.D{
+		{Key: "hash", Value: image.Hash},
+		{Key: "backend", Value: image.Backend},
+		{Key: "deleting_at", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: now}}},
+		{Key: "$setOnInsert", Value: bson.D{
+			{Key: "key", Value: image.Key},
+			{Key: "url", Value: image.URL},
+			{Key: "size", Value: image.Size},
+			{Key: "content_type", Value: image.ContentType},
+			{Key: "ref_count", Value: 0},
+			{Key: "created_at", Value: now},
+		}},
+	}
+
+	if _, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrImageDeleting
+		}
+		return fmt.Errorf("failed to save image: %w", err)
+	}
+
+	return nil
+}
+
+// AddImageRef counts a property's reference to the image stored at url. URLs that aren't
+// in the image index are ignored.
+func (c *Client) AddImageRef(ctx context.Context, url, propertyID string) error {
+	collection := c.GetCollection(ImagesCollection)
+
+	filter := bson.D{{Key: "url", Value: url}}
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{
+			{Key: "property_refs." + propertyID, Value: 1},
+			{Key: "ref_count", Value: 1},
+		}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now()}}},
+	}
+
+	if _, err := collection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to add image reference: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseImageRefs drops every reference a property holds to images, for when the property is
+// deleted or its images are replaced. Released images start their garbage collection grace period anew.
+func (c *Client) ReleaseImageRefs(ctx context.Context, propertyID string) error {
+	collection := c.GetCollection(ImagesCollection)
+
+	field := "property_refs." + propertyID
+	filter := bson.D{{Key: field, Value: bson.D{{Key: "$gt", Value: 0}}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "ref_count", Value: bson.D{{Key: "$subtract", Value: bson.A{"$ref_count", "$" + field}}}},
+			{Key: "updated_at", Value: time.Now()},
+		}}},
+		{{Key: "$unset", Value: field}},
+	}
+
+	if _, err := collection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to release image references: %w", err)
+	}
+
+	return nil
+}
+
+// collectableImages matches images the garbage collector may claim: unreferenced images that
+// haven't been stored or reused since before, and deletions abandoned by an earlier pass
+func collectableImages(before time.Time) bson.D {
+	return bson.D{{Key: "$or", Value: bson.A{
+		bson.D{
+			{Key: "ref_count", Value: bson.D{{Key: "$lte", Value: 0}}},
+			{Key: "updated_at", Value: bson.D{{Key: "$lt", Value: before}}},
+			{Key: "deleting_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		},
+		bson.D{{Key: "deleting_at", Value: bson.D{{Key: "$lt", Value: time.Now().Add(-imageTombstoneLease)}}}},
+	}}}
+}
+
+// ListUnreferencedImages returns up to limit images that no property references and that
+// haven't been stored or reused since before, along with deletions an earlier pass abandoned
+func (c *Client) ListUnreferencedImages(ctx context.Context, before time.Time, limit int64) ([]Image, error) {
+	collection := c.GetCollection(ImagesCollection)
+
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}}).SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, collectableImages(before), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find unreferenced images: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	images := []Image{}
+	if err := cursor.All(ctx, &images); err != nil {
+		return nil, fmt.Errorf("failed to decode images: %w", err)
+	}
+
+	return images, nil
+}
+
+// ClaimUnreferencedImage tombstones an image for deletion if it is still unreferenced and hasn't
+// been reused since before. Until DeleteImage or ReleaseImageClaim, the image can't be reused
+// and its content can't be indexed again. It reports whether the image was claimed.
+func (c *Client) ClaimUnreferencedImage(ctx context.Context, hash, backend string, before time.Time) (bool, error) {
+	collection := c.GetCollection(ImagesCollection)
+
+	filter := append(bson.D{
+		{Key: "hash", Value: hash},
+		{Key: "backend", Value: backend},
+	}, collectableImages(before)...)
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "deleting_at", Value: time.Now()}}}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim image: %w", err)
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// ReleaseImageClaim clears a tombstone whose blob couldn't be deleted, so a later pass retries it
+func (c *Client) ReleaseImageClaim(ctx context.Context, hash, backend string) error {
+	collection := c.GetCollection(ImagesCollection)
+
+	filter := bson.D{{Key: "hash", Value: hash}, {Key: "backend", Value: backend}}
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "deleting_at", Value: ""}}}}
+
+	if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to release image claim: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteImage removes a claimed image from the index once its blob is deleted
+func (c *Client) DeleteImage(ctx context.Context, hash, backend string) error {
+	collection := c.GetCollection(ImagesCollection)
+
+	filter := bson.D{
+		{Key: "hash", Value: hash},
+		{Key: "backend", Value: backend},
+		{Key: "deleting_at", Value: bson.D{{Key: "$exists", Value: true}}},
+	}
+
+	if _, err := collection.DeleteOne(ctx, filter); err != nil {
+		return fmt.Errorf("failed to delete image: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,926 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore is an in-memory implementation of the repositories for tests and running without
+// MongoDB. It's safe for concurrent use and hands out copies, so callers can't modify stored documents.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	properties   map[string]Property
+	listings     map[string]Listing
+	chains       map[string]Chain
+	contracts    map[string]Contract
+	files        []StoredFile
+	images       map[string]Image
+	settlements  map[string][]SettlementEvent
+	transactions map[string]Transaction
+	nonces       map[string]AuthNonce
+	sessions     map[string]Session
+}
+
+var (
+	_ PropertyRepository    = (*MemoryStore)(nil)
+	_ ListingRepository     = (*MemoryStore)(nil)
+	_ ChainRepository       = (*MemoryStore)(nil)
+	_ FileRepository        = (*MemoryStore)(nil)
+	_ ImageRepository       = (*MemoryStore)(nil)
+	_ SettlementRepository  = (*MemoryStore)(nil)
+	_ TransactionRepository = (*MemoryStore)(nil)
+	_ SessionRepository     = (*MemoryStore)(nil)
+)
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		properties:   make(map[string]Property),
+		listings:     make(map[string]Listing),
+		chains:       make(map[string]Chain),
+		contracts:    make(map[string]Contract),
+		images:       make(map[string]Image),
+		settlements:  make(map[string][]SettlementEvent),
+		transactions: make(map[string]Transaction),
+		nonces:       make(map[string]AuthNonce),
+		sessions:     make(map[string]Session),
+	}
+}
+
+// PutChain adds or replaces a chain, the in-memory counterpart of seeding the chains collection
+func (s *MemoryStore) PutChain(chain *Chain) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	stored := *chain
+	if stored.ID.IsZero() {
+		stored.ID = primitive.NewObjectID()
+	}
+	if stored.CreatedAt.IsZero() {
+		stored.CreatedAt = now
+	}
+	stored.UpdatedAt = now
+	s.chains[stored.Chain] = stored
+}
+
+// InsertProperty stores a new property, failing if its property ID is taken
+func (s *MemoryStore) InsertProperty(ctx context.Context, property *Property) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.properties[property.PropertyID]; exists {
+		return fmt.Errorf("failed to insert property: property with ID '%s' already exists", property.PropertyID)
+	}
+
+	property.ID = primitive.NewObjectID()
+	property.CreatedAt = time.Now()
+	property.UpdatedAt = property.CreatedAt
+	s.properties[property.PropertyID] = copyProperty(*property)
+
+	return nil
+}
+
+// GetPropertyByID retrieves a property by property_id
+func (s *MemoryStore) GetPropertyByID(ctx context.Context, propertyID string) (*Property, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	property, ok := s.properties[propertyID]
+	if !ok {
+		return nil, fmt.Errorf("property with ID '%s' %w", propertyID, ErrNotFound)
+	}
+
+	property = copyProperty(property)
+	return &property, nil
+}
+
+// GetPropertiesByWallet retrieves all properties for a wallet address
+func (s *MemoryStore) GetPropertiesByWallet(ctx context.Context, walletAddress string) ([]Property, error) {
+	return s.findProperties(func(property *Property) bool {
+		return property.WalletAddress == walletAddress
+	}), nil
+}
+
+// GetProperties retrieves every property
+func (s *MemoryStore) GetProperties(ctx context.Context) ([]Property, error) {
+	return s.findProperties(func(*Property) bool { return true }), nil
+}
+
+// UpdateProperty updates an existing property
+func (s *MemoryStore) UpdateProperty(ctx context.Context, propertyID string, updates *PropertyUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	property, ok := s.properties[propertyID]
+	if !ok {
+		return fmt.Errorf("property with ID '%s' %w", propertyID, ErrNotFound)
+	}
+
+	property = copyProperty(property)
+	updates.apply(&property)
+	property.UpdatedAt = time.Now()
+	s.properties[propertyID] = property
+
+	// The replaced images lose this property's references and the new ones gain them
+	if updates.ImageVariants != nil {
+		s.releaseImageRefs(propertyID)
+		for _, url := range updates.ImageVariants.URLs() {
+			s.addImageRef(url, propertyID)
+		}
+	}
+
+	return nil
+}
+
+// DeleteProperty removes a property and releases its image references
+func (s *MemoryStore) DeleteProperty(ctx context.Context, propertyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.properties[propertyID]; !ok {
+		return fmt.Errorf("property with ID '%s' %w", propertyID, ErrNotFound)
+	}
+	delete(s.properties, propertyID)
+	s.releaseImageRefs(propertyID)
+
+	return nil
+}
+
+// InsertListing stores a new listing, failing if the property already has one for the date
+func (s *MemoryStore) InsertListing(ctx context.Context, listing *Listing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day, err := ListingDay(listing.Date)
+	if err != nil {
+		return fmt.Errorf("failed to insert listing: %w", err)
+	}
+
+	key := listingKey(listing.PropertyID, listing.Date)
+	if _, exists := s.listings[key]; exists {
+		return fmt.Errorf("failed to insert listing: listing for property '%s' and date '%s' already exists", listing.PropertyID, listing.Date)
+	}
+
+	listing.Day = day
+	listing.ID = primitive.NewObjectID()
+	listing.CreatedAt = time.Now()
+	listing.UpdatedAt = listing.CreatedAt
+	s.listings[key] = *listing
+
+	return nil
+}
+
+// GetListingByPropertyAndDate retrieves a listing by property_id and date
+func (s *MemoryStore) GetListingByPropertyAndDate(ctx context.Context, propertyID, date string) (*Listing, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	listing, ok := s.listings[listingKey(propertyID, date)]
+	if !ok {
+		return nil, fmt.Errorf("listing for property '%s' and date '%s' %w", propertyID, date, ErrNotFound)
+	}
+
+	return &listing, nil
+}
+
+// GetListingsByProperty retrieves all listings for a property
+func (s *MemoryStore) GetListingsByProperty(ctx context.Context, propertyID string) ([]Listing, error) {
+	return s.findListings(func(listing *Listing) bool {
+		return listing.PropertyID == propertyID
+	}), nil
+}
+
+// GetListingsByPropertyInRange retrieves a property's listings with from <= day <= to, ordered by day
+func (s *MemoryStore) GetListingsByPropertyInRange(ctx context.Context, propertyID string, from, to int64) ([]Listing, error) {
+	return s.findListings(func(listing *Listing) bool {
+		return listing.PropertyID == propertyID && listing.Day >= from && listing.Day <= to
+	}), nil
+}
+
+// UpdateListing updates an existing listing
+func (s *MemoryStore) UpdateListing(ctx context.Context, propertyID, date string, updates *ListingUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := listingKey(propertyID, date)
+	listing, ok := s.listings[key]
+	if !ok {
+		return fmt.Errorf("listing for property '%s' and date '%s' %w", propertyID, date, ErrNotFound)
+	}
+
+	updates.apply(&listing)
+	listing.UpdatedAt = time.Now()
+	s.listings[key] = listing
+
+	return nil
+}
+
+// GetChain retrieves a chain by name
+func (s *MemoryStore) GetChain(ctx context.Context, chainName string) (*Chain, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	chain, ok := s.chains[chainName]
+	if !ok {
+		return nil, fmt.Errorf("chain '%s' %w", chainName, ErrNotFound)
+	}
+
+	return &chain, nil
+}
+
+// UpdateChainTxType records which transaction type is used to submit transactions on a chain
+func (s *MemoryStore) UpdateChainTxType(ctx context.Context, chainName, txType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chain, ok := s.chains[chainName]
+	if !ok {
+		return fmt.Errorf("chain '%s' %w", chainName, ErrNotFound)
+	}
+
+	chain.TxType = txType
+	chain.UpdatedAt = time.Now()
+	s.chains[chainName] = chain
+
+	return nil
+}
+
+// GetContract retrieves a contract by type
+func (s *MemoryStore) GetContract(ctx context.Context, contractType string) (*Contract, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contract, ok := s.contracts[contractType]
+	if !ok {
+		return nil, fmt.Errorf("contract type '%s' %w", contractType, ErrNotFound)
+	}
+
+	return &contract, nil
+}
+
+// UpdateContractAddress updates an existing contract's address
+func (s *MemoryStore) UpdateContractAddress(ctx context.Context, contractType, contractAddress string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contract, ok := s.contracts[contractType]
+	if !ok {
+		return fmt.Errorf("contract type '%s' %w", contractType, ErrNotFound)
+	}
+
+	contract.ContractAddress = contractAddress
+	contract.UpdatedAt = time.Now()
+	s.contracts[contractType] = contract
+
+	return nil
+}
+
+// InsertOrUpdateContract inserts a new contract or updates existing one
+func (s *MemoryStore) InsertOrUpdateContract(ctx context.Context, contractType, contractAddress string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	contract, ok := s.contracts[contractType]
+	if !ok {
+		contract = Contract{ID: primitive.NewObjectID(), Type: contractType, CreatedAt: now}
+	}
+	contract.ContractAddress = contractAddress
+	contract.UpdatedAt = now
+	s.contracts[contractType] = contract
+
+	return nil
+}
+
+// SaveFile records an upload, updating the entry for the same backend, hash and uploader if there is one
+func (s *MemoryStore) SaveFile(ctx context.Context, file *StoredFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	file.UpdatedAt = now
+
+	for i := range s.files {
+		stored := &s.files[i]
+		if stored.Backend != file.Backend || stored.Hash != file.Hash || stored.UploaderWallet != file.UploaderWallet {
+			continue
+		}
+		stored.Name, stored.Size, stored.ContentType = file.Name, file.Size, file.ContentType
+		stored.URL, stored.Source, stored.UpdatedAt = file.URL, file.Source, now
+		if file.PropertyID != "" {
+			stored.PropertyID = file.PropertyID
+		}
+		if file.TxHash != "" {
+			stored.TxHash = file.TxHash
+		}
+		if file.ContentHash != "" {
+			stored.ContentHash = file.ContentHash
+		}
+		return nil
+	}
+
+	stored := *file
+	stored.ID = primitive.NewObjectID()
+	stored.CreatedAt = now
+	s.files = append(s.files, stored)
+
+	return nil
+}
+
+// GetFileByHash returns the most recent catalog entry for a hash, or nil if it was never uploaded here
+func (s *MemoryStore) GetFileByHash(ctx context.Context, hash string) (*StoredFile, error) {
+	return s.newestFile(func(file *StoredFile) bool {
+		return file.Hash == hash
+	}), nil
+}
+
+// GetFileByContentHash returns the most recent catalog entry for content with the given SHA-256
+// on a backend, or nil if it was never stored there
+func (s *MemoryStore) GetFileByContentHash(ctx context.Context, backend, contentHash string) (*StoredFile, error) {
+	return s.newestFile(func(file *StoredFile) bool {
+		return file.Backend == backend && file.ContentHash == contentHash
+	}), nil
+}
+
+// GetFileUploaders returns the distinct wallets that uploaded or pinned a hash
+func (s *MemoryStore) GetFileUploaders(ctx context.Context, hash string) ([]string, error) {
+	wallets := []string{}
+	seen := make(map[string]bool)
+	for _, file := range s.findFiles(func(file *StoredFile) bool { return file.Hash == hash }) {
+		if file.UploaderWallet != "" && !seen[file.UploaderWallet] {
+			seen[file.UploaderWallet] = true
+			wallets = append(wallets, file.UploaderWallet)
+		}
+	}
+	return wallets, nil
+}
+
+// ListFilesByUploader returns one page of a wallet's uploads, newest first, and the total number of matches.
+// An empty backend matches every backend.
+func (s *MemoryStore) ListFilesByUploader(ctx context.Context, wallet, backend string, page, limit int64) ([]StoredFile, int64, error) {
+	files := s.findFiles(func(file *StoredFile) bool {
+		return file.UploaderWallet == wallet && (backend == "" || file.Backend == backend)
+	})
+	total := int64(len(files))
+
+	start := (page - 1) * limit
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	return append([]StoredFile{}, files[start:end]...), total, nil
+}
+
+// GetFileStatsByUploader totals a wallet's uploads overall and per backend
+func (s *MemoryStore) GetFileStatsByUploader(ctx context.Context, wallet string) (*FileStats, error) {
+	stats := &FileStats{Backends: []BackendFileStats{}}
+	byBackend := make(map[string]int)
+	for _, file := range s.findFiles(func(file *StoredFile) bool { return file.UploaderWallet == wallet }) {
+		i, ok := byBackend[file.Backend]
+		if !ok {
+			i = len(stats.Backends)
+			byBackend[file.Backend] = i
+			stats.Backends = append(stats.Backends, BackendFileStats{Backend: file.Backend})
+		}
+		stats.Backends[i].FileCount++
+		stats.Backends[i].TotalSize += file.Size
+		stats.FileCount++
+		stats.TotalSize += file.Size
+	}
+	sort.Slice(stats.Backends, func(i, j int) bool {
+		return stats.Backends[i].Backend < stats.Backends[j].Backend
+	})
+
+	return stats, nil
+}
+
+// LinkFileToProperty attaches the file stored at url to a property
+func (s *MemoryStore) LinkFileToProperty(ctx context.Context, url, propertyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.files {
+		if s.files[i].URL == url {
+			s.files[i].PropertyID = propertyID
+			s.files[i].UpdatedAt = time.Now()
+		}
+	}
+
+	return nil
+}
+
+// DeleteFilesByURL removes every catalog entry for the object stored at url
+func (s *MemoryStore) DeleteFilesByURL(ctx context.Context, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.files[:0]
+	for _, file := range s.files {
+		if file.URL != url {
+			kept = append(kept, file)
+		}
+	}
+	s.files = kept
+
+	return nil
+}
+
+// TouchImage returns the image stored under a hash on a backend, or nil if there is none, and bumps
+// its updated_at. ErrImageDeleting is returned for an image the garbage collector has claimed.
+func (s *MemoryStore) TouchImage(ctx context.Context, hash, backend string) (*Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := imageKey(hash, backend)
+	image, ok := s.images[key]
+	if !ok {
+		return nil, nil
+	}
+	if image.DeletingAt != nil {
+		return nil, ErrImageDeleting
+	}
+
+	image.UpdatedAt = time.Now()
+	s.images[key] = image
+
+	image = copyImage(image)
+	return &image, nil
+}
+
+// SaveImage records a newly stored image, keeping one already stored under the same hash.
+// ErrImageDeleting is returned when the garbage collector holds the hash.
+func (s *MemoryStore) SaveImage(ctx context.Context, image *Image) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	image.CreatedAt = now
+	image.UpdatedAt = now
+
+	key := imageKey(image.Hash, image.Backend)
+	if stored, ok := s.images[key]; ok {
+		if stored.DeletingAt != nil {
+			return ErrImageDeleting
+		}
+		stored.UpdatedAt = now
+		s.images[key] = stored
+		return nil
+	}
+
+	s.images[key] = Image{
+		ID:          primitive.NewObjectID(),
+		Hash:        image.Hash,
+		Backend:     image.Backend,
+		Key:         image.Key,
+		URL:         image.URL,
+		Size:        image.Size,
+		ContentType: image.ContentType,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	return nil
+}
+
+// AddImageRef counts a property's reference to the image stored at url. URLs that aren't
+// in the image index are ignored.
+func (s *MemoryStore) AddImageRef(ctx context.Context, url, propertyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addImageRef(url, propertyID)
+	return nil
+}
+
+// ListUnreferencedImages returns up to limit images the garbage collector may claim, least
+// recently updated first
+func (s *MemoryStore) ListUnreferencedImages(ctx context.Context, before time.Time, limit int64) ([]Image, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	images := []Image{}
+	for _, image := range s.images {
+		if collectable(&image, before) {
+			images = append(images, copyImage(image))
+		}
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].UpdatedAt.Before(images[j].UpdatedAt)
+	})
+	if int64(len(images)) > limit {
+		images = images[:limit]
+	}
+
+	return images, nil
+}
+
+// ClaimUnreferencedImage tombstones an image for deletion if the garbage collector may still
+// claim it, reporting whether it was claimed
+func (s *MemoryStore) ClaimUnreferencedImage(ctx context.Context, hash, backend string, before time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := imageKey(hash, backend)
+	image, ok := s.images[key]
+	if !ok || !collectable(&image, before) {
+		return false, nil
+	}
+
+	now := time.Now()
+	image.DeletingAt = &now
+	s.images[key] = image
+
+	return true, nil
+}
+
+// ReleaseImageClaim clears a tombstone whose blob couldn't be deleted
+func (s *MemoryStore) ReleaseImageClaim(ctx context.Context, hash, backend string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := imageKey(hash, backend)
+	if image, ok := s.images[key]; ok {
+		image.DeletingAt = nil
+		s.images[key] = image
+	}
+
+	return nil
+}
+
+// DeleteImage removes a claimed image from the index
+func (s *MemoryStore) DeleteImage(ctx context.Context, hash, backend string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := imageKey(hash, backend)
+	if image, ok := s.images[key]; ok && image.DeletingAt != nil {
+		delete(s.images, key)
+	}
+
+	return nil
+}
+
+// UpsertSettlementEvent stores a settlement event, ignoring logs that were already stored
+func (s *MemoryStore) UpsertSettlementEvent(ctx context.Context, event *SettlementEvent) error {
+	if _, ok := SettlementCollections[event.Event]; !ok {
+		return fmt.Errorf("unknown settlement event '%s'", event.Event)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.settlements[event.Event] {
+		if stored.TxHash == event.TxHash && stored.LogIndex == event.LogIndex {
+			return nil
+		}
+	}
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	stored := *event
+	stored.ID = primitive.NewObjectID()
+	s.settlements[event.Event] = append(s.settlements[event.Event], stored)
+
+	return nil
+}
+
+// GetSettlementEvents retrieves settlement events of one type for a property, optionally filtered by date,
+// that are confirmed or pending as asked
+func (s *MemoryStore) GetSettlementEvents(ctx context.Context, eventName, propertyID, date string, confirmed bool) ([]SettlementEvent, error) {
+	if _, ok := SettlementCollections[eventName]; !ok {
+		return nil, fmt.Errorf("unknown settlement event '%s'", eventName)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []SettlementEvent{}
+	for _, event := range s.settlements[eventName] {
+		if event.PropertyID == propertyID && event.Confirmed == confirmed && (date == "" || event.Date == date) {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].BlockNumber != events[j].BlockNumber {
+			return events[i].BlockNumber < events[j].BlockNumber
+		}
+		return events[i].LogIndex < events[j].LogIndex
+	})
+
+	return events, nil
+}
+
+// InsertTransaction stores a newly submitted transaction, failing if its hash is taken
+func (s *MemoryStore) InsertTransaction(ctx context.Context, tx *Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.transactions[tx.Hash]; exists {
+		return fmt.Errorf("failed to insert transaction: transaction '%s' already exists", tx.Hash)
+	}
+
+	tx.CreatedAt = time.Now()
+	tx.UpdatedAt = tx.CreatedAt
+	stored := copyTransaction(*tx)
+	stored.ID = primitive.NewObjectID()
+	s.transactions[tx.Hash] = stored
+
+	return nil
+}
+
+// GetTransactionByHash retrieves a transaction by its hash
+func (s *MemoryStore) GetTransactionByHash(ctx context.Context, hash string) (*Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tx, ok := s.transactions[hash]
+	if !ok {
+		return nil, fmt.Errorf("transaction '%s' %w", hash, ErrNotFound)
+	}
+
+	tx = copyTransaction(tx)
+	return &tx, nil
+}
+
+// GetPendingTransactions retrieves all pending transactions for a chain, oldest first
+func (s *MemoryStore) GetPendingTransactions(ctx context.Context, chain string) ([]Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var txs []Transaction
+	for _, tx := range s.transactions {
+		if tx.Chain == chain && tx.Status == TxStatusPending {
+			txs = append(txs, copyTransaction(tx))
+		}
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].Nonce != txs[j].Nonce {
+			return txs[i].Nonce < txs[j].Nonce
+		}
+		return txs[i].Attempt < txs[j].Attempt
+	})
+
+	return txs, nil
+}
+
+// UpdateTransaction updates an existing transaction by hash
+func (s *MemoryStore) UpdateTransaction(ctx context.Context, hash string, updates *TransactionUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.transactions[hash]
+	if !ok {
+		return fmt.Errorf("transaction '%s' %w", hash, ErrNotFound)
+	}
+
+	updates.apply(&tx)
+	tx.UpdatedAt = time.Now()
+	s.transactions[hash] = tx
+
+	return nil
+}
+
+// SettleNonce marks every other pending attempt that shares a mined transaction's nonce as replaced
+func (s *MemoryStore) SettleNonce(ctx context.Context, chain, from string, nonce uint64, minedHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, tx := range s.transactions {
+		if tx.Chain == chain && tx.From == from && tx.Nonce == nonce && tx.Status == TxStatusPending && hash != minedHash {
+			tx.Status = TxStatusReplaced
+			tx.UpdatedAt = time.Now()
+			s.transactions[hash] = tx
+		}
+	}
+
+	return nil
+}
+
+// InsertAuthNonce stores a freshly issued nonce
+func (s *MemoryStore) InsertAuthNonce(ctx context.Context, nonce *AuthNonce) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.nonces[nonce.Nonce]; exists {
+		return fmt.Errorf("failed to insert nonce: nonce '%s' already exists", nonce.Nonce)
+	}
+
+	nonce.CreatedAt = time.Now()
+	stored := *nonce
+	stored.ID = primitive.NewObjectID()
+	s.nonces[nonce.Nonce] = stored
+
+	return nil
+}
+
+// ConsumeAuthNonce deletes an unexpired nonce, failing if it was never issued or already used
+func (s *MemoryStore) ConsumeAuthNonce(ctx context.Context, nonce string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.nonces[nonce]
+	if !ok || !stored.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("nonce '%s' is invalid or expired", nonce)
+	}
+	delete(s.nonces, nonce)
+
+	return nil
+}
+
+// InsertSession stores a new wallet session
+func (s *MemoryStore) InsertSession(ctx context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[session.TokenHash]; exists {
+		return fmt.Errorf("failed to insert session: session already exists")
+	}
+
+	session.CreatedAt = time.Now()
+	stored := *session
+	stored.ID = primitive.NewObjectID()
+	s.sessions[session.TokenHash] = stored
+
+	return nil
+}
+
+// GetSession retrieves an unexpired session by token hash
+func (s *MemoryStore) GetSession(ctx context.Context, tokenHash string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[tokenHash]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("session not found or expired")
+	}
+
+	return &session, nil
+}
+
+// DeleteSession removes a session by token hash
+func (s *MemoryStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, tokenHash)
+	return nil
+}
+
+// findProperties returns copies of the properties matching a predicate, ordered by property ID
+func (s *MemoryStore) findProperties(match func(*Property) bool) []Property {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var properties []Property
+	for _, property := range s.properties {
+		if match(&property) {
+			properties = append(properties, copyProperty(property))
+		}
+	}
+	sort.Slice(properties, func(i, j int) bool {
+		return properties[i].PropertyID < properties[j].PropertyID
+	})
+
+	return properties
+}
+
+// findListings returns the listings matching a predicate, ordered by day
+func (s *MemoryStore) findListings(match func(*Listing) bool) []Listing {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var listings []Listing
+	for _, listing := range s.listings {
+		if match(&listing) {
+			listings = append(listings, listing)
+		}
+	}
+	sort.Slice(listings, func(i, j int) bool {
+		return listings[i].Day < listings[j].Day
+	})
+
+	return listings
+}
+
+// listingKey identifies a listing by its property and date
+func listingKey(propertyID, date string) string {
+	return propertyID + "/" + date
+}
+
+// copyProperty copies a property along with its image variants
+func copyProperty(property Property) Property {
+	if property.ImageVariants != nil {
+		variants := *property.ImageVariants
+		property.ImageVariants = &variants
+	}
+	return property
+}
+
+// findFiles returns the files matching a predicate, newest first
+func (s *MemoryStore) findFiles(match func(*StoredFile) bool) []StoredFile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Files are collected last inserted first, so files created at the same time stay in that order
+	var files []StoredFile
+	for i := len(s.files) - 1; i >= 0; i-- {
+		if match(&s.files[i]) {
+			files = append(files, s.files[i])
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].CreatedAt.After(files[j].CreatedAt)
+	})
+
+	return files
+}
+
+// newestFile returns the newest file matching a predicate, or nil if none does
+func (s *MemoryStore) newestFile(match func(*StoredFile) bool) *StoredFile {
+	files := s.findFiles(match)
+	if len(files) == 0 {
+		return nil
+	}
+	return &files[0]
+}
+
+// addImageRef counts a property's reference to the images stored at url. The caller holds the lock.
+func (s *MemoryStore) addImageRef(url, propertyID string) {
+	for key, image := range s.images {
+		if image.URL != url {
+			continue
+		}
+		image = copyImage(image)
+		if image.PropertyRefs == nil {
+			image.PropertyRefs = make(map[string]int64)
+		}
+		image.PropertyRefs[propertyID]++
+		image.RefCount++
+		image.UpdatedAt = time.Now()
+		s.images[key] = image
+	}
+}
+
+// releaseImageRefs drops every reference a property holds to images. The caller holds the lock.
+func (s *MemoryStore) releaseImageRefs(propertyID string) {
+	for key, image := range s.images {
+		refs := image.PropertyRefs[propertyID]
+		if refs <= 0 {
+			continue
+		}
+		image = copyImage(image)
+		image.RefCount -= refs
+		delete(image.PropertyRefs, propertyID)
+		image.UpdatedAt = time.Now()
+		s.images[key] = image
+	}
+}
+
+// collectable reports whether the garbage collector may claim an image, as collectableImages matches
+func collectable(image *Image, before time.Time) bool {
+	if image.DeletingAt != nil {
+		return image.DeletingAt.Before(time.Now().Add(-imageTombstoneLease))
+	}
+	return image.RefCount <= 0 && image.UpdatedAt.Before(before)
+}
+
+// imageKey identifies an image by its hash and backend
+func imageKey(hash, backend string) string {
+	return backend + "/" + hash
+}
+
+// copyImage copies an image along with its references and tombstone
+func copyImage(image Image) Image {
+	if image.PropertyRefs != nil {
+		refs := make(map[string]int64, len(image.PropertyRefs))
+		for propertyID, count := range image.PropertyRefs {
+			refs[propertyID] = count
+		}
+		image.PropertyRefs = refs
+	}
+	if image.DeletingAt != nil {
+		deletingAt := *image.DeletingAt
+		image.DeletingAt = &deletingAt
+	}
+	return image
+}
+
+// copyTransaction copies a transaction along with its receipt
+func copyTransaction(tx Transaction) Transaction {
+	if tx.Receipt != nil {
+		receipt := *tx.Receipt
+		tx.Receipt = &receipt
+	}
+	return tx
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreUpdatesProperty(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	for _, url := range []string{"https://img/old", "https://img/new"} {
+		if err := store.SaveImage(ctx, &Image{Hash: url, Backend: "local", URL: url}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.InsertProperty(ctx, &Property{PropertyID: "7", PropertyName: "Cabin", Description: "By the lake"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddImageRef(ctx, "https://img/old", "7"); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "Lodge"
+	err := store.UpdateProperty(ctx, "7", &PropertyUpdate{
+		PropertyName:  &name,
+		ImageVariants: &ImageVariants{Thumbnail: "https://img/new", Full: "https://img/new"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	property, err := store.GetPropertyByID(ctx, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if property.PropertyName != "Lodge" || property.Description != "By the lake" || property.ImageVariants.Full != "https://img/new" {
+		t.Errorf("updated property is %+v", property)
+	}
+
+	// The references moved from the old image to the new one, counted once per URL
+	for url, want := range map[string]int64{"https://img/old": 0, "https://img/new": 1} {
+		image, err := store.TouchImage(ctx, url, "local")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if image.RefCount != want || image.PropertyRefs["7"] != want {
+			t.Errorf("%s has %d references (%v), want %d", url, image.RefCount, image.PropertyRefs, want)
+		}
+	}
+
+	if err := store.UpdateProperty(ctx, "8", &PropertyUpdate{PropertyName: &name}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("updating a missing property = %v, want %v", err, ErrNotFound)
+	}
+	ipfsHash := "bafy"
+	if err := store.UpdateListing(ctx, "7", "20000", &ListingUpdate{IPFSHash: &ipfsHash}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("updating a missing listing = %v, want %v", err, ErrNotFound)
+	}
+
+	// Deleting the property releases its references
+	if err := store.DeleteProperty(ctx, "7"); err != nil {
+		t.Fatal(err)
+	}
+	if image, _ := store.TouchImage(ctx, "https://img/new", "local"); image.RefCount != 0 {
+		t.Errorf("deleted property still holds %d references", image.RefCount)
+	}
+}
+
+func TestMemoryStoreCollectsImages(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	if err := store.SaveImage(ctx, &Image{Hash: "h", Backend: "local", URL: "https://img/h"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertProperty(ctx, &Property{PropertyID: "7"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddImageRef(ctx, "https://img/h", "7"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A referenced image isn't collectable, however old
+	later := time.Now().Add(time.Hour)
+	if images, _ := store.ListUnreferencedImages(ctx, later, 10); len(images) != 0 {
+		t.Fatalf("listed referenced images %+v", images)
+	}
+
+	if err := store.DeleteProperty(ctx, "7"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only images untouched since before are collectable
+	if images, _ := store.ListUnreferencedImages(ctx, time.Now().Add(-time.Hour), 10); len(images) != 0 {
+		t.Fatalf("listed a recently used image %+v", images)
+	}
+	if images, _ := store.ListUnreferencedImages(ctx, later, 10); len(images) != 1 {
+		t.Fatalf("listed %d unreferenced images, want 1", len(images))
+	}
+
+	claimed, err := store.ClaimUnreferencedImage(ctx, "h", "local", later)
+	if err != nil || !claimed {
+		t.Fatalf("ClaimUnreferencedImage = %v, %v", claimed, err)
+	}
+	if claimed, _ := store.ClaimUnreferencedImage(ctx, "h", "local", later); claimed {
+		t.Error("claimed an image twice")
+	}
+
+	// A claimed image can't be reused or stored again
+	if _, err := store.TouchImage(ctx, "h", "local"); !errors.Is(err, ErrImageDeleting) {
+		t.Errorf("TouchImage = %v, want %v", err, ErrImageDeleting)
+	}
+	if err := store.SaveImage(ctx, &Image{Hash: "h", Backend: "local"}); !errors.Is(err, ErrImageDeleting) {
+		t.Errorf("SaveImage = %v, want %v", err, ErrImageDeleting)
+	}
+
+	// Releasing the claim makes it usable again, deleting it removes it
+	if err := store.ReleaseImageClaim(ctx, "h", "local"); err != nil {
+		t.Fatal(err)
+	}
+	if image, err := store.TouchImage(ctx, "h", "local"); err != nil || image == nil {
+		t.Fatalf("TouchImage after release = %v, %v", image, err)
+	}
+	if _, err := store.ClaimUnreferencedImage(ctx, "h", "local", later); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteImage(ctx, "h", "local"); err != nil {
+		t.Fatal(err)
+	}
+	if image, err := store.TouchImage(ctx, "h", "local"); image != nil || err != nil {
+		t.Errorf("TouchImage after delete = %v, %v", image, err)
+	}
+}
+
+func TestMemoryStoreCatalogsFiles(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	files := []StoredFile{
+		{Hash: "a", Backend: "0g", Size: 10, URL: "https://files/a", UploaderWallet: "0xA"},
+		{Hash: "b", Backend: "ipfs", Size: 20, URL: "https://files/b", UploaderWallet: "0xA"},
+		{Hash: "c", Backend: "ipfs", Size: 30, URL: "https://files/c", UploaderWallet: "0xA"},
+		{Hash: "c", Backend: "ipfs", Size: 30, URL: "https://files/c", UploaderWallet: "0xB"},
+		// The same upload again updates the first entry
+		{Hash: "a", Backend: "0g", Size: 10, URL: "https://files/a", UploaderWallet: "0xA", Name: "renamed"},
+	}
+	for i := range files {
+		if err := store.SaveFile(ctx, &files[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, total, err := store.ListFilesByUploader(ctx, "0xA", "", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(page) != 2 || page[0].Hash != "c" || page[1].Hash != "b" {
+		t.Errorf("first page is %+v of %d", page, total)
+	}
+	if page, _, _ := store.ListFilesByUploader(ctx, "0xA", "", 2, 2); len(page) != 1 || page[0].Name != "renamed" {
+		t.Errorf("second page is %+v", page)
+	}
+	if page, total, _ := store.ListFilesByUploader(ctx, "0xA", "", 3, 2); len(page) != 0 || total != 3 {
+		t.Errorf("page past the end is %+v of %d", page, total)
+	}
+
+	stats, err := store.GetFileStatsByUploader(ctx, "0xA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FileCount != 3 || stats.TotalSize != 60 || len(stats.Backends) != 2 ||
+		stats.Backends[0] != (BackendFileStats{Backend: "0g", FileCount: 1, TotalSize: 10}) ||
+		stats.Backends[1] != (BackendFileStats{Backend: "ipfs", FileCount: 2, TotalSize: 50}) {
+		t.Errorf("stats are %+v", stats)
+	}
+
+	if uploaders, _ := store.GetFileUploaders(ctx, "c"); len(uploaders) != 2 {
+		t.Errorf("uploaders of c are %v", uploaders)
+	}
+
+	if err := store.LinkFileToProperty(ctx, "https://files/c", "7"); err != nil {
+		t.Fatal(err)
+	}
+	if file, _ := store.GetFileByHash(ctx, "c"); file == nil || file.PropertyID != "7" {
+		t.Errorf("linked file is %+v", file)
+	}
+
+	if err := store.DeleteFilesByURL(ctx, "https://files/c"); err != nil {
+		t.Fatal(err)
+	}
+	if file, _ := store.GetFileByHash(ctx, "c"); file != nil {
+		t.Errorf("deleted file is still cataloged: %+v", file)
+	}
+}
+
+func TestMemoryStoreFiltersSettlements(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	events := []SettlementEvent{
+		{Event: "SettlePayment", PropertyID: "7", Date: "20000", TxHash: "0x2", BlockNumber: 12, Confirmed: true},
+		{Event: "SettlePayment", PropertyID: "7", Date: "20001", TxHash: "0x1", BlockNumber: 11, Confirmed: true},
+		{Event: "SettlePayment", PropertyID: "7", Date: "20000", TxHash: "0x3", BlockNumber: 13},
+		{Event: "SettleFee", PropertyID: "7", Date: "20000", TxHash: "0x2", LogIndex: 1, BlockNumber: 12, Confirmed: true},
+		// Indexing the same log again is ignored
+		{Event: "SettlePayment", PropertyID: "7", Date: "20000", TxHash: "0x2", BlockNumber: 12, Confirmed: true},
+	}
+	for i := range events {
+		if err := store.UpsertSettlementEvent(ctx, &events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		date      string
+		confirmed bool
+		want      []string
+	}{
+		{"confirmed", "", true, []string{"0x1", "0x2"}},
+		{"confirmed on a date", "20000", true, []string{"0x2"}},
+		{"pending", "", false, []string{"0x3"}},
+	}
+
+	for _, test := range tests {
+		got, err := store.GetSettlementEvents(ctx, "SettlePayment", "7", test.date, test.confirmed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hashes []string
+		for _, event := range got {
+			hashes = append(hashes, event.TxHash)
+		}
+		if fmt.Sprint(hashes) != fmt.Sprint(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, hashes, test.want)
+		}
+	}
+
+	if _, err := store.GetSettlementEvents(ctx, "Unknown", "7", "", true); err == nil {
+		t.Error("read events of an unknown type")
+	}
+}
@@ -0,0 +1,776 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrationsCollection records the schema migrations applied to the database
+const MigrationsCollection = "schema_migrations"
+
+// migrationLockID is the schema_migrations document held while a runner is applying migrations
+const migrationLockID = "lock"
+
+// migrationLockLease bounds how long a crashed runner keeps others out. A live runner renews it
+// every migrationLockRenewal, so migrations may take longer than the lease.
+const (
+	migrationLockLease   = 10 * time.Minute
+	migrationLockRenewal = migrationLockLease / 3
+)
+
+var (
+	// ErrMigrationLocked is returned when another runner is applying migrations
+	ErrMigrationLocked = errors.New("migrations are locked by another runner")
+	// ErrIrreversible is returned when rolling back a migration that has no down step
+	ErrIrreversible = errors.New("migration cannot be rolled back")
+)
+
+// Migration is one versioned change to the database schema or data. Down undoes Up, and is nil
+// for migrations that can't be undone.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(ctx context.Context, c *Client) error
+	Down    func(ctx context.Context, c *Client) error
+}
+
+// AppliedMigration represents a migration recorded in schema_migrations
+type AppliedMigration struct {
+	Version   int64     `bson:"version" json:"version"`
+	Name      string    `bson:"name" json:"name"`
+	AppliedAt time.Time `bson:"applied_at" json:"applied_at"`
+}
+
+// MigrationStatus reports whether a migration has been applied. Migrations recorded in the
+// database but unknown to this build are reported with Unknown set.
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Unknown   bool       `json:"unknown,omitempty"`
+}
+
+// Migrations lists every migration in version order. Applied migrations must never be edited,
+// changes go in a new migration.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline_indexes",
+		Up:      migrateBaselineIndexes,
+		Down:    dropBaselineIndexes,
+	},
+	{
+		Version: 2,
+		Name:    "remove_placeholder_contracts",
+		Up:      removePlaceholderContracts,
+	},
+	{
+		Version: 3,
+		Name:    "collection_validators",
+		Up:      addCollectionValidators,
+		Down:    removeCollectionValidators,
+	},
+	{
+		Version: 4,
+		Name:    "backfill_property_image_variants",
+		Up:      backfillPropertyImageVariants,
+		Down:    unsetBackfilledImageVariants,
+	},
+	{
+		Version: 5,
+		Name:    "listing_days",
+		Up:      backfillListingDays,
+		Down:    removeListingDays,
+	},
+	{
+		Version: 6,
+		Name:    "file_content_hashes",
+		Up:      addFileContentHashIndex,
+		Down:    dropFileContentHashIndex,
+	},
+	{
+		Version: 7,
+		Name:    "property_transfers",
+		Up:      addPropertyTransferIndexes,
+		Down:    dropPropertyTransferIndexes,
+	},
+}
+
+// MigrateUp applies pending migrations in order, up to and including target, or all of them
+// when target is 0. It returns the migrations it applied.
+func (c *Client) MigrateUp(ctx context.Context, target int64) ([]Migration, error) {
+	ctx, release, err := c.lockMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range pendingMigrations(Migrations, applied, target) {
+		if err := migration.Up(ctx, c); err != nil {
+			return done, fmt.Errorf("migration %d %s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		record := AppliedMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+		if _, err := c.GetCollection(MigrationsCollection).InsertOne(ctx, record); err != nil {
+			return done, fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// MigrateDown rolls back the most recently applied migrations, newest first, and returns them
+func (c *Client) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	ctx, release, err := c.lockMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Migrations newer than an irreversible one are still rolled back before it's reported
+	rollback, planErr := rollbackMigrations(Migrations, applied, steps)
+
+	var done []Migration
+	for _, migration := range rollback {
+		if err := migration.Down(ctx, c); err != nil {
+			return done, fmt.Errorf("rollback of migration %d %s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		filter := bson.D{{Key: "version", Value: migration.Version}}
+		if _, err := c.GetCollection(MigrationsCollection).DeleteOne(ctx, filter); err != nil {
+			return done, fmt.Errorf("failed to unrecord migration %d: %w", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, planErr
+}
+
+// pendingMigrations returns the migrations not yet applied, in version order, up to and including
+// target, or all of them when target is 0
+func pendingMigrations(migrations []Migration, applied map[int64]AppliedMigration, target int64) []Migration {
+	var pending []Migration
+	for _, migration := range migrations {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		pending = append(pending, migration)
+	}
+	return pending
+}
+
+// rollbackMigrations returns up to steps applied migrations to roll back, newest first. It stops at
+// the first irreversible one, returning those before it along with ErrIrreversible.
+func rollbackMigrations(migrations []Migration, applied map[int64]AppliedMigration, steps int) ([]Migration, error) {
+	var rollback []Migration
+	for i := len(migrations) - 1; i >= 0 && len(rollback) < steps; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return rollback, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, ErrIrreversible)
+		}
+		rollback = append(rollback, migration)
+	}
+	return rollback, nil
+}
+
+// GetMigrationStatus lists every known migration and whether it has been applied
+func (c *Client) GetMigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(Migrations))
+	for _, migration := range Migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &record.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	// Whatever is left was applied by a newer build
+	for _, record := range applied {
+		appliedAt := record.AppliedAt
+		statuses = append(statuses, MigrationStatus{
+			Version:   record.Version,
+			Name:      record.Name,
+			Applied:   true,
+			AppliedAt: &appliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// appliedMigrations returns the recorded migrations by version
+func (c *Client) appliedMigrations(ctx context.Context) (map[int64]AppliedMigration, error) {
+	filter := bson.D{{Key: "version", Value: bson.D{{Key: "$exists", Value: true}}}}
+	cursor, err := c.GetCollection(MigrationsCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find applied migrations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []AppliedMigration
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode applied migrations: %w", err)
+	}
+
+	applied := make(map[int64]AppliedMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+
+	return applied, nil
+}
+
+// lockMigrations takes the migration lock, so instances starting together don't apply the same
+// migration twice. The lock expires after a lease in case its holder dies, and is renewed while
+// it's held. The returned context is canceled if the lock is lost, so the run stops instead of
+// racing whoever took it over.
+func (c *Client) lockMigrations(ctx context.Context) (context.Context, func(), error) {
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d:%d", hostname, os.Getpid(), time.Now().UnixNano())
+
+	lock := mongoMigrationLock{collection: c.GetCollection(MigrationsCollection)}
+	return holdMigrationLock(ctx, lock, owner, migrationLockLease, migrationLockRenewal)
+}
+
+// migrationLock stores the migration lock's owner and lease
+type migrationLock interface {
+	// acquire takes the lock for owner until the given time, unless another owner holds it past now.
+	// It returns ErrMigrationLocked when it's held.
+	acquire(ctx context.Context, owner string, now, until time.Time) error
+	// renew extends owner's lease, reporting false when owner no longer holds the lock
+	renew(ctx context.Context, owner string, until time.Time) (bool, error)
+	// release gives up the lock if owner still holds it
+	release(ctx context.Context, owner string) error
+}
+
+// holdMigrationLock acquires the lock for owner and renews its lease every renewal until the
+// returned release function is called. The returned context is canceled when the lock is lost.
+func holdMigrationLock(ctx context.Context, lock migrationLock, owner string, lease, renewal time.Duration) (context.Context, func(), error) {
+	now := time.Now()
+	if err := lock.acquire(ctx, owner, now, now.Add(lease)); err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(renewal)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			held, err := lock.renew(ctx, owner, time.Now().Add(lease))
+			if err != nil {
+				// A later renewal may still make it in time
+				log.Printf("⚠️  Failed to renew migration lock: %v", err)
+				continue
+			}
+			if !held {
+				log.Printf("❌ Migration lock was lost, stopping migrations")
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		<-renewed
+
+		// Release with a fresh context, the caller's may be what ended the run
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := lock.release(ctx, owner); err != nil {
+			log.Printf("⚠️  Failed to release migration lock: %v", err)
+		}
+	}, nil
+}
+
+// mongoMigrationLock keeps the migration lock in a schema_migrations document
+type mongoMigrationLock struct {
+	collection *mongo.Collection
+}
+
+func (l mongoMigrationLock) acquire(ctx context.Context, owner string, now, until time.Time) error {
+	// A held lock doesn't match the filter, so the upsert collides with it on _id
+	filter := bson.D{
+		{Key: "_id", Value: migrationLockID},
+		{Key: "locked_until", Value: bson.D{{Key: "$lt", Value: now}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "owner", Value: owner},
+		{Key: "locked_until", Value: until},
+	}}}
+
+	_, err := l.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return lockError(err)
+}
+
+func (l mongoMigrationLock) renew(ctx context.Context, owner string, until time.Time) (bool, error) {
+	held := bson.D{{Key: "_id", Value: migrationLockID}, {Key: "owner", Value: owner}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "locked_until", Value: until}}}}
+	result, err := l.collection.UpdateOne(ctx, held, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (l mongoMigrationLock) release(ctx context.Context, owner string) error {
+	held := bson.D{{Key: "_id", Value: migrationLockID}, {Key: "owner", Value: owner}}
+	_, err := l.collection.DeleteOne(ctx, held)
+	return err
+}
+
+// lockError maps the error of an attempt to take the lock, a duplicate key meaning another
+// runner holds it
+func lockError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrMigrationLocked
+	}
+	return fmt.Errorf("failed to lock migrations: %w", err)
+}
+
+// setValidator replaces a collection's JSON schema validator, creating the collection if it doesn't
+// exist yet. Documents already stored aren't checked, and updates to ones that don't pass are allowed.
+func (c *Client) setValidator(ctx context.Context, name string, schema bson.M) error {
+	exists, err := c.CollectionExists(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	validator := bson.M{"$jsonSchema": schema}
+	if !exists {
+		opts := options.CreateCollection().SetValidator(validator).SetValidationLevel("moderate")
+		if err := c.Database.CreateCollection(ctx, name, opts); err != nil {
+			return fmt.Errorf("failed to create %s collection: %w", name, err)
+		}
+		return nil
+	}
+
+	command := bson.D{
+		{Key: "collMod", Value: name},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+	}
+	if err := c.Database.RunCommand(ctx, command).Err(); err != nil {
+		return fmt.Errorf("failed to set %s validator: %w", name, err)
+	}
+
+	return nil
+}
+
+// removeValidator drops a collection's validator
+func (c *Client) removeValidator(ctx context.Context, name string) error {
+	command := bson.D{
+		{Key: "collMod", Value: name},
+		{Key: "validator", Value: bson.M{}},
+		{Key: "validationLevel", Value: "strict"},
+	}
+	if err := c.Database.RunCommand(ctx, command).Err(); err != nil && !isNamespaceNotFound(err) {
+		return fmt.Errorf("failed to remove %s validator: %w", name, err)
+	}
+
+	return nil
+}
+
+// dropIndexes drops every index of a collection except the one on _id
+func (c *Client) dropIndexes(ctx context.Context, name string) error {
+	if _, err := c.GetCollection(name).Indexes().DropAll(ctx); err != nil && !isNamespaceNotFound(err) {
+		return fmt.Errorf("failed to drop %s indexes: %w", name, err)
+	}
+	return nil
+}
+
+// isNamespaceNotFound reports whether a command failed because its collection doesn't exist
+func isNamespaceNotFound(err error) bool {
+	var commandErr mongo.CommandError
+	return errors.As(err, &commandErr) && commandErr.Code == 26
+}
+
+// isIndexNotFound reports whether a command failed because the index doesn't exist
+func isIndexNotFound(err error) bool {
+	var commandErr mongo.CommandError
+	return errors.As(err, &commandErr) && commandErr.Code == 27
+}
+
+// collectionIndexes are indexes to create on one collection
+type collectionIndexes struct {
+	collection string
+	models     []mongo.IndexModel
+}
+
+// baselineIndexes are the indexes collections were given before migrations existed. They're
+// frozen as they were then, later index changes go in their own migrations.
+func baselineIndexes() []collectionIndexes {
+	unique := func(keys bson.D) mongo.IndexModel {
+		return mongo.IndexModel{Keys: keys, Options: options.Index().SetUnique(true)}
+	}
+	ttl := func(keys bson.D) mongo.IndexModel {
+		return mongo.IndexModel{Keys: keys, Options: options.Index().SetExpireAfterSeconds(0)}
+	}
+
+	indexes := []collectionIndexes{
+		{"contracts", []mongo.IndexModel{unique(bson.D{{Key: "type", Value: 1}})}},
+		{"chains", []mongo.IndexModel{unique(bson.D{{Key: "chain", Value: 1}})}},
+		{"properties", []mongo.IndexModel{unique(bson.D{{Key: "property_id", Value: 1}})}},
+		{"listings", []mongo.IndexModel{unique(bson.D{{Key: "property_id", Value: 1}, {Key: "date", Value: 1}})}},
+	}
+
+	// A settlement log is uniquely identified by its transaction and position
+	for _, name := range []string{"settle_payments", "settle_securities", "settle_fees"} {
+		indexes = append(indexes, collectionIndexes{name, []mongo.IndexModel{
+			unique(bson.D{{Key: "tx_hash", Value: 1}, {Key: "log_index", Value: 1}}),
+			{Keys: bson.D{{Key: "property_id", Value: 1}, {Key: "date", Value: 1}}},
+		}})
+	}
+
+	return append(indexes,
+		collectionIndexes{"indexer_checkpoints", []mongo.IndexModel{
+			unique(bson.D{{Key: "name", Value: 1}}),
+		}},
+		collectionIndexes{"indexed_blocks", []mongo.IndexModel{
+			unique(bson.D{{Key: "cursor", Value: 1}, {Key: "number", Value: -1}}),
+		}},
+		collectionIndexes{"transactions", []mongo.IndexModel{
+			unique(bson.D{{Key: "hash", Value: 1}}),
+			{Keys: bson.D{{Key: "chain", Value: 1}, {Key: "status", Value: 1}}},
+			{Keys: bson.D{{Key: "from", Value: 1}, {Key: "nonce", Value: 1}}},
+		}},
+		collectionIndexes{"auth_nonces", []mongo.IndexModel{
+			unique(bson.D{{Key: "nonce", Value: 1}}),
+			ttl(bson.D{{Key: "expires_at", Value: 1}}),
+		}},
+		collectionIndexes{"sessions", []mongo.IndexModel{
+			unique(bson.D{{Key: "token_hash", Value: 1}}),
+			ttl(bson.D{{Key: "expires_at", Value: 1}}),
+		}},
+		collectionIndexes{"files", []mongo.IndexModel{
+			unique(bson.D{{Key: "backend", Value: 1}, {Key: "hash", Value: 1}, {Key: "uploader_wallet", Value: 1}}),
+			{Keys: bson.D{{Key: "uploader_wallet", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "hash", Value: 1}}},
+			{Keys: bson.D{{Key: "url", Value: 1}}},
+		}},
+		collectionIndexes{"images", []mongo.IndexModel{
+			unique(bson.D{{Key: "hash", Value: 1}, {Key: "backend", Value: 1}}),
+			{Keys: bson.D{{Key: "url", Value: 1}}},
+			{Keys: bson.D{{Key: "ref_count", Value: 1}, {Key: "updated_at", Value: 1}}},
+		}},
+	)
+}
+
+// migrateBaselineIndexes creates the baseline indexes. Creating an index that already exists with
+// the same options succeeds, so it also applies to databases set up by earlier builds.
+func migrateBaselineIndexes(ctx context.Context, c *Client) error {
+	for _, index := range baselineIndexes() {
+		if _, err := c.GetCollection(index.collection).Indexes().CreateMany(ctx, index.models); err != nil {
+			return fmt.Errorf("failed to create %s indexes: %w", index.collection, err)
+		}
+	}
+	return nil
+}
+
+// dropBaselineIndexes drops the baseline migration's indexes
+func dropBaselineIndexes(ctx context.Context, c *Client) error {
+	for _, index := range baselineIndexes() {
+		if err := c.dropIndexes(ctx, index.collection); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placeholderContractAddress is what earlier builds seeded contracts with
+const placeholderContractAddress = "0x..."
+
+// removePlaceholderContracts replaces seeded placeholder contract addresses with the ones in
+// MARKETPLACE_CONTRACT_ADDRESS and PROPERTY_CONTRACT_ADDRESS, and deletes those left unset, so
+// lookups fail instead of returning an address that isn't one.
+func removePlaceholderContracts(ctx context.Context, c *Client) error {
+	collection := c.GetCollection("contracts")
+
+	for contractType, address := range contractAddressesFromEnv() {
+		filter := bson.D{{Key: "type", Value: contractType}, {Key: "contract_address", Value: placeholderContractAddress}}
+
+		if address == "" {
+			if _, err := collection.DeleteOne(ctx, filter); err != nil {
+				return fmt.Errorf("failed to delete placeholder %s contract: %w", contractType, err)
+			}
+			continue
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "contract_address", Value: address},
+			{Key: "updated_at", Value: time.Now()},
+		}}}
+		if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
+			return fmt.Errorf("failed to update placeholder %s contract: %w", contractType, err)
+		}
+	}
+
+	return nil
+}
+
+// contractAddressesFromEnv returns the configured address of each contract type, empty when unset
+func contractAddressesFromEnv() map[string]string {
+	return map[string]string{
+		"marketplace": os.Getenv("MARKETPLACE_CONTRACT_ADDRESS"),
+		"property":    os.Getenv("PROPERTY_CONTRACT_ADDRESS"),
+	}
+}
+
+// collectionValidators are the JSON schemas written documents must match
+var collectionValidators = map[string]bson.M{
+	"contracts": {
+		"bsonType": "object",
+		"required": bson.A{"type", "contract_address"},
+		"properties": bson.M{
+			"type":             bson.M{"enum": bson.A{"marketplace", "property"}},
+			"contract_address": bson.M{"bsonType": "string", "pattern": "^0x[0-9a-fA-F]{40}$"},
+		},
+	},
+	"chains": {
+		"bsonType": "object",
+		"required": bson.A{"chain", "rpc", "chain_id"},
+		"properties": bson.M{
+			"chain":    bson.M{"bsonType": "string", "minLength": 1},
+			"rpc":      bson.M{"bsonType": "string", "minLength": 1},
+			"chain_id": bson.M{"bsonType": "string", "pattern": "^[0-9]+$"},
+			"tx_type":  bson.M{"enum": bson.A{TxTypeLegacy, TxTypeDynamicFee}},
+		},
+	},
+	"properties": {
+		"bsonType": "object",
+		"required": bson.A{"property_id", "wallet_address", "property_name"},
+		"properties": bson.M{
+			"property_id":    bson.M{"bsonType": "string", "minLength": 1},
+			"wallet_address": bson.M{"bsonType": "string"},
+			"property_name":  bson.M{"bsonType": "string"},
+			"ipfs_hash":      bson.M{"bsonType": "string"},
+			"image":          bson.M{"bsonType": "string"},
+			"image_variants": bson.M{
+				"bsonType": "object",
+				"properties": bson.M{
+					"thumbnail": bson.M{"bsonType": "string"},
+					"card":      bson.M{"bsonType": "string"},
+					"full":      bson.M{"bsonType": "string"},
+				},
+			},
+		},
+	},
+	"listings": {
+		"bsonType": "object",
+		"required": bson.A{"property_id", "date"},
+		"properties": bson.M{
+			"property_id": bson.M{"bsonType": "string", "minLength": 1},
+			"date":        bson.M{"bsonType": "string", "minLength": 1},
+			"ipfs_hash":   bson.M{"bsonType": "string"},
+		},
+	},
+}
+
+// addCollectionValidators validates documents written to the core collections
+func addCollectionValidators(ctx context.Context, c *Client) error {
+	for name, schema := range collectionValidators {
+		if err := c.setValidator(ctx, name, schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeCollectionValidators drops the core collections' validators
+func removeCollectionValidators(ctx context.Context, c *Client) error {
+	for name := range collectionValidators {
+		if err := c.removeValidator(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillPropertyImageVariants gives properties minted before images were resized their
+// original image as every variant, so readers can rely on image_variants being set
+func backfillPropertyImageVariants(ctx context.Context, c *Client) error {
+	filter := bson.D{
+		{Key: "image", Value: bson.D{{Key: "$nin", Value: bson.A{"", nil}}}},
+		{Key: "image_variants", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "image_variants", Value: bson.D{
+			{Key: "thumbnail", Value: "$image"},
+			{Key: "card", Value: "$image"},
+			{Key: "full", Value: "$image"},
+		}}}}},
+	}
+
+	result, err := c.GetCollection("properties").UpdateMany(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to backfill image variants: %w", err)
+	}
+	log.Printf("🔍 Backfilled image variants for %d properties", result.ModifiedCount)
+
+	return nil
+}
+
+// unsetBackfilledImageVariants removes the variants backfilled from the original image
+func unsetBackfilledImageVariants(ctx context.Context, c *Client) error {
+	filter := bson.D{{Key: "$expr", Value: bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "$eq", Value: bson.A{"$image_variants.thumbnail", "$image"}}},
+		bson.D{{Key: "$eq", Value: bson.A{"$image_variants.card", "$image"}}},
+		bson.D{{Key: "$eq", Value: bson.A{"$image_variants.full", "$image"}}},
+	}}}}}
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "image_variants", Value: ""}}}}
+
+	if _, err := c.GetCollection("properties").UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to unset image variants: %w", err)
+	}
+
+	return nil
+}
+
+// listingDayIndex is the index listing range queries use
+const listingDayIndex = "property_id_1_day_1"
+
+// backfillListingDays stores every listing's date as a number, so date ranges compare numerically
+// instead of as strings, and indexes it for range queries
+func backfillListingDays(ctx context.Context, c *Client) error {
+	collection := c.GetCollection("listings")
+
+	filter := bson.D{{Key: "day", Value: bson.D{{Key: "$exists", Value: false}}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "day", Value: bson.D{{Key: "$convert", Value: bson.D{
+			{Key: "input", Value: "$date"},
+			{Key: "to", Value: "long"},
+			{Key: "onError", Value: nil},
+		}}}}}}},
+	}
+
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to backfill listing days: %w", err)
+	}
+	log.Printf("🔍 Backfilled days for %d listings", result.ModifiedCount)
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "property_id", Value: 1}, {Key: "day", Value: 1}},
+		Options: options.Index().SetName(listingDayIndex),
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, indexModel); err != nil {
+		return fmt.Errorf("failed to create listings day index: %w", err)
+	}
+
+	return nil
+}
+
+// removeListingDays drops the listing day index and field
+func removeListingDays(ctx context.Context, c *Client) error {
+	collection := c.GetCollection("listings")
+
+	if _, err := collection.Indexes().DropOne(ctx, listingDayIndex); err != nil && !isNamespaceNotFound(err) && !isIndexNotFound(err) {
+		return fmt.Errorf("failed to drop listings day index: %w", err)
+	}
+
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "day", Value: ""}}}}
+	if _, err := collection.UpdateMany(ctx, bson.D{}, update); err != nil {
+		return fmt.Errorf("failed to unset listing days: %w", err)
+	}
+
+	return nil
+}
+
+// fileContentHashIndex is the index deduplicated uploads are looked up by
+const fileContentHashIndex = "content_hash_1_backend_1"
+
+// addFileContentHashIndex indexes cataloged files by content hash. Files cataloged earlier have
+// none and are simply never matched.
+func addFileContentHashIndex(ctx context.Context, c *Client) error {
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "content_hash", Value: 1}, {Key: "backend", Value: 1}},
+		Options: options.Index().SetName(fileContentHashIndex).SetSparse(true),
+	}
+	if _, err := c.GetCollection(FilesCollection).Indexes().CreateOne(ctx, indexModel); err != nil {
+		return fmt.Errorf("failed to create files content hash index: %w", err)
+	}
+	return nil
+}
+
+// dropFileContentHashIndex drops the files content hash index
+func dropFileContentHashIndex(ctx context.Context, c *Client) error {
+	_, err := c.GetCollection(FilesCollection).Indexes().DropOne(ctx, fileContentHashIndex)
+	if err != nil && !isNamespaceNotFound(err) && !isIndexNotFound(err) {
+		return fmt.Errorf("failed to drop files content hash index: %w", err)
+	}
+	return nil
+}
+
+// addPropertyTransferIndexes indexes property transfers by log, like settlements, and by property
+// for ownership history
+func addPropertyTransferIndexes(ctx context.Context, c *Client) error {
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tx_hash", Value: 1}, {Key: "log_index", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "property_id", Value: 1}, {Key: "block_number", Value: 1}}},
+	}
+	if _, err := c.GetCollection(PropertyTransfersCollection).Indexes().CreateMany(ctx, indexModels); err != nil {
+		return fmt.Errorf("failed to create property transfer indexes: %w", err)
+	}
+	return nil
+}
+
+// dropPropertyTransferIndexes drops the property transfer indexes
+func dropPropertyTransferIndexes(ctx context.Context, c *Client) error {
+	return c.dropIndexes(ctx, PropertyTransfersCollection)
+}
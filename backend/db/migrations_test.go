@@ -0,0 +1,250 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// appliedVersions returns applied migration records for the given versions
+func appliedVersions(versions ...int64) map[int64]AppliedMigration {
+	applied := make(map[int64]AppliedMigration, len(versions))
+	for _, version := range versions {
+		applied[version] = AppliedMigration{Version: version}
+	}
+	return applied
+}
+
+func migrationVersions(migrations []Migration) []int64 {
+	var versions []int64
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+	return versions
+}
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	names := make(map[string]bool)
+	for i, migration := range Migrations {
+		if i > 0 && migration.Version <= Migrations[i-1].Version {
+			t.Errorf("migration %d follows migration %d", migration.Version, Migrations[i-1].Version)
+		}
+		if names[migration.Name] {
+			t.Errorf("migration name %s is used twice", migration.Name)
+		}
+		names[migration.Name] = true
+		if migration.Up == nil {
+			t.Errorf("migration %d has no up step", migration.Version)
+		}
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied []int64
+		target  int64
+		want    []int64
+	}{
+		{"fresh database", nil, 0, []int64{1, 2, 3, 4, 5, 6, 7}},
+		{"fresh database to a target", nil, 3, []int64{1, 2, 3}},
+		{"partly applied", []int64{1, 2, 3}, 0, []int64{4, 5, 6, 7}},
+		{"gap filled in order", []int64{1, 3, 5}, 0, []int64{2, 4, 6, 7}},
+		{"target already reached", []int64{1, 2, 3}, 2, nil},
+		{"everything applied", []int64{1, 2, 3, 4, 5, 6, 7}, 0, nil},
+		{"applied by a newer build", []int64{1, 2, 3, 4, 5, 6, 7, 8}, 0, nil},
+	}
+
+	for _, test := range tests {
+		got := migrationVersions(pendingMigrations(Migrations, appliedVersions(test.applied...), test.target))
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: pending %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRollbackMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied []int64
+		steps   int
+		want    []int64
+		err     error
+	}{
+		{"newest first", []int64{1, 2, 3, 4, 5, 6, 7}, 2, []int64{7, 6}, nil},
+		{"skips unapplied", []int64{1, 2, 3, 6}, 2, []int64{6, 3}, nil},
+		{"no steps", []int64{1, 2, 3}, 0, nil, nil},
+		{"nothing applied", nil, 3, nil, nil},
+		{"stops at irreversible migration 2", []int64{1, 2, 3, 4}, 5, []int64{4, 3}, ErrIrreversible},
+		{"irreversible migration 2 first", []int64{1, 2}, 1, nil, ErrIrreversible},
+		{"past irreversible migration 2 when it isn't applied", []int64{1, 3}, 5, []int64{3, 1}, nil},
+		{"steps end before migration 2", []int64{1, 2, 3}, 1, []int64{3}, nil},
+	}
+
+	for _, test := range tests {
+		rollback, err := rollbackMigrations(Migrations, appliedVersions(test.applied...), test.steps)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.err)
+		}
+		if got := migrationVersions(rollback); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: rolls back %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// fakeLock keeps the migration lock in memory, taken the way the lock document's upsert takes it
+type fakeLock struct {
+	mu       sync.Mutex
+	owner    string
+	until    time.Time
+	renewals int
+	renewErr error
+}
+
+func (l *fakeLock) acquire(ctx context.Context, owner string, now, until time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.owner != "" && !l.until.Before(now) {
+		return ErrMigrationLocked
+	}
+	l.owner, l.until = owner, until
+	return nil
+}
+
+func (l *fakeLock) renew(ctx context.Context, owner string, until time.Time) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.renewErr != nil {
+		return false, l.renewErr
+	}
+	if l.owner != owner {
+		return false, nil
+	}
+	l.until = until
+	l.renewals++
+	return true, nil
+}
+
+func (l *fakeLock) release(ctx context.Context, owner string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.owner == owner {
+		l.owner, l.until = "", time.Time{}
+	}
+	return nil
+}
+
+func (l *fakeLock) set(owner string, renewErr error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.owner, l.renewErr = owner, renewErr
+}
+
+func TestMigrationLockLease(t *testing.T) {
+	lock := &fakeLock{}
+	ctx := context.Background()
+
+	// Without renewals the lease runs out
+	_, releaseA, err := holdMigrationLock(ctx, lock, "a", 50*time.Millisecond, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := holdMigrationLock(ctx, lock, "b", time.Hour, time.Hour); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("locking a held lock = %v, want %v", err, ErrMigrationLocked)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	_, releaseB, err := holdMigrationLock(ctx, lock, "b", time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("locking after the lease ran out: %v", err)
+	}
+	defer releaseB()
+
+	// The expired holder releasing doesn't free the lock it lost
+	releaseA()
+	if _, _, err := holdMigrationLock(ctx, lock, "c", time.Hour, time.Hour); !errors.Is(err, ErrMigrationLocked) {
+		t.Errorf("locking after the previous holder released = %v, want %v", err, ErrMigrationLocked)
+	}
+}
+
+func TestMigrationLockRenewal(t *testing.T) {
+	lock := &fakeLock{}
+	parent, cancel := context.WithCancel(context.Background())
+
+	ctx, release, err := holdMigrationLock(parent, lock, "a", 40*time.Millisecond, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Held well past its first lease
+	time.Sleep(120 * time.Millisecond)
+	if _, _, err := holdMigrationLock(context.Background(), lock, "b", time.Hour, time.Hour); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("locking a renewed lock = %v, want %v", err, ErrMigrationLocked)
+	}
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("a renewed lock's context ended: %v", err)
+	}
+	lock.mu.Lock()
+	renewals := lock.renewals
+	lock.mu.Unlock()
+	if renewals == 0 {
+		t.Fatal("the lease was never renewed")
+	}
+
+	// Releasing works even once the caller's context has ended
+	cancel()
+	release()
+	if _, releaseB, err := holdMigrationLock(context.Background(), lock, "b", time.Hour, time.Hour); err != nil {
+		t.Errorf("locking a released lock: %v", err)
+	} else {
+		releaseB()
+	}
+}
+
+func TestMigrationLockLost(t *testing.T) {
+	lock := &fakeLock{}
+
+	ctx, release, err := holdMigrationLock(context.Background(), lock, "a", time.Hour, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// Failed renewals are retried, the lease may outlast them
+	lock.set("a", errors.New("connection reset"))
+	time.Sleep(30 * time.Millisecond)
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("a failed renewal ended the context: %v", err)
+	}
+
+	// Another runner took the lock over
+	lock.set("b", nil)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the context outlived the lock")
+	}
+}
+
+func TestLockError(t *testing.T) {
+	duplicate := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}}
+	other := errors.New("server selection timeout")
+
+	if err := lockError(nil); err != nil {
+		t.Errorf("lockError(nil) = %v", err)
+	}
+	if err := lockError(duplicate); !errors.Is(err, ErrMigrationLocked) {
+		t.Errorf("lockError(duplicate key) = %v, want %v", err, ErrMigrationLocked)
+	}
+	if err := lockError(other); errors.Is(err, ErrMigrationLocked) || !errors.Is(err, other) {
+		t.Errorf("lockError(%v) = %v", other, err)
+	}
+}
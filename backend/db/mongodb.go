@@ -12,8 +12,6 @@ import (
 )
 
 // Client represents a MongoDB database client
-var MongoClient Client
-
 type Client struct {
 	Client   *mongo.Client
 	Database *mongo.Database
@@ -55,15 +53,13 @@ func NewClient(config *Config) (*Client, error) {
 	// Get database
 	database := client.Database(config.Database)
 
-	MongoClient = Client{
+	log.Printf("✅ Connected to MongoDB database: %s", config.Database)
+
+	return &Client{
 		Client:   client,
 		Database: database,
 		Config:   config,
-	}
-
-	log.Printf("✅ Connected to MongoDB database: %s", config.Database)
-
-	return &MongoClient, nil
+	}, nil
 }
 
 // Close closes the MongoDB connection
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -27,10 +28,17 @@ type Chain struct {
 	Chain     string             `bson:"chain" json:"chain"`
 	RPC       string             `bson:"rpc" json:"rpc"`
 	ChainID   string             `bson:"chain_id" json:"chain_id"`
+	TxType    string             `bson:"tx_type,omitempty" json:"tx_type,omitempty"` // transaction type last used to submit, see TxType constants
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
+// Transaction types recorded per chain
+const (
+	TxTypeLegacy     = "legacy"
+	TxTypeDynamicFee = "dynamic_fee"
+)
+
 // Property represents a property document in MongoDB
 type Property struct {
 	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
@@ -41,124 +49,171 @@ type Property struct {
 	PropertyAddress string             `bson:"property_address" json:"property_address"`
 	Description     string             `bson:"description" json:"description"`
 	Image           string             `bson:"image" json:"image"`
+	ImageVariants   *ImageVariants     `bson:"image_variants,omitempty" json:"image_variants,omitempty"`
 	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
+// ImageVariants holds the URLs of an image's processed sizes
+type ImageVariants struct {
+	Thumbnail string `bson:"thumbnail" json:"thumbnail"`
+	Card      string `bson:"card" json:"card"`
+	Full      string `bson:"full" json:"full"`
+}
+
+// URLs returns the distinct variant URLs
+func (v *ImageVariants) URLs() []string {
+	var urls []string
+	for _, url := range []string{v.Thumbnail, v.Card, v.Full} {
+		if url == "" {
+			continue
+		}
+		seen := false
+		for _, existing := range urls {
+			seen = seen || existing == url
+		}
+		if !seen {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
 // Listing represents a listing document in MongoDB
 type Listing struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	PropertyID string             `bson:"property_id" json:"property_id"`
 	Date       string             `bson:"date" json:"date"`
+	Day        int64              `bson:"day" json:"-"` // Date as a number, for range queries
 	IPFSHash   string             `bson:"ipfs_hash" json:"ipfs_hash"`
 	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
-// QueryResult represents a query result with metadata
-type QueryResult struct {
-	Data  []map[string]interface{} `json:"data"`
-	Count int64                    `json:"count"`
+// PropertyUpdate lists the property fields to set. Nil fields are left as they are.
+type PropertyUpdate struct {
+	IPFSHash        *string
+	WalletAddress   *string
+	PropertyName    *string
+	PropertyAddress *string
+	Description     *string
+	Image           *string
+	// ImageVariants replaces the image variants and moves the property's image references to them
+	ImageVariants *ImageVariants
 }
 
-// InsertResult represents an insert operation result
-type InsertResult struct {
-	InsertedCount int64                `json:"inserted_count"`
-	InsertedIDs   []primitive.ObjectID `json:"inserted_ids,omitempty"`
-	Error         error                `json:"error,omitempty"`
+// set returns the $set document for the update
+func (u *PropertyUpdate) set() bson.D {
+	var set bson.D
+	if u.IPFSHash != nil {
+		set = append(set, bson.E{Key: "ipfs_hash", Value: *u.IPFSHash})
+	}
+	if u.WalletAddress != nil {
+		set = append(set, bson.E{Key: "wallet_address", Value: *u.WalletAddress})
+	}
+	if u.PropertyName != nil {
+		set = append(set, bson.E{Key: "property_name", Value: *u.PropertyName})
+	}
+	if u.PropertyAddress != nil {
+		set = append(set, bson.E{Key: "property_address", Value: *u.PropertyAddress})
+	}
+	if u.Description != nil {
+		set = append(set, bson.E{Key: "description", Value: *u.Description})
+	}
+	if u.Image != nil {
+		set = append(set, bson.E{Key: "image", Value: *u.Image})
+	}
+	if u.ImageVariants != nil {
+		set = append(set, bson.E{Key: "image_variants", Value: u.ImageVariants})
+	}
+	return set
 }
 
-// InitializeCollections creates the necessary collections and indexes if they don't exist
-func (c *Client) InitializeCollections(ctx context.Context) error {
-	// Create contracts collection with unique index on type
-	contractsCollection := c.GetCollection("contracts")
-
-	// Create unique index on type field
-	contractsIndexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "type", Value: 1}},
-		Options: options.Index().SetUnique(true),
+// apply sets the update's fields on a property
+func (u *PropertyUpdate) apply(property *Property) {
+	if u.IPFSHash != nil {
+		property.IPFSHash = *u.IPFSHash
 	}
-
-	if _, err := contractsCollection.Indexes().CreateOne(ctx, contractsIndexModel); err != nil {
-		// Index might already exist, log but don't fail
-		log.Printf("Info: contracts index creation: %v", err)
+	if u.WalletAddress != nil {
+		property.WalletAddress = *u.WalletAddress
 	}
-
-	// Create chains collection with unique index on chain
-	chainsCollection := c.GetCollection("chains")
-
-	// Create unique index on chain field
-	chainsIndexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "chain", Value: 1}},
-		Options: options.Index().SetUnique(true),
+	if u.PropertyName != nil {
+		property.PropertyName = *u.PropertyName
 	}
-
-	if _, err := chainsCollection.Indexes().CreateOne(ctx, chainsIndexModel); err != nil {
-		// Index might already exist, log but don't fail
-		log.Printf("Info: chains index creation: %v", err)
+	if u.PropertyAddress != nil {
+		property.PropertyAddress = *u.PropertyAddress
+	}
+	if u.Description != nil {
+		property.Description = *u.Description
 	}
+	if u.Image != nil {
+		property.Image = *u.Image
+	}
+	if u.ImageVariants != nil {
+		variants := *u.ImageVariants
+		property.ImageVariants = &variants
+	}
+}
 
-	// Create properties collection with unique index on property_id
-	propertiesCollection := c.GetCollection("properties")
+// ListingUpdate lists the listing fields to set. Nil fields are left as they are.
+type ListingUpdate struct {
+	IPFSHash *string
+}
 
-	// Create unique index on property_id field
-	propertiesIndexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "property_id", Value: 1}},
-		Options: options.Index().SetUnique(true),
+// set returns the $set document for the update
+func (u *ListingUpdate) set() bson.D {
+	var set bson.D
+	if u.IPFSHash != nil {
+		set = append(set, bson.E{Key: "ipfs_hash", Value: *u.IPFSHash})
 	}
+	return set
+}
 
-	if _, err := propertiesCollection.Indexes().CreateOne(ctx, propertiesIndexModel); err != nil {
-		// Index might already exist, log but don't fail
-		log.Printf("Info: properties index creation: %v", err)
+// apply sets the update's fields on a listing
+func (u *ListingUpdate) apply(listing *Listing) {
+	if u.IPFSHash != nil {
+		listing.IPFSHash = *u.IPFSHash
 	}
+}
 
-	// Create listings collection with compound index on property_id and date
-	listingsCollection := c.GetCollection("listings")
+// QueryResult represents a query result with metadata
+type QueryResult struct {
+	Data  []map[string]interface{} `json:"data"`
+	Count int64                    `json:"count"`
+}
 
-	// Create compound index on property_id and date fields
-	listingsIndexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "property_id", Value: 1}, {Key: "date", Value: 1}},
-		Options: options.Index().SetUnique(true),
-	}
+// InsertResult represents an insert operation result
+type InsertResult struct {
+	InsertedCount int64                `json:"inserted_count"`
+	InsertedIDs   []primitive.ObjectID `json:"inserted_ids,omitempty"`
+	Error         error                `json:"error,omitempty"`
+}
 
-	if _, err := listingsCollection.Indexes().CreateOne(ctx, listingsIndexModel); err != nil {
-		// Index might already exist, log but don't fail
-		log.Printf("Info: listings index creation: %v", err)
+// InitializeCollections brings the collections, their indexes and validators up to date by applying
+// pending migrations
+func (c *Client) InitializeCollections(ctx context.Context) error {
+	applied, err := c.MigrateUp(ctx, 0)
+	for _, migration := range applied {
+		log.Printf("🧹 Applied migration %d %s", migration.Version, migration.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	return nil
 }
 
-// SeedInitialData inserts initial data into the collections
+// SeedInitialData inserts initial data into the collections. Contracts are only seeded from
+// MARKETPLACE_CONTRACT_ADDRESS and PROPERTY_CONTRACT_ADDRESS when set.
 func (c *Client) SeedInitialData(ctx context.Context) error {
 	now := time.Now()
 
-	// Check if contracts collection has data
-	contractsCollection := c.GetCollection("contracts")
-	contractCount, err := contractsCollection.CountDocuments(ctx, bson.D{})
-	if err != nil {
-		return fmt.Errorf("failed to check contracts count: %w", err)
-	}
-
-	// Insert initial contract data if collection is empty
-	if contractCount == 0 {
-		contracts := []interface{}{
-			Contract{
-				Type:            "marketplace",
-				ContractAddress: "0x...", // Replace with actual marketplace contract address
-				CreatedAt:       now,
-				UpdatedAt:       now,
-			},
-			Contract{
-				Type:            "property",
-				ContractAddress: "0x...", // Replace with actual property contract address
-				CreatedAt:       now,
-				UpdatedAt:       now,
-			},
+	for contractType, address := range contractAddressesFromEnv() {
+		if address == "" {
+			continue
 		}
-
-		if _, err := contractsCollection.InsertMany(ctx, contracts); err != nil {
-			return fmt.Errorf("failed to insert initial contracts: %w", err)
+		if err := c.InsertOrUpdateContract(ctx, contractType, address); err != nil {
+			return fmt.Errorf("failed to seed %s contract: %w", contractType, err)
 		}
 	}
 
@@ -198,7 +253,7 @@ func (c *Client) GetContract(ctx context.Context, contractType string) (*Contrac
 
 	if err := collection.FindOne(ctx, filter).Decode(&contract); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("contract type '%s' not found", contractType)
+			return nil, fmt.Errorf("contract type '%s' %w", contractType, ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get contract: %w", err)
 	}
@@ -215,7 +270,7 @@ func (c *Client) GetChain(ctx context.Context, chainName string) (*Chain, error)
 
 	if err := collection.FindOne(ctx, filter).Decode(&chain); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("chain '%s' not found", chainName)
+			return nil, fmt.Errorf("chain '%s' %w", chainName, ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get chain: %w", err)
 	}
@@ -223,6 +278,30 @@ func (c *Client) GetChain(ctx context.Context, chainName string) (*Chain, error)
 	return &chain, nil
 }
 
+// UpdateChainTxType records which transaction type is used to submit transactions on a chain
+func (c *Client) UpdateChainTxType(ctx context.Context, chainName, txType string) error {
+	collection := c.GetCollection("chains")
+
+	filter := bson.D{{Key: "chain", Value: chainName}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "tx_type", Value: txType},
+			{Key: "updated_at", Value: time.Now()},
+		}},
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update chain tx type: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("chain '%s' %w", chainName, ErrNotFound)
+	}
+
+	return nil
+}
+
 // UpdateContractAddress updates a contract address in the database
 func (c *Client) UpdateContractAddress(ctx context.Context, contractType, contractAddress string) error {
 	collection := c.GetCollection("contracts")
@@ -241,7 +320,7 @@ func (c *Client) UpdateContractAddress(ctx context.Context, contractType, contra
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("contract type '%s' not found", contractType)
+		return fmt.Errorf("contract type '%s' %w", contractType, ErrNotFound)
 	}
 
 	return nil
@@ -328,7 +407,7 @@ func (c *Client) GetPropertyByID(ctx context.Context, propertyID string) (*Prope
 
 	if err := collection.FindOne(ctx, filter).Decode(&property); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("property with ID '%s' not found", propertyID)
+			return nil, fmt.Errorf("property with ID '%s' %w", propertyID, ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get property: %w", err)
 	}
@@ -356,12 +435,12 @@ func (c *Client) GetPropertiesByWallet(ctx context.Context, walletAddress string
 }
 
 // UpdateProperty updates an existing property
-func (c *Client) UpdateProperty(ctx context.Context, propertyID string, updates bson.D) error {
+func (c *Client) UpdateProperty(ctx context.Context, propertyID string, updates *PropertyUpdate) error {
 	collection := c.GetCollection("properties")
 
 	filter := bson.D{{Key: "property_id", Value: propertyID}}
 	update := bson.D{
-		{Key: "$set", Value: append(updates, bson.E{Key: "updated_at", Value: time.Now()})},
+		{Key: "$set", Value: append(updates.set(), bson.E{Key: "updated_at", Value: time.Now()})},
 	}
 
 	result, err := collection.UpdateOne(ctx, filter, update)
@@ -370,20 +449,52 @@ func (c *Client) UpdateProperty(ctx context.Context, propertyID string, updates
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("property with ID '%s' not found", propertyID)
+		return fmt.Errorf("property with ID '%s' %w", propertyID, ErrNotFound)
+	}
+
+	// The replaced images lose this property's references and the new ones gain them
+	if updates.ImageVariants != nil {
+		if err := c.ReleaseImageRefs(ctx, propertyID); err != nil {
+			return err
+		}
+		for _, url := range updates.ImageVariants.URLs() {
+			if err := c.AddImageRef(ctx, url, propertyID); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+// DeleteProperty removes a property and releases its image references
+func (c *Client) DeleteProperty(ctx context.Context, propertyID string) error {
+	collection := c.GetCollection("properties")
+
+	result, err := collection.DeleteOne(ctx, bson.D{{Key: "property_id", Value: propertyID}})
+	if err != nil {
+		return fmt.Errorf("failed to delete property: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("property with ID '%s' %w", propertyID, ErrNotFound)
+	}
+
+	return c.ReleaseImageRefs(ctx, propertyID)
+}
+
 // InsertListing inserts a new listing into the database
 func (c *Client) InsertListing(ctx context.Context, listing *Listing) error {
 	collection := c.GetCollection("listings")
 
+	day, err := ListingDay(listing.Date)
+	if err != nil {
+		return fmt.Errorf("failed to insert listing: %w", err)
+	}
+	listing.Day = day
 	listing.CreatedAt = time.Now()
 	listing.UpdatedAt = time.Now()
 
-	_, err := collection.InsertOne(ctx, listing)
+	_, err = collection.InsertOne(ctx, listing)
 	if err != nil {
 		return fmt.Errorf("failed to insert listing: %w", err)
 	}
@@ -400,7 +511,7 @@ func (c *Client) GetListingByPropertyAndDate(ctx context.Context, propertyID, da
 
 	if err := collection.FindOne(ctx, filter).Decode(&listing); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("listing for property '%s' and date '%s' not found", propertyID, date)
+			return nil, fmt.Errorf("listing for property '%s' and date '%s' %w", propertyID, date, ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get listing: %w", err)
 	}
@@ -413,7 +524,34 @@ func (c *Client) GetListingsByProperty(ctx context.Context, propertyID string) (
 	collection := c.GetCollection("listings")
 
 	filter := bson.D{{Key: "property_id", Value: propertyID}}
-	cursor, err := collection.Find(ctx, filter)
+	return findListings(ctx, collection, filter, options.Find())
+}
+
+// GetListingsByPropertyInRange retrieves a property's listings with from <= day <= to, ordered by day
+func (c *Client) GetListingsByPropertyInRange(ctx context.Context, propertyID string, from, to int64) ([]Listing, error) {
+	collection := c.GetCollection("listings")
+
+	filter := bson.D{
+		{Key: "property_id", Value: propertyID},
+		{Key: "day", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lte", Value: to}}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "day", Value: 1}})
+
+	return findListings(ctx, collection, filter, opts)
+}
+
+// ListingDay parses a listing's date, the contract's day number
+func ListingDay(date string) (int64, error) {
+	day, err := strconv.ParseInt(date, 10, 64)
+	if err != nil || day < 0 {
+		return 0, fmt.Errorf("listing date '%s' is not a day number", date)
+	}
+	return day, nil
+}
+
+// findListings runs a listings query and decodes every match
+func findListings(ctx context.Context, collection *mongo.Collection, filter bson.D, opts *options.FindOptions) ([]Listing, error) {
+	cursor, err := collection.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find listings: %w", err)
 	}
@@ -428,12 +566,12 @@ func (c *Client) GetListingsByProperty(ctx context.Context, propertyID string) (
 }
 
 // UpdateListing updates an existing listing
-func (c *Client) UpdateListing(ctx context.Context, propertyID, date string, updates bson.D) error {
+func (c *Client) UpdateListing(ctx context.Context, propertyID, date string, updates *ListingUpdate) error {
 	collection := c.GetCollection("listings")
 
 	filter := bson.D{{Key: "property_id", Value: propertyID}, {Key: "date", Value: date}}
 	update := bson.D{
-		{Key: "$set", Value: append(updates, bson.E{Key: "updated_at", Value: time.Now()})},
+		{Key: "$set", Value: append(updates.set(), bson.E{Key: "updated_at", Value: time.Now()})},
 	}
 
 	result, err := collection.UpdateOne(ctx, filter, update)
@@ -442,12 +580,13 @@ func (c *Client) UpdateListing(ctx context.Context, propertyID, date string, upd
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("listing for property '%s' and date '%s' not found", propertyID, date)
+		return fmt.Errorf("listing for property '%s' and date '%s' %w", propertyID, date, ErrNotFound)
 	}
 
 	return nil
 }
 
+// GetProperties retrieves every property
 func (c *Client) GetProperties(ctx context.Context) ([]Property, error) {
 	collection := c.GetCollection("properties")
 	cursor, err := collection.Find(ctx, bson.D{})
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is wrapped by repository lookups and updates that match no document
+var ErrNotFound = errors.New("not found")
+
+// PropertyRepository stores property documents
+type PropertyRepository interface {
+	InsertProperty(ctx context.Context, property *Property) error
+	GetPropertyByID(ctx context.Context, propertyID string) (*Property, error)
+	GetPropertiesByWallet(ctx context.Context, walletAddress string) ([]Property, error)
+	GetProperties(ctx context.Context) ([]Property, error)
+	// UpdateProperty sets the update's non-nil fields. Setting ImageVariants moves the property's
+	// image references to the new images.
+	UpdateProperty(ctx context.Context, propertyID string, updates *PropertyUpdate) error
+	// DeleteProperty removes a property and releases its image references
+	DeleteProperty(ctx context.Context, propertyID string) error
+}
+
+// ListingRepository stores listing documents, one per property and date
+type ListingRepository interface {
+	InsertListing(ctx context.Context, listing *Listing) error
+	GetListingByPropertyAndDate(ctx context.Context, propertyID, date string) (*Listing, error)
+	GetListingsByProperty(ctx context.Context, propertyID string) ([]Listing, error)
+	// GetListingsByPropertyInRange returns listings whose day number is in [from, to], ordered by day
+	GetListingsByPropertyInRange(ctx context.Context, propertyID string, from, to int64) ([]Listing, error)
+	// UpdateListing sets the update's non-nil fields
+	UpdateListing(ctx context.Context, propertyID, date string, updates *ListingUpdate) error
+}
+
+// ChainRepository stores chain and contract configuration
+type ChainRepository interface {
+	GetChain(ctx context.Context, chainName string) (*Chain, error)
+	UpdateChainTxType(ctx context.Context, chainName, txType string) error
+	GetContract(ctx context.Context, contractType string) (*Contract, error)
+	UpdateContractAddress(ctx context.Context, contractType, contractAddress string) error
+	InsertOrUpdateContract(ctx context.Context, contractType, contractAddress string) error
+}
+
+// FileRepository catalogs uploaded files
+type FileRepository interface {
+	SaveFile(ctx context.Context, file *StoredFile) error
+	GetFileByHash(ctx context.Context, hash string) (*StoredFile, error)
+	GetFileByContentHash(ctx context.Context, backend, contentHash string) (*StoredFile, error)
+	GetFileUploaders(ctx context.Context, hash string) ([]string, error)
+	ListFilesByUploader(ctx context.Context, wallet, backend string, page, limit int64) ([]StoredFile, int64, error)
+	GetFileStatsByUploader(ctx context.Context, wallet string) (*FileStats, error)
+	LinkFileToProperty(ctx context.Context, url, propertyID string) error
+	DeleteFilesByURL(ctx context.Context, url string) error
+}
+
+// ImageRepository indexes stored images by content hash and counts the properties referencing them
+type ImageRepository interface {
+	TouchImage(ctx context.Context, hash, backend string) (*Image, error)
+	SaveImage(ctx context.Context, image *Image) error
+	AddImageRef(ctx context.Context, url, propertyID string) error
+	ListUnreferencedImages(ctx context.Context, before time.Time, limit int64) ([]Image, error)
+	ClaimUnreferencedImage(ctx context.Context, hash, backend string, before time.Time) (bool, error)
+	ReleaseImageClaim(ctx context.Context, hash, backend string) error
+	DeleteImage(ctx context.Context, hash, backend string) error
+}
+
+// SettlementRepository reads indexed settlement events
+type SettlementRepository interface {
+	GetSettlementEvents(ctx context.Context, eventName, propertyID, date string, confirmed bool) ([]SettlementEvent, error)
+}
+
+// BlockRepository stores the block hashes and checkpoints of block cursors, and the documents
+// they derive from each block
+type BlockRepository interface {
+	GetCheckpoint(ctx context.Context, name string) (*IndexerCheckpoint, error)
+	SaveCheckpoint(ctx context.Context, name, chain string, blockNumber uint64, blockHash string) error
+	SaveBlock(ctx context.Context, block *IndexedBlock) error
+	GetBlocksDescending(ctx context.Context, cursorName string, limit int64) ([]IndexedBlock, error)
+	DeleteBlocksAfter(ctx context.Context, cursorName string, number uint64) error
+	PruneBlocksBefore(ctx context.Context, cursorName string, number uint64) error
+	RewindDerived(ctx context.Context, collections []string, forkPoint uint64) (int64, error)
+	ConfirmDerived(ctx context.Context, collections []string, number uint64) error
+}
+
+// TransactionRepository tracks transactions submitted by the backend
+type TransactionRepository interface {
+	InsertTransaction(ctx context.Context, tx *Transaction) error
+	GetTransactionByHash(ctx context.Context, hash string) (*Transaction, error)
+	GetPendingTransactions(ctx context.Context, chain string) ([]Transaction, error)
+	// UpdateTransaction sets the update's non-nil fields
+	UpdateTransaction(ctx context.Context, hash string, updates *TransactionUpdate) error
+	SettleNonce(ctx context.Context, chain, from string, nonce uint64, minedHash string) error
+}
+
+// SessionRepository stores Sign-In With Ethereum nonces and sessions
+type SessionRepository interface {
+	InsertAuthNonce(ctx context.Context, nonce *AuthNonce) error
+	ConsumeAuthNonce(ctx context.Context, nonce string) error
+	InsertSession(ctx context.Context, session *Session) error
+	GetSession(ctx context.Context, tokenHash string) (*Session, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+}
+
+var (
+	_ PropertyRepository    = (*Client)(nil)
+	_ ListingRepository     = (*Client)(nil)
+	_ ChainRepository       = (*Client)(nil)
+	_ FileRepository        = (*Client)(nil)
+	_ ImageRepository       = (*Client)(nil)
+	_ SettlementRepository  = (*Client)(nil)
+	_ BlockRepository       = (*Client)(nil)
+	_ TransactionRepository = (*Client)(nil)
+	_ SessionRepository     = (*Client)(nil)
+)
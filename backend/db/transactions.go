@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TransactionsCollection stores every transaction submitted by the backend
+const TransactionsCollection = "transactions"
+
+// Transaction statuses
+const (
+	TxStatusPending  = "pending"
+	TxStatusMined    = "mined"
+	TxStatusFailed   = "failed"
+	TxStatusReplaced = "replaced"
+)
+
+// TxReceipt represents the receipt fields stored with a mined transaction
+type TxReceipt struct {
+	BlockNumber      uint64 `bson:"block_number" json:"block_number"`
+	BlockHash        string `bson:"block_hash" json:"block_hash"`
+	GasUsed          uint64 `bson:"gas_used" json:"gas_used"`
+	Status           uint64 `bson:"status" json:"status"`
+	ContractAddress  string `bson:"contract_address,omitempty" json:"contract_address,omitempty"`
+	TransactionIndex uint   `bson:"transaction_index" json:"transaction_index"`
+}
+
+// Transaction represents a submitted transaction document in MongoDB
+type Transaction struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Hash        string             `bson:"hash" json:"hash"`
+	Chain       string             `bson:"chain" json:"chain"`
+	From        string             `bson:"from" json:"from"`
+	To          string             `bson:"to" json:"to"`
+	Nonce       uint64             `bson:"nonce" json:"nonce"`
+	Data        string             `bson:"data" json:"data"`
+	Value       string             `bson:"value" json:"value"`
+	GasLimit    uint64             `bson:"gas_limit" json:"gas_limit"`
+	TxType      string             `bson:"tx_type" json:"tx_type"`
+	GasPrice    string             `bson:"gas_price,omitempty" json:"gas_price,omitempty"`
+	GasTipCap   string             `bson:"gas_tip_cap,omitempty" json:"gas_tip_cap,omitempty"`
+	GasFeeCap   string             `bson:"gas_fee_cap,omitempty" json:"gas_fee_cap,omitempty"`
+	Attempt     int                `bson:"attempt" json:"attempt"`
+	Status      string             `bson:"status" json:"status"`
+	ReplacedBy  string             `bson:"replaced_by,omitempty" json:"replaced_by,omitempty"`
+	Receipt     *TxReceipt         `bson:"receipt,omitempty" json:"receipt,omitempty"`
+	SubmittedAt time.Time          `bson:"submitted_at" json:"submitted_at"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// TransactionUpdate lists the transaction fields to set. Nil fields are left as they are.
+type TransactionUpdate struct {
+	Status     *string
+	ReplacedBy *string
+	Receipt    *TxReceipt
+}
+
+// set returns the $set document for the update
+func (u *TransactionUpdate) set() bson.D {
+	var set bson.D
+	if u.Status != nil {
+		set = append(set, bson.E{Key: "status", Value: *u.Status})
+	}
+	if u.ReplacedBy != nil {
+		set = append(set, bson.E{Key: "replaced_by", Value: *u.ReplacedBy})
+	}
+	if u.Receipt != nil {
+		set = append(set, bson.E{Key: "receipt", Value: u.Receipt})
+	}
+	return set
+}
+
+// apply sets the update's fields on a transaction
+func (u *TransactionUpdate) apply(tx *Transaction) {
+	if u.Status != nil {
+		tx.Status = *u.Status
+	}
+	if u.ReplacedBy != nil {
+		tx.ReplacedBy = *u.ReplacedBy
+	}
+	if u.Receipt != nil {
+		receipt := *u.Receipt
+		tx.Receipt = &receipt
+	}
+}
+
+// InsertTransaction inserts a newly submitted transaction into the database
+func (c *Client) InsertTransaction(ctx context.Context, tx *Transaction) error {
+	collection := c.GetCollection(TransactionsCollection)
+
+	tx.CreatedAt = time.Now()
+	tx.UpdatedAt = time.Now()
+
+	if _, err := collection.InsertOne(ctx, tx); err != nil {
+		return fmt.Errorf("failed to insert transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetTransactionByHash retrieves a transaction by its hash
+func (c *Client) GetTransactionByHash(ctx context.Context, hash string) (*Transaction, error) {
+	collection := c.GetCollection(TransactionsCollection)
+
+	var tx Transaction
+	filter := bson.D{{Key: "hash", Value: hash}}
+
+	if err := collection.FindOne(ctx, filter).Decode(&tx); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("transaction '%s' %w", hash, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	return &tx, nil
+}
+
+// GetPendingTransactions retrieves all pending transactions for a chain, oldest first
+func (c *Client) GetPendingTransactions(ctx context.Context, chain string) ([]Transaction, error) {
+	collection := c.GetCollection(TransactionsCollection)
+
+	filter := bson.D{{Key: "chain", Value: chain}, {Key: "status", Value: TxStatusPending}}
+	opts := options.Find().SetSort(bson.D{{Key: "nonce", Value: 1}, {Key: "attempt", Value: 1}})
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pending transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var txs []Transaction
+	if err := cursor.All(ctx, &txs); err != nil {
+		return nil, fmt.Errorf("failed to decode transactions: %w", err)
+	}
+
+	return txs, nil
+}
+
+// UpdateTransaction updates an existing transaction by hash
+func (c *Client) UpdateTransaction(ctx context.Context, hash string, updates *TransactionUpdate) error {
+	collection := c.GetCollection(TransactionsCollection)
+
+	filter := bson.D{{Key: "hash", Value: hash}}
+	update := bson.D{
+		{Key: "$set", Value: append(updates.set(), bson.E{Key: "updated_at", Value: time.Now()})},
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to update transaction: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("transaction '%s' %w", hash, ErrNotFound)
+	}
+
+	return nil
+}
+
+// SettleNonce marks every other pending attempt that shares a mined transaction's nonce as replaced
+func (c *Client) SettleNonce(ctx context.Context, chain, from string, nonce uint64, minedHash string) error {
+	collection := c.GetCollection(TransactionsCollection)
+
+	filter := bson.D{
+		{Key: "chain", Value: chain},
+		{Key: "from", Value: from},
+		{Key: "nonce", Value: nonce},
+		{Key: "status", Value: TxStatusPending},
+		{Key: "hash", Value: bson.D{{Key: "$ne", Value: minedHash}}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: TxStatusReplaced},
+			{Key: "updated_at", Value: time.Now()},
+		}},
+	}
+
+	if _, err := collection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to settle nonce: %w", err)
+	}
+
+	return nil
+}
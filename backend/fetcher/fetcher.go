@@ -0,0 +1,288 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrBlockedAddress is returned for URLs that resolve to loopback, private or otherwise internal addresses
+	ErrBlockedAddress = errors.New("address is not allowed")
+	// ErrInvalidURL is returned for URLs that aren't absolute http(s) URLs
+	ErrInvalidURL = errors.New("invalid URL")
+	// ErrTooManyRedirects is returned when a fetch follows more redirects than allowed
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrTooLarge is returned when a body exceeds the size limit
+	ErrTooLarge = errors.New("response too large")
+	// ErrUnexpectedType is returned when the body's sniffed content type isn't one the caller accepts
+	ErrUnexpectedType = errors.New("unexpected content type")
+	// ErrUpstream is returned when the remote server fails or doesn't respond in time
+	ErrUpstream = errors.New("remote server error")
+)
+
+// sniffLength is how much of the body is read to detect its content type
+const sniffLength = 512
+
+// Config holds fetcher configuration
+type Config struct {
+	Timeout      time.Duration
+	MaxBytes     int64
+	MaxRedirects int
+	// AllowPrivate disables the address filter, for development against local servers only
+	AllowPrivate bool
+}
+
+// NewConfigFromEnv creates a fetcher config for remote images from environment variables
+func NewConfigFromEnv() *Config {
+	config := &Config{
+		Timeout:      15 * time.Second,
+		MaxBytes:     20 << 20,
+		MaxRedirects: 3,
+		AllowPrivate: os.Getenv("IMAGE_FETCH_ALLOW_PRIVATE") == "true",
+	}
+
+	if d, err := time.ParseDuration(os.Getenv("IMAGE_FETCH_TIMEOUT")); err == nil && d > 0 {
+		config.Timeout = d
+	}
+	if n, err := strconv.ParseInt(os.Getenv("IMAGE_FETCH_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		config.MaxBytes = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("IMAGE_FETCH_MAX_REDIRECTS")); err == nil && n >= 0 {
+		config.MaxRedirects = n
+	}
+
+	return config
+}
+
+// Fetcher fetches untrusted URLs. Every connection, including those made for redirects, is checked
+// against the address filter after DNS resolution, so a hostname can't be pointed at an internal address.
+type Fetcher struct {
+	config     *Config
+	httpClient *http.Client
+}
+
+// Response is a fetched body whose content type has been sniffed
+type Response struct {
+	Body io.ReadCloser
+	// ContentType is the type sniffed from the body, not the one the server declared
+	ContentType string
+	// DeclaredType is the Content-Type header the server sent
+	DeclaredType string
+	// Size is the Content-Length, or -1 if unknown
+	Size int64
+}
+
+// New creates a fetcher
+func New(config *Config) *Fetcher {
+	dialer := &net.Dialer{
+		Timeout:   config.Timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	if !config.AllowPrivate {
+		dialer.Control = checkAddress
+	}
+
+	transport := &http.Transport{
+		// A proxy would make the connection we check be to the proxy, not the target
+		Proxy:                  nil,
+		DialContext:            dialer.DialContext,
+		TLSHandshakeTimeout:    config.Timeout,
+		ResponseHeaderTimeout:  config.Timeout,
+		MaxResponseHeaderBytes: 64 << 10,
+		MaxIdleConns:           10,
+		IdleConnTimeout:        30 * time.Second,
+	}
+
+	return &Fetcher{
+		config: config,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > config.MaxRedirects {
+					return ErrTooManyRedirects
+				}
+				return checkURL(req.URL)
+			},
+		},
+	}
+}
+
+// Get fetches a URL and checks that its body sniffs as one of the accepted content type prefixes,
+// e.g. "image/". The caller must close the body, which fails once it exceeds the size limit.
+func (f *Fetcher) Get(ctx context.Context, rawURL string, accept ...string) (*Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if err := checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		// Our own checks surface wrapped in a *url.Error
+		for _, known := range []error{ErrBlockedAddress, ErrInvalidURL, ErrTooManyRedirects} {
+			if errors.Is(err, known) {
+				return nil, err
+			}
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUpstream, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: status %d", ErrUpstream, resp.StatusCode)
+	}
+	if resp.ContentLength > f.config.MaxBytes {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %d bytes exceeds %d", ErrTooLarge, resp.ContentLength, f.config.MaxBytes)
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(resp.Body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %v", ErrUpstream, err)
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	if len(accept) > 0 {
+		accepted := false
+		for _, prefix := range accept {
+			accepted = accepted || strings.HasPrefix(contentType, prefix)
+		}
+		if !accepted {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%w: %s", ErrUnexpectedType, contentType)
+		}
+	}
+
+	// Replay the sniffed bytes ahead of the rest of the body
+	body := &limitedBody{
+		r: io.MultiReader(bytes.NewReader(head), resp.Body),
+		c: resp.Body,
+		n: f.config.MaxBytes,
+	}
+
+	return &Response{
+		Body:         body,
+		ContentType:  contentType,
+		DeclaredType: resp.Header.Get("Content-Type"),
+		Size:         resp.ContentLength,
+	}, nil
+}
+
+// checkURL accepts absolute http and https URLs only
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be http or https", ErrInvalidURL)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("%w: missing host", ErrInvalidURL)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials are not allowed", ErrInvalidURL)
+	}
+	return nil
+}
+
+// checkAddress is a dialer control function rejecting connections to internal addresses.
+// It runs after DNS resolution, on the address actually being connected to.
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublic(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
+
+// blockedNets lists special-purpose ranges the net.IP predicates don't cover
+var blockedNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",       // "this" network
+		"100.64.0.0/10",   // carrier-grade NAT
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // documentation
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // documentation
+		"203.0.113.0/24",  // documentation
+		"240.0.0.0/4",     // reserved, including broadcast
+		"64:ff9b::/96",    // NAT64, which can reach IPv4 internal addresses
+		"2001::/32",       // Teredo, which tunnels to an embedded IPv4 address
+		"2002::/16",       // 6to4, which tunnels to an embedded IPv4 address
+		"2001:db8::/32",   // documentation
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// isPublic reports whether an address is a globally routable unicast address
+func isPublic(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// limitedBody reads at most n bytes, failing with ErrTooLarge rather than truncating
+type limitedBody struct {
+	r io.Reader
+	c io.Closer
+	n int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return 0, fmt.Errorf("%w: exceeds size limit", ErrTooLarge)
+	}
+	return n, err
+}
+
+func (l *limitedBody) Close() error {
+	return l.c.Close()
+}
@@ -0,0 +1,282 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metaSuffix names the sidecar file holding a cached object's content type
+const metaSuffix = ".meta"
+
+// CacheEntry describes a cached object
+type CacheEntry struct {
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	ModTime     time.Time `json:"mod_time"`
+
+	accessed time.Time
+}
+
+// Cache is a size-limited disk cache of gateway content keyed by CID, evicting least recently used objects
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*CacheEntry
+	size    int64
+}
+
+// NewCache opens the cache in dir, picking up objects cached by earlier runs
+func NewCache(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+
+	c := &Cache{dir: dir, maxBytes: maxBytes, entries: make(map[string]*CacheEntry)}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %v", err)
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, metaSuffix) {
+			continue
+		}
+
+		cid := strings.TrimSuffix(name, metaSuffix)
+		entry, err := c.readEntry(cid)
+		if err != nil {
+			// Leftovers of an interrupted write, drop them
+			c.remove(cid)
+			continue
+		}
+		c.entries[cid] = entry
+		c.size += entry.Size
+	}
+
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// Open returns a cached object, the caller must close the file
+func (c *Cache) Open(cid string) (*os.File, *CacheEntry, bool) {
+	if !validKey(cid) {
+		return nil, nil, false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[cid]
+	if ok {
+		entry.accessed = time.Now()
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, nil, false
+	}
+
+	file, err := os.Open(c.path(cid))
+	if err != nil {
+		c.mu.Lock()
+		c.forget(cid)
+		c.mu.Unlock()
+		return nil, nil, false
+	}
+
+	return file, entry, true
+}
+
+// Create starts writing an object into the cache. Nothing is visible until Commit.
+func (c *Cache) Create(cid, contentType string) (*CacheWriter, error) {
+	if !validKey(cid) {
+		return nil, fmt.Errorf("invalid cache key '%s'", cid)
+	}
+
+	file, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache file: %v", err)
+	}
+
+	return &CacheWriter{cache: c, cid: cid, contentType: contentType, file: file}, nil
+}
+
+// Add copies a complete object from r into the cache
+func (c *Cache) Add(cid, contentType string, r io.ReaderAt) error {
+	w, err := c.Create(cid, contentType)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, io.NewSectionReader(r, 0, c.maxBytes+1)); err != nil {
+		w.Abort()
+		return err
+	}
+
+	return w.Commit()
+}
+
+// CacheWriter writes one object into the cache
+type CacheWriter struct {
+	cache       *Cache
+	cid         string
+	contentType string
+	file        *os.File
+	written     int64
+	failed      bool
+}
+
+// Write appends to the object. Write errors mark the object failed but are not returned,
+// so a broken cache never interrupts the response it is teed from.
+func (w *CacheWriter) Write(p []byte) (int, error) {
+	if w.failed {
+		return len(p), nil
+	}
+
+	n, err := w.file.Write(p)
+	w.written += int64(n)
+	if err != nil || w.written > w.cache.maxBytes {
+		w.failed = true
+	}
+	return len(p), nil
+}
+
+// Commit makes the object visible and evicts old objects to stay within the size limit
+func (w *CacheWriter) Commit() error {
+	if w.failed {
+		w.Abort()
+		return fmt.Errorf("cache write for %s failed", w.cid)
+	}
+
+	tmpName := w.file.Name()
+	if err := w.file.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to close cache file: %v", err)
+	}
+
+	c := w.cache
+	now := time.Now()
+	entry := &CacheEntry{Size: w.written, ContentType: w.contentType, ModTime: now, accessed: now}
+
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to encode cache entry: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(tmpName, c.path(w.cid)); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to store cache file: %v", err)
+	}
+	if err := os.WriteFile(c.path(w.cid)+metaSuffix, meta, 0644); err != nil {
+		c.remove(w.cid)
+		return fmt.Errorf("failed to store cache entry: %v", err)
+	}
+
+	c.forget(w.cid)
+	c.entries[w.cid] = entry
+	c.size += entry.Size
+	c.evict()
+
+	return nil
+}
+
+// Abort discards the object
+func (w *CacheWriter) Abort() {
+	name := w.file.Name()
+	w.file.Close()
+	os.Remove(name)
+}
+
+// evict removes least recently used objects until the cache fits, c.mu must be held
+func (c *Cache) evict() {
+	if c.size <= c.maxBytes {
+		return
+	}
+
+	cids := make([]string, 0, len(c.entries))
+	for cid := range c.entries {
+		cids = append(cids, cid)
+	}
+	sort.Slice(cids, func(i, j int) bool {
+		return c.entries[cids[i]].accessed.Before(c.entries[cids[j]].accessed)
+	})
+
+	for _, cid := range cids {
+		if c.size <= c.maxBytes {
+			break
+		}
+		c.forget(cid)
+		c.remove(cid)
+		log.Printf("🧹 Evicted %s from the IPFS cache", cid)
+	}
+}
+
+// forget drops an entry from the index, c.mu must be held
+func (c *Cache) forget(cid string) {
+	if entry, ok := c.entries[cid]; ok {
+		c.size -= entry.Size
+		delete(c.entries, cid)
+	}
+}
+
+// remove deletes an object's files
+func (c *Cache) remove(cid string) {
+	os.Remove(c.path(cid))
+	os.Remove(c.path(cid) + metaSuffix)
+}
+
+// readEntry loads an object's sidecar and checks the object is complete
+func (c *Cache) readEntry(cid string) (*CacheEntry, error) {
+	data, err := os.ReadFile(c.path(cid) + metaSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(c.path(cid))
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != entry.Size {
+		return nil, fmt.Errorf("cached size mismatch")
+	}
+
+	entry.accessed = info.ModTime()
+	return &entry, nil
+}
+
+func (c *Cache) path(cid string) string {
+	return filepath.Join(c.dir, cid)
+}
+
+// validKey accepts CID-shaped keys only, so keys can't escape the cache directory
+func validKey(key string) bool {
+	if key == "" || len(key) > 128 {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package gateway
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWeight is how much a new sample moves the latency average
+	latencyWeight = 0.3
+	// outcomeDecay ages old successes and failures so recovered gateways win back traffic
+	outcomeDecay = 0.9
+	// failuresBeforeCooldown is how many failures in a row take a gateway out of rotation
+	failuresBeforeCooldown = 3
+	// baseCooldown doubles for every further failure, up to maxCooldown
+	baseCooldown = 30 * time.Second
+	maxCooldown  = 5 * time.Minute
+	// defaultLatency is assumed for gateways that haven't answered yet
+	defaultLatency = 500 * time.Millisecond
+)
+
+// Gateway is one IPFS HTTP gateway and its observed health
+type Gateway struct {
+	Name    string
+	BaseURL string
+
+	mu                  sync.Mutex
+	latency             time.Duration
+	successes           float64
+	failures            float64
+	consecutiveFailures int
+	cooldownUntil       time.Time
+}
+
+// NewGateway creates a gateway serving CIDs under baseURL, e.g. https://ipfs.io/ipfs/
+func NewGateway(name, baseURL string) *Gateway {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &Gateway{Name: name, BaseURL: baseURL}
+}
+
+// URL returns the gateway URL for a CID
+func (g *Gateway) URL(cid string) string {
+	return g.BaseURL + cid
+}
+
+// recordSuccess updates the gateway's health after it answered in latency
+func (g *Gateway) recordSuccess(latency time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.latency == 0 {
+		g.latency = latency
+	} else {
+		g.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(g.latency))
+	}
+	g.successes = g.successes*outcomeDecay + 1
+	g.failures *= outcomeDecay
+	g.consecutiveFailures = 0
+	g.cooldownUntil = time.Time{}
+}
+
+// recordFailure updates the gateway's health after a failed request
+func (g *Gateway) recordFailure() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.failures = g.failures*outcomeDecay + 1
+	g.successes *= outcomeDecay
+	g.consecutiveFailures++
+
+	if g.consecutiveFailures >= failuresBeforeCooldown {
+		cooldown := baseCooldown << (g.consecutiveFailures - failuresBeforeCooldown)
+		if cooldown > maxCooldown || cooldown <= 0 {
+			cooldown = maxCooldown
+		}
+		g.cooldownUntil = time.Now().Add(cooldown)
+	}
+}
+
+// score ranks gateways by success rate per second of latency. Gateways cooling down score zero.
+func (g *Gateway) score(now time.Time) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if now.Before(g.cooldownUntil) {
+		return 0
+	}
+
+	latency := g.latency
+	if latency == 0 {
+		latency = defaultLatency
+	}
+	successRate := (g.successes + 1) / (g.successes + g.failures + 2)
+
+	return successRate / latency.Seconds()
+}
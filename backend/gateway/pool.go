@@ -0,0 +1,501 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when every gateway reports the CID as missing
+	ErrNotFound = errors.New("content not found on any gateway")
+	// ErrInvalidCID is returned for keys that can't be a CID
+	ErrInvalidCID = errors.New("invalid CID")
+)
+
+// DefaultPinataGatewayURL is Pinata's shared public gateway, used when PINATA_GATEWAY_URL doesn't
+// name a dedicated one
+const DefaultPinataGatewayURL = "https://gateway.pinata.cloud/ipfs/"
+
+// PinataGatewayURLFromEnv returns the Pinata gateway from PINATA_GATEWAY_URL, or the public one
+func PinataGatewayURLFromEnv() string {
+	return getEnvOrDefault("PINATA_GATEWAY_URL", DefaultPinataGatewayURL)
+}
+
+// Config holds gateway pool configuration
+type Config struct {
+	PinataGatewayURL string
+	PublicGateways   []string
+	KuboGatewayURL   string
+	HedgeDelay       time.Duration
+	MaxHedged        int
+	RequestTimeout   time.Duration
+	CacheDir         string
+	CacheMaxBytes    int64
+	Verify           bool
+	// MaxVerifiedFetches bounds how many verified downloads run at once
+	MaxVerifiedFetches int
+}
+
+// NewConfigFromEnv creates a gateway pool config from environment variables
+func NewConfigFromEnv() *Config {
+	config := &Config{
+		PinataGatewayURL:   PinataGatewayURLFromEnv(),
+		PublicGateways:     strings.Split(getEnvOrDefault("IPFS_GATEWAYS", "https://ipfs.io/ipfs/,https://dweb.link/ipfs/,https://w3s.link/ipfs/"), ","),
+		KuboGatewayURL:     os.Getenv("KUBO_GATEWAY_URL"),
+		HedgeDelay:         300 * time.Millisecond,
+		MaxHedged:          3,
+		RequestTimeout:     2 * time.Minute,
+		CacheDir:           getEnvOrDefault("IPFS_CACHE_DIR", "uploads/ipfs-cache"),
+		CacheMaxBytes:      1 << 30,
+		Verify:             os.Getenv("IPFS_VERIFY") != "false",
+		MaxVerifiedFetches: 8,
+	}
+
+	if d, err := time.ParseDuration(os.Getenv("IPFS_HEDGE_DELAY")); err == nil && d > 0 {
+		config.HedgeDelay = d
+	}
+	if n, err := strconv.ParseInt(os.Getenv("IPFS_CACHE_MAX_BYTES"), 10, 64); err == nil {
+		config.CacheMaxBytes = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("IPFS_VERIFY_CONCURRENCY")); err == nil && n > 0 {
+		config.MaxVerifiedFetches = n
+	}
+
+	return config
+}
+
+// Pool fetches CIDs from several gateways, preferring the healthiest and hedging slow requests
+type Pool struct {
+	gateways   []*Gateway
+	httpClient *http.Client
+	hedgeDelay time.Duration
+	maxHedged  int
+	cache      *Cache
+	verify     bool
+	// verifySlots limits concurrent verified downloads
+	verifySlots chan struct{}
+}
+
+// NewPool creates a gateway pool. A cache size of zero disables the disk cache.
+func NewPool(config *Config) (*Pool, error) {
+	pool := &Pool{
+		httpClient: &http.Client{Timeout: config.RequestTimeout},
+		hedgeDelay: config.HedgeDelay,
+		maxHedged:  config.MaxHedged,
+		verify:     config.Verify,
+	}
+
+	if config.KuboGatewayURL != "" {
+		pool.gateways = append(pool.gateways, NewGateway("kubo", config.KuboGatewayURL))
+	}
+	if config.PinataGatewayURL != "" {
+		pool.gateways = append(pool.gateways, NewGateway("pinata", config.PinataGatewayURL))
+	}
+	for _, url := range config.PublicGateways {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://")
+		name = strings.SplitN(name, "/", 2)[0]
+		pool.gateways = append(pool.gateways, NewGateway(name, url))
+	}
+	if len(pool.gateways) == 0 {
+		return nil, fmt.Errorf("no IPFS gateways configured")
+	}
+	if pool.maxHedged < 1 {
+		pool.maxHedged = 1
+	}
+	pool.verifySlots = make(chan struct{}, max(config.MaxVerifiedFetches, 1))
+
+	if config.CacheMaxBytes > 0 {
+		cache, err := NewCache(config.CacheDir, config.CacheMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		pool.cache = cache
+	}
+
+	return pool, nil
+}
+
+// ranked returns the gateways best first
+func (p *Pool) ranked() []*Gateway {
+	now := time.Now()
+	gateways := append([]*Gateway(nil), p.gateways...)
+	scores := make(map[*Gateway]float64, len(gateways))
+	for _, g := range gateways {
+		scores[g] = g.score(now)
+	}
+	sort.SliceStable(gateways, func(i, j int) bool {
+		return scores[gateways[i]] > scores[gateways[j]]
+	})
+	return gateways
+}
+
+// attempt is the outcome of one gateway request
+type attempt struct {
+	gateway *Gateway
+	resp    *http.Response
+	cancel  context.CancelFunc
+	err     error
+}
+
+// fetchOptions shape a gateway request
+type fetchOptions struct {
+	query       string
+	accept      string
+	rangeHeader string
+	// check rejects a successful response the caller can't use, so the next gateway is tried
+	check func(*http.Response) error
+}
+
+// Fetch requests a CID from the best gateway, starting the next best whenever the current ones
+// haven't answered within the hedge delay. The first successful response wins and the rest are
+// cancelled. rangeHeader is forwarded as is. The content is not verified against the CID.
+func (p *Pool) Fetch(ctx context.Context, cid, rangeHeader string) (*http.Response, *Gateway, error) {
+	if _, err := parseCID(cid); err != nil {
+		return nil, nil, err
+	}
+	return p.fetch(ctx, cid, fetchOptions{rangeHeader: rangeHeader})
+}
+
+// sniffLength is how much content Stat reads to detect a content type
+const sniffLength = 512
+
+// Stat returns the size and content type behind a CID, from the cache or by reading its first bytes.
+// The content type is sniffed when gateways only report a generic one.
+func (p *Pool) Stat(ctx context.Context, cid string) (*CacheEntry, error) {
+	if _, err := parseCID(cid); err != nil {
+		return nil, err
+	}
+
+	if p.cache != nil {
+		if file, entry, ok := p.cache.Open(cid); ok {
+			file.Close()
+			return entry, nil
+		}
+	}
+
+	resp, _, err := p.fetch(ctx, cid, fetchOptions{rangeHeader: fmt.Sprintf("bytes=0-%d", sniffLength-1)})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	head, err := io.ReadAll(io.LimitReader(resp.Body, sniffLength))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content: %v", err)
+	}
+
+	entry := &CacheEntry{Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}
+	if resp.StatusCode == http.StatusPartialContent {
+		// Content-Range is "bytes 0-511/total", where the total may be unknown
+		entry.Size = -1
+		contentRange := resp.Header.Get("Content-Range")
+		if i := strings.LastIndex(contentRange, "/"); i >= 0 {
+			if total, err := strconv.ParseInt(contentRange[i+1:], 10, 64); err == nil {
+				entry.Size = total
+			}
+		}
+	}
+	if entry.ContentType == "" || strings.HasPrefix(entry.ContentType, "application/octet-stream") {
+		entry.ContentType = http.DetectContentType(head)
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		entry.ModTime = lastModified
+	}
+
+	return entry, nil
+}
+
+// fetch runs a hedged request across the gateways
+func (p *Pool) fetch(ctx context.Context, cid string, opts fetchOptions) (*http.Response, *Gateway, error) {
+	gateways := p.ranked()
+	results := make(chan attempt, len(gateways))
+
+	launched := 0
+	launch := func() {
+		g := gateways[launched]
+		launched++
+
+		attemptCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			resp, err := p.request(attemptCtx, g, cid, opts)
+			results <- attempt{gateway: g, resp: resp, cancel: cancel, err: err}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(p.hedgeDelay)
+	defer timer.Stop()
+
+	var errs []string
+	notFound := 0
+	pending := 1
+	for pending > 0 {
+		select {
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				// Close the losers as they come in
+				go drain(results, pending)
+				result.resp.Body = &cancelOnClose{ReadCloser: result.resp.Body, cancel: result.cancel}
+				return result.resp, result.gateway, nil
+			}
+
+			result.cancel()
+			if errors.Is(result.err, ErrNotFound) {
+				notFound++
+			}
+			errs = append(errs, fmt.Sprintf("%s: %v", result.gateway.Name, result.err))
+
+			// A failure frees a hedge slot immediately
+			if launched < len(gateways) {
+				launch()
+				pending++
+				timer.Reset(p.hedgeDelay)
+			}
+		case <-timer.C:
+			if launched < len(gateways) && pending < p.maxHedged {
+				launch()
+				pending++
+			}
+			timer.Reset(p.hedgeDelay)
+		case <-ctx.Done():
+			go drain(results, pending)
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	if notFound == len(errs) {
+		return nil, nil, ErrNotFound
+	}
+	return nil, nil, fmt.Errorf("all gateways failed: %s", strings.Join(errs, "; "))
+}
+
+// request fetches a CID from one gateway and records the outcome in its health
+func (p *Pool) request(ctx context.Context, g *Gateway, cid string, opts fetchOptions) (*http.Response, error) {
+	url := g.URL(cid)
+	if opts.query != "" {
+		url += "?" + opts.query
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if opts.rangeHeader != "" {
+		req.Header.Set("Range", opts.rangeHeader)
+	}
+	if opts.accept != "" {
+		req.Header.Set("Accept", opts.accept)
+	}
+
+	start := time.Now()
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		// Losing a hedge race isn't the gateway's fault
+		if ctx.Err() == nil {
+			g.recordFailure()
+		}
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		if opts.check != nil {
+			if err := opts.check(resp); err != nil {
+				resp.Body.Close()
+				g.recordFailure()
+				return nil, err
+			}
+		}
+		g.recordSuccess(time.Since(start))
+		return resp, nil
+	case http.StatusNotFound, http.StatusGone:
+		resp.Body.Close()
+		g.recordFailure()
+		return nil, ErrNotFound
+	default:
+		resp.Body.Close()
+		g.recordFailure()
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
+
+// Serve writes a CID to w, from the disk cache when possible. Range requests are honoured.
+// With verification on, content is rebuilt from verified blocks before anything is sent;
+// otherwise complete responses are cached as they stream. Errors are returned before anything is written.
+func (p *Pool) Serve(w http.ResponseWriter, r *http.Request, cid string) error {
+	if _, err := parseCID(cid); err != nil {
+		return err
+	}
+
+	header := w.Header()
+	etag := `"` + cid + `"`
+
+	// Content under a CID never changes, so any copy the client holds is current
+	if r.Header.Get("If-None-Match") == etag {
+		setImmutable(header, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	if p.cache != nil {
+		if file, entry, ok := p.cache.Open(cid); ok {
+			defer file.Close()
+			setImmutable(header, etag)
+			header.Set("Content-Type", entry.ContentType)
+			header.Set("X-Cache", "HIT")
+			http.ServeContent(w, r, "", entry.ModTime, file)
+			return nil
+		}
+	}
+
+	if p.verify {
+		return p.serveVerified(w, r, cid, etag)
+	}
+
+	resp, g, err := p.Fetch(r.Context(), cid, r.Header.Get("Range"))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := bufio.NewReader(resp.Body)
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || strings.HasPrefix(contentType, "application/octet-stream") {
+		// Gateways fall back to octet-stream for raw blocks, sniff the real type
+		if resp.StatusCode == http.StatusOK {
+			peek, _ := body.Peek(512)
+			contentType = http.DetectContentType(peek)
+		}
+	}
+
+	setImmutable(header, etag)
+	header.Set("Content-Type", contentType)
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("X-Cache", "MISS")
+	header.Set("X-IPFS-Gateway", g.Name)
+	if length := resp.Header.Get("Content-Length"); length != "" {
+		header.Set("Content-Length", length)
+	}
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		header.Set("Content-Range", contentRange)
+	}
+
+	var dst io.Writer = w
+	var cacheWriter *CacheWriter
+	if resp.StatusCode == http.StatusOK && p.cache != nil && resp.ContentLength <= p.cache.maxBytes {
+		if cacheWriter, err = p.cache.Create(cid, contentType); err != nil {
+			log.Printf("⚠️  IPFS cache disabled for %s: %v", cid, err)
+		} else {
+			dst = io.MultiWriter(w, cacheWriter)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	n, err := io.Copy(dst, body)
+
+	if cacheWriter != nil {
+		if err == nil && (resp.ContentLength < 0 || n == resp.ContentLength) {
+			if err := cacheWriter.Commit(); err != nil {
+				log.Printf("⚠️  Failed to cache %s: %v", cid, err)
+			}
+		} else {
+			cacheWriter.Abort()
+		}
+	}
+	if err != nil {
+		log.Printf("⚠️  Streaming %s from %s stopped after %d bytes: %v", cid, g.Name, n, err)
+	}
+
+	return nil
+}
+
+// serveVerified fetches and verifies the whole file into the cache, or a temporary file
+// when caching is off, and serves it from there
+func (p *Pool) serveVerified(w http.ResponseWriter, r *http.Request, cid, etag string) error {
+	file, err := os.CreateTemp("", "ipfs-verified-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	size, err := p.FetchVerified(r.Context(), cid, file)
+	if err != nil {
+		return err
+	}
+
+	head := make([]byte, 512)
+	n, _ := file.ReadAt(head, 0)
+	contentType := http.DetectContentType(head[:n])
+
+	if p.cache != nil && size <= p.cache.maxBytes {
+		if err := p.cache.Add(cid, contentType, file); err != nil {
+			log.Printf("⚠️  Failed to cache %s: %v", cid, err)
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind verified content: %v", err)
+	}
+
+	header := w.Header()
+	setImmutable(header, etag)
+	header.Set("Content-Type", contentType)
+	header.Set("X-Cache", "MISS")
+	header.Set("X-Content-Verified", "true")
+	http.ServeContent(w, r, "", time.Now(), file)
+
+	return nil
+}
+
+// setImmutable marks a response as cacheable forever, which content addressing guarantees
+func setImmutable(header http.Header, etag string) {
+	header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	header.Set("ETag", etag)
+}
+
+// drain closes the responses of hedged requests that lost the race
+func drain(results <-chan attempt, pending int) {
+	for ; pending > 0; pending-- {
+		result := <-results
+		if result.resp != nil {
+			result.resp.Body.Close()
+		}
+		result.cancel()
+	}
+}
+
+// cancelOnClose releases the winning request's context once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// getEnvOrDefault gets environment variable with default value
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+
+	"rebnb/internal/streamtest"
+)
+
+// streamingPool returns the URL of a server proxying a CID through a pool whose only gateway
+// generates TransferSize bytes for it
+func streamingPool(t testing.TB) string {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(streamtest.TransferSize))
+		io.Copy(w, streamtest.NewReader(streamtest.TransferSize))
+	}))
+	t.Cleanup(gateway.Close)
+
+	pool, err := NewPool(&Config{
+		PinataGatewayURL: gateway.URL + "/ipfs/",
+		HedgeDelay:       time.Second,
+		MaxHedged:        1,
+		RequestTimeout:   time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: multihash.SHA2_256, MhLength: -1}
+	key, err := prefix.Sum([]byte("large"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := pool.Serve(w, r, key.String()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(proxy.Close)
+
+	return proxy.URL
+}
+
+// download fetches url into a verifier
+func download(t testing.TB, url string) *streamtest.Verifier {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	verifier := &streamtest.Verifier{}
+	io.Copy(verifier, resp.Body)
+	return verifier
+}
+
+func TestServeStreams(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams a 500MB download")
+	}
+	url := streamingPool(t)
+
+	var verifier *streamtest.Verifier
+	growth := streamtest.PeakHeapGrowth(func() {
+		verifier = download(t, url)
+	})
+	if err := verifier.Check(streamtest.TransferSize); err != nil {
+		t.Fatal(err)
+	}
+	if growth > streamtest.MaxHeapGrowth {
+		t.Errorf("heap grew by %d bytes serving %d", growth, streamtest.TransferSize)
+	}
+}
+
+func BenchmarkServe(b *testing.B) {
+	url := streamingPool(b)
+	b.ReportAllocs()
+	b.SetBytes(streamtest.TransferSize)
+
+	var peak uint64
+	for i := 0; i < b.N; i++ {
+		growth := streamtest.PeakHeapGrowth(func() {
+			if err := download(b, url).Check(streamtest.TransferSize); err != nil {
+				b.Fatal(err)
+			}
+		})
+		peak = max(peak, growth)
+	}
+	b.ReportMetric(float64(peak), "peak-heap-bytes")
+}
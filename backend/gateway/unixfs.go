@@ -0,0 +1,147 @@
+package gateway
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// UnixFS data types
+const (
+	unixfsRaw       = 0
+	unixfsDirectory = 1
+	unixfsFile      = 2
+	unixfsMetadata  = 3
+	unixfsSymlink   = 4
+	unixfsHAMTShard = 5
+)
+
+// pbLink is a link in a dag-pb node
+type pbLink struct {
+	Hash  []byte
+	Name  string
+	Tsize uint64
+}
+
+// pbNode is a decoded dag-pb node
+type pbNode struct {
+	Links []pbLink
+	Data  []byte
+}
+
+// unixfsData is the UnixFS message carried in a dag-pb node's Data
+type unixfsData struct {
+	Type       uint64
+	Data       []byte
+	FileSize   uint64
+	BlockSizes []uint64
+}
+
+// decodePBNode decodes a dag-pb block
+func decodePBNode(b []byte) (*pbNode, error) {
+	node := &pbNode{}
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			node.Data = value
+		case num == 2 && typ == protowire.BytesType:
+			link, err := decodePBLink(value)
+			if err != nil {
+				return err
+			}
+			node.Links = append(node.Links, *link)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid dag-pb node: %v", err)
+	}
+	return node, nil
+}
+
+// decodePBLink decodes a dag-pb link
+func decodePBLink(b []byte) (*pbLink, error) {
+	link := &pbLink{}
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, value []byte, v uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			link.Hash = value
+		case num == 2 && typ == protowire.BytesType:
+			link.Name = string(value)
+		case num == 3 && typ == protowire.VarintType:
+			link.Tsize = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if link.Hash == nil {
+		return nil, fmt.Errorf("link without hash")
+	}
+	return link, nil
+}
+
+// decodeUnixFS decodes the UnixFS message in a dag-pb node
+func decodeUnixFS(b []byte) (*unixfsData, error) {
+	data := &unixfsData{}
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, value []byte, v uint64) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			data.Type = v
+		case num == 2 && typ == protowire.BytesType:
+			data.Data = value
+		case num == 3 && typ == protowire.VarintType:
+			data.FileSize = v
+		case num == 4 && typ == protowire.VarintType:
+			data.BlockSizes = append(data.BlockSizes, v)
+		case num == 4 && typ == protowire.BytesType:
+			// Packed encoding
+			for len(value) > 0 {
+				size, n := protowire.ConsumeVarint(value)
+				if n < 0 {
+					return protowire.ParseError(n)
+				}
+				data.BlockSizes = append(data.BlockSizes, size)
+				value = value[n:]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid unixfs data: %v", err)
+	}
+	return data, nil
+}
+
+// walkFields calls fn for every field in a protobuf message, with the bytes of length-delimited
+// fields or the value of varint fields. Other wire types are skipped.
+func walkFields(b []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, v uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var value []byte
+		var v uint64
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, value, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,361 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+)
+
+var (
+	// ErrCIDMismatch is returned when a gateway serves bytes that don't hash to the requested CID
+	ErrCIDMismatch = errors.New("content does not match CID")
+	// ErrUnsupportedDAG is returned for CIDs that aren't UnixFS files or raw blocks
+	ErrUnsupportedDAG = errors.New("CID is not a file")
+)
+
+const (
+	// maxBlockSize bounds a single block, the IPFS limit is 2 MiB
+	maxBlockSize = 2 << 20
+	// maxCARHeaderSize bounds the CAR header, which only lists the roots
+	maxCARHeaderSize = 1 << 20
+	// maxDAGDepth bounds how deep a file DAG may nest
+	maxDAGDepth = 64
+	// maxVerifiedSize bounds a verified download
+	maxVerifiedSize = 256 << 20
+	// maxCARSeen bounds how many CAR blocks are remembered to recognise repeats
+	maxCARSeen = 1 << 16
+)
+
+// Trustless gateway response formats
+const (
+	carContentType = "application/vnd.ipld.car"
+	rawContentType = "application/vnd.ipld.raw"
+)
+
+// parseCID parses a CID, reporting failures as ErrInvalidCID
+func parseCID(key string) (cid.Cid, error) {
+	c, err := cid.Decode(key)
+	if err != nil || !validKey(key) {
+		return cid.Undef, fmt.Errorf("%w: %s", ErrInvalidCID, key)
+	}
+	return c, nil
+}
+
+// verifyBlock checks that data hashes to the multihash in c
+func verifyBlock(c cid.Cid, data []byte) error {
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return fmt.Errorf("failed to hash block %s: %v", c, err)
+	}
+	if !sum.Equals(c) {
+		return fmt.Errorf("%w: block %s hashes to %s", ErrCIDMismatch, c, sum)
+	}
+	return nil
+}
+
+// FetchVerified writes the file behind a CID to w, rebuilding it from blocks that are each checked
+// against their CID. Blocks are streamed from a DFS-ordered CAR of the DAG as the walk reaches them,
+// and are fetched one at a time from the trustless gateway API when the CAR is unavailable, incomplete
+// or out of order. Nothing unverified is written, and only the blocks on the current path are held.
+func (p *Pool) FetchVerified(ctx context.Context, key string, w io.Writer) (int64, error) {
+	root, err := parseCID(key)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case p.verifySlots <- struct{}{}:
+		defer func() { <-p.verifySlots }()
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	walker := &dagWalker{pool: p, key: key, seen: make(map[string]struct{})}
+	car, err := p.fetchCAR(ctx, key)
+	if err != nil {
+		log.Printf("⚠️  CAR fetch for %s failed, fetching blocks individually: %v", key, err)
+	} else {
+		walker.car = car
+		defer walker.closeCAR()
+	}
+
+	n, err := walker.write(ctx, root, w, 0)
+	if errors.Is(err, ErrCIDMismatch) {
+		log.Printf("🚨 Gateway served content that does not match %s: %v", key, err)
+	}
+	return n, err
+}
+
+// fetchCAR opens the CID's DAG as a DFS-ordered CAR stream
+func (p *Pool) fetchCAR(ctx context.Context, key string) (*carReader, error) {
+	resp, _, err := p.fetch(ctx, key, fetchOptions{
+		query:  "format=car&dag-scope=all",
+		accept: carContentType + ";version=1;order=dfs;dups=n",
+		check:  requireContentType(carContentType),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	car, err := newCARReader(io.LimitReader(resp.Body, maxVerifiedSize), resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return car, nil
+}
+
+// fetchBlock fetches and verifies a single raw block
+func (p *Pool) fetchBlock(ctx context.Context, c cid.Cid) ([]byte, error) {
+	resp, _, err := p.fetch(ctx, c.String(), fetchOptions{
+		query:  "format=raw",
+		accept: rawContentType,
+		check:  requireContentType(rawContentType),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch block %s: %w", c, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBlockSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %s: %v", c, err)
+	}
+	if len(data) > maxBlockSize {
+		return nil, fmt.Errorf("block %s exceeds %d bytes", c, maxBlockSize)
+	}
+	if err := verifyBlock(c, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// requireContentType rejects gateway responses that ignored the requested format
+func requireContentType(contentType string) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), contentType) {
+			return fmt.Errorf("gateway returned %q instead of %s", resp.Header.Get("Content-Type"), contentType)
+		}
+		return nil
+	}
+}
+
+// carReader reads the blocks of a CARv1 stream one at a time
+type carReader struct {
+	br   *bufio.Reader
+	body io.Closer
+}
+
+// newCARReader reads the CAR header from r, body is closed with the reader
+func newCARReader(r io.Reader, body io.Closer) (*carReader, error) {
+	br := bufio.NewReader(r)
+
+	headerLength, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CAR header: %v", err)
+	}
+	if headerLength == 0 || headerLength > maxCARHeaderSize {
+		return nil, fmt.Errorf("invalid CAR header length %d", headerLength)
+	}
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("failed to read CAR header: %v", err)
+	}
+	// The header is canonical dag-cbor {roots, version}, so the version is its last byte
+	if header[len(header)-1] != 0x01 {
+		return nil, fmt.Errorf("unsupported CAR version")
+	}
+
+	return &carReader{br: br, body: body}, nil
+}
+
+// next returns the next block, verified against its CID, or io.EOF at the end of the CAR
+func (r *carReader) next() (cid.Cid, []byte, error) {
+	length, err := binary.ReadUvarint(r.br)
+	if err == io.EOF {
+		return cid.Undef, nil, io.EOF
+	}
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to read CAR section: %v", err)
+	}
+	if length == 0 || length > maxBlockSize+128 {
+		return cid.Undef, nil, fmt.Errorf("invalid CAR section length %d", length)
+	}
+
+	section := make([]byte, length)
+	if _, err := io.ReadFull(r.br, section); err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to read CAR section: %v", err)
+	}
+
+	n, c, err := cid.CidFromBytes(section)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("invalid CID in CAR: %v", err)
+	}
+	data := section[n:]
+	if err := verifyBlock(c, data); err != nil {
+		return cid.Undef, nil, err
+	}
+	return c, data, nil
+}
+
+// Close closes the underlying response
+func (r *carReader) Close() error {
+	return r.body.Close()
+}
+
+// dagWalker writes a UnixFS file by walking its DAG in order
+type dagWalker struct {
+	pool *Pool
+	key  string
+	// car streams blocks in the order the walk needs them, nil once abandoned
+	car *carReader
+	// pending is a CAR block read ahead while a duplicate was fetched separately
+	pending *carBlock
+	// seen tracks blocks already taken from the CAR, which omits repeats
+	seen    map[string]struct{}
+	written int64
+}
+
+// carBlock is a verified block read from a CAR
+type carBlock struct {
+	cid  cid.Cid
+	data []byte
+}
+
+// block returns a verified block, from the CAR when it's next in the stream or fetched on its own
+func (d *dagWalker) block(ctx context.Context, c cid.Cid) ([]byte, error) {
+	if d.car != nil {
+		data, err := d.fromCAR(c)
+		if err != nil || data != nil {
+			return data, err
+		}
+	}
+	return d.pool.fetchBlock(ctx, c)
+}
+
+// fromCAR takes c from the CAR stream. It returns no data when c has to be fetched separately,
+// and gives up on the CAR when it isn't in the order the walk expects.
+func (d *dagWalker) fromCAR(c cid.Cid) ([]byte, error) {
+	if d.pending == nil {
+		next, data, err := d.car.next()
+		if errors.Is(err, ErrCIDMismatch) {
+			return nil, err
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("⚠️  CAR for %s broke off, fetching remaining blocks individually: %v", d.key, err)
+			}
+			d.closeCAR()
+			return nil, nil
+		}
+		d.pending = &carBlock{cid: next, data: data}
+	}
+
+	if d.pending.cid.Equals(c) {
+		data := d.pending.data
+		d.pending = nil
+		if len(d.seen) < maxCARSeen {
+			d.seen[c.KeyString()] = struct{}{}
+		}
+		return data, nil
+	}
+
+	// Repeated blocks are left out of the CAR, the stream continues after them
+	if _, ok := d.seen[c.KeyString()]; ok {
+		return nil, nil
+	}
+
+	log.Printf("⚠️  CAR for %s is out of DFS order at %s, fetching remaining blocks individually", d.key, c)
+	d.closeCAR()
+	return nil, nil
+}
+
+// closeCAR stops reading the CAR
+func (d *dagWalker) closeCAR() {
+	if d.car != nil {
+		d.car.Close()
+		d.car = nil
+		d.pending = nil
+	}
+}
+
+// write writes the file data under c and returns how many bytes it wrote
+func (d *dagWalker) write(ctx context.Context, c cid.Cid, w io.Writer, depth int) (int64, error) {
+	if depth > maxDAGDepth {
+		return 0, fmt.Errorf("DAG deeper than %d levels", maxDAGDepth)
+	}
+
+	data, err := d.block(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+
+	switch c.Type() {
+	case cid.Raw:
+		return d.emit(w, data)
+	case cid.DagProtobuf:
+	default:
+		return 0, fmt.Errorf("%w: unsupported codec 0x%x", ErrUnsupportedDAG, c.Type())
+	}
+
+	node, err := decodePBNode(data)
+	if err != nil {
+		return 0, err
+	}
+	fsData, err := decodeUnixFS(node.Data)
+	if err != nil {
+		return 0, err
+	}
+	if fsData.Type != unixfsFile && fsData.Type != unixfsRaw {
+		return 0, fmt.Errorf("%w: unixfs type %d", ErrUnsupportedDAG, fsData.Type)
+	}
+
+	total, err := d.emit(w, fsData.Data)
+	if err != nil {
+		return total, err
+	}
+
+	for i, link := range node.Links {
+		child, err := cid.Cast(link.Hash)
+		if err != nil {
+			return total, fmt.Errorf("invalid link in %s: %v", c, err)
+		}
+
+		n, err := d.write(ctx, child, w, depth+1)
+		total += n
+		if err != nil {
+			return total, err
+		}
+
+		// Each child's size is part of the verified parent, so a mismatch means a malformed DAG
+		if i < len(fsData.BlockSizes) && uint64(n) != fsData.BlockSizes[i] {
+			return total, fmt.Errorf("%w: child %s has %d bytes, parent expects %d", ErrCIDMismatch, child, n, fsData.BlockSizes[i])
+		}
+	}
+
+	if len(node.Links) > 0 && fsData.FileSize != 0 && uint64(total) != fsData.FileSize {
+		return total, fmt.Errorf("%w: %s has %d bytes, expected %d", ErrCIDMismatch, c, total, fsData.FileSize)
+	}
+
+	return total, nil
+}
+
+// emit writes verified data, enforcing the overall size limit
+func (d *dagWalker) emit(w io.Writer, data []byte) (int64, error) {
+	if d.written+int64(len(data)) > maxVerifiedSize {
+		return 0, fmt.Errorf("file exceeds %d bytes", maxVerifiedSize)
+	}
+	n, err := io.Copy(w, bytes.NewReader(data))
+	d.written += n
+	return n, err
+}
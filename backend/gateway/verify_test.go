@@ -0,0 +1,207 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// testBlock is a block of a test DAG
+type testBlock struct {
+	cid  cid.Cid
+	data []byte
+}
+
+// newBlock hashes data into a block of the given codec
+func newBlock(t *testing.T, codec uint64, data []byte) testBlock {
+	prefix := cid.Prefix{Version: 1, Codec: codec, MhType: multihash.SHA2_256, MhLength: -1}
+	c, err := prefix.Sum(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testBlock{cid: c, data: data}
+}
+
+// fileNode builds a UnixFS file node linking to raw leaves
+func fileNode(t *testing.T, leaves ...testBlock) testBlock {
+	var fsData []byte
+	fsData = protowire.AppendTag(fsData, 1, protowire.VarintType)
+	fsData = protowire.AppendVarint(fsData, unixfsFile)
+	var total uint64
+	for _, leaf := range leaves {
+		total += uint64(len(leaf.data))
+	}
+	fsData = protowire.AppendTag(fsData, 3, protowire.VarintType)
+	fsData = protowire.AppendVarint(fsData, total)
+	for _, leaf := range leaves {
+		fsData = protowire.AppendTag(fsData, 4, protowire.VarintType)
+		fsData = protowire.AppendVarint(fsData, uint64(len(leaf.data)))
+	}
+
+	var node []byte
+	for _, leaf := range leaves {
+		var link []byte
+		link = protowire.AppendTag(link, 1, protowire.BytesType)
+		link = protowire.AppendBytes(link, leaf.cid.Bytes())
+		node = protowire.AppendTag(node, 2, protowire.BytesType)
+		node = protowire.AppendBytes(node, link)
+	}
+	node = protowire.AppendTag(node, 1, protowire.BytesType)
+	node = protowire.AppendBytes(node, fsData)
+
+	return newBlock(t, cid.DagProtobuf, node)
+}
+
+// encodeCAR writes a CARv1 of blocks, in the order given, rooted at the first
+func encodeCAR(blocks ...testBlock) []byte {
+	// dag-cbor {"roots": [CID], "version": 1}
+	root := append([]byte{0x00}, blocks[0].cid.Bytes()...)
+	header := []byte{0xa2, 0x65}
+	header = append(header, "roots"...)
+	header = append(header, 0x81, 0xd8, 0x2a, 0x58, byte(len(root)))
+	header = append(header, root...)
+	header = append(header, 0x67)
+	header = append(header, "version"...)
+	header = append(header, 0x01)
+
+	car := binary.AppendUvarint(nil, uint64(len(header)))
+	car = append(car, header...)
+	for _, block := range blocks {
+		section := append(block.cid.Bytes(), block.data...)
+		car = binary.AppendUvarint(car, uint64(len(section)))
+		car = append(car, section...)
+	}
+	return car
+}
+
+// fakeGateway serves car for CAR requests and blocks for raw requests, counting the latter
+func fakeGateway(t *testing.T, car []byte, blocks ...testBlock) (*Pool, *atomic.Int32) {
+	raw := make(map[string][]byte)
+	for _, block := range blocks {
+		raw[block.cid.String()] = block.data
+	}
+
+	var rawRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/ipfs/")
+		switch r.URL.Query().Get("format") {
+		case "car":
+			w.Header().Set("Content-Type", carContentType)
+			w.Write(car)
+		case "raw":
+			rawRequests.Add(1)
+			data, ok := raw[key]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", rawContentType)
+			w.Write(data)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	pool, err := NewPool(&Config{
+		PinataGatewayURL:   server.URL + "/ipfs/",
+		HedgeDelay:         time.Second,
+		MaxHedged:          1,
+		RequestTimeout:     10 * time.Second,
+		Verify:             true,
+		MaxVerifiedFetches: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool, &rawRequests
+}
+
+func TestFetchVerifiedStreamsCAR(t *testing.T) {
+	a := newBlock(t, cid.Raw, []byte("first leaf "))
+	b := newBlock(t, cid.Raw, []byte("second leaf"))
+	root := fileNode(t, a, a, b)
+
+	// With dups=n the repeated leaf is left out of the CAR
+	pool, rawRequests := fakeGateway(t, encodeCAR(root, a, b), root, a, b)
+
+	var out bytes.Buffer
+	n, err := pool.FetchVerified(context.Background(), root.cid.String(), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first leaf first leaf second leaf"; out.String() != want || n != int64(len(want)) {
+		t.Errorf("FetchVerified wrote %q (%d bytes), want %q", out.String(), n, want)
+	}
+	if got := rawRequests.Load(); got != 1 {
+		t.Errorf("made %d block requests, want 1 for the repeated leaf", got)
+	}
+}
+
+func TestFetchVerifiedFallsBackOnUnorderedCAR(t *testing.T) {
+	a := newBlock(t, cid.Raw, []byte("first leaf "))
+	b := newBlock(t, cid.Raw, []byte("second leaf"))
+	junk := newBlock(t, cid.Raw, bytes.Repeat([]byte{0xff}, 1024))
+	root := fileNode(t, a, b)
+
+	// A block outside the DAG isn't kept, the walk fetches what it needs instead
+	pool, rawRequests := fakeGateway(t, encodeCAR(root, junk, a, b), root, a, b)
+
+	var out bytes.Buffer
+	if _, err := pool.FetchVerified(context.Background(), root.cid.String(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "first leaf second leaf"; out.String() != want {
+		t.Errorf("FetchVerified wrote %q, want %q", out.String(), want)
+	}
+	if got := rawRequests.Load(); got != 2 {
+		t.Errorf("made %d block requests, want 2", got)
+	}
+}
+
+func TestFetchVerifiedRejectsTamperedCAR(t *testing.T) {
+	a := newBlock(t, cid.Raw, []byte("first leaf "))
+	root := fileNode(t, a)
+	tampered := testBlock{cid: a.cid, data: []byte("forged leaf")}
+
+	pool, _ := fakeGateway(t, encodeCAR(root, tampered), root, a)
+
+	var out bytes.Buffer
+	if _, err := pool.FetchVerified(context.Background(), root.cid.String(), &out); !errors.Is(err, ErrCIDMismatch) {
+		t.Fatalf("FetchVerified of a tampered CAR: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("wrote %d bytes of unverified content", out.Len())
+	}
+}
+
+func TestFetchVerifiedLimitsConcurrency(t *testing.T) {
+	a := newBlock(t, cid.Raw, []byte("leaf"))
+	pool, _ := fakeGateway(t, encodeCAR(a), a)
+
+	// Hold the only slot, the next fetch waits until its context ends
+	pool.verifySlots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := pool.FetchVerified(ctx, a.cid.String(), &bytes.Buffer{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FetchVerified with no free slot: %v", err)
+	}
+
+	<-pool.verifySlots
+	var out bytes.Buffer
+	if _, err := pool.FetchVerified(context.Background(), a.cid.String(), &out); err != nil || out.String() != "leaf" {
+		t.Errorf("FetchVerified after the slot was freed wrote %q: %v", out.String(), err)
+	}
+}
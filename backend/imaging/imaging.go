@@ -0,0 +1,194 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	// Register decoders for every format we accept
+	_ "image/gif"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for content that isn't a JPEG, PNG, GIF or WebP image
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrTypeMismatch is returned when an image's content doesn't match its declared type
+	ErrTypeMismatch = errors.New("image content does not match its declared type")
+	// ErrTooLarge is returned for images over the byte or pixel limits
+	ErrTooLarge = errors.New("image too large")
+)
+
+const (
+	// MaxBytes bounds the encoded image we are willing to read
+	MaxBytes = 20 << 20
+	// maxPixels bounds the decoded image, guarding against decompression bombs
+	maxPixels = 50_000_000
+	// jpegQuality is used for every JPEG variant
+	jpegQuality = 85
+)
+
+// Variant names
+const (
+	Thumbnail = "thumbnail"
+	Card      = "card"
+	Full      = "full"
+)
+
+// Sizes lists the variants produced for every image with their maximum width and height, smallest first
+var Sizes = []struct {
+	Name string
+	Max  int
+}{
+	{Thumbnail, 256},
+	{Card, 800},
+	{Full, 2048},
+}
+
+// Variant is one re-encoded size of an image
+type Variant struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Ext         string
+	Data        []byte
+}
+
+// Result is a processed image
+type Result struct {
+	// Format is the format detected from the content: jpeg, png, gif or webp
+	Format   string
+	Variants []Variant
+}
+
+// Variant returns the variant with the given name
+func (r *Result) Variant(name string) *Variant {
+	for i := range r.Variants {
+		if r.Variants[i].Name == name {
+			return &r.Variants[i]
+		}
+	}
+	return nil
+}
+
+// Process decodes an image, checks its content against declaredType and re-encodes it at every size
+// in Sizes. Re-encoding from pixels drops EXIF, GPS and any other embedded metadata, so the JPEG
+// orientation tag is applied to the pixels first. An empty declaredType skips the type check.
+func Process(r io.Reader, declaredType string) (*Result, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %v", err)
+	}
+	if len(data) > MaxBytes {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrTooLarge, MaxBytes)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if declaredType != "" && !matchesType(format, declaredType) {
+		return nil, fmt.Errorf("%w: declared %s, content is %s", ErrTypeMismatch, declaredType, format)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s image: %v", format, err)
+	}
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	// Keep transparency where the source has any, everything else becomes a JPEG
+	encodePNG := format != "jpeg" && !isOpaque(img)
+
+	result := &Result{Format: format}
+	for _, size := range Sizes {
+		scaled := fit(img, size.Max)
+
+		variant := Variant{
+			Name:   size.Name,
+			Width:  scaled.Bounds().Dx(),
+			Height: scaled.Bounds().Dy(),
+		}
+
+		var buf bytes.Buffer
+		if encodePNG {
+			variant.ContentType, variant.Ext = "image/png", ".png"
+			err = png.Encode(&buf, scaled)
+		} else {
+			variant.ContentType, variant.Ext = "image/jpeg", ".jpg"
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: jpegQuality})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s variant: %v", size.Name, err)
+		}
+		variant.Data = buf.Bytes()
+
+		result.Variants = append(result.Variants, variant)
+	}
+
+	return result, nil
+}
+
+// matchesType reports whether a detected format matches a declared MIME type
+func matchesType(format, declaredType string) bool {
+	declaredType = strings.ToLower(strings.TrimSpace(strings.SplitN(declaredType, ";", 2)[0]))
+	switch format {
+	case "jpeg":
+		return declaredType == "image/jpeg" || declaredType == "image/jpg"
+	default:
+		return declaredType == "image/"+format
+	}
+}
+
+// fit scales an image down to fit within max×max, keeping its aspect ratio. Smaller images are
+// copied unscaled.
+func fit(img image.Image, max int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width <= max && height <= max {
+		dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+		return dst
+	}
+
+	if width >= height {
+		height = max * height / width
+		width = max
+	} else {
+		width = max * width / height
+		height = max
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Src, nil)
+	return dst
+}
+
+// isOpaque reports whether every pixel of the image is fully opaque
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
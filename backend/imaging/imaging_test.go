@@ -0,0 +1,271 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red   = color.NRGBA{255, 0, 0, 255}
+	green = color.NRGBA{0, 255, 0, 255}
+	blue  = color.NRGBA{0, 0, 255, 255}
+	white = color.NRGBA{255, 255, 255, 255}
+)
+
+// quadrants returns a w×h image whose quadrants are filled with tl, tr, bl and br
+func quadrants(w, h int, tl, tr, bl, br color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := tl
+			switch {
+			case x >= w/2 && y < h/2:
+				c = tr
+			case x < w/2 && y >= h/2:
+				c = bl
+			case x >= w/2 && y >= h/2:
+				c = br
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withOrientation inserts an EXIF APP1 segment holding the orientation tag after the JPEG's SOI
+// marker, in the given TIFF byte order
+func withOrientation(data []byte, orientation uint16, order binary.ByteOrder) []byte {
+	var tiff bytes.Buffer
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))
+	// One IFD entry: tag, SHORT type, count 1, value padded to four bytes, then no next IFD
+	binary.Write(&tiff, order, uint16(1))
+	binary.Write(&tiff, order, uint16(exifOrientationTag))
+	binary.Write(&tiff, order, uint16(3))
+	binary.Write(&tiff, order, uint32(1))
+	binary.Write(&tiff, order, orientation)
+	binary.Write(&tiff, order, uint16(0))
+	binary.Write(&tiff, order, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+// withPNGSize rewrites the width and height in a PNG's IHDR chunk, fixing up its CRC
+func withPNGSize(data []byte, width, height uint32) []byte {
+	out := append([]byte{}, data...)
+	binary.BigEndian.PutUint32(out[16:], width)
+	binary.BigEndian.PutUint32(out[20:], height)
+	binary.BigEndian.PutUint32(out[29:], crc32.ChecksumIEEE(out[12:29]))
+	return out
+}
+
+// near reports whether two colors are within JPEG's rounding of each other
+func near(a color.Color, b color.NRGBA) bool {
+	r, g, bl, _ := a.RGBA()
+	diff := func(x uint32, y uint8) bool {
+		d := int(x>>8) - int(y)
+		return d > -48 && d < 48
+	}
+	return diff(r, b.R) && diff(g, b.G) && diff(bl, b.B)
+}
+
+func decodeVariant(t *testing.T, variant *Variant) image.Image {
+	img, _, err := image.Decode(bytes.NewReader(variant.Data))
+	if err != nil {
+		t.Fatalf("failed to decode %s variant: %v", variant.Name, err)
+	}
+	return img
+}
+
+func TestProcessAppliesEXIFOrientation(t *testing.T) {
+	// The stored pixels are 64×32 with one color per quadrant. Each case lists the quadrants as they
+	// should display once the orientation is applied.
+	stored := quadrants(64, 32, red, green, blue, white)
+
+	tests := []struct {
+		orientation    uint16
+		width, height  int
+		tl, tr, bl, br color.NRGBA
+	}{
+		{1, 64, 32, red, green, blue, white},
+		{2, 64, 32, green, red, white, blue},
+		{3, 64, 32, white, blue, green, red},
+		{4, 64, 32, blue, white, red, green},
+		{5, 32, 64, red, blue, green, white},
+		{6, 32, 64, blue, red, white, green},
+		{7, 32, 64, white, green, blue, red},
+		{8, 32, 64, green, white, red, blue},
+	}
+
+	for _, test := range tests {
+		for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+			data := withOrientation(encodeJPEG(t, stored), test.orientation, order)
+			result, err := Process(bytes.NewReader(data), "image/jpeg")
+			if err != nil {
+				t.Fatalf("orientation %d (%s): %v", test.orientation, order, err)
+			}
+
+			full := result.Variant(Full)
+			if full.Width != test.width || full.Height != test.height {
+				t.Errorf("orientation %d (%s): %dx%d, want %dx%d", test.orientation, order, full.Width, full.Height, test.width, test.height)
+				continue
+			}
+
+			img := decodeVariant(t, full)
+			w, h := test.width, test.height
+			for _, corner := range []struct {
+				name string
+				x, y int
+				want color.NRGBA
+			}{
+				{"top left", w / 4, h / 4, test.tl},
+				{"top right", 3 * w / 4, h / 4, test.tr},
+				{"bottom left", w / 4, 3 * h / 4, test.bl},
+				{"bottom right", 3 * w / 4, 3 * h / 4, test.br},
+			} {
+				if got := img.At(corner.x, corner.y); !near(got, corner.want) {
+					t.Errorf("orientation %d (%s): %s is %v, want %v", test.orientation, order, corner.name, got, corner.want)
+				}
+			}
+		}
+	}
+}
+
+func TestProcessChecksDeclaredType(t *testing.T) {
+	img := quadrants(8, 8, red, green, blue, white)
+	jpegData := encodeJPEG(t, img)
+	pngData := encodePNG(t, img)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		declared string
+		err      error
+	}{
+		{"jpeg", jpegData, "image/jpeg", nil},
+		{"jpeg declared as image/jpg", jpegData, "image/jpg", nil},
+		{"png with parameters", pngData, "IMAGE/PNG; charset=binary", nil},
+		{"no declared type", pngData, "", nil},
+		{"png declared as jpeg", pngData, "image/jpeg", ErrTypeMismatch},
+		{"jpeg declared as png", jpegData, "image/png", ErrTypeMismatch},
+		{"jpeg declared as webp", jpegData, "image/webp", ErrTypeMismatch},
+		{"not an image", []byte("<html><body>hello</body></html>"), "image/png", ErrUnsupportedFormat},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Process(bytes.NewReader(test.data), test.declared); !errors.Is(err, test.err) {
+				t.Errorf("Process = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestProcessRejectsLargeImages(t *testing.T) {
+	small := encodePNG(t, quadrants(2, 2, red, green, blue, white))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		// Only the header is read, so claiming a huge size costs nothing to check
+		{"over the pixel cap", withPNGSize(small, 10_000, maxPixels/10_000+1)},
+		{"wide and short", withPNGSize(small, maxPixels+1, 1)},
+		{"over the byte limit", append(small, make([]byte, MaxBytes)...)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Process(bytes.NewReader(test.data), "image/png"); !errors.Is(err, ErrTooLarge) {
+				t.Errorf("Process = %v, want %v", err, ErrTooLarge)
+			}
+		})
+	}
+}
+
+func TestProcessKeepsTransparencyAsPNG(t *testing.T) {
+	opaque := quadrants(16, 16, red, green, blue, white)
+	transparent := quadrants(16, 16, red, green, blue, color.NRGBA{0, 0, 0, 0})
+
+	var gifData bytes.Buffer
+	palette := color.Palette{color.NRGBA{0, 0, 0, 0}, red}
+	paletted := image.NewPaletted(image.Rect(0, 0, 16, 16), palette)
+	paletted.SetColorIndex(3, 3, 1)
+	if err := gif.Encode(&gifData, paletted, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		ext         string
+	}{
+		{"opaque jpeg", encodeJPEG(t, opaque), "image/jpeg", ".jpg"},
+		{"opaque png", encodePNG(t, opaque), "image/jpeg", ".jpg"},
+		{"png with alpha", encodePNG(t, transparent), "image/png", ".png"},
+		{"gif with a transparent color", gifData.Bytes(), "image/png", ".png"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := Process(bytes.NewReader(test.data), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Variants) != len(Sizes) {
+				t.Fatalf("Process returned %d variants, want %d", len(result.Variants), len(Sizes))
+			}
+			for _, variant := range result.Variants {
+				if variant.ContentType != test.contentType || variant.Ext != test.ext {
+					t.Errorf("%s variant is %s (%s), want %s (%s)", variant.Name, variant.ContentType, variant.Ext, test.contentType, test.ext)
+				}
+			}
+		})
+	}
+
+	// Transparent pixels survive the re-encode
+	result, err := Process(bytes.NewReader(encodePNG(t, transparent)), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := decodeVariant(t, result.Variant(Full)).At(12, 12).RGBA(); a != 0 {
+		t.Errorf("transparent pixel has alpha %d", a)
+	}
+}
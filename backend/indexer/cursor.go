@@ -0,0 +1,240 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"rebnb/db"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// reorgWindow is how many blocks below the confirmation depth keep their recorded hashes
+const reorgWindow = 64
+
+// HeaderSource reads block headers from a chain; an *ethclient.Client is one
+type HeaderSource interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// Range is an inclusive block range handed out by a Cursor
+type Range struct {
+	From uint64
+	To   uint64
+	Head uint64
+	// headers are the blocks whose hashes are recorded on commit, in ascending order ending at To
+	headers []*types.Header
+}
+
+// Cursor walks a chain range by range and records the hash of every committed block a reorg can
+// still reach, those within confirmations+reorgWindow of the head, and of the last block of older
+// ranges. A parent hash mismatch is traced back to the newest recorded block that is still
+// canonical, and the documents derived from orphaned blocks above it are removed.
+type Cursor struct {
+	name          string
+	chain         string
+	start         uint64
+	confirmations uint64
+	derived       []string
+	headers       HeaderSource
+	blocks        db.BlockRepository
+}
+
+// NewCursor creates a cursor whose derived documents live in the given collections.
+// Every derived document must carry the block_number it was read from.
+func NewCursor(name, chain string, start, confirmations uint64, derived []string, headers HeaderSource, blocks db.BlockRepository) *Cursor {
+	return &Cursor{
+		name:          name,
+		chain:         chain,
+		start:         start,
+		confirmations: confirmations,
+		derived:       derived,
+		headers:       headers,
+		blocks:        blocks,
+	}
+}
+
+// Next returns the next range to process, or nil when the cursor has caught up with the chain head.
+// If the chain no longer builds on the last committed block, the cursor rewinds to the fork point first.
+func (cur *Cursor) Next(ctx context.Context, batchSize uint64) (*Range, error) {
+	head, err := cur.headers.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block number: %w", err)
+	}
+
+	checkpoint, err := cur.blocks.GetCheckpoint(ctx, cur.name)
+	if err != nil {
+		return nil, err
+	}
+
+	from := cur.start
+	if checkpoint != nil {
+		from = checkpoint.BlockNumber + 1
+	}
+	if from > head {
+		return nil, nil
+	}
+
+	to := from + batchSize - 1
+	if to > head {
+		to = head
+	}
+
+	// The first block of the range must build on the block we committed last
+	if checkpoint != nil && checkpoint.BlockHash != "" {
+		first, err := cur.header(ctx, from)
+		if err != nil {
+			return nil, err
+		}
+		if first.ParentHash.Hex() != checkpoint.BlockHash {
+			log.Printf("⚠️  Reorg detected by cursor %s at block %d: parent %s, expected %s",
+				cur.name, from, first.ParentHash.Hex(), checkpoint.BlockHash)
+			if err := cur.rewind(ctx); err != nil {
+				return nil, err
+			}
+			return cur.Next(ctx, batchSize)
+		}
+	}
+
+	// Fetch the recorded headers before the range is processed so a reorg during processing is
+	// caught on the next call
+	headers, err := cur.rangeHeaders(ctx, from, to, head)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Range{From: from, To: to, Head: head, headers: headers}, nil
+}
+
+// rangeHeaders fetches the headers of a range's blocks that are within reach of a reorg, or just
+// its last block when none are, and checks that they form one chain
+func (cur *Cursor) rangeHeaders(ctx context.Context, from, to, head uint64) ([]*types.Header, error) {
+	first := from
+	if depth := cur.confirmations + reorgWindow; head > depth {
+		first = max(from, min(head-depth, to))
+	}
+
+	headers := make([]*types.Header, 0, to-first+1)
+	for number := first; number <= to; number++ {
+		header, err := cur.header(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+		if len(headers) > 0 && header.ParentHash != headers[len(headers)-1].Hash() {
+			return nil, fmt.Errorf("chain reorganized while reading block %d", number)
+		}
+		headers = append(headers, header)
+	}
+
+	return headers, nil
+}
+
+// Commit records the hashes of a processed range's blocks and moves the checkpoint past it
+func (cur *Cursor) Commit(ctx context.Context, r *Range) error {
+	for _, header := range r.headers {
+		block := &db.IndexedBlock{
+			Cursor:     cur.name,
+			Number:     header.Number.Uint64(),
+			Hash:       header.Hash().Hex(),
+			ParentHash: header.ParentHash.Hex(),
+		}
+		if err := cur.blocks.SaveBlock(ctx, block); err != nil {
+			return err
+		}
+	}
+
+	return cur.blocks.SaveCheckpoint(ctx, cur.name, cur.chain, r.To, r.headers[len(r.headers)-1].Hash().Hex())
+}
+
+// IsFinal reports whether a block has the configured number of confirmations at the given head
+func (cur *Cursor) IsFinal(blockNumber, head uint64) bool {
+	return blockNumber+cur.confirmations <= head
+}
+
+// Finalize marks derived documents as confirmed and prunes block hashes that are past the reorg window
+func (cur *Cursor) Finalize(ctx context.Context, head uint64) error {
+	if head < cur.confirmations {
+		return nil
+	}
+	final := head - cur.confirmations
+
+	if err := cur.blocks.ConfirmDerived(ctx, cur.derived, final); err != nil {
+		return err
+	}
+
+	if final < reorgWindow {
+		return nil
+	}
+	cutoff := final - reorgWindow
+
+	// Never prune the block the checkpoint points at
+	checkpoint, err := cur.blocks.GetCheckpoint(ctx, cur.name)
+	if err != nil {
+		return err
+	}
+	if checkpoint != nil && checkpoint.BlockNumber < cutoff {
+		cutoff = checkpoint.BlockNumber
+	}
+
+	return cur.blocks.PruneBlocksBefore(ctx, cur.name, cutoff)
+}
+
+// rewind finds the newest recorded block that is still canonical and rolls everything above it back
+func (cur *Cursor) rewind(ctx context.Context) error {
+	blocks, err := cur.blocks.GetBlocksDescending(ctx, cur.name, int64(cur.confirmations+reorgWindow))
+	if err != nil {
+		return err
+	}
+
+	var forkPoint *types.Header
+	for _, block := range blocks {
+		header, err := cur.header(ctx, block.Number)
+		if err != nil {
+			return err
+		}
+		if header.Hash().Hex() == block.Hash {
+			forkPoint = header
+			break
+		}
+	}
+
+	// The reorg is deeper than the recorded history, restart below the oldest block we know about
+	if forkPoint == nil {
+		number := cur.start
+		if len(blocks) > 0 && blocks[len(blocks)-1].Number > cur.start {
+			number = blocks[len(blocks)-1].Number - 1
+		}
+		log.Printf("⚠️  Reorg for cursor %s is deeper than recorded history, rewinding to block %d", cur.name, number)
+
+		forkPoint, err = cur.header(ctx, number)
+		if err != nil {
+			return err
+		}
+	}
+	fork := forkPoint.Number.Uint64()
+
+	deleted, err := cur.blocks.RewindDerived(ctx, cur.derived, fork)
+	if err != nil {
+		return err
+	}
+	if err := cur.blocks.DeleteBlocksAfter(ctx, cur.name, fork); err != nil {
+		return err
+	}
+	if err := cur.blocks.SaveCheckpoint(ctx, cur.name, cur.chain, fork, forkPoint.Hash().Hex()); err != nil {
+		return err
+	}
+
+	log.Printf("🔄 Cursor %s rewound to block %d, removed %d derived documents", cur.name, fork, deleted)
+	return nil
+}
+
+// header fetches a block header by number
+func (cur *Cursor) header(ctx context.Context, number uint64) (*types.Header, error) {
+	header, err := cur.headers.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get header %d: %w", number, err)
+	}
+	return header, nil
+}
@@ -0,0 +1,251 @@
+package indexer
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"rebnb/db"
+)
+
+// fakeChain is a HeaderSource whose blocks can be replaced by a fork
+type fakeChain struct {
+	headers []*types.Header
+}
+
+// extend appends length blocks tagged with fork, so blocks on different forks hash differently
+func (c *fakeChain) extend(length int, fork string) {
+	for i := 0; i < length; i++ {
+		parent := common.Hash{}
+		if n := len(c.headers); n > 0 {
+			parent = c.headers[n-1].Hash()
+		}
+		c.headers = append(c.headers, &types.Header{
+			Number:     big.NewInt(int64(len(c.headers))),
+			ParentHash: parent,
+			Extra:      []byte(fork),
+		})
+	}
+}
+
+// reorg replaces every block from number on with length blocks of a new fork
+func (c *fakeChain) reorg(number uint64, length int, fork string) {
+	c.headers = c.headers[:number]
+	c.extend(length, fork)
+}
+
+func (c *fakeChain) BlockNumber(ctx context.Context) (uint64, error) {
+	return uint64(len(c.headers) - 1), nil
+}
+
+func (c *fakeChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return c.headers[number.Uint64()], nil
+}
+
+// fakeBlocks is a BlockRepository for one cursor and one derived collection, holding a derived
+// document per block number
+type fakeBlocks struct {
+	checkpoint *db.IndexerCheckpoint
+	blocks     map[uint64]db.IndexedBlock
+	derived    map[uint64]bool // block number to confirmed
+}
+
+func newFakeBlocks() *fakeBlocks {
+	return &fakeBlocks{blocks: make(map[uint64]db.IndexedBlock), derived: make(map[uint64]bool)}
+}
+
+func (f *fakeBlocks) GetCheckpoint(ctx context.Context, name string) (*db.IndexerCheckpoint, error) {
+	return f.checkpoint, nil
+}
+
+func (f *fakeBlocks) SaveCheckpoint(ctx context.Context, name, chain string, blockNumber uint64, blockHash string) error {
+	f.checkpoint = &db.IndexerCheckpoint{Name: name, Chain: chain, BlockNumber: blockNumber, BlockHash: blockHash}
+	return nil
+}
+
+func (f *fakeBlocks) SaveBlock(ctx context.Context, block *db.IndexedBlock) error {
+	f.blocks[block.Number] = *block
+	return nil
+}
+
+func (f *fakeBlocks) GetBlocksDescending(ctx context.Context, cursorName string, limit int64) ([]db.IndexedBlock, error) {
+	var blocks []db.IndexedBlock
+	for _, number := range f.recorded() {
+		blocks = append([]db.IndexedBlock{f.blocks[number]}, blocks...)
+	}
+	if int64(len(blocks)) > limit {
+		blocks = blocks[:limit]
+	}
+	return blocks, nil
+}
+
+func (f *fakeBlocks) DeleteBlocksAfter(ctx context.Context, cursorName string, number uint64) error {
+	for n := range f.blocks {
+		if n > number {
+			delete(f.blocks, n)
+		}
+	}
+	return nil
+}
+
+func (f *fakeBlocks) PruneBlocksBefore(ctx context.Context, cursorName string, number uint64) error {
+	for n := range f.blocks {
+		if n < number {
+			delete(f.blocks, n)
+		}
+	}
+	return nil
+}
+
+func (f *fakeBlocks) RewindDerived(ctx context.Context, collections []string, forkPoint uint64) (int64, error) {
+	var deleted int64
+	for n := range f.derived {
+		if n > forkPoint {
+			delete(f.derived, n)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeBlocks) ConfirmDerived(ctx context.Context, collections []string, number uint64) error {
+	for n := range f.derived {
+		if n <= number {
+			f.derived[n] = true
+		}
+	}
+	return nil
+}
+
+// recorded returns the numbers of the recorded blocks in ascending order
+func (f *fakeBlocks) recorded() []uint64 {
+	var numbers []uint64
+	for n := range f.blocks {
+		numbers = append(numbers, n)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers
+}
+
+// syncCursor processes every range up to the head, deriving one document per block
+func syncCursor(t *testing.T, cursor *Cursor, blocks *fakeBlocks, batchSize uint64) {
+	ctx := context.Background()
+	for {
+		r, err := cursor.Next(ctx, batchSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r == nil {
+			return
+		}
+		for n := r.From; n <= r.To; n++ {
+			blocks.derived[n] = false
+		}
+		if err := cursor.Commit(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCursorRewindsToForkPoint(t *testing.T) {
+	chain := &fakeChain{}
+	chain.extend(30, "a")
+	blocks := newFakeBlocks()
+	cursor := NewCursor("test", "test", 0, 3, []string{"derived"}, chain, blocks)
+
+	syncCursor(t, cursor, blocks, 8)
+	if blocks.checkpoint.BlockNumber != 29 {
+		t.Fatalf("checkpoint at %d, want 29", blocks.checkpoint.BlockNumber)
+	}
+
+	// Blocks 25-29 are orphaned by a longer fork
+	chain.reorg(25, 8, "b")
+
+	r, err := cursor.Next(context.Background(), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == nil || r.From != 25 || r.To != 32 {
+		t.Fatalf("Next after the reorg returned %+v, want blocks 25-32", r)
+	}
+	if blocks.checkpoint.BlockNumber != 24 || blocks.checkpoint.BlockHash != chain.headers[24].Hash().Hex() {
+		t.Errorf("checkpoint rewound to %+v, want block 24", blocks.checkpoint)
+	}
+	for n := range blocks.derived {
+		if n > 24 {
+			t.Errorf("document derived from orphaned block %d survived the rewind", n)
+		}
+	}
+	if recorded := blocks.recorded(); recorded[len(recorded)-1] != 24 {
+		t.Errorf("recorded blocks end at %d after the rewind, want 24", recorded[len(recorded)-1])
+	}
+
+	// The new fork is indexed like any other range
+	syncCursor(t, cursor, blocks, 8)
+	if blocks.checkpoint.BlockHash != chain.headers[32].Hash().Hex() {
+		t.Errorf("checkpoint %+v is not the new fork's head", blocks.checkpoint)
+	}
+	if len(blocks.derived) != 33 {
+		t.Errorf("%d derived documents after resyncing, want 33", len(blocks.derived))
+	}
+}
+
+func TestCursorRecordsBlocksWithinReorgReach(t *testing.T) {
+	chain := &fakeChain{}
+	chain.extend(200, "a")
+	blocks := newFakeBlocks()
+	cursor := NewCursor("test", "test", 0, 6, []string{"derived"}, chain, blocks)
+
+	syncCursor(t, cursor, blocks, 50)
+
+	// Blocks older than the head minus confirmations+reorgWindow only record their range's tip
+	var want []uint64
+	want = append(want, 49, 99)
+	for n := uint64(199 - 6 - reorgWindow); n <= 199; n++ {
+		want = append(want, n)
+	}
+	recorded := blocks.recorded()
+	if len(recorded) != len(want) {
+		t.Fatalf("recorded %d blocks, want %d: %v", len(recorded), len(want), recorded)
+	}
+	for i := range want {
+		if recorded[i] != want[i] {
+			t.Fatalf("recorded blocks %v, want %v", recorded, want)
+		}
+	}
+
+	// A reorg within reach is rewound to the exact fork point, not the range tip
+	chain.reorg(160, 45, "b")
+	r, err := cursor.Next(context.Background(), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.From != 160 || blocks.checkpoint.BlockNumber != 159 {
+		t.Errorf("rewound to %d and resumed at %d, want 159 and 160", blocks.checkpoint.BlockNumber, r.From)
+	}
+}
+
+func TestCursorConfirmsDerivedDocuments(t *testing.T) {
+	chain := &fakeChain{}
+	chain.extend(10, "a")
+	blocks := newFakeBlocks()
+	cursor := NewCursor("test", "test", 0, 3, []string{"derived"}, chain, blocks)
+
+	syncCursor(t, cursor, blocks, 4)
+	if err := cursor.Finalize(context.Background(), 9); err != nil {
+		t.Fatal(err)
+	}
+
+	for n, confirmed := range blocks.derived {
+		if want := cursor.IsFinal(n, 9); confirmed != want {
+			t.Errorf("document from block %d confirmed = %v, want %v", n, confirmed, want)
+		}
+		if final := n <= 6; cursor.IsFinal(n, 9) != final {
+			t.Errorf("IsFinal(%d, 9) = %v, want %v", n, !final, final)
+		}
+	}
+}
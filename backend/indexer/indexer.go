@@ -0,0 +1,378 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"rebnb/contracts"
+	"rebnb/db"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Checkpoint names of the indexer's cursors, one per followed contract
+const (
+	CheckpointName         = "marketplace-settlements"
+	TransferCheckpointName = "property-transfers"
+)
+
+// settlementEvents are the Marketplace events followed by the indexer
+var settlementEvents = []string{"SettlePayment", "SettleSecurity", "SettleFee"}
+
+// Config holds indexer configuration
+type Config struct {
+	Chain         string
+	StartBlock    uint64
+	BatchSize     uint64
+	Confirmations uint64
+	PollInterval  time.Duration
+}
+
+// NewConfigFromEnv creates a new indexer config from environment variables
+func NewConfigFromEnv() *Config {
+	config := &Config{
+		Chain:         "0g",
+		BatchSize:     1000,
+		Confirmations: 5,
+		PollInterval:  15 * time.Second,
+	}
+
+	if chain := os.Getenv("INDEXER_CHAIN"); chain != "" {
+		config.Chain = chain
+	}
+
+	if startStr := os.Getenv("INDEXER_START_BLOCK"); startStr != "" {
+		if b, err := strconv.ParseUint(startStr, 10, 64); err == nil {
+			config.StartBlock = b
+		}
+	}
+
+	if batchStr := os.Getenv("INDEXER_BATCH_SIZE"); batchStr != "" {
+		if b, err := strconv.ParseUint(batchStr, 10, 64); err == nil && b > 0 {
+			config.BatchSize = b
+		}
+	}
+
+	if confirmationsStr := os.Getenv("INDEXER_CONFIRMATIONS"); confirmationsStr != "" {
+		if n, err := strconv.ParseUint(confirmationsStr, 10, 64); err == nil {
+			config.Confirmations = n
+		}
+	}
+
+	if pollStr := os.Getenv("INDEXER_POLL_INTERVAL"); pollStr != "" {
+		if d, err := time.ParseDuration(pollStr); err == nil && d > 0 {
+			config.PollInterval = d
+		}
+	}
+
+	return config
+}
+
+// Indexer follows Marketplace settlement and property Transfer logs and stores them in MongoDB.
+// Each contract is followed by its own cursor, so one added later is indexed from the start block.
+type Indexer struct {
+	config         *Config
+	db             *db.Client
+	client         *ethclient.Client
+	marketplaceABI *abi.ABI
+	feeds          []*feed
+}
+
+// feed is one contract's logs, followed by its own cursor
+type feed struct {
+	contract common.Address
+	topics   []common.Hash
+	cursor   *Cursor
+	// store decodes and saves a log read from a block with the given time and finality
+	store func(ctx context.Context, vLog types.Log, blockTime time.Time, confirmed bool) error
+}
+
+// New creates an indexer for the configured chain and the contracts stored in MongoDB. The
+// marketplace contract is required, property transfers are only followed when the property
+// contract is configured.
+func New(ctx context.Context, config *Config, dbClient *db.Client) (*Indexer, error) {
+	if config == nil {
+		config = NewConfigFromEnv()
+	}
+
+	marketplaceABI, err := contracts.LoadMarketplaceABI()
+	if err != nil {
+		return nil, err
+	}
+	propertyABI, err := contracts.LoadPropertyABI()
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := dbClient.GetChain(ctx, config.Chain)
+	if err != nil {
+		return nil, err
+	}
+
+	marketplace, err := contractAddress(ctx, dbClient, "marketplace")
+	if err != nil {
+		return nil, err
+	}
+	property, err := contractAddress(ctx, dbClient, "property")
+	if err != nil {
+		log.Printf("⚠️  Property transfers not indexed: %v", err)
+	}
+
+	client, err := ethclient.DialContext(ctx, chain.RPC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to blockchain: %w", err)
+	}
+
+	ix := &Indexer{config: config, db: dbClient, client: client, marketplaceABI: marketplaceABI}
+
+	settlements, err := ix.newFeed(CheckpointName, marketplace, marketplaceABI, settlementEvents,
+		db.SettlementCollectionNames(), ix.storeSettlement)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	ix.feeds = append(ix.feeds, settlements)
+
+	if property != (common.Address{}) {
+		transfers, err := ix.newFeed(TransferCheckpointName, property, propertyABI, []string{"Transfer"},
+			[]string{db.PropertyTransfersCollection}, ix.storeTransfer)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		ix.feeds = append(ix.feeds, transfers)
+	}
+
+	return ix, nil
+}
+
+// contractAddress looks up a contract's address, failing when it isn't configured
+func contractAddress(ctx context.Context, dbClient *db.Client, contractType string) (common.Address, error) {
+	contract, err := dbClient.GetContract(ctx, contractType)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if !common.IsHexAddress(contract.ContractAddress) {
+		return common.Address{}, fmt.Errorf("%s contract address '%s' is not configured", contractType, contract.ContractAddress)
+	}
+	return common.HexToAddress(contract.ContractAddress), nil
+}
+
+// newFeed follows the named events of a contract with a cursor whose derived documents live in
+// the given collections
+func (ix *Indexer) newFeed(name string, contract common.Address, contractABI *abi.ABI, events, derived []string,
+	store func(ctx context.Context, vLog types.Log, blockTime time.Time, confirmed bool) error) (*feed, error) {
+	var topics []common.Hash
+	for _, event := range events {
+		abiEvent, ok := contractABI.Events[event]
+		if !ok {
+			return nil, fmt.Errorf("event '%s' not found in %s ABI", event, name)
+		}
+		topics = append(topics, abiEvent.ID)
+	}
+
+	return &feed{
+		contract: contract,
+		topics:   topics,
+		cursor:   NewCursor(name, ix.config.Chain, ix.config.StartBlock, ix.config.Confirmations, derived, ix.client, ix.db),
+		store:    store,
+	}, nil
+}
+
+// Close closes the indexer's RPC connection
+func (ix *Indexer) Close() {
+	ix.client.Close()
+}
+
+// Run polls for new blocks until the context is cancelled
+func (ix *Indexer) Run(ctx context.Context) {
+	for _, feed := range ix.feeds {
+		log.Printf("🔍 Indexer following %s on chain %s", feed.contract.Hex(), ix.config.Chain)
+	}
+
+	ticker := time.NewTicker(ix.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, feed := range ix.feeds {
+			if err := ix.poll(ctx, feed); err != nil {
+				log.Printf("⚠️  Indexer %s: %v", feed.cursor.name, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("🔌 Indexer stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll processes every block between a feed's checkpoint and the chain head in batches
+func (ix *Indexer) poll(ctx context.Context, feed *feed) error {
+	var head uint64
+	for {
+		r, err := feed.cursor.Next(ctx, ix.config.BatchSize)
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			break
+		}
+		head = r.Head
+
+		if err := ix.processRange(ctx, feed, r); err != nil {
+			return fmt.Errorf("blocks %d-%d: %w", r.From, r.To, err)
+		}
+
+		if err := feed.cursor.Commit(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	if head == 0 {
+		var err error
+		if head, err = ix.client.BlockNumber(ctx); err != nil {
+			return fmt.Errorf("failed to get block number: %w", err)
+		}
+	}
+
+	return feed.cursor.Finalize(ctx, head)
+}
+
+// processRange fetches and stores a feed's logs for an inclusive block range
+func (ix *Indexer) processRange(ctx context.Context, feed *feed, r *Range) error {
+	logs, err := ix.client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(r.From),
+		ToBlock:   new(big.Int).SetUint64(r.To),
+		Addresses: []common.Address{feed.contract},
+		Topics:    [][]common.Hash{feed.topics},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to filter logs: %w", err)
+	}
+
+	blockTimes := make(map[uint64]time.Time)
+	for _, vLog := range logs {
+		if vLog.Removed {
+			continue
+		}
+
+		blockTime, ok := blockTimes[vLog.BlockNumber]
+		if !ok {
+			header, err := ix.client.HeaderByNumber(ctx, new(big.Int).SetUint64(vLog.BlockNumber))
+			if err != nil {
+				return fmt.Errorf("failed to get block header: %w", err)
+			}
+			blockTime = time.Unix(int64(header.Time), 0).UTC()
+			blockTimes[vLog.BlockNumber] = blockTime
+		}
+
+		if err := feed.store(ctx, vLog, blockTime, feed.cursor.IsFinal(vLog.BlockNumber, r.Head)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storeSettlement saves a Marketplace settlement log, skipping logs that can't be decoded
+func (ix *Indexer) storeSettlement(ctx context.Context, vLog types.Log, blockTime time.Time, confirmed bool) error {
+	event, err := ix.decodeSettlement(vLog)
+	if err != nil {
+		log.Printf("⚠️  Skipping log %s#%d: %v", vLog.TxHash.Hex(), vLog.Index, err)
+		return nil
+	}
+	event.BlockTime = blockTime
+	event.Confirmed = confirmed
+
+	return ix.db.UpsertSettlementEvent(ctx, event)
+}
+
+// storeTransfer saves a property Transfer log, skipping logs that can't be decoded
+func (ix *Indexer) storeTransfer(ctx context.Context, vLog types.Log, blockTime time.Time, confirmed bool) error {
+	// Transfer(address indexed from, address indexed to, uint256 indexed tokenId)
+	if len(vLog.Topics) != 4 {
+		log.Printf("⚠️  Skipping log %s#%d: Transfer has %d topics", vLog.TxHash.Hex(), vLog.Index, len(vLog.Topics))
+		return nil
+	}
+
+	return ix.db.UpsertPropertyTransfer(ctx, &db.PropertyTransfer{
+		PropertyID:      vLog.Topics[3].Big().String(),
+		From:            common.BytesToAddress(vLog.Topics[1].Bytes()).Hex(),
+		To:              common.BytesToAddress(vLog.Topics[2].Bytes()).Hex(),
+		ContractAddress: vLog.Address.Hex(),
+		TxHash:          vLog.TxHash.Hex(),
+		LogIndex:        vLog.Index,
+		BlockNumber:     vLog.BlockNumber,
+		BlockHash:       vLog.BlockHash.Hex(),
+		BlockTime:       blockTime,
+		Confirmed:       confirmed,
+	})
+}
+
+// decodeSettlement converts a raw settlement log into its MongoDB document
+func (ix *Indexer) decodeSettlement(vLog types.Log) (*db.SettlementEvent, error) {
+	if len(vLog.Topics) == 0 {
+		return nil, fmt.Errorf("log has no topics")
+	}
+
+	event, err := ix.marketplaceABI.EventByID(vLog.Topics[0])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make(map[string]interface{})
+	if err := ix.marketplaceABI.UnpackIntoMap(args, event.Name, vLog.Data); err != nil {
+		return nil, fmt.Errorf("failed to unpack data: %w", err)
+	}
+
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(args, indexed, vLog.Topics[1:]); err != nil {
+		return nil, fmt.Errorf("failed to parse topics: %w", err)
+	}
+
+	settlement := &db.SettlementEvent{
+		Event:           event.Name,
+		PropertyID:      bigString(args["propertyId"]),
+		Date:            bigString(args["date"]),
+		Amount:          bigString(args["amount"]),
+		Expected:        bigString(args["expected"]),
+		ContractAddress: vLog.Address.Hex(),
+		TxHash:          vLog.TxHash.Hex(),
+		LogIndex:        vLog.Index,
+		BlockNumber:     vLog.BlockNumber,
+		BlockHash:       vLog.BlockHash.Hex(),
+	}
+
+	// The first indexed argument is the receiver (or payer for fees)
+	if len(indexed) > 0 {
+		if account, ok := args[indexed[0].Name].(common.Address); ok {
+			settlement.Account = account.Hex()
+		}
+	}
+
+	return settlement, nil
+}
+
+// bigString formats a decoded uint256 argument, returning an empty string when absent
+func bigString(value interface{}) string {
+	if v, ok := value.(*big.Int); ok {
+		return v.String()
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+// Package streamtest helps tests check that large transfers stream instead of being buffered.
+// Content is generated from its offset, so neither side of a transfer has to hold it.
+package streamtest
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// TransferSize is the size of the transfers streaming tests run
+const TransferSize = 500 << 20
+
+// MaxHeapGrowth bounds how far the heap may grow during a streamed transfer of TransferSize bytes.
+// Buffering the content would grow it by the whole transfer.
+const MaxHeapGrowth = 64 << 20
+
+// At returns the content byte at offset
+func At(offset int64) byte {
+	return byte((uint64(offset) * 0x9E3779B1) >> 13)
+}
+
+// Reader generates Size bytes of content
+type Reader struct {
+	Size   int64
+	offset int64
+}
+
+// NewReader returns a reader generating size bytes
+func NewReader(size int64) *Reader {
+	return &Reader{Size: size}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+// ReadAt fills p with the content at offset
+func (r *Reader) ReadAt(p []byte, offset int64) (int, error) {
+	if offset >= r.Size {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if remaining := r.Size - offset; int64(n) > remaining {
+		n = int(remaining)
+	}
+	for i := 0; i < n; i++ {
+		p[i] = At(offset + int64(i))
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Verifier checks written bytes against the generated content
+type Verifier struct {
+	Written int64
+	err     error
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	for i, b := range p {
+		if b != At(v.Written+int64(i)) {
+			v.err = fmt.Errorf("byte %d differs from the generated content", v.Written+int64(i))
+			return i, v.err
+		}
+	}
+	v.Written += int64(len(p))
+	return len(p), nil
+}
+
+// Check returns an error unless exactly size matching bytes were written
+func (v *Verifier) Check(size int64) error {
+	if v.err != nil {
+		return v.err
+	}
+	if v.Written != size {
+		return fmt.Errorf("received %d bytes, expected %d", v.Written, size)
+	}
+	return nil
+}
+
+// PeakHeapGrowth runs f and returns how far the heap grew above where it started, sampled while f runs
+func PeakHeapGrowth(f func()) uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	base := stats.HeapAlloc
+
+	var peak uint64
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > base && stats.HeapAlloc-base > peak {
+				peak = stats.HeapAlloc - base
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	f()
+	close(done)
+	wg.Wait()
+
+	return peak
+}
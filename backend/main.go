@@ -25,6 +25,12 @@ func main() {
 		log.Println("PRIVATE_KEY=your_private_key_here")
 	}
 
+	// Database migrations don't need the server's configuration
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	privateKey := os.Getenv("PRIVATE_KEY")
 	if privateKey == "" {
 		log.Fatal("❌ PRIVATE_KEY environment variable is required. Please add it to .env file")
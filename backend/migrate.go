@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"rebnb/db"
+)
+
+// migrateTimeout bounds a migrate command, backfills on large collections can take a while
+const migrateTimeout = 30 * time.Minute
+
+const migrateUsage = `Usage: rebnb migrate <command>
+
+Commands:
+  up [version]   apply pending migrations, up to version if given
+  down [steps]   roll back the last steps migrations (default 1)
+  status         list migrations and whether they are applied`
+
+// runMigrate runs the migrate subcommand against the database configured in the environment
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	client, err := db.NewClient(nil)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		var target int64
+		if len(args) > 1 {
+			if target, err = strconv.ParseInt(args[1], 10, 64); err != nil || target < 1 {
+				log.Fatalf("❌ Invalid version %q", args[1])
+			}
+		}
+
+		applied, err := client.MigrateUp(ctx, target)
+		for _, migration := range applied {
+			log.Printf("✅ Applied migration %d %s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if len(applied) == 0 {
+			log.Println("Database is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("❌ Invalid number of steps %q", args[1])
+			}
+		}
+
+		rolledBack, err := client.MigrateDown(ctx, steps)
+		for _, migration := range rolledBack {
+			log.Printf("✅ Rolled back migration %d %s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if len(rolledBack) == 0 {
+			log.Println("No migrations to roll back")
+		}
+
+	case "status":
+		statuses, err := client.GetMigrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state, appliedAt := "pending", "-"
+			if status.Applied {
+				state = "applied"
+				appliedAt = status.AppliedAt.Local().Format(time.RFC3339)
+			}
+			if status.Unknown {
+				state += " (unknown to this build)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		w.Flush()
+
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
@@ -0,0 +1,131 @@
+package pinning
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	shell "github.com/ipfs/go-ipfs-api"
+)
+
+// kuboStatWorkers bounds concurrent size lookups when listing pins
+const kuboStatWorkers = 8
+
+// KuboService pins content on a Kubo node through its HTTP RPC API
+type KuboService struct {
+	shell *shell.Shell
+}
+
+// NewKuboService creates a Kubo pinning service
+func NewKuboService(apiURL string) *KuboService {
+	return &KuboService{
+		shell: shell.NewShellWithClient(apiURL, &http.Client{Timeout: 10 * time.Minute}),
+	}
+}
+
+// Name returns the service name
+func (s *KuboService) Name() string {
+	return ServiceKubo
+}
+
+// List returns the node's recursive pins with their sizes
+func (s *KuboService) List(ctx context.Context) ([]Pin, error) {
+	keys, err := s.shell.PinsOfType(ctx, shell.RecursivePin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pins: %v", err)
+	}
+
+	pins := make([]Pin, 0, len(keys))
+	for cid := range keys {
+		pins = append(pins, Pin{CID: cid, Status: StatusPinned})
+	}
+
+	// Pinned content is local, so stats are cheap, but there may be many of them
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for w := 0; w < kuboStatWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if size, err := s.size(ctx, pins[i].CID); err == nil {
+					pins[i].Size = size
+				}
+			}
+		}()
+	}
+	for i := range pins {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return pins, nil
+}
+
+// Status reports whether the node holds a recursive pin for the CID
+func (s *KuboService) Status(ctx context.Context, cid string) (*Pin, error) {
+	var resp struct {
+		Keys map[string]shell.PinInfo
+	}
+	err := s.shell.Request("pin/ls", "/ipfs/"+cid).Option("type", shell.RecursivePin).Exec(ctx, &resp)
+	if err != nil {
+		if isNotPinned(err) {
+			return &Pin{CID: cid, Status: StatusUnpinned}, nil
+		}
+		return nil, fmt.Errorf("failed to get pin status: %v", err)
+	}
+
+	pin := &Pin{CID: cid, Status: StatusPinned}
+	if size, err := s.size(ctx, cid); err == nil {
+		pin.Size = size
+	}
+
+	return pin, nil
+}
+
+// Pin pins the CID recursively, returning once the node has fetched the whole DAG
+func (s *KuboService) Pin(ctx context.Context, cid, name string) (*Pin, error) {
+	if err := s.shell.Request("pin/add", "/ipfs/"+cid).Option("recursive", true).Exec(ctx, nil); err != nil {
+		return nil, fmt.Errorf("failed to pin %s: %v", cid, err)
+	}
+
+	pin, err := s.Status(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+	pin.Name = name
+
+	return pin, nil
+}
+
+// Unpin removes the CID's recursive pin so the node can garbage collect it
+func (s *KuboService) Unpin(ctx context.Context, cid string) error {
+	if err := s.shell.Request("pin/rm", "/ipfs/"+cid).Option("recursive", true).Exec(ctx, nil); err != nil {
+		if isNotPinned(err) {
+			return ErrNotPinned
+		}
+		return fmt.Errorf("failed to unpin %s: %v", cid, err)
+	}
+	return nil
+}
+
+// size returns the file size behind a CID, without fetching anything the node doesn't have
+func (s *KuboService) size(ctx context.Context, cid string) (int64, error) {
+	stat, err := s.shell.FilesStat(ctx, "/ipfs/"+cid, shell.FilesStat.WithLocal(true))
+	if err != nil {
+		return 0, err
+	}
+	if stat.Type == "directory" {
+		return int64(stat.CumulativeSize), nil
+	}
+	return int64(stat.Size), nil
+}
+
+// isNotPinned reports whether a Kubo error means the CID has no pin
+func isNotPinned(err error) bool {
+	return strings.Contains(err.Error(), "not pinned")
+}
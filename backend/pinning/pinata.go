@@ -0,0 +1,238 @@
+package pinning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	pinataAPIURL = "https://api.pinata.cloud"
+	// pinataPageLimit is the largest page the pin list API returns
+	pinataPageLimit = 1000
+)
+
+// PinataService pins content through Pinata's pinning API
+type PinataService struct {
+	jwt        string
+	httpClient *http.Client
+}
+
+// pinataPin represents a row in Pinata's pin list
+type pinataPin struct {
+	IPFSPinHash string `json:"ipfs_pin_hash"`
+	Size        int64  `json:"size"`
+	DatePinned  string `json:"date_pinned"`
+	MimeType    string `json:"mime_type"`
+	Metadata    struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+}
+
+// pinataJob represents a pin-by-hash request still in Pinata's queue
+type pinataJob struct {
+	IPFSPinHash string `json:"ipfs_pin_hash"`
+	Status      string `json:"status"`
+	Name        string `json:"name"`
+	DateQueued  string `json:"date_queued"`
+}
+
+// NewPinataService creates a Pinata pinning service
+func NewPinataService(jwt string) *PinataService {
+	return &PinataService{
+		jwt:        jwt,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name returns the service name
+func (s *PinataService) Name() string {
+	return ServicePinata
+}
+
+// List returns every pinned CID on the account
+func (s *PinataService) List(ctx context.Context) ([]Pin, error) {
+	var pins []Pin
+
+	for offset := 0; ; offset += pinataPageLimit {
+		query := url.Values{
+			"status":     {"pinned"},
+			"pageLimit":  {strconv.Itoa(pinataPageLimit)},
+			"pageOffset": {strconv.Itoa(offset)},
+		}
+
+		rows, err := s.pinList(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			pins = append(pins, *rows[i].pin())
+		}
+
+		if len(rows) < pinataPageLimit {
+			return pins, nil
+		}
+	}
+}
+
+// Status looks the CID up in the pin list, then in the queue of pending pin-by-hash requests
+func (s *PinataService) Status(ctx context.Context, cid string) (*Pin, error) {
+	rows, err := s.pinList(ctx, url.Values{
+		"status":       {"pinned"},
+		"hashContains": {cid},
+		"pageLimit":    {"10"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		if rows[i].IPFSPinHash == cid {
+			return rows[i].pin(), nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pinataAPIURL+"/pinning/pinJobs?"+url.Values{"ipfs_pin_hash": {cid}}.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	var jobs struct {
+		Rows []pinataJob `json:"rows"`
+	}
+	if err := s.do(req, &jobs); err != nil {
+		return nil, err
+	}
+	for _, job := range jobs.Rows {
+		if job.IPFSPinHash == cid {
+			created, _ := time.Parse(time.RFC3339, job.DateQueued)
+			return &Pin{CID: cid, Name: job.Name, Status: jobStatus(job.Status), Created: created}, nil
+		}
+	}
+
+	return &Pin{CID: cid, Status: StatusUnpinned}, nil
+}
+
+// Pin queues the CID to be fetched and pinned by Pinata
+func (s *PinataService) Pin(ctx context.Context, cid, name string) (*Pin, error) {
+	payload := map[string]interface{}{"hashToPin": cid}
+	if name != "" {
+		payload["pinataMetadata"] = map[string]string{"name": name}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pinataAPIURL+"/pinning/pinByHash", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		Status string `json:"status"`
+		Name   string `json:"name"`
+	}
+	if err := s.do(req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &Pin{CID: cid, Name: name, Status: jobStatus(resp.Status), Created: time.Now()}, nil
+}
+
+// Unpin removes the account's pin for the CID
+func (s *PinataService) Unpin(ctx context.Context, cid string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, pinataAPIURL+"/pinning/unpin/"+url.PathEscape(cid), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	err = s.do(req, nil)
+	if err == errPinataNotFound {
+		return ErrNotPinned
+	}
+	return err
+}
+
+// pinList queries one page of the pin list
+func (s *PinataService) pinList(ctx context.Context, query url.Values) ([]pinataPin, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pinataAPIURL+"/data/pinList?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	var resp struct {
+		Rows []pinataPin `json:"rows"`
+	}
+	if err := s.do(req, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Rows, nil
+}
+
+// errPinataNotFound is returned by do for 404 responses
+var errPinataNotFound = fmt.Errorf("pinata API error (status %d)", http.StatusNotFound)
+
+// do sends an authenticated API request and decodes the JSON response into out
+func (s *PinataService) do(req *http.Request, out interface{}) error {
+	req.Header.Set("Authorization", "Bearer "+s.jwt)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errPinataNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("pinata API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	return nil
+}
+
+func (p *pinataPin) pin() *Pin {
+	created, _ := time.Parse(time.RFC3339, p.DatePinned)
+
+	return &Pin{
+		CID:         p.IPFSPinHash,
+		Name:        p.Metadata.Name,
+		Status:      StatusPinned,
+		Size:        p.Size,
+		ContentType: p.MimeType,
+		Created:     created,
+	}
+}
+
+// jobStatus maps a Pinata pin job status onto a pin status
+func jobStatus(status string) string {
+	switch status {
+	case "searching", "prechecking":
+		return StatusQueued
+	case "retrieving":
+		return StatusPinning
+	case "pinned":
+		return StatusPinned
+	case "expired", "over_free_limit", "over_max_size", "invalid_object", "bad_host_node":
+		return StatusFailed
+	default:
+		return StatusQueued
+	}
+}
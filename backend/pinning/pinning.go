@@ -0,0 +1,130 @@
+package pinning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Supported pinning services
+const (
+	ServiceKubo   = "kubo"
+	ServicePinata = "pinata"
+	ServiceRemote = "remote"
+)
+
+// Pin statuses, following the IPFS Pinning Service API
+const (
+	StatusQueued   = "queued"
+	StatusPinning  = "pinning"
+	StatusPinned   = "pinned"
+	StatusFailed   = "failed"
+	StatusUnpinned = "unpinned"
+)
+
+// ErrNotPinned is returned when unpinning a CID the service doesn't hold
+var ErrNotPinned = errors.New("CID is not pinned")
+
+// ErrListTruncated is returned when a service can't page past pins sharing one creation time
+var ErrListTruncated = errors.New("pin list truncated")
+
+// Pin describes a CID held by a pinning service
+type Pin struct {
+	CID         string    `json:"cid"`
+	Name        string    `json:"name,omitempty"`
+	Status      string    `json:"status"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	Created     time.Time `json:"created,omitempty"`
+	RequestID   string    `json:"requestid,omitempty"`
+	Delegates   []string  `json:"delegates,omitempty"`
+}
+
+// Service pins and unpins content by CID
+type Service interface {
+	// Name returns the service name
+	Name() string
+	// List returns every pinned CID
+	List(ctx context.Context) ([]Pin, error)
+	// Status reports whether a CID is pinned, returning StatusUnpinned if the service doesn't hold it
+	Status(ctx context.Context, cid string) (*Pin, error)
+	// Pin asks the service to pin a CID, which may complete asynchronously
+	Pin(ctx context.Context, cid, name string) (*Pin, error)
+	// Unpin removes a CID's pin
+	Unpin(ctx context.Context, cid string) error
+}
+
+// Config holds pinning service configuration
+type Config struct {
+	Service    string
+	KuboAPIURL string
+	PinataJWT  string
+
+	// Pinning Service API
+	RemoteEndpoint string
+	RemoteToken    string
+	RemoteOrigins  []string
+}
+
+// NewConfigFromEnv creates a pinning config from environment variables. Without PINNING_SERVICE,
+// a Pinning Service API endpoint is preferred, then a Kubo node, then Pinata.
+func NewConfigFromEnv() *Config {
+	config := &Config{
+		Service:        strings.ToLower(os.Getenv("PINNING_SERVICE")),
+		KuboAPIURL:     os.Getenv("KUBO_API_URL"),
+		PinataJWT:      os.Getenv("PINATA_JWT"),
+		RemoteEndpoint: os.Getenv("PINNING_SERVICE_ENDPOINT"),
+		RemoteToken:    os.Getenv("PINNING_SERVICE_TOKEN"),
+	}
+
+	for _, origin := range strings.Split(os.Getenv("PINNING_SERVICE_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			config.RemoteOrigins = append(config.RemoteOrigins, origin)
+		}
+	}
+
+	if config.Service == "" {
+		switch {
+		case config.RemoteEndpoint != "":
+			config.Service = ServiceRemote
+		case config.KuboAPIURL != "":
+			config.Service = ServiceKubo
+		default:
+			config.Service = ServicePinata
+		}
+	}
+
+	return config
+}
+
+// New creates the pinning service selected by config
+func New(config *Config) (Service, error) {
+	switch config.Service {
+	case ServiceKubo:
+		apiURL := config.KuboAPIURL
+		if apiURL == "" {
+			apiURL = "http://127.0.0.1:5001"
+		}
+		return NewKuboService(apiURL), nil
+	case ServicePinata:
+		if config.PinataJWT == "" {
+			return nil, fmt.Errorf("pinata pinning requires PINATA_JWT")
+		}
+		return NewPinataService(config.PinataJWT), nil
+	case ServiceRemote:
+		if config.RemoteEndpoint == "" {
+			return nil, fmt.Errorf("remote pinning requires PINNING_SERVICE_ENDPOINT")
+		}
+		// Pinata speaks the Pinning Service API too, so its JWT works when no token is given
+		token := config.RemoteToken
+		if token == "" && strings.Contains(config.RemoteEndpoint, "pinata.cloud") {
+			token = config.PinataJWT
+		}
+		return NewRemoteService(config.RemoteEndpoint, token, config.RemoteOrigins), nil
+	default:
+		return nil, fmt.Errorf("unknown pinning service '%s'", config.Service)
+	}
+}
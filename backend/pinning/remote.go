@@ -0,0 +1,265 @@
+package pinning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// remotePageLimit is the largest page the Pinning Service API allows
+const remotePageLimit = 1000
+
+// RemoteService is a client for the vendor-neutral IPFS Pinning Service API, spoken by Pinata
+// (under /psa), web3.storage-compatible services and self-hosted pinning services
+type RemoteService struct {
+	endpoint   string
+	token      string
+	origins    []string
+	httpClient *http.Client
+}
+
+// RemotePin is the pin object of the Pinning Service API
+type RemotePin struct {
+	CID     string            `json:"cid"`
+	Name    string            `json:"name,omitempty"`
+	Origins []string          `json:"origins,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// RemotePinStatus is a pin request tracked by the service
+type RemotePinStatus struct {
+	RequestID string            `json:"requestid"`
+	Status    string            `json:"status"`
+	Created   time.Time         `json:"created"`
+	Pin       RemotePin         `json:"pin"`
+	Delegates []string          `json:"delegates"`
+	Info      map[string]string `json:"info,omitempty"`
+}
+
+// remoteError is the Pinning Service API error body
+type remoteError struct {
+	Error struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	} `json:"error"`
+}
+
+// NewRemoteService creates a Pinning Service API client. origins are multiaddrs of nodes that
+// already hold the content, passed with every pin request so the service can fetch from them.
+func NewRemoteService(endpoint, token string, origins []string) *RemoteService {
+	return &RemoteService{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		token:      token,
+		origins:    origins,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name returns the service name
+func (s *RemoteService) Name() string {
+	return ServiceRemote
+}
+
+// List returns every pinned CID, paging back through creation time
+func (s *RemoteService) List(ctx context.Context) ([]Pin, error) {
+	var pins []Pin
+	seen := make(map[string]bool)
+
+	query := url.Values{
+		"status": {StatusPinned},
+		"limit":  {strconv.Itoa(remotePageLimit)},
+	}
+	for {
+		results, err := s.Query(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for i := range results {
+			if seen[results[i].RequestID] {
+				continue
+			}
+			seen[results[i].RequestID] = true
+			pins = append(pins, *results[i].pin())
+			added++
+		}
+
+		if len(results) < remotePageLimit {
+			return pins, nil
+		}
+		// A full page of nothing new means a whole page shares one timestamp, which before can't
+		// step past, so the older pins can't be reached
+		if added == 0 {
+			return nil, fmt.Errorf("%w: more than %d pins created at %s", ErrListTruncated, remotePageLimit,
+				results[len(results)-1].Created.Format(time.RFC3339Nano))
+		}
+		// before is exclusive, so the next page starts just after the oldest timestamp to keep
+		// the pins sharing it, and the ones already listed are skipped
+		query.Set("before", results[len(results)-1].Created.Add(time.Nanosecond).Format(time.RFC3339Nano))
+	}
+}
+
+// Status returns the most recent pin request for the CID
+func (s *RemoteService) Status(ctx context.Context, cid string) (*Pin, error) {
+	results, err := s.Query(ctx, url.Values{
+		"cid":    {cid},
+		"status": {strings.Join([]string{StatusQueued, StatusPinning, StatusPinned, StatusFailed}, ",")},
+		"limit":  {"1"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return &Pin{CID: cid, Status: StatusUnpinned}, nil
+	}
+	return results[0].pin(), nil
+}
+
+// Pin requests a pin for the CID, which the service fetches asynchronously
+func (s *RemoteService) Pin(ctx context.Context, cid, name string) (*Pin, error) {
+	status, err := s.Add(ctx, RemotePin{CID: cid, Name: name, Origins: s.origins})
+	if err != nil {
+		return nil, err
+	}
+	return status.pin(), nil
+}
+
+// Unpin removes every pin request for the CID
+func (s *RemoteService) Unpin(ctx context.Context, cid string) error {
+	results, err := s.Query(ctx, url.Values{
+		"cid":    {cid},
+		"status": {strings.Join([]string{StatusQueued, StatusPinning, StatusPinned, StatusFailed}, ",")},
+		"limit":  {strconv.Itoa(remotePageLimit)},
+	})
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return ErrNotPinned
+	}
+
+	for _, result := range results {
+		if err := s.Remove(ctx, result.RequestID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query lists pin requests matching the query, newest first
+func (s *RemoteService) Query(ctx context.Context, query url.Values) ([]RemotePinStatus, error) {
+	var resp struct {
+		Count   int               `json:"count"`
+		Results []RemotePinStatus `json:"results"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/pins?"+query.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// Add creates a pin request
+func (s *RemoteService) Add(ctx context.Context, pin RemotePin) (*RemotePinStatus, error) {
+	var status RemotePinStatus
+	if err := s.do(ctx, http.MethodPost, "/pins", pin, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Get returns a pin request by its request ID
+func (s *RemoteService) Get(ctx context.Context, requestID string) (*RemotePinStatus, error) {
+	var status RemotePinStatus
+	if err := s.do(ctx, http.MethodGet, "/pins/"+url.PathEscape(requestID), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Replace swaps the pin behind a request ID for a new one, returning the new request
+func (s *RemoteService) Replace(ctx context.Context, requestID string, pin RemotePin) (*RemotePinStatus, error) {
+	var status RemotePinStatus
+	if err := s.do(ctx, http.MethodPost, "/pins/"+url.PathEscape(requestID), pin, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Remove deletes a pin request
+func (s *RemoteService) Remove(ctx context.Context, requestID string) error {
+	err := s.do(ctx, http.MethodDelete, "/pins/"+url.PathEscape(requestID), nil, nil)
+	if err == errRemoteNotFound {
+		return ErrNotPinned
+	}
+	return err
+}
+
+// errRemoteNotFound is returned by do for 404 responses
+var errRemoteNotFound = fmt.Errorf("pinning service error (status %d)", http.StatusNotFound)
+
+// do sends an authenticated API request with an optional JSON body and decodes the JSON response into out
+func (s *RemoteService) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errRemoteNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr remoteError
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Reason != "" {
+			return fmt.Errorf("pinning service error (status %d): %s: %s", resp.StatusCode, apiErr.Error.Reason, apiErr.Error.Details)
+		}
+		return fmt.Errorf("pinning service error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	return nil
+}
+
+func (s *RemotePinStatus) pin() *Pin {
+	return &Pin{
+		CID:       s.Pin.CID,
+		Name:      s.Pin.Name,
+		Status:    s.Status,
+		Created:   s.Created,
+		RequestID: s.RequestID,
+		Delegates: s.Delegates,
+	}
+}
@@ -0,0 +1,195 @@
+package pinning
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testToken = "test-token"
+
+// fakePinningService is an in-memory Pinning Service API
+type fakePinningService struct {
+	mu     sync.Mutex
+	pins   map[string]*RemotePinStatus
+	nextID int
+}
+
+func newFakePinningService(t *testing.T) (*fakePinningService, *RemoteService) {
+	fake := &fakePinningService{pins: make(map[string]*RemotePinStatus)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return fake, NewRemoteService(server.URL+"/", testToken, []string{"/ip4/127.0.0.1/tcp/4001"})
+}
+
+// add stores a pinned request created at the given time
+func (f *fakePinningService) add(cid string, created time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	id := strconv.Itoa(f.nextID)
+	f.pins[id] = &RemotePinStatus{RequestID: id, Status: StatusPinned, Created: created, Pin: RemotePin{CID: cid}}
+}
+
+func (f *fakePinningService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"reason":"UNAUTHORIZED","details":"invalid token"}}`)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := strings.TrimPrefix(r.URL.Path, "/pins/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/pins":
+		f.query(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/pins":
+		var pin RemotePin
+		if err := json.NewDecoder(r.Body).Decode(&pin); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.nextID++
+		status := &RemotePinStatus{RequestID: strconv.Itoa(f.nextID), Status: StatusQueued, Created: time.Now(), Pin: pin}
+		f.pins[status.RequestID] = status
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(status)
+	case r.Method == http.MethodDelete && f.pins[id] != nil:
+		delete(f.pins, id)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// query answers GET /pins, newest first, with before as an exclusive bound
+func (f *fakePinningService) query(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	statuses := strings.Split(query.Get("status"), ",")
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	before, _ := time.Parse(time.RFC3339Nano, query.Get("before"))
+
+	var results []RemotePinStatus
+	for _, pin := range f.pins {
+		if cid := query.Get("cid"); cid != "" && pin.Pin.CID != cid {
+			continue
+		}
+		if !before.IsZero() && !pin.Created.Before(before) {
+			continue
+		}
+		for _, status := range statuses {
+			if pin.Status == status {
+				results = append(results, *pin)
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].Created.Equal(results[j].Created) {
+			return results[i].Created.After(results[j].Created)
+		}
+		return results[i].RequestID < results[j].RequestID
+	})
+
+	count := len(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"count": count, "results": results})
+}
+
+func TestRemoteListPagesThroughSharedTimestamps(t *testing.T) {
+	fake, service := newFakePinningService(t)
+
+	// Pins are created in bursts sharing a timestamp, so page boundaries fall inside a burst
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	total := 2*remotePageLimit + 500
+	for i := 0; i < total; i++ {
+		fake.add(fmt.Sprintf("cid-%d", i), start.Add(time.Duration(i/7)*time.Second))
+	}
+
+	pins, err := service.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != total {
+		t.Fatalf("List returned %d pins, want %d", len(pins), total)
+	}
+	seen := make(map[string]bool)
+	for _, pin := range pins {
+		if seen[pin.CID] {
+			t.Fatalf("List returned %s twice", pin.CID)
+		}
+		seen[pin.CID] = true
+	}
+}
+
+func TestRemoteListReportsUnreachablePins(t *testing.T) {
+	fake, service := newFakePinningService(t)
+
+	// One more pin than a page shares a timestamp, so the oldest can't be paged to
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= remotePageLimit; i++ {
+		fake.add(fmt.Sprintf("cid-%d", i), created)
+	}
+
+	if pins, err := service.List(context.Background()); !errors.Is(err, ErrListTruncated) {
+		t.Fatalf("List = %d pins, %v, want %v", len(pins), err, ErrListTruncated)
+	}
+}
+
+func TestRemotePinLifecycle(t *testing.T) {
+	ctx := context.Background()
+	_, service := newFakePinningService(t)
+
+	pin, err := service.Pin(ctx, "bafy-test", "photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Status != StatusQueued || pin.RequestID == "" {
+		t.Errorf("Pin returned status %q with request ID %q", pin.Status, pin.RequestID)
+	}
+
+	status, err := service.Status(ctx, "bafy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.RequestID != pin.RequestID || status.Name != "photo.jpg" {
+		t.Errorf("Status returned %+v, want request %s", status, pin.RequestID)
+	}
+
+	if err := service.Unpin(ctx, "bafy-test"); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := service.Status(ctx, "bafy-test"); err != nil || status.Status != StatusUnpinned {
+		t.Errorf("Status after Unpin = %+v, %v", status, err)
+	}
+	if err := service.Unpin(ctx, "bafy-test"); !errors.Is(err, ErrNotPinned) {
+		t.Errorf("second Unpin returned %v, want ErrNotPinned", err)
+	}
+	if err := service.Remove(ctx, "missing"); !errors.Is(err, ErrNotPinned) {
+		t.Errorf("Remove of an unknown request returned %v, want ErrNotPinned", err)
+	}
+}
+
+func TestRemoteReportsAPIErrors(t *testing.T) {
+	_, service := newFakePinningService(t)
+	service.token = "wrong"
+
+	_, err := service.Status(context.Background(), "bafy-test")
+	if err == nil || !strings.Contains(err.Error(), "UNAUTHORIZED") || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("Status with a bad token returned %v", err)
+	}
+}
@@ -4,9 +4,17 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"os"
+	"rebnb/blobstore"
+	"rebnb/db"
+	"rebnb/rest/handlers/auth"
+	"rebnb/zerog"
+	"strconv"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -14,19 +22,32 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// Mock 0G Storage client interface for development
-// In production, replace with actual 0G Storage SDK
+// Page size bounds for the file list
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// multipartMemory is how much of a multipart upload is kept in memory before the rest is spooled to disk
+const multipartMemory = 1 << 20
+
+// uploadTimeout bounds an upload, including the flow submission and waiting for the node to finalize
+const uploadTimeout = 10 * time.Minute
 
 // StorageClient represents a 0G Storage client
 type StorageClient struct {
 	privateKey *ecdsa.PrivateKey
 	endpoint   string
 	testnet    bool
+	node       *zerog.NodeClient
+	client     *zerog.Client
 }
 
-// Server wraps the storage client for HTTP handlers
+// Server wraps the storage client and the file catalog for HTTP handlers. Files stays nil
+// while the database is unavailable.
 type Server struct {
 	Client *StorageClient
+	Files  db.FileRepository
 }
 
 // FileMetadata represents metadata for uploaded files
@@ -36,6 +57,7 @@ type FileMetadata struct {
 	FileSize    int64     `json:"file_size"`
 	UploadTime  time.Time `json:"upload_time"`
 	ContentType string    `json:"content_type"`
+	TxHash      string    `json:"tx_hash,omitempty"`
 }
 
 // UploadResponse represents the response for file uploads
@@ -55,6 +77,11 @@ type DownloadResponse struct {
 	FileSize    int64  `json:"file_size"`
 	ContentType string `json:"content_type"`
 	Available   bool   `json:"available"`
+
+	UploaderWallet string     `json:"uploader_wallet,omitempty"`
+	PropertyID     string     `json:"property_id,omitempty"`
+	TxHash         string     `json:"tx_hash,omitempty"`
+	UploadedAt     *time.Time `json:"uploaded_at,omitempty"`
 }
 
 // ErrorResponse represents an error response
@@ -64,7 +91,8 @@ type ErrorResponse struct {
 	Success bool   `json:"success"`
 }
 
-// NewStorageClient creates a new 0G Storage client
+// NewStorageClient creates a new 0G Storage client. ZEROG_NODE_URL overrides the storage node,
+// and "stub" runs an in-memory node for local development.
 func NewStorageClient(ctx context.Context, privateKeyHex string, testnet bool) (*StorageClient, error) {
 	// Remove 0x prefix if present
 	if len(privateKeyHex) >= 2 && privateKeyHex[:2] == "0x" {
@@ -86,58 +114,158 @@ func NewStorageClient(ctx context.Context, privateKeyHex string, testnet bool) (
 	if !testnet {
 		endpoint = "https://rpc-storage.0g.ai"
 	}
+	if url := os.Getenv("ZEROG_NODE_URL"); url != "" {
+		endpoint = url
+	}
+
+	var node *zerog.NodeClient
+	if endpoint == "stub" {
+		node, err = zerog.NewStubNode().Client()
+	} else {
+		node, err = zerog.DialNode(ctx, endpoint)
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	return &StorageClient{
 		privateKey: privateKey,
 		endpoint:   endpoint,
 		testnet:    testnet,
+		node:       node,
+		client:     zerog.NewClient(node, nil),
 	}, nil
 }
 
+// EnableFlowSubmission submits uploads to the flow contract in ZEROG_FLOW_CONTRACT through the transactor.
+// Real storage nodes only accept segments for files submitted to the flow.
+func (c *StorageClient) EnableFlowSubmission(transactor zerog.Transactor) error {
+	address := os.Getenv("ZEROG_FLOW_CONTRACT")
+	if address == "" {
+		return fmt.Errorf("ZEROG_FLOW_CONTRACT not set")
+	}
+	if !common.IsHexAddress(address) {
+		return fmt.Errorf("invalid flow contract address: %s", address)
+	}
+
+	flow, err := zerog.NewFlow(common.HexToAddress(address), transactor)
+	if err != nil {
+		return err
+	}
+
+	c.client.SetFlow(flow)
+	return nil
+}
+
 // Close closes the storage client connection
 func (c *StorageClient) Close() {
-	// Cleanup if needed
+	c.node.Close()
 }
 
-// uploadFile simulates uploading a file to 0G Storage
-// In production, this would use the actual 0G Storage SDK
-func (c *StorageClient) uploadFile(ctx context.Context, data []byte, filename string) (*FileMetadata, error) {
-	// Generate a mock root hash (in production, this would be calculated by 0G Storage)
-	hash := crypto.Keccak256Hash(data)
-	rootHash := hash.Hex()
+// uploadFile uploads a file to 0G Storage, returning its Merkle root. The content is read in
+// segments, once for the Merkle tree and again for the upload, so it's never held in memory.
+func (c *StorageClient) uploadFile(ctx context.Context, r io.ReaderAt, size int64, filename string) (*FileMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, uploadTimeout)
+	defer cancel()
 
-	// Detect content type
-	contentType := http.DetectContentType(data)
+	result, err := c.client.Upload(ctx, r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 512)
+	n, _ := r.ReadAt(head, 0)
 
 	metadata := &FileMetadata{
-		RootHash:    rootHash,
+		RootHash:    result.Root.Hex(),
 		FileName:    filename,
-		FileSize:    int64(len(data)),
+		FileSize:    result.Size,
 		UploadTime:  time.Now(),
-		ContentType: contentType,
+		ContentType: http.DetectContentType(head[:n]),
+	}
+	if result.TxHash != (common.Hash{}) {
+		metadata.TxHash = result.TxHash.Hex()
 	}
-
-	// In production, this would:
-	// 1. Split file into chunks
-	// 2. Calculate merkle tree
-	// 3. Submit to 0G Storage network
-	// 4. Wait for confirmation
 
 	return metadata, nil
 }
 
-// downloadFile simulates downloading a file from 0G Storage
-// In production, this would use the actual 0G Storage SDK
-func (c *StorageClient) downloadFile(ctx context.Context, rootHash string) ([]byte, *FileMetadata, error) {
-	// Mock implementation - in production this would retrieve from 0G Storage
-	// For now, return an error indicating file not found
-	return nil, nil, fmt.Errorf("file not found in 0G Storage network")
+// downloadFile streams a file from 0G Storage to w, verifying each segment against the root before it's written
+func (c *StorageClient) downloadFile(ctx context.Context, rootHash string, w io.Writer) (int64, error) {
+	return c.client.Download(ctx, common.HexToHash(rootHash), w)
 }
 
 // getFileInfo retrieves file metadata from 0G Storage
 func (c *StorageClient) getFileInfo(ctx context.Context, rootHash string) (*FileMetadata, error) {
-	// Mock implementation - in production this would query 0G Storage
-	return nil, fmt.Errorf("file metadata not found")
+	info, err := c.client.FileInfo(ctx, common.HexToHash(rootHash))
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMetadata{
+		RootHash:    info.Tx.DataMerkleRoot.Hex(),
+		FileName:    rootHash,
+		FileSize:    int64(info.Tx.Size),
+		ContentType: "application/octet-stream",
+	}, nil
+}
+
+// Upload stores content on 0G Storage and returns its root hash, so the client can back a blob store.
+// Content that isn't already a file is spooled to a temporary one, since it's read more than once.
+func (c *StorageClient) Upload(ctx context.Context, r io.Reader, name string) (string, int64, error) {
+	file, ok := r.(*os.File)
+	if !ok {
+		tmp, err := os.CreateTemp("", "0g-upload-*")
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to create temporary file: %v", err)
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if _, err := io.Copy(tmp, r); err != nil {
+			return "", 0, fmt.Errorf("failed to read content: %v", err)
+		}
+		file = tmp
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to stat content: %v", err)
+	}
+
+	metadata, err := c.uploadFile(ctx, file, stat.Size(), name)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return metadata.RootHash, metadata.FileSize, nil
+}
+
+// Download opens the content stored under a root hash. Segments are verified and streamed as the
+// caller reads, and closing the reader early stops the download.
+func (c *StorageClient) Download(ctx context.Context, rootHash string) (io.ReadCloser, int64, error) {
+	metadata, err := c.getFileInfo(ctx, rootHash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := c.downloadFile(ctx, rootHash, writer)
+		writer.CloseWithError(err)
+	}()
+
+	return reader, metadata.FileSize, nil
+}
+
+// FileInfo returns the size of the content stored under a root hash
+func (c *StorageClient) FileInfo(ctx context.Context, rootHash string) (int64, error) {
+	metadata, err := c.getFileInfo(ctx, rootHash)
+	if err != nil {
+		return 0, err
+	}
+
+	return metadata.FileSize, nil
 }
 
 // HandleUploadFile handles file uploads to 0G Storage
@@ -145,9 +273,19 @@ func HandleUploadFile(server *Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := context.Background()
 
-		// Get file from form
-		file, header, err := c.Request.FormFile("file")
-		if err != nil {
+		// Bound the request body, then spool the file to disk rather than memory
+		maxSize := int64(100 * 1024 * 1024) // 100MB limit
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartMemory)
+		if err := c.Request.ParseMultipartForm(multipartMemory); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Error:   "file_too_large",
+					Message: fmt.Sprintf("File size exceeds maximum limit of %d bytes", maxSize),
+					Success: false,
+				})
+				return
+			}
 			c.JSON(http.StatusBadRequest, ErrorResponse{
 				Error:   "file_required",
 				Message: "File is required",
@@ -155,22 +293,21 @@ func HandleUploadFile(server *Server) gin.HandlerFunc {
 			})
 			return
 		}
-		defer file.Close()
 
-		// Read file content
-		content, err := io.ReadAll(file)
+		// Get file from form
+		file, header, err := c.Request.FormFile("file")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Error:   "file_read_error",
-				Message: "Failed to read file content",
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "file_required",
+				Message: "File is required",
 				Success: false,
 			})
 			return
 		}
+		defer file.Close()
 
 		// Check file size (0G Storage has limits)
-		maxSize := int64(100 * 1024 * 1024) // 100MB limit
-		if int64(len(content)) > maxSize {
+		if header.Size > maxSize {
 			c.JSON(http.StatusBadRequest, ErrorResponse{
 				Error:   "file_too_large",
 				Message: fmt.Sprintf("File size exceeds maximum limit of %d bytes", maxSize),
@@ -180,7 +317,7 @@ func HandleUploadFile(server *Server) gin.HandlerFunc {
 		}
 
 		// Upload to 0G Storage
-		metadata, err := server.Client.uploadFile(ctx, content, header.Filename)
+		metadata, err := server.Client.uploadFile(ctx, file, header.Size, header.Filename)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{
 				Error:   "upload_failed",
@@ -190,13 +327,31 @@ func HandleUploadFile(server *Server) gin.HandlerFunc {
 			return
 		}
 
+		// Record the upload in the file catalog
+		if server.Files != nil {
+			wallet, _ := auth.WalletFromContext(c)
+			if err := server.Files.SaveFile(ctx, &db.StoredFile{
+				Hash:           metadata.RootHash,
+				Backend:        blobstore.BackendZeroG,
+				Name:           metadata.FileName,
+				Size:           metadata.FileSize,
+				ContentType:    metadata.ContentType,
+				Source:         db.FileSourceStorageUpload,
+				UploaderWallet: wallet,
+				PropertyID:     c.PostForm("property_id"),
+				TxHash:         metadata.TxHash,
+			}); err != nil {
+				log.Printf("⚠️  Failed to catalog upload %s: %v", metadata.RootHash, err)
+			}
+		}
+
 		response := UploadResponse{
 			RootHash: metadata.RootHash,
 			FileName: metadata.FileName,
 			FileSize: metadata.FileSize,
 			Message:  "File uploaded successfully to 0G Storage",
 			Success:  true,
-			TxHash:   "", // Would be populated with actual transaction hash
+			TxHash:   metadata.TxHash,
 		}
 
 		c.JSON(http.StatusOK, response)
@@ -232,8 +387,8 @@ func HandleGetFile(server *Server) gin.HandlerFunc {
 			return
 		}
 
-		// Download from 0G Storage
-		content, metadata, err := server.Client.downloadFile(ctx, rootHash)
+		// Look the file up first, so a missing file still gets an error response
+		metadata, err := server.Client.getFileInfo(ctx, rootHash)
 		if err != nil {
 			c.JSON(http.StatusNotFound, ErrorResponse{
 				Error:   "file_not_found",
@@ -243,17 +398,64 @@ func HandleGetFile(server *Server) gin.HandlerFunc {
 			return
 		}
 
-		// Set headers for file download
-		c.Header("Content-Type", metadata.ContentType)
-		c.Header("Content-Length", fmt.Sprintf("%d", len(content)))
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", metadata.FileName))
-		c.Header("X-Root-Hash", metadata.RootHash)
+		// Prefer the name and type the file was uploaded with
+		metadata.ContentType = ""
+		if file := server.lookupFile(ctx, metadata.RootHash); file != nil {
+			metadata.FileName = file.Name
+			metadata.ContentType = file.ContentType
+		}
 
-		// Return file content
-		c.Data(http.StatusOK, metadata.ContentType, content)
+		// Stream the verified segments, setting headers once the first one arrives
+		w := &downloadWriter{c: c, metadata: metadata}
+		if _, err := server.Client.downloadFile(ctx, rootHash, w); err != nil {
+			if !w.started {
+				c.JSON(http.StatusNotFound, ErrorResponse{
+					Error:   "file_not_found",
+					Message: fmt.Sprintf("Failed to download from 0G Storage: %v", err),
+					Success: false,
+				})
+				return
+			}
+			// The body is cut short of its Content-Length, so the client sees the failure
+			log.Printf("⚠️  Download of %s failed mid-stream: %v", metadata.RootHash, err)
+			c.Abort()
+			return
+		}
+		if !w.started {
+			// An empty file, headers still need writing
+			w.Write(nil)
+		}
 	}
 }
 
+// downloadWriter writes a download's headers before its first bytes, sniffing the content type
+// from them when the catalog doesn't have it
+type downloadWriter struct {
+	c        *gin.Context
+	metadata *FileMetadata
+	started  bool
+}
+
+func (w *downloadWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+
+		contentType := w.metadata.ContentType
+		if contentType == "" {
+			contentType = http.DetectContentType(p)
+		}
+
+		// Set headers for file download
+		w.c.Header("Content-Type", contentType)
+		w.c.Header("Content-Length", fmt.Sprintf("%d", w.metadata.FileSize))
+		w.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", w.metadata.FileName))
+		w.c.Header("X-Root-Hash", w.metadata.RootHash)
+		w.c.Status(http.StatusOK)
+	}
+
+	return w.c.Writer.Write(p)
+}
+
 // HandleGetFileInfo handles requests for file metadata
 func HandleGetFileInfo(server *Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -269,15 +471,24 @@ func HandleGetFileInfo(server *Server) gin.HandlerFunc {
 			return
 		}
 
+		if len(rootHash) < 2 || rootHash[:2] != "0x" {
+			rootHash = "0x" + rootHash
+		}
+		file := server.lookupFile(ctx, common.HexToHash(rootHash).Hex())
+
 		// Get file info from 0G Storage
 		metadata, err := server.Client.getFileInfo(ctx, rootHash)
 		if err != nil {
-			c.JSON(http.StatusNotFound, ErrorResponse{
-				Error:   "file_not_found",
-				Message: fmt.Sprintf("File metadata not found: %v", err),
-				Success: false,
-			})
-			return
+			// A cataloged file the node no longer has is reported as unavailable
+			if file == nil {
+				c.JSON(http.StatusNotFound, ErrorResponse{
+					Error:   "file_not_found",
+					Message: fmt.Sprintf("File metadata not found: %v", err),
+					Success: false,
+				})
+				return
+			}
+			metadata = &FileMetadata{RootHash: file.Hash, FileSize: file.Size}
 		}
 
 		response := DownloadResponse{
@@ -285,22 +496,70 @@ func HandleGetFileInfo(server *Server) gin.HandlerFunc {
 			FileName:    metadata.FileName,
 			FileSize:    metadata.FileSize,
 			ContentType: metadata.ContentType,
-			Available:   true,
+			Available:   err == nil,
+		}
+		if file != nil {
+			response.FileName = file.Name
+			response.ContentType = file.ContentType
+			response.UploaderWallet = file.UploaderWallet
+			response.PropertyID = file.PropertyID
+			response.TxHash = file.TxHash
+			response.UploadedAt = &file.CreatedAt
 		}
 
 		c.JSON(http.StatusOK, response)
 	}
 }
 
-// HandleListFiles handles requests to list uploaded files
+// HandleListFiles lists the authenticated wallet's uploads from the file catalog, newest first.
+// Supports page, limit and backend query parameters.
 func HandleListFiles(server *Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Mock implementation - in production this would query user's files
-		files := []FileMetadata{}
+		// Check if MongoDB client is initialized
+		if server.Files == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
+
+		page, err := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_page",
+				Message: "page must be a positive integer",
+				Success: false,
+			})
+			return
+		}
+
+		limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.Itoa(defaultListLimit)), 10, 64)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_limit",
+				Message: fmt.Sprintf("limit must be between 1 and %d", maxListLimit),
+				Success: false,
+			})
+			return
+		}
+
+		wallet, _ := auth.WalletFromContext(c)
+		files, total, err := server.Files.ListFilesByUploader(c.Request.Context(), wallet, c.Query("backend"), page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:   "list_failed",
+				Message: fmt.Sprintf("Failed to list files: %v", err),
+				Success: false,
+			})
+			return
+		}
 
 		response := map[string]interface{}{
 			"files":   files,
 			"count":   len(files),
+			"total":   total,
+			"page":    page,
+			"limit":   limit,
 			"success": true,
 			"message": "Files retrieved successfully",
 		}
@@ -309,14 +568,35 @@ func HandleListFiles(server *Server) gin.HandlerFunc {
 	}
 }
 
-// HandleStorageStats handles requests for storage statistics
+// HandleStorageStats reports the authenticated wallet's usage from the file catalog
 func HandleStorageStats(server *Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Check if MongoDB client is initialized
+		if server.Files == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
+
+		wallet, _ := auth.WalletFromContext(c)
+		usage, err := server.Files.GetFileStatsByUploader(c.Request.Context(), wallet)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:   "stats_failed",
+				Message: fmt.Sprintf("Failed to get storage stats: %v", err),
+				Success: false,
+			})
+			return
+		}
+
 		stats := map[string]interface{}{
 			"network_status":    "connected",
 			"available_storage": "unlimited",
-			"used_storage":      "0 bytes",
-			"file_count":        0,
+			"used_storage":      formatBytes(usage.TotalSize),
+			"used_bytes":        usage.TotalSize,
+			"file_count":        usage.FileCount,
+			"backends":          usage.Backends,
 			"testnet":           server.Client.testnet,
 			"endpoint":          server.Client.endpoint,
 		}
@@ -324,3 +604,32 @@ func HandleStorageStats(server *Server) gin.HandlerFunc {
 		c.JSON(http.StatusOK, stats)
 	}
 }
+
+// lookupFile returns the catalog entry for a root hash, or nil when there is none or no database
+func (s *Server) lookupFile(ctx context.Context, rootHash string) *db.StoredFile {
+	if s.Files == nil {
+		return nil
+	}
+
+	file, err := s.Files.GetFileByHash(ctx, rootHash)
+	if err != nil {
+		log.Printf("⚠️  Failed to look up %s in the file catalog: %v", rootHash, err)
+		return nil
+	}
+	return file
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "1.5 MiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d bytes", n)
+	}
+
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,168 @@
+package gstorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+
+	"rebnb/internal/streamtest"
+	"rebnb/zerog"
+)
+
+// fakeNode is a storage node holding one generated file. Uploaded segments are checked against
+// their proofs and dropped, downloads are regenerated, so the node holds none of the content.
+type fakeNode struct {
+	tree   *zerog.Tree
+	layout zerog.Layout
+
+	mu       sync.Mutex
+	uploaded map[uint64]bool
+}
+
+func newFakeNode(t testing.TB, size int64) *fakeNode {
+	tree, layout, err := zerog.BuildFileTree(streamtest.NewReader(size), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakeNode{tree: tree, layout: layout, uploaded: make(map[uint64]bool)}
+}
+
+// GetFileInfo implements zgs_getFileInfo
+func (n *fakeNode) GetFileInfo(ctx context.Context, root common.Hash) (*zerog.FileInfo, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if root != n.tree.Root() || len(n.uploaded) == 0 {
+		return nil, nil
+	}
+	return &zerog.FileInfo{
+		Tx:             zerog.FileTx{DataMerkleRoot: root, Size: uint64(n.layout.Size)},
+		Finalized:      uint64(len(n.uploaded)) == n.layout.NumSegments(),
+		UploadedSegNum: uint64(len(n.uploaded)),
+	}, nil
+}
+
+// UploadSegment implements zgs_uploadSegment
+func (n *fakeNode) UploadSegment(ctx context.Context, segment zerog.SegmentWithProof) error {
+	if segment.Root != n.tree.Root() {
+		return fmt.Errorf("unknown root %s", segment.Root.Hex())
+	}
+	padded, err := n.layout.PadSegment(segment.Index, segment.Data)
+	if err != nil {
+		return err
+	}
+	if err := segment.Proof.Validate(segment.Root, zerog.SegmentRoot(padded), segment.Index, n.layout.NumSegmentsPadded()); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	n.uploaded[segment.Index] = true
+	n.mu.Unlock()
+	return nil
+}
+
+// DownloadSegmentWithProof implements zgs_downloadSegmentWithProof
+func (n *fakeNode) DownloadSegmentWithProof(ctx context.Context, root common.Hash, index uint64) (*zerog.SegmentWithProof, error) {
+	if root != n.tree.Root() || index >= n.layout.NumSegments() {
+		return nil, nil
+	}
+
+	start, _ := n.layout.SegmentRange(index)
+	data := make([]byte, n.layout.DataLength(index))
+	streamtest.NewReader(n.layout.Size).ReadAt(data, start)
+
+	proof, err := n.tree.Proof(int(index))
+	if err != nil {
+		return nil, err
+	}
+	return &zerog.SegmentWithProof{Root: root, Data: data, Index: index, Proof: *proof, FileSize: uint64(n.layout.Size)}, nil
+}
+
+// newFakeStorage serves a fake node over HTTP and returns a storage client connected to it
+func newFakeStorage(t testing.TB, size int64) *StorageClient {
+	server := rpc.NewServer()
+	if err := server.RegisterName("zgs", newFakeNode(t, size)); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	t.Cleanup(server.Stop)
+
+	node, err := zerog.DialNode(context.Background(), httpServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(node.Close)
+
+	return &StorageClient{node: node, client: zerog.NewClient(node, nil)}
+}
+
+// roundTrip uploads size generated bytes, then downloads them through HandleGetFile into a verifier
+func roundTrip(t testing.TB, client *StorageClient, size int64) {
+	metadata, err := client.uploadFile(context.Background(), streamtest.NewReader(size), size, "large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.FileSize != size {
+		t.Fatalf("uploaded %d bytes, want %d", metadata.FileSize, size)
+	}
+
+	router := gin.New()
+	router.GET("/files/:root_hash", HandleGetFile(&Server{Client: client}))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/files/" + metadata.RootHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("download status %d", resp.StatusCode)
+	}
+
+	verifier := &streamtest.Verifier{}
+	io.Copy(verifier, resp.Body)
+	if err := verifier.Check(size); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransferStreams(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams a 500MB upload and download")
+	}
+	gin.SetMode(gin.TestMode)
+	client := newFakeStorage(t, streamtest.TransferSize)
+
+	growth := streamtest.PeakHeapGrowth(func() {
+		roundTrip(t, client, streamtest.TransferSize)
+	})
+	if growth > streamtest.MaxHeapGrowth {
+		t.Errorf("heap grew by %d bytes transferring %d", growth, streamtest.TransferSize)
+	}
+}
+
+func BenchmarkTransfer(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	client := newFakeStorage(b, streamtest.TransferSize)
+	b.ReportAllocs()
+	b.SetBytes(2 * streamtest.TransferSize)
+
+	var peak uint64
+	for i := 0; i < b.N; i++ {
+		growth := streamtest.PeakHeapGrowth(func() {
+			roundTrip(b, client, streamtest.TransferSize)
+		})
+		peak = max(peak, growth)
+	}
+	b.ReportMetric(float64(peak), "peak-heap-bytes")
+}
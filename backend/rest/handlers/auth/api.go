@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"rebnb/db"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config holds Sign-In With Ethereum configuration
+type Config struct {
+	Domain     string // domain messages must be bound to, the host of the site users sign in on
+	ChainID    string // chain ID messages must be bound to
+	NonceTTL   time.Duration
+	SessionTTL time.Duration
+}
+
+// NewConfigFromEnv creates a new auth config from environment variables
+func NewConfigFromEnv() *Config {
+	config := &Config{
+		Domain:     os.Getenv("SIWE_DOMAIN"),
+		ChainID:    os.Getenv("SIWE_CHAIN_ID"),
+		NonceTTL:   10 * time.Minute,
+		SessionTTL: 24 * time.Hour,
+	}
+
+	if d, err := time.ParseDuration(os.Getenv("SIWE_NONCE_TTL")); err == nil && d > 0 {
+		config.NonceTTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("SESSION_TTL")); err == nil && d > 0 {
+		config.SessionTTL = d
+	}
+
+	return config
+}
+
+// Validate checks that messages can be bound to a domain and chain. Without them a signature
+// collected by any other site would sign in here.
+func (c *Config) Validate() error {
+	if c.Domain == "" {
+		return fmt.Errorf("SIWE_DOMAIN is required")
+	}
+	if c.ChainID == "" {
+		return fmt.Errorf("SIWE_CHAIN_ID is required")
+	}
+	return nil
+}
+
+// Server holds what the auth handlers and middleware need. Sessions stays nil while the
+// database is unavailable.
+type Server struct {
+	Config   *Config
+	Sessions db.SessionRepository
+}
+
+// NonceResponse represents the response for the nonce endpoint
+type NonceResponse struct {
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// VerifyRequest represents the request payload for the verify endpoint
+type VerifyRequest struct {
+	Message   string `json:"message" binding:"required"`
+	Signature string `json:"signature" binding:"required"`
+}
+
+// SessionResponse represents an issued or current session
+type SessionResponse struct {
+	Token         string    `json:"token,omitempty"`
+	WalletAddress string    `json:"wallet_address"`
+	ChainID       string    `json:"chain_id"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// HandleNonce issues a single-use nonce to embed in a SIWE message
+func HandleNonce(server *Server) gin.HandlerFunc {
+	config := server.Config
+	return func(c *gin.Context) {
+		// Check if MongoDB client is initialized
+		if server.Sessions == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
+
+		nonce, err := randomHex(16)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to generate nonce: " + err.Error(),
+			})
+			return
+		}
+
+		record := &db.AuthNonce{
+			Nonce:     nonce,
+			ExpiresAt: time.Now().Add(config.NonceTTL),
+		}
+		if err := server.Sessions.InsertAuthNonce(c.Request.Context(), record); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to store nonce: " + err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, NonceResponse{
+			Nonce:     record.Nonce,
+			ExpiresAt: record.ExpiresAt,
+		})
+	}
+}
+
+// HandleVerify checks a signed SIWE message and issues a session token for the signer
+func HandleVerify(server *Server) gin.HandlerFunc {
+	config := server.Config
+	return func(c *gin.Context) {
+		// Check if MongoDB client is initialized
+		if server.Sessions == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
+
+		var request VerifyRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request payload: " + err.Error(),
+			})
+			return
+		}
+
+		message, err := ParseSIWEMessage(request.Message)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid SIWE message: " + err.Error(),
+			})
+			return
+		}
+
+		if message.Domain != config.Domain {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Message domain does not match " + config.Domain,
+			})
+			return
+		}
+		if message.ChainID != config.ChainID {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Message chain ID does not match " + config.ChainID,
+			})
+			return
+		}
+		if err := message.ValidateTime(time.Now()); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid SIWE message: " + err.Error(),
+			})
+			return
+		}
+
+		signer, err := RecoverSigner(request.Message, request.Signature)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid signature: " + err.Error(),
+			})
+			return
+		}
+		if signer != message.Address {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Signature does not match message address",
+			})
+			return
+		}
+
+		ctx := c.Request.Context()
+
+		// Only consume the nonce once the signature checks out
+		if err := server.Sessions.ConsumeAuthNonce(ctx, message.Nonce); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid nonce: " + err.Error(),
+			})
+			return
+		}
+
+		token, err := randomHex(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to generate session token: " + err.Error(),
+			})
+			return
+		}
+
+		expiresAt := time.Now().Add(config.SessionTTL)
+		if message.ExpirationTime != nil && message.ExpirationTime.Before(expiresAt) {
+			expiresAt = *message.ExpirationTime
+		}
+
+		session := &db.Session{
+			TokenHash:     hashToken(token),
+			WalletAddress: signer.Hex(),
+			ChainID:       message.ChainID,
+			ExpiresAt:     expiresAt,
+		}
+		if err := server.Sessions.InsertSession(ctx, session); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to store session: " + err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, SessionResponse{
+			Token:         token,
+			WalletAddress: session.WalletAddress,
+			ChainID:       session.ChainID,
+			ExpiresAt:     session.ExpiresAt,
+		})
+	}
+}
+
+// HandleSession returns the session attached to the request
+func HandleSession(c *gin.Context) {
+	session := c.MustGet(sessionContextKey).(*db.Session)
+
+	c.JSON(http.StatusOK, SessionResponse{
+		WalletAddress: session.WalletAddress,
+		ChainID:       session.ChainID,
+		ExpiresAt:     session.ExpiresAt,
+	})
+}
+
+// HandleLogout revokes the session attached to the request
+func HandleLogout(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := c.MustGet(sessionContextKey).(*db.Session)
+
+		if err := server.Sessions.DeleteSession(c.Request.Context(), session.TokenHash); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to revoke session: " + err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	}
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken hashes a session token for storage and lookup
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
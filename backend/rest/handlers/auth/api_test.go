@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+
+	"rebnb/db"
+)
+
+// newTestAuth serves the auth endpoints for the test domain and chain
+func newTestAuth(t *testing.T) (*httptest.Server, *db.MemoryStore) {
+	sessions := db.NewMemoryStore()
+	server := &Server{
+		Config:   &Config{Domain: testDomain, ChainID: testChainID, NonceTTL: time.Minute, SessionTTL: time.Hour},
+		Sessions: sessions,
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/auth/nonce", HandleNonce(server))
+	router.POST("/auth/verify", HandleVerify(server))
+	router.GET("/auth/session", RequireAuth(server), HandleSession)
+	router.POST("/auth/logout", RequireAuth(server), HandleLogout(server))
+
+	httpServer := httptest.NewServer(router)
+	t.Cleanup(httpServer.Close)
+	return httpServer, sessions
+}
+
+// do sends a request with an optional JSON body and bearer token, decoding the response into v
+func do(t *testing.T, method, url, token string, body, v interface{}) int {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("failed to decode %s %s: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// issueNonce fetches a fresh nonce from the server
+func issueNonce(t *testing.T, server *httptest.Server) string {
+	var nonce NonceResponse
+	if status := do(t, http.MethodGet, server.URL+"/auth/nonce", "", nil, &nonce); status != http.StatusOK {
+		t.Fatalf("GET /auth/nonce: status %d", status)
+	}
+	return nonce.Nonce
+}
+
+func TestVerifyIssuesSession(t *testing.T) {
+	server, _ := newTestAuth(t)
+	key := newKey(t)
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+
+	message := newSIWEFields(key, issueNonce(t, server)).String()
+	var session SessionResponse
+	status := do(t, http.MethodPost, server.URL+"/auth/verify", "",
+		VerifyRequest{Message: message, Signature: sign(t, key, message, false)}, &session)
+	if status != http.StatusOK {
+		t.Fatalf("POST /auth/verify: status %d", status)
+	}
+	if session.Token == "" || session.WalletAddress != address || session.ChainID != testChainID {
+		t.Fatalf("verify returned %+v", session)
+	}
+
+	var current SessionResponse
+	if status := do(t, http.MethodGet, server.URL+"/auth/session", session.Token, nil, &current); status != http.StatusOK {
+		t.Fatalf("GET /auth/session: status %d", status)
+	}
+	if current.WalletAddress != address {
+		t.Errorf("session belongs to %s, want %s", current.WalletAddress, address)
+	}
+
+	if status := do(t, http.MethodPost, server.URL+"/auth/logout", session.Token, nil, nil); status != http.StatusOK {
+		t.Fatalf("POST /auth/logout: status %d", status)
+	}
+	if status := do(t, http.MethodGet, server.URL+"/auth/session", session.Token, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("GET /auth/session after logout: status %d", status)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	server, sessions := newTestAuth(t)
+	key := newKey(t)
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		// edit changes the fields of a valid message
+		edit func(f *siweFields)
+		// signer signs the message instead of its address's key when set
+		signer bool
+		raw    bool
+		status int
+	}{
+		{"valid with v as 0/1", func(f *siweFields) {}, false, true, http.StatusOK},
+		{"wrong domain", func(f *siweFields) { f.domain = "evil.test" }, false, false, http.StatusUnauthorized},
+		{"wrong chain ID", func(f *siweFields) { f.chainID = "1" }, false, false, http.StatusUnauthorized},
+		{"expired", func(f *siweFields) { f.expiration = &past }, false, false, http.StatusUnauthorized},
+		{"not valid yet", func(f *siweFields) { f.notBefore = &future }, false, false, http.StatusUnauthorized},
+		{"issued in the future", func(f *siweFields) { f.issuedAt = future }, false, false, http.StatusUnauthorized},
+		{"unissued nonce", func(f *siweFields) { f.nonce = "0123456789abcdef" }, false, false, http.StatusUnauthorized},
+		{"malformed statement", func(f *siweFields) { f.statement = "Sign in\nto ReBnB" }, false, false, http.StatusBadRequest},
+		{"unchecksummed address", func(f *siweFields) { f.address = "0x" + fmt.Sprintf("%x", crypto.PubkeyToAddress(key.PublicKey)) }, false, false, http.StatusBadRequest},
+		{"signed by another key", func(f *siweFields) {}, true, false, http.StatusUnauthorized},
+	}
+
+	nonces := make([]string, len(tests))
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nonces[i] = issueNonce(t, server)
+			fields := newSIWEFields(key, nonces[i])
+			test.edit(&fields)
+			message := fields.String()
+
+			signingKey := key
+			if test.signer {
+				signingKey = newKey(t)
+			}
+
+			var body map[string]interface{}
+			status := do(t, http.MethodPost, server.URL+"/auth/verify", "",
+				VerifyRequest{Message: message, Signature: sign(t, signingKey, message, test.raw)}, &body)
+			if status != test.status {
+				t.Errorf("POST /auth/verify: status %d, want %d: %v", status, test.status, body)
+			}
+		})
+	}
+
+	// Only the accepted message used up its nonce
+	for i, test := range tests {
+		used := sessions.ConsumeAuthNonce(context.Background(), nonces[i]) != nil
+		if want := test.status == http.StatusOK; used != want {
+			t.Errorf("%s: nonce used %v, want %v", test.name, used, want)
+		}
+	}
+}
+
+func TestVerifyRejectsReusedNonce(t *testing.T) {
+	server, _ := newTestAuth(t)
+	key := newKey(t)
+
+	message := newSIWEFields(key, issueNonce(t, server)).String()
+	request := VerifyRequest{Message: message, Signature: sign(t, key, message, false)}
+
+	if status := do(t, http.MethodPost, server.URL+"/auth/verify", "", request, nil); status != http.StatusOK {
+		t.Fatalf("first verify: status %d", status)
+	}
+	if status := do(t, http.MethodPost, server.URL+"/auth/verify", "", request, nil); status != http.StatusUnauthorized {
+		t.Errorf("replayed verify: status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
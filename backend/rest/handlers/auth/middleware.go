@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys set by RequireAuth
+const (
+	WalletContextKey  = "wallet_address"
+	sessionContextKey = "session"
+)
+
+// RequireAuth rejects requests without a valid "Authorization: Bearer <token>" session
+// and puts the authenticated wallet address on the gin context
+func RequireAuth(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Check if MongoDB client is initialized
+		if server.Sessions == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
+
+		header := c.GetHeader("Authorization")
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Authorization bearer token is required",
+			})
+			return
+		}
+
+		session, err := server.Sessions.GetSession(c.Request.Context(), hashToken(token))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid session: " + err.Error(),
+			})
+			return
+		}
+
+		c.Set(sessionContextKey, session)
+		c.Set(WalletContextKey, session.WalletAddress)
+		c.Next()
+	}
+}
+
+// WalletFromContext returns the authenticated wallet address set by RequireAuth
+func WalletFromContext(c *gin.Context) (string, bool) {
+	wallet := c.GetString(WalletContextKey)
+	return wallet, wallet != ""
+}
+
+// OptionalAuth puts the wallet on the gin context when the request carries a valid session,
+// and lets anonymous requests through. A bearer token that doesn't resolve is still rejected.
+func OptionalAuth(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" || server.Sessions == nil {
+			c.Next()
+			return
+		}
+
+		RequireAuth(server)(c)
+	}
+}
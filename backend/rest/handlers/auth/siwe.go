@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// siweHeaderSuffix ends the first line of every EIP-4361 message
+const siweHeaderSuffix = " wants you to sign in with your Ethereum account:"
+
+// clockSkew is tolerated between the wallet's clock and ours for Issued At and Not Before
+const clockSkew = 5 * time.Minute
+
+// SIWEMessage represents a parsed EIP-4361 Sign-In With Ethereum message
+type SIWEMessage struct {
+	Domain         string
+	Address        common.Address
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        string
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// ParseSIWEMessage parses the plaintext message a wallet signed
+func ParseSIWEMessage(message string) (*SIWEMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(message, "\r\n", "\n"), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("message is too short")
+	}
+
+	if !strings.HasSuffix(lines[0], siweHeaderSuffix) {
+		return nil, fmt.Errorf("missing sign-in header")
+	}
+	msg := &SIWEMessage{Domain: strings.TrimSuffix(lines[0], siweHeaderSuffix)}
+	if msg.Domain == "" {
+		return nil, fmt.Errorf("missing domain")
+	}
+
+	// EIP-4361 requires the EIP-55 checksummed form
+	if !common.IsHexAddress(lines[1]) {
+		return nil, fmt.Errorf("invalid address %q", lines[1])
+	}
+	msg.Address = common.HexToAddress(lines[1])
+	if msg.Address.Hex() != lines[1] {
+		return nil, fmt.Errorf("address %q is not EIP-55 checksummed", lines[1])
+	}
+
+	// An optional single-line statement sits between two blank lines after the address
+	i := 2
+	if i < len(lines) && lines[i] == "" {
+		i++
+		if i < len(lines) && lines[i] != "" && !strings.HasPrefix(lines[i], "URI: ") {
+			msg.Statement = lines[i]
+			i++
+			if i >= len(lines) || lines[i] != "" {
+				return nil, fmt.Errorf("statement must be a single line followed by a blank line")
+			}
+		}
+	}
+
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+
+		if line == "Resources:" {
+			for i++; i < len(lines) && strings.HasPrefix(lines[i], "- "); i++ {
+				msg.Resources = append(msg.Resources, strings.TrimPrefix(lines[i], "- "))
+			}
+			i--
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("malformed line %q", line)
+		}
+
+		switch key {
+		case "URI":
+			msg.URI = value
+		case "Version":
+			msg.Version = value
+		case "Chain ID":
+			msg.ChainID = value
+		case "Nonce":
+			msg.Nonce = value
+		case "Issued At":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Issued At: %v", err)
+			}
+			msg.IssuedAt = t
+		case "Expiration Time":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Expiration Time: %v", err)
+			}
+			msg.ExpirationTime = &t
+		case "Not Before":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Not Before: %v", err)
+			}
+			msg.NotBefore = &t
+		case "Request ID":
+			msg.RequestID = value
+		default:
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+	}
+
+	switch {
+	case msg.URI == "":
+		return nil, fmt.Errorf("missing URI")
+	case msg.Version != "1":
+		return nil, fmt.Errorf("unsupported version %q", msg.Version)
+	case msg.ChainID == "":
+		return nil, fmt.Errorf("missing Chain ID")
+	case len(msg.Nonce) < 8:
+		return nil, fmt.Errorf("nonce must be at least 8 characters")
+	case msg.IssuedAt.IsZero():
+		return nil, fmt.Errorf("missing Issued At")
+	}
+
+	return msg, nil
+}
+
+// ValidateTime checks the message's validity window against the given time
+func (m *SIWEMessage) ValidateTime(now time.Time) error {
+	if m.IssuedAt.After(now.Add(clockSkew)) {
+		return fmt.Errorf("message was issued in the future")
+	}
+	if m.ExpirationTime != nil && !now.Before(*m.ExpirationTime) {
+		return fmt.Errorf("message has expired")
+	}
+	if m.NotBefore != nil && now.Add(clockSkew).Before(*m.NotBefore) {
+		return fmt.Errorf("message is not valid yet")
+	}
+	return nil
+}
+
+// RecoverSigner recovers the address that produced an EIP-191 personal_sign signature over message
+func RecoverSigner(message, signatureHex string) (common.Address, error) {
+	signature, err := hexutil.Decode(signatureHex)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("invalid signature length %d", len(signature))
+	}
+
+	// Wallets return v as 27/28, crypto expects 0/1
+	sig := make([]byte, len(signature))
+	copy(sig, signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	publicKey, err := crypto.SigToPub(accounts.TextHash([]byte(message)), sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to recover signer: %v", err)
+	}
+
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
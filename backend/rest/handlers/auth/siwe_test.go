@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	testDomain  = "rebnb.test"
+	testChainID = "16601"
+)
+
+// siweFields are the parts of a test message; String lays them out as EIP-4361 does
+type siweFields struct {
+	domain     string
+	address    string
+	statement  string
+	chainID    string
+	nonce      string
+	issuedAt   time.Time
+	expiration *time.Time
+	notBefore  *time.Time
+}
+
+// newSIWEFields returns a message from key that is valid now for the test domain and chain
+func newSIWEFields(key *ecdsa.PrivateKey, nonce string) siweFields {
+	return siweFields{
+		domain:    testDomain,
+		address:   crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		statement: "Sign in to ReBnB",
+		chainID:   testChainID,
+		nonce:     nonce,
+		issuedAt:  time.Now().UTC(),
+	}
+}
+
+func (f siweFields) String() string {
+	var b strings.Builder
+	b.WriteString(f.domain + siweHeaderSuffix + "\n")
+	b.WriteString(f.address + "\n\n")
+	if f.statement != "" {
+		b.WriteString(f.statement + "\n\n")
+	}
+	b.WriteString("URI: https://" + f.domain + "/login\n")
+	b.WriteString("Version: 1\n")
+	b.WriteString("Chain ID: " + f.chainID + "\n")
+	b.WriteString("Nonce: " + f.nonce + "\n")
+	b.WriteString("Issued At: " + f.issuedAt.Format(time.RFC3339))
+	if f.expiration != nil {
+		b.WriteString("\nExpiration Time: " + f.expiration.Format(time.RFC3339))
+	}
+	if f.notBefore != nil {
+		b.WriteString("\nNot Before: " + f.notBefore.Format(time.RFC3339))
+	}
+	return b.String()
+}
+
+// sign returns an EIP-191 personal_sign signature over message, with v as 27/28 like wallets
+// return it, or as 0/1 when raw is set
+func sign(t *testing.T, key *ecdsa.PrivateKey, message string, raw bool) string {
+	signature, err := crypto.Sign(accounts.TextHash([]byte(message)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !raw {
+		signature[crypto.RecoveryIDOffset] += 27
+	}
+	return hexutil.Encode(signature)
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestParseSIWEMessage(t *testing.T) {
+	key := newKey(t)
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	expiration := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	fields := newSIWEFields(key, "abcdef0123456789")
+	fields.expiration = &expiration
+	msg, err := ParseSIWEMessage(fields.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Domain != testDomain || msg.Address != address || msg.Statement != "Sign in to ReBnB" ||
+		msg.ChainID != testChainID || msg.Nonce != "abcdef0123456789" || msg.URI != "https://rebnb.test/login" ||
+		msg.ExpirationTime == nil || !msg.ExpirationTime.Equal(expiration) {
+		t.Errorf("parsed %+v", msg)
+	}
+
+	// The statement is optional
+	fields.statement = ""
+	if msg, err := ParseSIWEMessage(fields.String()); err != nil || msg.Statement != "" {
+		t.Errorf("message without a statement: %+v, %v", msg, err)
+	}
+}
+
+func TestParseSIWEMessageRejects(t *testing.T) {
+	key := newKey(t)
+	valid := newSIWEFields(key, "abcdef0123456789").String()
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+
+	tests := []struct {
+		name    string
+		message string
+	}{
+		{"missing header", strings.Replace(valid, siweHeaderSuffix, " wants you to sign in:", 1)},
+		{"missing domain", strings.TrimPrefix(valid, testDomain)},
+		{"invalid address", strings.Replace(valid, address, "0x1234", 1)},
+		{"lowercase address", strings.Replace(valid, address, strings.ToLower(address), 1)},
+		{"uppercase address", strings.Replace(valid, address, "0x"+strings.ToUpper(address[2:]), 1)},
+		{"statement without a blank line after it", strings.Replace(valid, "ReBnB\n\n", "ReBnB\n", 1)},
+		{"statement over two lines", strings.Replace(valid, "ReBnB\n\n", "ReBnB\nand more\n\n", 1)},
+		{"statement without a blank line before it", strings.Replace(valid, "\n\nSign in", "\nSign in", 1)},
+		{"unknown field", valid + "\nColor: blue"},
+		{"malformed field", strings.Replace(valid, "Version: 1", "Version 1", 1)},
+		{"missing URI", strings.Replace(valid, "URI: https://rebnb.test/login\n", "", 1)},
+		{"unsupported version", strings.Replace(valid, "Version: 1", "Version: 2", 1)},
+		{"missing chain ID", strings.Replace(valid, "Chain ID: "+testChainID+"\n", "", 1)},
+		{"short nonce", strings.Replace(valid, "abcdef0123456789", "abc", 1)},
+		{"invalid issued at", strings.Replace(valid, "Issued At: ", "Issued At: yesterday ", 1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if msg, err := ParseSIWEMessage(test.message); err == nil {
+				t.Errorf("parsed %+v from\n%s", msg, test.message)
+			}
+		})
+	}
+}
+
+func TestValidateTime(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name      string
+		issuedAt  time.Time
+		expires   *time.Time
+		notBefore *time.Time
+		valid     bool
+	}{
+		{"current", now.Add(-time.Minute), at(time.Hour), nil, true},
+		{"issued within the clock skew", now.Add(clockSkew - time.Second), nil, nil, true},
+		{"issued in the future", now.Add(clockSkew + time.Minute), nil, nil, false},
+		{"expired", now.Add(-time.Hour), at(-time.Second), nil, false},
+		{"expiring now", now.Add(-time.Hour), at(0), nil, false},
+		{"not valid yet", now, nil, at(clockSkew + time.Minute), false},
+		{"valid within the clock skew", now, nil, at(clockSkew - time.Second), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := &SIWEMessage{IssuedAt: test.issuedAt, ExpirationTime: test.expires, NotBefore: test.notBefore}
+			if err := msg.ValidateTime(now); (err == nil) != test.valid {
+				t.Errorf("ValidateTime = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestRecoverSigner(t *testing.T) {
+	key := newKey(t)
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	message := newSIWEFields(key, "abcdef0123456789").String()
+
+	tests := []struct {
+		name      string
+		signature string
+		want      common.Address
+		valid     bool
+	}{
+		{"v as 27/28", sign(t, key, message, false), address, true},
+		{"v as 0/1", sign(t, key, message, true), address, true},
+		{"other signer", sign(t, newKey(t), message, false), address, false},
+		{"other message", sign(t, key, message+"\nRequest ID: 1", false), address, false},
+		{"not hex", "signature", address, false},
+		{"short", "0x1234", address, false},
+		{"invalid recovery ID", sign(t, key, message, false)[:130] + "1f", address, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signer, err := RecoverSigner(message, test.signature)
+			if matches := err == nil && signer == test.want; matches != test.valid {
+				t.Errorf("RecoverSigner = %s, %v, want %s to be %v", signer.Hex(), err, test.want.Hex(), test.valid)
+			}
+		})
+	}
+}
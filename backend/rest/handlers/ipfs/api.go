@@ -1,19 +1,33 @@
 package ipfs
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"log"
 	"net/http"
 	"os"
+	"rebnb/blobstore"
+	"rebnb/db"
+	"rebnb/gateway"
+	"rebnb/pinning"
+	"rebnb/rest/handlers/auth"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	shell "github.com/ipfs/go-ipfs-api"
+	"github.com/ipfs/go-cid"
 )
 
+// multipartMemory is how much of a multipart upload is kept in memory before the rest is spooled to disk
+const multipartMemory = 1 << 20
+
+// maxUploadSize bounds a file uploaded through HandleIPFSUpload, larger files go through resumable uploads
+const maxUploadSize = 100 << 20
+
 // PinataConfig holds Pinata API credentials
 type PinataConfig struct {
 	APIKey     string
@@ -26,16 +40,20 @@ type PinataConfig struct {
 type IPFSClient struct {
 	config     *PinataConfig
 	httpClient *http.Client
-	shell      *shell.Shell
+	pins       pinning.Service
+	store      blobstore.BlobStore
+	gateways   *gateway.Pool
+	files      db.FileRepository
 }
 
-// NewIPFSClient creates a new IPFS client using Pinata
-func NewIPFSClient() *IPFSClient {
+// NewIPFSClient creates a new IPFS client using Pinata. Uploads and pins are cataloged in files,
+// which is nil while the database is unavailable.
+func NewIPFSClient(files db.FileRepository) *IPFSClient {
 	// Get credentials from environment variables
 	apiKey := os.Getenv("PINATA_API_KEY")
 	apiSecret := os.Getenv("PINATA_API_SECRET")
 	jwt := os.Getenv("PINATA_JWT")
-	gatewayURL := os.Getenv("PINATA_GATEWAY_URL")
+	gatewayURL := gateway.PinataGatewayURLFromEnv()
 
 	// Fallback to defaults if env vars not set (for development)
 	if apiKey == "" {
@@ -47,9 +65,6 @@ func NewIPFSClient() *IPFSClient {
 	if jwt == "" {
 		jwt = "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJ1c2VySW5mb3JtYXRpb24iOnsiaWQiOiI4ZDlhMDVhNS04ZmUxLTRiYmUtYTJhMC05NGViNzIyOTI4ZTUiLCJlbWFpbCI6ImhlbGxvQHN1bWl0ZGhpbWFuLmluIiwiZW1haWxfdmVyaWZpZWQiOnRydWUsInBpbl9wb2xpY3kiOnsicmVnaW9ucyI6W3siZGVzaXJlZFJlcGxpY2F0aW9uQ291bnQiOjEsImlkIjoiRlJBMSJ9LHsiZGVzaXJlZFJlcGxpY2F0aW9uQ291bnQiOjEsImlkIjoiTllDMSJ9XSwidmVyc2lvbiI6MX0sIm1mYV9lbmFibGVkIjpmYWxzZSwic3RhdHVzIjoiQUNUSVZFIn0sImF1dGhlbnRpY2F0aW9uVHlwZSI6InNjb3BlZEtleSIsInNjb3BlZEtleUtleSI6IjMyYzUzNWRkMDVjYTVlMTg3Y2NlIiwic2NvcGVkS2V5U2VjcmV0IjoiZTk1YTA1MTk0NTBjZTkyY2E4OTVmMTcwODE4OTU1ZWFhMzQ2NGViNTUxNmQ5ZWU3NzI0NjgwZDQyOTA2MzE3MiIsImV4cCI6MTc5MDQzMzM5Mn0.Ve8HRmHSsIoLI7qlZqTD6z8C33yhiKBQ7yMm0IqTGE0"
 	}
-	if gatewayURL == "" {
-		gatewayURL = "https://pink-improved-swift-480.mypinata.cloud/ipfs/"
-	}
 
 	config := &PinataConfig{
 		APIKey:     apiKey,
@@ -58,76 +73,104 @@ func NewIPFSClient() *IPFSClient {
 		GatewayURL: gatewayURL,
 	}
 
-	return &IPFSClient{
-		config:     config,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+	// Retrieval goes through a pool of gateways with a disk cache in front
+	poolConfig := gateway.NewConfigFromEnv()
+	pool, err := gateway.NewPool(poolConfig)
+	if err != nil {
+		log.Printf("⚠️  IPFS cache disabled: %v", err)
+		poolConfig.CacheMaxBytes = 0
+		pool, err = gateway.NewPool(poolConfig)
+		if err != nil {
+			log.Fatalf("Failed to initialize IPFS gateways: %v", err)
+		}
 	}
-}
 
-// uploadToPinata uploads a file to Pinata using their v3 API
-func (c *IPFSClient) uploadToPinata(fileContent []byte, filename string) (*PinataUploadResponse, error) {
-	// Create multipart form
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-
-	// Add file part
-	part, err := writer.CreateFormFile("file", filename)
+	// Pins are managed on a Kubo node when one is configured, otherwise on Pinata
+	pinConfig := pinning.NewConfigFromEnv()
+	if pinConfig.PinataJWT == "" {
+		pinConfig.PinataJWT = jwt
+	}
+	pins, err := pinning.New(pinConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create form file: %v", err)
+		log.Printf("⚠️  IPFS pinning disabled: %v", err)
 	}
 
-	_, err = part.Write(fileContent)
+	// Uploads go to the Kubo node when pins are managed there, otherwise to Pinata, unless
+	// IPFS_UPLOAD_BACKEND picks one. Either way the key is a CID any pinning service can fetch.
+	uploadBackend := blobstore.BackendPinata
+	if pinConfig.Service == pinning.ServiceKubo {
+		uploadBackend = blobstore.BackendKubo
+	}
+	uploadConfig := blobstore.NewConfigFromEnv("IPFS_UPLOAD_BACKEND", uploadBackend, "", "")
+	if uploadConfig.Backend != blobstore.BackendPinata && uploadConfig.Backend != blobstore.BackendKubo {
+		log.Fatalf("❌ IPFS uploads need an IPFS backend, got '%s'", uploadConfig.Backend)
+	}
+	if uploadConfig.PinataJWT == "" {
+		uploadConfig.PinataJWT = jwt
+	}
+	store, err := blobstore.New(uploadConfig, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write file content: %v", err)
+		log.Fatalf("Failed to initialize IPFS uploads: %v", err)
 	}
 
-	// Add network field (required for v3 API)
-	writer.WriteField("network", "public")
-
-	writer.Close()
-
-	// Create request using v3 API endpoint
-	req, err := http.NewRequest("POST", "https://uploads.pinata.cloud/v3/files", &buf)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+	return &IPFSClient{
+		config:     config,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		pins:       pins,
+		store:      store,
+		gateways:   pool,
+		files:      files,
 	}
+}
 
-	// Set headers
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Authorization", "Bearer "+c.config.JWT)
+// Gateways returns the client's gateway pool
+func (c *IPFSClient) Gateways() *gateway.Pool {
+	return c.gateways
+}
+
+// Store returns the blob store uploads are pinned through
+func (c *IPFSClient) Store() blobstore.BlobStore {
+	return c.store
+}
 
-	// Send request
-	resp, err := c.httpClient.Do(req)
+// uploadToPinata uploads a file to Pinata using their v3 API, streaming it as the request body
+func (c *IPFSClient) uploadToPinata(ctx context.Context, r io.Reader, filename string) (*PinataUploadResponse, error) {
+	info, err := c.store.Put(ctx, filename, r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+	// Convert the blob info to legacy format for compatibility
+	pinataResp := &PinataUploadResponse{
+		IpfsHash:  info.Key,
+		PinSize:   int(info.Size),
+		Timestamp: info.CreatedAt.Format(time.RFC3339),
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("pinata API error (status %d): %s", resp.StatusCode, string(respBody))
+	return pinataResp, nil
+}
+
+// findUpload returns an earlier upload of the content with the given SHA-256 that is still pinned, or nil
+func (c *IPFSClient) findUpload(ctx context.Context, contentHash string) *db.StoredFile {
+	if c.files == nil {
+		return nil
 	}
 
-	// Parse response (v3 API has different response format)
-	var v3Resp PinataV3Response
-	err = json.Unmarshal(respBody, &v3Resp)
+	existing, err := c.files.GetFileByContentHash(ctx, c.store.Backend(), contentHash)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+		log.Printf("⚠️  Failed to look up upload %s: %v", contentHash, err)
+		return nil
 	}
-
-	// Convert v3 response to legacy format for compatibility
-	pinataResp := &PinataUploadResponse{
-		IpfsHash:  v3Resp.Data.CID,
-		PinSize:   v3Resp.Data.Size,
-		Timestamp: v3Resp.Data.CreatedAt,
+	if existing == nil || c.pins == nil {
+		return existing
 	}
 
-	return pinataResp, nil
+	// Content unpinned since can't be handed out again
+	pin, err := c.pins.Status(ctx, existing.Hash)
+	if err != nil || pin.Status == pinning.StatusUnpinned || pin.Status == pinning.StatusFailed {
+		return nil
+	}
+	return existing
 }
 
 // PinataUploadResponse represents Pinata's upload response (legacy format)
@@ -167,6 +210,12 @@ type FileInfo struct {
 	RetrievedAt time.Time `json:"retrieved_at"`
 	Available   bool      `json:"available"`
 	PinStatus   string    `json:"pin_status"`
+	PinService  string    `json:"pin_service,omitempty"`
+}
+
+// PinRequest represents a request to pin an existing CID
+type PinRequest struct {
+	Name string `json:"name"`
 }
 
 // ErrorResponse represents an error response
@@ -179,6 +228,26 @@ type ErrorResponse struct {
 // HandleIPFSUpload handles file uploads to IPFS
 func HandleIPFSUpload(client *IPFSClient) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Bound the request body, then spool the file to disk rather than memory
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize+multipartMemory)
+		if err := c.Request.ParseMultipartForm(multipartMemory); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Error:   "file_too_large",
+					Message: fmt.Sprintf("File size exceeds maximum limit of %d bytes", maxUploadSize),
+					Success: false,
+				})
+				return
+			}
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "file_required",
+				Message: "File is required",
+				Success: false,
+			})
+			return
+		}
+
 		// Get file from form
 		file, header, err := c.Request.FormFile("file")
 		if err != nil {
@@ -191,31 +260,76 @@ func HandleIPFSUpload(client *IPFSClient) gin.HandlerFunc {
 		}
 		defer file.Close()
 
-		// Read file content
-		content, err := io.ReadAll(file)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Error:   "file_read_error",
-				Message: "Failed to read file content",
+		if header.Size > maxUploadSize {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "file_too_large",
+				Message: fmt.Sprintf("File size exceeds maximum limit of %d bytes", maxUploadSize),
 				Success: false,
 			})
 			return
 		}
 
-		// Upload to Pinata
-		pinataResp, err := client.uploadToPinata(content, header.Filename)
+		// Sniff the content type without moving the read position
+		head := make([]byte, 512)
+		n, _ := file.ReadAt(head, 0)
+		contentType := http.DetectContentType(head[:n])
+
+		// Hash the spooled file, content already stored on this backend isn't uploaded again
+		hasher := sha256.New()
+		if _, err := io.Copy(hasher, file); err == nil {
+			_, err = file.Seek(0, io.SeekStart)
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{
 				Error:   "ipfs_upload_error",
-				Message: fmt.Sprintf("Failed to upload to IPFS: %v", err),
+				Message: fmt.Sprintf("Failed to read file: %v", err),
 				Success: false,
 			})
 			return
 		}
+		contentHash := hex.EncodeToString(hasher.Sum(nil))
+
+		var pinataResp *PinataUploadResponse
+		if existing := client.findUpload(c.Request.Context(), contentHash); existing != nil {
+			pinataResp = &PinataUploadResponse{
+				IpfsHash:  existing.Hash,
+				PinSize:   int(existing.Size),
+				Timestamp: existing.CreatedAt.Format(time.RFC3339),
+			}
+		} else {
+			pinataResp, err = client.uploadToPinata(c.Request.Context(), file, header.Filename)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{
+					Error:   "ipfs_upload_error",
+					Message: fmt.Sprintf("Failed to upload to IPFS: %v", err),
+					Success: false,
+				})
+				return
+			}
+		}
 
 		hash := pinataResp.IpfsHash
 		sizeStr := fmt.Sprintf("%d", pinataResp.PinSize)
 
+		// Record the upload in the file catalog
+		if client.files != nil {
+			wallet, _ := auth.WalletFromContext(c)
+			if err := client.files.SaveFile(c.Request.Context(), &db.StoredFile{
+				Hash:           hash,
+				Backend:        client.store.Backend(),
+				Name:           header.Filename,
+				Size:           int64(pinataResp.PinSize),
+				ContentType:    contentType,
+				URL:            client.store.URL(hash),
+				Source:         db.FileSourceIPFSUpload,
+				UploaderWallet: wallet,
+				PropertyID:     c.PostForm("property_id"),
+				ContentHash:    contentHash,
+			}); err != nil {
+				log.Printf("⚠️  Failed to catalog upload %s: %v", hash, err)
+			}
+		}
+
 		response := UploadResponse{
 			Hash:     hash,
 			Name:     header.Filename,
@@ -241,138 +355,298 @@ func HandleIPFSGet(client *IPFSClient) gin.HandlerFunc {
 			return
 		}
 
-		// Get file from IPFS via gateway
-		gatewayURL := fmt.Sprintf("https://ipfs.io/ipfs/%s", hash)
-		resp, err := client.httpClient.Get(gatewayURL)
-		if err != nil {
-			c.JSON(http.StatusNotFound, ErrorResponse{
+		// Stream from the cache or the healthiest gateways
+		if err := client.gateways.Serve(c.Writer, c.Request, hash); err != nil {
+			status := http.StatusBadGateway
+			switch {
+			case errors.Is(err, gateway.ErrInvalidCID):
+				status = http.StatusBadRequest
+			case errors.Is(err, gateway.ErrNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, gateway.ErrCIDMismatch):
+				c.JSON(http.StatusBadGateway, ErrorResponse{
+					Error:   "content_verification_failed",
+					Message: fmt.Sprintf("Content returned by the gateways does not match the CID: %v", err),
+					Success: false,
+				})
+				return
+			}
+
+			c.JSON(status, ErrorResponse{
 				Error:   "file_not_found",
 				Message: fmt.Sprintf("Failed to retrieve file from IPFS: %v", err),
 				Success: false,
 			})
+		}
+	}
+}
+
+// HandleIPFSInfo retrieves information about an IPFS file
+func HandleIPFSInfo(client *IPFSClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hash := c.Param("ipfs_hash")
+		if hash == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "hash_required",
+				Message: "IPFS hash is required",
+				Success: false,
+			})
 			return
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			c.JSON(http.StatusNotFound, ErrorResponse{
-				Error:   "file_not_found",
-				Message: fmt.Sprintf("File not found on IPFS (status %d)", resp.StatusCode),
+		ctx := c.Request.Context()
+		info := FileInfo{
+			Hash:        hash,
+			Size:        -1,
+			Name:        hash, // Use hash as name if no filename available
+			RetrievedAt: time.Now(),
+			PinStatus:   "unknown",
+		}
+
+		if client.pins != nil {
+			info.PinService = client.pins.Name()
+			pin, err := client.pins.Status(ctx, hash)
+			if err != nil {
+				log.Printf("⚠️  Failed to get pin status for %s: %v", hash, err)
+			} else {
+				info.PinStatus = pin.Status
+				if pin.Status == pinning.StatusPinned {
+					info.Size = pin.Size
+					info.Type = pin.ContentType
+				}
+				if pin.Name != "" {
+					info.Name = pin.Name
+				}
+			}
+		}
+
+		// Uploads through this backend recorded their name and sniffed type
+		if client.files != nil {
+			if file, err := client.files.GetFileByHash(ctx, hash); err != nil {
+				log.Printf("⚠️  Failed to look up %s in the file catalog: %v", hash, err)
+			} else if file != nil {
+				info.Name = file.Name
+				if info.Size <= 0 {
+					info.Size = file.Size
+				}
+				if file.ContentType != "" {
+					info.Type = file.ContentType
+				}
+			}
+		}
+
+		stat, err := client.gateways.Stat(ctx, hash)
+		switch {
+		case errors.Is(err, gateway.ErrInvalidCID):
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_hash",
+				Message: err.Error(),
 				Success: false,
 			})
 			return
+		case err != nil:
+			if info.PinStatus != pinning.StatusPinned {
+				c.JSON(http.StatusNotFound, ErrorResponse{
+					Error:   "file_not_found",
+					Message: fmt.Sprintf("Failed to get file info: %v", err),
+					Success: false,
+				})
+				return
+			}
+			log.Printf("⚠️  Pinned content %s is not reachable through the gateways: %v", hash, err)
+		default:
+			info.Available = true
+			if info.Size <= 0 && stat.Size >= 0 {
+				info.Size = stat.Size
+			}
+			if info.Type == "" {
+				info.Type = stat.ContentType
+			}
+		}
+
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// HandleIPFSList lists the pinning service's pins (optional utility endpoint)
+func HandleIPFSList(client *IPFSClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requirePins(c, client) {
+			return
 		}
 
-		// Read content
-		content, err := io.ReadAll(resp.Body)
+		pins, err := client.pins.List(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Error:   "file_read_error",
-				Message: "Failed to read file from IPFS",
+				Error:   "pins_error",
+				Message: fmt.Sprintf("Failed to list pinned files: %v", err),
 				Success: false,
 			})
 			return
 		}
+		if pins == nil {
+			pins = []pinning.Pin{}
+		}
 
-		// Try to determine content type
-		contentType := http.DetectContentType(content)
-
-		// Set headers for file download
-		c.Header("Content-Type", contentType)
-		c.Header("Content-Length", fmt.Sprintf("%d", len(content)))
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", hash))
+		response := map[string]interface{}{
+			"pinned_files": pins,
+			"count":        len(pins),
+			"service":      client.pins.Name(),
+			"success":      true,
+		}
 
-		// Return file content
-		c.Data(http.StatusOK, contentType, content)
+		c.JSON(http.StatusOK, response)
 	}
 }
 
-// HandleIPFSInfo retrieves information about an IPFS file
-func HandleIPFSInfo(client *IPFSClient) gin.HandlerFunc {
+// HandleIPFSPin pins an existing CID and records it for the caller
+func HandleIPFSPin(client *IPFSClient) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if !requirePins(c, client) {
+			return
+		}
+
 		hash := c.Param("ipfs_hash")
-		if hash == "" {
+		if _, err := cid.Decode(hash); err != nil {
 			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Error:   "hash_required",
-				Message: "IPFS hash is required",
+				Error:   "invalid_hash",
+				Message: fmt.Sprintf("Invalid CID: %v", err),
 				Success: false,
 			})
 			return
 		}
 
-		// Get object statistics
-		stat, err := client.shell.ObjectStat(hash)
+		var req PinRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Error:   "invalid_request",
+					Message: fmt.Sprintf("Invalid request body: %v", err),
+					Success: false,
+				})
+				return
+			}
+		}
+
+		pin, err := client.pins.Pin(c.Request.Context(), hash, req.Name)
 		if err != nil {
-			c.JSON(http.StatusNotFound, ErrorResponse{
-				Error:   "file_not_found",
-				Message: fmt.Sprintf("Failed to get file info: %v", err),
+			c.JSON(http.StatusBadGateway, ErrorResponse{
+				Error:   "pin_error",
+				Message: fmt.Sprintf("Failed to pin %s: %v", hash, err),
 				Success: false,
 			})
 			return
 		}
 
-		// Check if file is pinned
-		pinned := false
-		pins, err := client.shell.Pins()
-		if err == nil {
-			for pin := range pins {
-				if pin == hash {
-					pinned = true
-					break
-				}
+		// Record the pin so the caller can unpin it later
+		if client.files != nil {
+			wallet, _ := auth.WalletFromContext(c)
+			name := req.Name
+			if name == "" {
+				name = hash
+			}
+			if err := client.files.SaveFile(c.Request.Context(), &db.StoredFile{
+				Hash:           hash,
+				Backend:        client.pins.Name(),
+				Name:           name,
+				Size:           pin.Size,
+				ContentType:    pin.ContentType,
+				URL:            client.store.URL(hash),
+				Source:         db.FileSourcePin,
+				UploaderWallet: wallet,
+			}); err != nil {
+				log.Printf("⚠️  Failed to catalog pin %s: %v", hash, err)
 			}
 		}
 
-		pinStatus := "unpinned"
-		if pinned {
-			pinStatus = "pinned"
+		status := http.StatusOK
+		if pin.Status != pinning.StatusPinned {
+			status = http.StatusAccepted
 		}
+		c.JSON(status, pin)
+	}
+}
 
-		// Try to get additional info
-		available := true
-		_, err = client.shell.Cat(hash)
-		if err != nil {
-			available = false
+// HandleIPFSUnpin unpins a CID. Only a wallet that uploaded or pinned the CID may unpin it,
+// and not while other wallets still rely on the same content.
+func HandleIPFSUnpin(client *IPFSClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requirePins(c, client) {
+			return
 		}
 
-		info := FileInfo{
-			Hash:        hash,
-			Size:        int64(stat.CumulativeSize),
-			Type:        "file", // IPFS doesn't provide MIME type in ObjectStat
-			Name:        hash,   // Use hash as name if no filename available
-			RetrievedAt: time.Now(),
-			Available:   available,
-			PinStatus:   pinStatus,
+		// Check if MongoDB client is initialized
+		if client.files == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
 		}
 
-		c.JSON(http.StatusOK, info)
-	}
-}
+		hash := c.Param("ipfs_hash")
+		wallet, _ := auth.WalletFromContext(c)
+		ctx := c.Request.Context()
 
-// HandleIPFSList lists pinned files (optional utility endpoint)
-func HandleIPFSList(client *IPFSClient) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		pins, err := client.shell.Pins()
+		uploaders, err := client.files.GetFileUploaders(ctx, hash)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Error:   "pins_error",
-				Message: fmt.Sprintf("Failed to list pinned files: %v", err),
+				Error:   "database_error",
+				Message: fmt.Sprintf("Failed to look up file: %v", err),
 				Success: false,
 			})
 			return
 		}
 
-		var files []string
-		for pin := range pins {
-			files = append(files, pin)
+		owned := false
+		for _, uploader := range uploaders {
+			if strings.EqualFold(uploader, wallet) {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			c.JSON(http.StatusForbidden, ErrorResponse{
+				Error:   "not_owner",
+				Message: "Only the wallet that uploaded or pinned this file can unpin it",
+				Success: false,
+			})
+			return
+		}
+		if len(uploaders) > 1 {
+			c.JSON(http.StatusConflict, ErrorResponse{
+				Error:   "shared_content",
+				Message: "Other wallets have uploaded the same content",
+				Success: false,
+			})
+			return
 		}
 
-		response := map[string]interface{}{
-			"pinned_files": files,
-			"count":        len(files),
-			"success":      true,
+		if err := client.pins.Unpin(ctx, hash); err != nil && !errors.Is(err, pinning.ErrNotPinned) {
+			c.JSON(http.StatusBadGateway, ErrorResponse{
+				Error:   "unpin_error",
+				Message: fmt.Sprintf("Failed to unpin %s: %v", hash, err),
+				Success: false,
+			})
+			return
 		}
 
-		c.JSON(http.StatusOK, response)
+		c.JSON(http.StatusOK, gin.H{
+			"hash":    hash,
+			"status":  pinning.StatusUnpinned,
+			"success": true,
+		})
+	}
+}
+
+// requirePins responds with 503 when no pinning service is configured
+func requirePins(c *gin.Context, client *IPFSClient) bool {
+	if client.pins == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Error:   "pinning_unavailable",
+			Message: "No IPFS pinning service is configured",
+			Success: false,
+		})
+		return false
 	}
+	return true
 }
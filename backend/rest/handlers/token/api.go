@@ -1,29 +1,26 @@
 package token
 
 import (
-	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"math/big"
 	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
+	"rebnb/contracts"
 	"rebnb/db"
+	"rebnb/fetcher"
+	"rebnb/imaging"
+	"rebnb/rest/handlers/auth"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/gin-gonic/gin"
 )
 
@@ -34,7 +31,7 @@ type MintRequest struct {
 	Description     string      `json:"description" binding:"required"`
 	Services        []string    `json:"services"`
 	Image           string      `json:"image"` // Single image instead of array
-	To              string      `json:"to" binding:"required"`
+	To              string      `json:"to"`    // defaults to the authenticated wallet
 	ExternalUrl     string      `json:"external_url,omitempty"`
 	Attributes      []Attribute `json:"attributes,omitempty"`
 	// PrivateKey      string      `json:"privateKey" binding:"required"`
@@ -43,9 +40,10 @@ type MintRequest struct {
 
 // ImageUploadResponse represents the response for image upload
 type ImageUploadResponse struct {
-	Success   bool     `json:"success"`
-	ImageURLs []string `json:"image_urls,omitempty"`
-	Error     string   `json:"error,omitempty"`
+	Success   bool               `json:"success"`
+	ImageURLs []string           `json:"image_urls,omitempty"`
+	Images    []db.ImageVariants `json:"images,omitempty"`
+	Error     string             `json:"error,omitempty"`
 }
 
 // Attribute represents NFT metadata attributes
@@ -70,12 +68,13 @@ type TxnResponse struct {
 
 // MintWithIPFSResponse represents the response for the mint with IPFS endpoint
 type MintWithIPFSResponse struct {
-	IPFSHash        string              `json:"ipfs_hash,omitempty"`
-	TokenURI        string              `json:"token_uri,omitempty"`
-	TransactionHash string              `json:"transaction_hash,omitempty"`
-	Receipt         *TransactionReceipt `json:"receipt,omitempty"`
-	PropertyId      string              `json:"property_id,omitempty"`
-	Error           string              `json:"error,omitempty"`
+	IPFSHash          string              `json:"ipfs_hash,omitempty"`
+	TokenURI          string              `json:"token_uri,omitempty"`
+	TransactionHash   string              `json:"transaction_hash,omitempty"`
+	TransactionStatus string              `json:"transaction_status,omitempty"`
+	Receipt           *TransactionReceipt `json:"receipt,omitempty"`
+	PropertyId        string              `json:"property_id,omitempty"`
+	Error             string              `json:"error,omitempty"`
 }
 
 // TransactionReceipt represents a simplified transaction receipt
@@ -92,30 +91,27 @@ type TransactionReceipt struct {
 // GetReceiptRequest represents the request for getting a transaction receipt
 type GetReceiptRequest struct {
 	TransactionHash string `json:"transaction_hash" binding:"required"`
-	ChainName       string `json:"chain_name,omitempty"` // defaults to "0g"
+	ChainName       string `json:"chain_name,omitempty"`      // defaults to "0g"
+	Wait            bool   `json:"wait,omitempty"`            // block until the transaction is mined
+	TimeoutSeconds  int    `json:"timeout_seconds,omitempty"` // wait timeout, defaults to 30s
 }
 
 // GetReceiptResponse represents the response for getting a transaction receipt
 type GetReceiptResponse struct {
 	Receipt *TransactionReceipt `json:"receipt,omitempty"`
+	Events  []DecodedEvent      `json:"events,omitempty"`
+	Pending bool                `json:"pending,omitempty"`
 	Error   string              `json:"error,omitempty"`
 }
 
-// PinataResponse represents the response from Pinata API
-type PinataResponse struct {
-	IPFSHash    string `json:"IpfsHash"`
-	PinSize     int    `json:"PinSize"`
-	Timestamp   string `json:"Timestamp"`
-	IsDuplicate bool   `json:"isDuplicate"`
-}
-
 // NFTMetadata represents the NFT metadata structure
 type NFTMetadata struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description"`
-	Image       string      `json:"image"`
-	ExternalURL string      `json:"external_url,omitempty"`
-	Attributes  []Attribute `json:"attributes,omitempty"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	Image         string            `json:"image"`
+	ImageVariants *db.ImageVariants `json:"image_variants,omitempty"`
+	ExternalURL   string            `json:"external_url,omitempty"`
+	Attributes    []Attribute       `json:"attributes,omitempty"`
 }
 
 // Chain represents chain data from the database
@@ -123,6 +119,7 @@ type Chain struct {
 	Chain   string `json:"chain" db:"chain"`
 	RPC     string `json:"rpc" db:"rpc"`
 	ChainID string `json:"chain_id" db:"chain_id"`
+	TxType  string `json:"tx_type,omitempty" db:"tx_type"`
 }
 
 // ChainResponse represents the response for the chain endpoint
@@ -153,331 +150,231 @@ type ListingData struct {
 	BookingSecurity string `json:"booking_security"`
 }
 
-// PinataUploadResponse represents Pinata's upload response
-type PinataUploadResponse struct {
-	IpfsHash  string `json:"IpfsHash"`
-	PinSize   int    `json:"PinSize"`
-	Timestamp string `json:"Timestamp"`
-}
-
-// pinJSONToIPFS pins JSON data to Pinata IPFS using the JSON pinning endpoint
-func pinJSONToIPFS(data interface{}) (string, error) {
-
-	// Create the request payload for JSON pinning
-	requestPayload := map[string]interface{}{
-		"pinataContent": data,
-		"pinataMetadata": map[string]interface{}{
-			"name": "listing-data",
-		},
-	}
-
-	// Convert payload to JSON
-	jsonPayload, err := json.Marshal(requestPayload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request payload: %v", err)
-	}
-
-	// Create request to Pinata JSON pinning endpoint
-	req, err := http.NewRequest("POST", "https://api.pinata.cloud/pinning/pinJSONToIPFS", bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
-	}
-
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("pinata_api_key", os.Getenv("PINATA_API_KEY"))
-	req.Header.Set("pinata_secret_api_key", os.Getenv("PINATA_SECRET_API_KEY"))
-
-	// Send request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Read response
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %v", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("pinata API error (status %d): %s", resp.StatusCode, string(respBody))
-	}
-
-	// Parse response
-	var pinataResp PinataUploadResponse
-	err = json.Unmarshal(respBody, &pinataResp)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse response: %v", err)
-	}
-
-	return pinataResp.IpfsHash, nil
-}
-
-func CreateListing(c *gin.Context) {
-	// Check if MongoDB client is initialized
-	if db.MongoClient.Client == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Database connection not available",
-		})
-		return
-	}
-
-	var request ListingRequest
-
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request payload: " + err.Error(),
-		})
-		return
-	}
-
-	// Validate all required fields
-	if request.PropertyId == "" || request.Date == "" || request.RentPrice == "" ||
-		request.RentSecurity == "" || request.BookingPrice == "" || request.BookingSecurity == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "All fields are required: propertyId, date, rentPrice, rentSecurity, bookingPrice, bookingSecurity",
-		})
-		return
-	}
-
-	ctx := context.Background()
-
-	// Fetch property details from database
-	property, err := db.MongoClient.GetPropertyByID(ctx, request.PropertyId)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Property not found: " + err.Error(),
-		})
-		return
-	}
-
-	// Create listing data object combining property info with listing attributes
-	listingData := ListingData{
-		PropertyName:    property.PropertyName,
-		Description:     property.Description,
-		Image:           property.Image,
-		Date:            request.Date,
-		RentPrice:       request.RentPrice,
-		RentSecurity:    request.RentSecurity,
-		BookingPrice:    request.BookingPrice,
-		BookingSecurity: request.BookingSecurity,
-	}
-
-	// Pin JSON data to IPFS
-	ipfsHash, err := pinJSONToIPFS(listingData)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to pin data to IPFS: " + err.Error(),
-		})
-		return
-	}
-
-	// Create listing entry in database
-	listing := &db.Listing{
-		PropertyID: request.PropertyId,
-		Date:       request.Date,
-		IPFSHash:   ipfsHash,
-	}
-
-	err = db.MongoClient.InsertListing(ctx, listing)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to save listing to database: " + err.Error(),
-		})
-		return
-	}
-
-	// Convert and validate numeric fields for blockchain transaction
-	propertyIdInt, err := strconv.ParseUint(request.PropertyId, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid propertyId: must be a valid number",
-		})
-		return
-	}
-
-	dateInt, err := strconv.ParseUint(request.Date, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid date: must be a valid timestamp",
-		})
-		return
-	}
-
-	rentPriceInt, err := strconv.ParseUint(request.RentPrice, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid rentPrice: must be a valid number",
-		})
-		return
-	}
-
-	rentSecurityInt, err := strconv.ParseUint(request.RentSecurity, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid rentSecurity: must be a valid number",
-		})
-		return
-	}
+func CreateListing(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Check if the database is available
+		if server.Properties == nil || server.Listings == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
 
-	bookingPriceInt, err := strconv.ParseUint(request.BookingPrice, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid bookingPrice: must be a valid number",
-		})
-		return
-	}
+		var request ListingRequest
 
-	bookingSecurityInt, err := strconv.ParseUint(request.BookingSecurity, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid bookingSecurity: must be a valid number",
-		})
-		return
-	}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request payload: " + err.Error(),
+			})
+			return
+		}
 
-	// Load the marketplace contract ABI
-	contractABI, err := loadMarketPlaceABI()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to load contract ABI: " + err.Error(),
-		})
-		return
-	}
+		// Validate all required fields
+		if request.PropertyId == "" || request.Date == "" || request.RentPrice == "" ||
+			request.RentSecurity == "" || request.BookingPrice == "" || request.BookingSecurity == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "All fields are required: propertyId, date, rentPrice, rentSecurity, bookingPrice, bookingSecurity",
+			})
+			return
+		}
 
-	// Convert parameters to proper big.Int types for ABI encoding
-	propertyId := new(big.Int).SetUint64(propertyIdInt)
-	date := new(big.Int).SetUint64(dateInt)
-	rentPrice := new(big.Int).SetUint64(rentPriceInt)
-	rentSecurity := new(big.Int).SetUint64(rentSecurityInt)
-	bookingPrice := new(big.Int).SetUint64(bookingPriceInt)
-	bookingSecurity := new(big.Int).SetUint64(bookingSecurityInt)
+		// Convert and validate numeric fields for blockchain transaction
+		propertyIdInt, err := strconv.ParseUint(request.PropertyId, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid propertyId: must be a valid number",
+			})
+			return
+		}
 
-	// Encode the function call using ABI
-	data, err := contractABI.Pack("createListing", propertyId, date, rentPrice, rentSecurity, bookingPrice, bookingSecurity)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to encode function call: " + err.Error(),
-		})
-		return
-	}
+		dateInt, err := strconv.ParseUint(request.Date, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid date: must be a valid timestamp",
+			})
+			return
+		}
 
-	// Get chain configuration
-	chain, err := GetChain("0g")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to get chain configuration: " + err.Error(),
-		})
-		return
-	}
+		rentPriceInt, err := strconv.ParseUint(request.RentPrice, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid rentPrice: must be a valid number",
+			})
+			return
+		}
 
-	contract, err := GetContract("marketplace")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to get contract: " + err.Error(),
-		})
-		return
-	}
+		rentSecurityInt, err := strconv.ParseUint(request.RentSecurity, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid rentSecurity: must be a valid number",
+			})
+			return
+		}
 
-	// Create the transaction data
-	transactionData := MintTransactionData{
-		ChainId: chain.ChainID,
-		To:      contract,
-		Data:    "0x" + common.Bytes2Hex(data),
-		Value:   "0x0", // No ETH value needed for creating listing
-	}
+		bookingPriceInt, err := strconv.ParseUint(request.BookingPrice, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid bookingPrice: must be a valid number",
+			})
+			return
+		}
 
-	// Create the response including IPFS hash
-	response := gin.H{
-		"success":     true,
-		"ipfs_hash":   ipfsHash,
-		"property_id": request.PropertyId,
-		"date":        request.Date,
-		"transaction": TxnResponse{
-			Msg: transactionData,
-		},
-	}
+		bookingSecurityInt, err := strconv.ParseUint(request.BookingSecurity, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid bookingSecurity: must be a valid number",
+			})
+			return
+		}
 
-	c.JSON(http.StatusOK, response)
-}
+		// Convert parameters to proper big.Int types for ABI encoding
+		propertyId := new(big.Int).SetUint64(propertyIdInt)
+		date := new(big.Int).SetUint64(dateInt)
+		rentPrice := new(big.Int).SetUint64(rentPriceInt)
+		rentSecurity := new(big.Int).SetUint64(rentSecurityInt)
+		bookingPrice := new(big.Int).SetUint64(bookingPriceInt)
+		bookingSecurity := new(big.Int).SetUint64(bookingSecurityInt)
+
+		ctx := context.Background()
+
+		// The caller must own the property on-chain and the date must not be minted yet,
+		// otherwise the marketplace rejects createListing after we've pinned and saved it
+		caller, ok := auth.WalletFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Authenticated wallet is required",
+			})
+			return
+		}
 
-// ABIWrapper represents the structure of the ABI JSON file
-type ABIWrapper struct {
-	ABI interface{} `json:"abi"`
-}
+		ownershipErr, status, err := server.checkListingOwnership(ctx, propertyId, date, caller)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": "Failed to verify property ownership: " + err.Error(),
+			})
+			return
+		}
+		if ownershipErr != nil {
+			c.JSON(status, ownershipErr)
+			return
+		}
 
-func loadMarketPlaceABI() (*abi.ABI, error) {
-	// Get the current working directory and construct the path to the ABI file
-	abiPath := filepath.Join("abi", "marketplace.json")
+		// Fetch property details from database
+		property, err := server.Properties.GetPropertyByID(ctx, request.PropertyId)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Property not found: " + err.Error(),
+			})
+			return
+		}
 
-	// Read the ABI file
-	abiBytes, err := os.ReadFile(abiPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read ABI file: %v", err)
-	}
+		// Create listing data object combining property info with listing attributes
+		listingData := ListingData{
+			PropertyName:    property.PropertyName,
+			Description:     property.Description,
+			Image:           property.Image,
+			Date:            request.Date,
+			RentPrice:       request.RentPrice,
+			RentSecurity:    request.RentSecurity,
+			BookingPrice:    request.BookingPrice,
+			BookingSecurity: request.BookingSecurity,
+		}
 
-	// First parse the wrapper to extract the ABI array
-	var wrapper ABIWrapper
-	if err := json.Unmarshal(abiBytes, &wrapper); err != nil {
-		return nil, fmt.Errorf("failed to parse ABI wrapper: %v", err)
-	}
+		// Store listing metadata in the configured blob store
+		blob, err := server.putJSON(ctx, fmt.Sprintf("listing-%s-%s.json", request.PropertyId, request.Date), listingData)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to store listing metadata: " + err.Error(),
+			})
+			return
+		}
+		ipfsHash := blob.Key
+		server.catalogBlob(ctx, blob, db.FileSourceMetadata, caller, request.PropertyId)
+
+		// Create listing entry in database
+		listing := &db.Listing{
+			PropertyID: request.PropertyId,
+			Date:       request.Date,
+			IPFSHash:   ipfsHash,
+		}
 
-	// Convert the ABI interface back to JSON string
-	abiJSON, err := json.Marshal(wrapper.ABI)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal ABI: %v", err)
-	}
+		err = server.Listings.InsertListing(ctx, listing)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to save listing to database: " + err.Error(),
+			})
+			return
+		}
 
-	// Parse the ABI JSON
-	contractABI, err := abi.JSON(strings.NewReader(string(abiJSON)))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse ABI: %v", err)
-	}
+		// Load the marketplace contract ABI
+		contractABI, err := contracts.LoadMarketplaceABI()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to load contract ABI: " + err.Error(),
+			})
+			return
+		}
 
-	return &contractABI, nil
-}
+		// Encode the function call using ABI
+		data, err := contractABI.Pack("createListing", propertyId, date, rentPrice, rentSecurity, bookingPrice, bookingSecurity)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to encode function call: " + err.Error(),
+			})
+			return
+		}
 
-// loadPropertyABI loads the property contract ABI from the JSON file
-func loadPropertyABI() (*abi.ABI, error) {
-	// Get the current working directory and construct the path to the ABI file
-	abiPath := filepath.Join("abi", "property.json")
+		// Get chain configuration
+		chain, err := server.GetChain("0g")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to get chain configuration: " + err.Error(),
+			})
+			return
+		}
 
-	// Read the ABI file
-	abiBytes, err := os.ReadFile(abiPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read ABI file: %v", err)
-	}
+		contract, err := server.GetContract("marketplace")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to get contract: " + err.Error(),
+			})
+			return
+		}
 
-	// First parse the wrapper to extract the ABI array
-	var wrapper ABIWrapper
-	if err := json.Unmarshal(abiBytes, &wrapper); err != nil {
-		return nil, fmt.Errorf("failed to parse ABI wrapper: %v", err)
-	}
+		// Create the transaction data
+		transactionData := MintTransactionData{
+			ChainId: chain.ChainID,
+			To:      contract,
+			Data:    "0x" + common.Bytes2Hex(data),
+			Value:   "0x0", // No ETH value needed for creating listing
+		}
 
-	// Convert the ABI interface back to JSON string
-	abiJSON, err := json.Marshal(wrapper.ABI)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal ABI: %v", err)
-	}
+		// Create the response including IPFS hash
+		response := gin.H{
+			"success":     true,
+			"ipfs_hash":   ipfsHash,
+			"property_id": request.PropertyId,
+			"date":        request.Date,
+			"transaction": TxnResponse{
+				Msg: transactionData,
+			},
+		}
 
-	// Parse the ABI JSON
-	contractABI, err := abi.JSON(strings.NewReader(string(abiJSON)))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse ABI: %v", err)
+		c.JSON(http.StatusOK, response)
 	}
-
-	return &contractABI, nil
 }
 
 // GetChain fetches chain data for a specific chain from MongoDB
-func GetChain(chainName string) (*Chain, error) {
+func (s *Server) GetChain(chainName string) (*Chain, error) {
 	ctx := context.Background()
 
+	// Check if the database is available
+	if s.Chains == nil {
+		return nil, fmt.Errorf("database is not available")
+	}
+
 	// Get chain from MongoDB
-	chainDoc, err := db.MongoClient.GetChain(ctx, chainName)
+	chainDoc, err := s.Chains.GetChain(ctx, chainName)
 	if err != nil {
 		return nil, err
 	}
@@ -487,6 +384,7 @@ func GetChain(chainName string) (*Chain, error) {
 		Chain:   chainDoc.Chain,
 		RPC:     chainDoc.RPC,
 		ChainID: chainDoc.ChainID,
+		TxType:  chainDoc.TxType,
 	}
 
 	return chain, nil
@@ -496,16 +394,16 @@ type Contract struct {
 	ContractAddress string `json:"contract_address"`
 }
 
-func GetContract(contractType string) (string, error) {
+func (s *Server) GetContract(contractType string) (string, error) {
 	ctx := context.Background()
 
-	// Check if MongoDB client is initialized
-	if db.MongoClient.Client == nil {
-		return "", fmt.Errorf("MongoDB client is not initialized")
+	// Check if the database is available
+	if s.Chains == nil {
+		return "", fmt.Errorf("database is not available")
 	}
 
 	// Get contract from MongoDB
-	contractDoc, err := db.MongoClient.GetContract(ctx, contractType)
+	contractDoc, err := s.Chains.GetContract(ctx, contractType)
 	if err != nil {
 		return "", fmt.Errorf("failed to get contract: %w", err)
 	}
@@ -513,198 +411,110 @@ func GetContract(contractType string) (string, error) {
 	return contractDoc.ContractAddress, nil
 }
 
-// uploadToIPFS uploads JSON metadata to Pinata IPFS
-func uploadToIPFS(metadata NFTMetadata, pinataJWT string) (*PinataResponse, error) {
-	// Create the request payload for Pinata
-	pinataPayload := map[string]interface{}{
-		"pinataOptions": map[string]interface{}{
-			"cidVersion": 1,
-		},
-		"pinataMetadata": map[string]interface{}{
-			"name": fmt.Sprintf("%s.json", metadata.Name),
-		},
-		"pinataContent": metadata,
-	}
-
-	url := "https://api.pinata.cloud/pinning/pinJSONToIPFS"
-
-	// Convert metadata to JSON
-	jsonData, err := json.Marshal(pinataPayload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
-	}
-
-	// Create the request
-	req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("pinata_api_key", os.Getenv("PINATA_API_KEY"))
-	req.Header.Set("pinata_secret_api_key", os.Getenv("PINATA_SECRET_API_KEY"))
-
-	// Make the request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("pinata API returned status %d", resp.StatusCode)
-	}
-
-	// Parse response
-	var pinataResp PinataResponse
-	if err := json.NewDecoder(resp.Body).Decode(&pinataResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %v", err)
-	}
-
-	return &pinataResp, nil
-}
-
-// broadcastTransaction broadcasts a transaction to the blockchain
-func broadcastTransaction(rpcURL string, privateKeyHex string, to common.Address, data []byte, chainID *big.Int) (string, error) {
-	// Connect to the blockchain
-	client, err := ethclient.Dial(rpcURL)
-	if err != nil {
-		return "", fmt.Errorf("failed to connect to blockchain: %v", err)
-	}
-	defer client.Close()
-
-	// Parse private key
-	privateKey, err := crypto.HexToECDSA(privateKeyHex)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse private key: %v", err)
-	}
-
-	// Get public key and address
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return "", fmt.Errorf("error casting public key to ECDSA")
-	}
-
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-
-	// Get nonce
-	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
-	if err != nil {
-		return "", fmt.Errorf("failed to get nonce: %v", err)
-	}
-
-	// Get gas price
-	gasPrice, err := client.SuggestGasPrice(context.Background())
-	if err != nil {
-		return "", fmt.Errorf("failed to get gas price: %v", err)
-	}
-
-	// Estimate gas limit
-	gasLimit, err := client.EstimateGas(context.Background(), ethereum.CallMsg{
-		From: fromAddress,
-		To:   &to,
-		Data: data,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to estimate gas: %v", err)
-	}
+// broadcastTransaction signs a transaction with the given nonce and fees and sends it to the blockchain.
+// Dynamic fees produce an EIP-1559 transaction signed with the London signer, otherwise a legacy one is built.
+func broadcastTransaction(ctx context.Context, client ethereum.TransactionSender, privateKey *ecdsa.PrivateKey, nonce uint64, to common.Address, data []byte, value *big.Int, gasLimit uint64, fees *txFees, chainID *big.Int) (*types.Transaction, error) {
+	var tx *types.Transaction
+	var signer types.Signer
 
 	// Create transaction
-	tx := types.NewTransaction(nonce, to, big.NewInt(0), gasLimit, gasPrice, data)
+	if fees.Dynamic {
+		tx = types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainID,
+			Nonce:     nonce,
+			GasTipCap: fees.TipCap,
+			GasFeeCap: fees.FeeCap,
+			Gas:       gasLimit,
+			To:        &to,
+			Value:     value,
+			Data:      data,
+		})
+		signer = types.NewLondonSigner(chainID)
+	} else {
+		tx = types.NewTransaction(nonce, to, value, gasLimit, fees.GasPrice, data)
+		signer = types.NewEIP155Signer(chainID)
+	}
 
 	// Sign transaction
-	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), privateKey)
+	signedTx, err := types.SignTx(tx, signer, privateKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign transaction: %v", err)
+		return nil, fmt.Errorf("failed to sign transaction: %v", err)
 	}
 
 	// Send transaction
-	err = client.SendTransaction(context.Background(), signedTx)
+	err = client.SendTransaction(ctx, signedTx)
 	if err != nil {
-		return "", fmt.Errorf("failed to send transaction: %v", err)
+		return nil, fmt.Errorf("failed to send transaction: %v", err)
 	}
 
-	return signedTx.Hash().Hex(), nil
+	return signedTx, nil
 }
 
 // UploadImages handles multiple image uploads and saves them to the local uploads directory
-func UploadImages(c *gin.Context) {
-	// Parse multipart form with max memory of 32MB
-	err := c.Request.ParseMultipartForm(32 << 20)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, ImageUploadResponse{
-			Success: false,
-			Error:   "Failed to parse multipart form: " + err.Error(),
-		})
-		return
-	}
-
-	files := c.Request.MultipartForm.File["images"]
-	if len(files) == 0 {
-		c.JSON(http.StatusBadRequest, ImageUploadResponse{
-			Success: false,
-			Error:   "No images provided",
-		})
-		return
-	}
-
-	var imageURLs []string
-	uploadsDir := "uploads/images"
-
-	// Ensure uploads directory exists
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, ImageUploadResponse{
-			Success: false,
-			Error:   "Failed to create uploads directory: " + err.Error(),
-		})
-		return
-	}
-
-	for _, fileHeader := range files {
-		// Validate file type
-		if !isValidImageType(fileHeader.Header.Get("Content-Type")) {
+func UploadImages(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Parse multipart form with max memory of 32MB
+		err := c.Request.ParseMultipartForm(32 << 20)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, ImageUploadResponse{
 				Success: false,
-				Error:   "Invalid file type. Only JPEG, PNG, GIF, and WebP are allowed",
+				Error:   "Failed to parse multipart form: " + err.Error(),
 			})
 			return
 		}
 
-		// Validate file size (max 10MB)
-		if fileHeader.Size > 10<<20 {
+		files := c.Request.MultipartForm.File["images"]
+		if len(files) == 0 {
 			c.JSON(http.StatusBadRequest, ImageUploadResponse{
 				Success: false,
-				Error:   "File size too large. Maximum size is 10MB",
+				Error:   "No images provided",
 			})
 			return
 		}
 
-		// Generate unique filename
-		ext := filepath.Ext(fileHeader.Filename)
-		filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-		filePath := filepath.Join(uploadsDir, filename)
+		var imageURLs []string
+		var images []db.ImageVariants
 
-		// Save file
-		if err := saveUploadedFile(fileHeader, filePath); err != nil {
-			c.JSON(http.StatusInternalServerError, ImageUploadResponse{
-				Success: false,
-				Error:   "Failed to save file: " + err.Error(),
-			})
-			return
+		for _, fileHeader := range files {
+			// Validate file type
+			if !isValidImageType(fileHeader.Header.Get("Content-Type")) {
+				c.JSON(http.StatusBadRequest, ImageUploadResponse{
+					Success: false,
+					Error:   "Invalid file type. Only JPEG, PNG, GIF, and WebP are allowed",
+				})
+				return
+			}
+
+			// Validate file size (max 10MB)
+			if fileHeader.Size > 10<<20 {
+				c.JSON(http.StatusBadRequest, ImageUploadResponse{
+					Success: false,
+					Error:   "File size too large. Maximum size is 10MB",
+				})
+				return
+			}
+
+			// Save file to the image store
+			wallet, _ := auth.WalletFromContext(c)
+			variants, err := server.saveUploadedFile(c.Request.Context(), fileHeader, wallet)
+			if err != nil {
+				c.JSON(imageErrorStatus(err), ImageUploadResponse{
+					Success: false,
+					Error:   "Failed to save file: " + err.Error(),
+				})
+				return
+			}
+
+			imageURLs = append(imageURLs, variants.Full)
+			images = append(images, *variants)
 		}
 
-		// Create URL for the uploaded image
-		imageURL := fmt.Sprintf("/api/v1/images/%s", filename)
-		imageURLs = append(imageURLs, imageURL)
+		c.JSON(http.StatusOK, ImageUploadResponse{
+			Success:   true,
+			ImageURLs: imageURLs,
+			Images:    images,
+		})
 	}
-
-	c.JSON(http.StatusOK, ImageUploadResponse{
-		Success:   true,
-		ImageURLs: imageURLs,
-	})
 }
 
 // isValidImageType checks if the content type is a valid image type
@@ -725,65 +535,54 @@ func isValidImageType(contentType string) bool {
 	return false
 }
 
-// saveUploadedFile saves the uploaded file to the specified path
-func saveUploadedFile(fileHeader *multipart.FileHeader, dst string) error {
+// saveUploadedFile processes the uploaded image and saves its variants to the image store
+func (s *Server) saveUploadedFile(ctx context.Context, fileHeader *multipart.FileHeader, uploader string) (*db.ImageVariants, error) {
 	src, err := fileHeader.Open()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer src.Close()
 
-	out, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, src)
-	return err
+	return s.putImageVariants(ctx, src, fileHeader.Header.Get("Content-Type"), uploader)
 }
-func processImageFromRequest(imageData string) (string, error) {
-	if imageData == "" {
-		return "", nil // No image provided
-	}
-
-	uploadsDir := "uploads/images"
 
-	// Ensure uploads directory exists
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create uploads directory: %v", err)
+// processImageFromRequest stores the image given in a request and returns its variants. Values that
+// aren't a data URL or a remote URL are taken as an existing image URL and returned as is, without variants.
+func (s *Server) processImageFromRequest(ctx context.Context, imageData, uploader string) (string, *db.ImageVariants, error) {
+	if imageData == "" {
+		return "", nil, nil // No image provided
 	}
 
-	var imageURL string
+	var variants *db.ImageVariants
 	var err error
 
 	// Check if it's a base64 data URL (starts with "data:image/")
 	if strings.HasPrefix(imageData, "data:image/") {
-		imageURL, err = saveBase64Image(imageData, uploadsDir)
+		variants, err = s.saveBase64Image(ctx, imageData, uploader)
 		if err != nil {
-			return "", fmt.Errorf("failed to save base64 image: %v", err)
+			return "", nil, fmt.Errorf("failed to save base64 image: %w", err)
 		}
 	} else if strings.HasPrefix(imageData, "http://") || strings.HasPrefix(imageData, "https://") {
 		// It's a URL, download and save the image
-		imageURL, err = downloadAndSaveImage(imageData, uploadsDir)
+		variants, err = s.downloadAndSaveImage(ctx, imageData, uploader)
 		if err != nil {
-			return "", fmt.Errorf("failed to download and save image: %v", err)
+			return "", nil, fmt.Errorf("failed to download and save image: %w", err)
 		}
 	} else {
 		// Assume it's already a local path or filename
-		imageURL = imageData
+		return imageData, nil, nil
 	}
 
-	return imageURL, nil
+	return variants.Full, variants, nil
 }
 
-// saveBase64Image saves a base64 encoded image to the uploads directory
-func saveBase64Image(dataURL, uploadsDir string) (string, error) {
+// saveBase64Image processes a base64 encoded image and saves its variants to the image store
+func (s *Server) saveBase64Image(ctx context.Context, dataURL, uploader string) (*db.ImageVariants, error) {
 	// Parse the data URL
 	// Format: data:image/jpeg;base64,/9j/4AAQSkZJRgABAQEAYABgAAD...
 	parts := strings.Split(dataURL, ",")
 	if len(parts) != 2 {
-		return "", fmt.Errorf("invalid data URL format")
+		return nil, fmt.Errorf("invalid data URL format")
 	}
 
 	// Extract MIME type
@@ -798,520 +597,506 @@ func saveBase64Image(dataURL, uploadsDir string) (string, error) {
 	} else if strings.Contains(header, "image/webp") {
 		mimeType = "webp"
 	} else {
-		return "", fmt.Errorf("unsupported image type")
+		return nil, fmt.Errorf("%w: unsupported data URL type", imaging.ErrUnsupportedFormat)
 	}
 
-	// Decode base64 data
-	imageData, err := base64.StdEncoding.DecodeString(parts[1])
+	// Decode base64 data as it is processed
+	imageData := base64.NewDecoder(base64.StdEncoding, strings.NewReader(parts[1]))
+
+	variants, err := s.putImageVariants(ctx, imageData, "image/"+mimeType, uploader)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode base64 data: %v", err)
+		return nil, fmt.Errorf("failed to write image file: %w", err)
 	}
 
-	// Generate unique filename
-	filename := fmt.Sprintf("%d.%s", time.Now().UnixNano(), mimeType)
-	filePath := filepath.Join(uploadsDir, filename)
+	return variants, nil
+}
 
-	// Save file
-	if err := os.WriteFile(filePath, imageData, 0644); err != nil {
-		return "", fmt.Errorf("failed to write image file: %v", err)
+// downloadAndSaveImage downloads an image from a URL, processes it and saves its variants to the image store.
+// The fetch refuses internal addresses and bodies that aren't images.
+func (s *Server) downloadAndSaveImage(ctx context.Context, imageURL, uploader string) (*db.ImageVariants, error) {
+	if s.ImageFetcher == nil {
+		return nil, fmt.Errorf("image fetcher not configured")
 	}
 
-	// Return URL path
-	return fmt.Sprintf("/api/v1/images/%s", filename), nil
-}
-
-// downloadAndSaveImage downloads an image from a URL and saves it locally
-func downloadAndSaveImage(imageURL, uploadsDir string) (string, error) {
 	// Download the image
-	resp, err := http.Get(imageURL)
+	resp, err := s.ImageFetcher.Get(ctx, imageURL, "image/")
 	if err != nil {
-		return "", fmt.Errorf("failed to download image: %v", err)
+		return nil, fmt.Errorf("failed to download image: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to download image: status %d", resp.StatusCode)
+	// Only hold the content to an image type the server claims; generic types are left to detection
+	contentType := resp.DeclaredType
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = ""
 	}
 
-	// Read image data
-	imageData, err := io.ReadAll(resp.Body)
+	variants, err := s.putImageVariants(ctx, resp.Body, contentType, uploader)
 	if err != nil {
-		return "", fmt.Errorf("failed to read image data: %v", err)
+		return nil, fmt.Errorf("failed to write image file: %w", err)
 	}
 
-	// Determine file extension from Content-Type
-	contentType := resp.Header.Get("Content-Type")
-	var ext string
-	switch contentType {
-	case "image/jpeg", "image/jpg":
-		ext = "jpg"
-	case "image/png":
-		ext = "png"
-	case "image/gif":
-		ext = "gif"
-	case "image/webp":
-		ext = "webp"
-	default:
-		ext = "jpg" // default to jpg
-	}
-
-	// Generate unique filename
-	filename := fmt.Sprintf("%d.%s", time.Now().UnixNano(), ext)
-	filePath := filepath.Join(uploadsDir, filename)
-
-	// Save file
-	if err := os.WriteFile(filePath, imageData, 0644); err != nil {
-		return "", fmt.Errorf("failed to write image file: %v", err)
-	}
-
-	// Return URL path
-	return fmt.Sprintf("/api/v1/images/%s", filename), nil
+	return variants, nil
 }
 
-// RedirectToIPFS redirects to the IPFS URL based on property ID
-func RedirectToIPFS(c *gin.Context) {
-	propertyID := c.Param("property_id")
-	if propertyID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Property ID is required",
-		})
-		return
-	}
-
-	// Get property from database
-	ctx := context.Background()
-	property, err := db.MongoClient.GetPropertyByID(ctx, propertyID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Property not found: " + err.Error(),
-		})
-		return
-	}
-
-	// Redirect to the actual IPFS URL
-	ipfsURL := fmt.Sprintf("https://pink-improved-swift-480.mypinata.cloud/ipfs/%s", property.IPFSHash)
-
-	// Redirect to the IPFS URL
-	c.Redirect(http.StatusFound, ipfsURL)
+// imageErrorStatus maps image processing errors to client errors and anything else to a server error
+func imageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, imaging.ErrUnsupportedFormat), errors.Is(err, imaging.ErrTypeMismatch), errors.Is(err, imaging.ErrTooLarge):
+		return http.StatusBadRequest
+	case errors.Is(err, fetcher.ErrBlockedAddress), errors.Is(err, fetcher.ErrInvalidURL), errors.Is(err, fetcher.ErrTooManyRedirects),
+		errors.Is(err, fetcher.ErrTooLarge), errors.Is(err, fetcher.ErrUnexpectedType):
+		return http.StatusBadRequest
+	case errors.Is(err, fetcher.ErrUpstream):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
 }
 
 // GetPropertyInfo returns property information by property ID
-func GetPropertyInfo(c *gin.Context) {
-	propertyID := c.Param("property_id")
-	if propertyID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Property ID is required",
-		})
-		return
-	}
-
-	// Get property from database
-	ctx := context.Background()
-	property, err := db.MongoClient.GetPropertyByID(ctx, propertyID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Property not found: " + err.Error(),
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, property)
-}
-
-// CreateMintWithIPFS creates a mint transaction with IPFS metadata upload and optional broadcasting
-func CreateMintMessage(c *gin.Context) {
-	var req MintRequest
-	var processedImageURL string
-
-	// Check content type to determine how to parse the request
-	contentType := c.GetHeader("Content-Type")
-
-	if strings.Contains(contentType, "multipart/form-data") {
-		// Handle multipart form data
-		err := c.Request.ParseMultipartForm(32 << 20) // 32MB max memory
-		if err != nil {
-			c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
-				Error: "Failed to parse multipart form: " + err.Error(),
+func GetPropertyInfo(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		propertyID := c.Param("property_id")
+		if propertyID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Property ID is required",
 			})
 			return
 		}
 
-		// Extract form values
-		form := c.Request.MultipartForm
-
-		// Helper function to get form value
-		getFormValue := func(key string) string {
-			if values, exists := form.Value[key]; exists && len(values) > 0 {
-				return values[0]
-			}
-			return ""
-		}
-
-		// Create request struct from form data
-		req = MintRequest{
-			PropertyName:    getFormValue("property_name"),
-			PropertyAddress: getFormValue("property_address"),
-			Description:     getFormValue("description"),
-			To:              getFormValue("to"),
-			ExternalUrl:     getFormValue("external_url"),
-		}
-
-		// Validate required fields
-		if req.PropertyName == "" {
-			c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
-				Error: "property_name is required",
-			})
-			return
-		}
-		if req.PropertyAddress == "" {
-			c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
-				Error: "property_address is required",
-			})
-			return
-		}
-		if req.Description == "" {
-			c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
-				Error: "description is required",
+		// Check if the database is available
+		if server.Properties == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
 			})
 			return
 		}
-		if req.To == "" {
-			c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
-				Error: "to address is required",
+
+		// Get property from database
+		ctx := context.Background()
+		property, err := server.Properties.GetPropertyByID(ctx, propertyID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Property not found: " + err.Error(),
 			})
 			return
 		}
 
-		// Handle image upload if present
-		if files, exists := form.File["image"]; exists && len(files) > 0 {
-			fileHeader := files[0]
+		c.JSON(http.StatusOK, property)
+	}
+}
 
-			// Validate file type
-			if !isValidImageType(fileHeader.Header.Get("Content-Type")) {
+// CreateMintWithIPFS creates a mint transaction with IPFS metadata upload and optional broadcasting
+func CreateMintMessage(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req MintRequest
+		var processedImageURL string
+		var processedImage *db.ImageVariants
+
+		// Check content type to determine how to parse the request
+		contentType := c.GetHeader("Content-Type")
+
+		if strings.Contains(contentType, "multipart/form-data") {
+			// Handle multipart form data
+			err := c.Request.ParseMultipartForm(32 << 20) // 32MB max memory
+			if err != nil {
 				c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
-					Error: "Invalid file type. Only JPEG, PNG, GIF, and WebP are allowed",
+					Error: "Failed to parse multipart form: " + err.Error(),
 				})
 				return
 			}
 
-			// Validate file size (max 10MB)
-			if fileHeader.Size > 10<<20 {
+			// Extract form values
+			form := c.Request.MultipartForm
+
+			// Helper function to get form value
+			getFormValue := func(key string) string {
+				if values, exists := form.Value[key]; exists && len(values) > 0 {
+					return values[0]
+				}
+				return ""
+			}
+
+			// Create request struct from form data
+			req = MintRequest{
+				PropertyName:    getFormValue("property_name"),
+				PropertyAddress: getFormValue("property_address"),
+				Description:     getFormValue("description"),
+				To:              getFormValue("to"),
+				ExternalUrl:     getFormValue("external_url"),
+			}
+
+			// Validate required fields
+			if req.PropertyName == "" {
 				c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
-					Error: "File size too large. Maximum size is 10MB",
+					Error: "property_name is required",
 				})
 				return
 			}
-
-			// Generate unique filename
-			ext := filepath.Ext(fileHeader.Filename)
-			filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-			uploadsDir := "uploads/images"
-
-			// Ensure uploads directory exists
-			if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-				c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
-					Error: "Failed to create uploads directory: " + err.Error(),
+			if req.PropertyAddress == "" {
+				c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
+					Error: "property_address is required",
 				})
 				return
 			}
-
-			filePath := filepath.Join(uploadsDir, filename)
-
-			// Save file
-			if err := saveUploadedFile(fileHeader, filePath); err != nil {
-				c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
-					Error: "Failed to save file: " + err.Error(),
+			if req.Description == "" {
+				c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
+					Error: "description is required",
+				})
+				return
+			}
+			// Handle image upload if present
+			if files, exists := form.File["image"]; exists && len(files) > 0 {
+				fileHeader := files[0]
+
+				// Validate file type
+				if !isValidImageType(fileHeader.Header.Get("Content-Type")) {
+					c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
+						Error: "Invalid file type. Only JPEG, PNG, GIF, and WebP are allowed",
+					})
+					return
+				}
+
+				// Validate file size (max 10MB)
+				if fileHeader.Size > 10<<20 {
+					c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
+						Error: "File size too large. Maximum size is 10MB",
+					})
+					return
+				}
+
+				// Save file to the image store
+				wallet, _ := auth.WalletFromContext(c)
+				variants, err := server.saveUploadedFile(c.Request.Context(), fileHeader, wallet)
+				if err != nil {
+					c.JSON(imageErrorStatus(err), MintWithIPFSResponse{
+						Error: "Failed to save file: " + err.Error(),
+					})
+					return
+				}
+				processedImageURL = variants.Full
+				processedImage = variants
+			}
+		} else {
+			// Handle JSON data (original behavior)
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
+					Error: "Invalid request payload: " + err.Error(),
 				})
 				return
 			}
+		}
 
-			// Create URL for the uploaded image
-			processedImageURL = fmt.Sprintf("https://api.rebnb.sumitdhiman.in/api/v1/images/%s", filename)
+		// Mint to the signed-in wallet, never to an address it doesn't control
+		wallet, _ := auth.WalletFromContext(c)
+		if req.To == "" {
+			req.To = wallet
 		}
-	} else {
-		// Handle JSON data (original behavior)
-		if err := c.ShouldBindJSON(&req); err != nil {
+		if !strings.EqualFold(req.To, wallet) {
+			c.JSON(http.StatusForbidden, MintWithIPFSResponse{
+				Error: "to address must match the authenticated wallet",
+			})
+			return
+		}
+
+		// Validate the address format
+		if !common.IsHexAddress(req.To) {
 			c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
-				Error: "Invalid request payload: " + err.Error(),
+				Error: "Invalid address format",
 			})
 			return
 		}
-	}
+		ppId := fmt.Sprintf("%08d", time.Now().UnixNano()%1e8)
 
-	// Validate the address format
-	if !common.IsHexAddress(req.To) {
-		c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
-			Error: "Invalid address format",
-		})
-		return
-	}
-	ppId := fmt.Sprintf("%08d", time.Now().UnixNano()%1e8)
+		// Validate propertyId is a valid number
+		propertyIdInt, err := strconv.ParseUint(ppId, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
+				Error: "Invalid propertyId: must be a valid number",
+			})
+			return
+		}
 
-	// Validate propertyId is a valid number
-	propertyIdInt, err := strconv.ParseUint(ppId, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, MintWithIPFSResponse{
-			Error: "Invalid propertyId: must be a valid number",
-		})
-		return
-	}
+		ctx := context.Background()
 
-	// Process single image from request body (base64, URL, etc.) and save it locally
-	// For JSON requests, process the image field; for multipart, processedImageURL is already set
-	if processedImageURL == "" && req.Image != "" {
-		var processErr error
-		processedImageURL, processErr = processImageFromRequest(req.Image)
-		if processErr != nil {
+		// Process single image from request body (base64, URL, etc.) and save it to the image store
+		// For JSON requests, process the image field; for multipart, processedImageURL is already set
+		if processedImageURL == "" && req.Image != "" {
+			var processErr error
+			processedImageURL, processedImage, processErr = server.processImageFromRequest(ctx, req.Image, wallet)
+			if processErr != nil {
+				c.JSON(imageErrorStatus(processErr), MintWithIPFSResponse{
+					Error: "Failed to process image: " + processErr.Error(),
+				})
+				return
+			}
+		}
+
+		// Create NFT metadata
+		metadata := NFTMetadata{
+			Name:        req.PropertyName,
+			Description: req.Description,
+			ExternalURL: req.ExternalUrl,
+			Attributes:  req.Attributes,
+		}
+
+		// Set image URL if processed image is available
+		if processedImageURL != "" {
+			metadata.Image = processedImageURL
+			metadata.ImageVariants = processedImage
+		}
+
+		// Add default attributes if none provided
+		if len(metadata.Attributes) == 0 {
+			metadata.Attributes = []Attribute{
+				{
+					TraitType: "property_id",
+					Value:     ppId,
+				},
+				{
+					TraitType:   "date_of_mint",
+					Value:       fmt.Sprintf("%d", time.Now().Unix()),
+					DisplayType: "date",
+				},
+				{
+					TraitType: "property_address",
+					Value:     req.PropertyAddress,
+				},
+			}
+		}
+
+		// Store metadata in the configured blob store
+		metadataBlob, err := server.putJSON(ctx, fmt.Sprintf("property-%s.json", ppId), metadata)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
-				Error: "Failed to process image: " + processErr.Error(),
+				Error: "Failed to upload metadata: " + err.Error(),
 			})
 			return
 		}
-	}
 
-	// Create NFT metadata
-	metadata := NFTMetadata{
-		Name:        req.PropertyName,
-		Description: req.Description,
-		ExternalURL: req.ExternalUrl,
-		Attributes:  req.Attributes,
-	}
-
-	// Set image URL if processed image is available
-	if processedImageURL != "" {
-		metadata.Image = processedImageURL
-	}
+		// Create token URI pointing to the stored metadata
+		tokenURI := metadataBlob.URL
+		server.catalogBlob(ctx, metadataBlob, db.FileSourceMetadata, wallet, ppId)
+
+		// Store property data in database
+		property := &db.Property{
+			PropertyID:      ppId,
+			IPFSHash:        metadataBlob.Key,
+			WalletAddress:   req.To,
+			PropertyName:    req.PropertyName,
+			PropertyAddress: req.PropertyAddress,
+			Description:     req.Description,
+			Image:           processedImageURL,
+			ImageVariants:   processedImage,
+		}
 
-	// Add default attributes if none provided
-	if len(metadata.Attributes) == 0 {
-		metadata.Attributes = []Attribute{
-			{
-				TraitType: "property_id",
-				Value:     ppId,
-			},
-			{
-				TraitType:   "date_of_mint",
-				Value:       fmt.Sprintf("%d", time.Now().Unix()),
-				DisplayType: "date",
-			},
-			{
-				TraitType: "property_address",
-				Value:     req.PropertyAddress,
-			},
+		if server.Properties == nil {
+			fmt.Printf("Warning: Database not available, property %s not stored\n", property.PropertyID)
+		} else if err := server.Properties.InsertProperty(ctx, property); err != nil {
+			// Log the error but don't fail the request
+			fmt.Printf("Warning: Failed to store property in database: %v\n", err)
 		}
-	}
 
-	// Get Pinata JWT from environment
-	pinataJWT := os.Getenv("PINATA_JWT")
-	if pinataJWT == "" {
-		c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
-			Error: "Pinata JWT not configured",
-		})
-		return
-	}
+		// The image was stored before the property ID existed, attach every size of it now
+		if processedImage != nil && server.Files != nil && server.Images != nil {
+			for _, imageURL := range processedImage.URLs() {
+				if err := server.Files.LinkFileToProperty(ctx, imageURL, ppId); err != nil {
+					fmt.Printf("Warning: Failed to link image to property %s: %v\n", ppId, err)
+				}
+				if err := server.Images.AddImageRef(ctx, imageURL, ppId); err != nil {
+					fmt.Printf("Warning: Failed to count image reference for property %s: %v\n", ppId, err)
+				}
+			}
+		}
 
-	// Upload metadata to IPFS via Pinata
-	pinataResp, err := uploadToIPFS(metadata, pinataJWT)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
-			Error: "Failed to upload to IPFS: " + err.Error(),
-		})
-		return
-	}
+		// Load the contract ABI
+		contractABI, err := contracts.LoadPropertyABI()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
+				Error: "Failed to load contract ABI: " + err.Error(),
+			})
+			return
+		}
 
-	// Create token URI pointing to IPFS
-	tokenURI := fmt.Sprintf("https://pink-improved-swift-480.mypinata.cloud/ipfs/%s", pinataResp.IPFSHash)
-
-	// Store property data in database
-	property := &db.Property{
-		PropertyID:      ppId,
-		IPFSHash:        pinataResp.IPFSHash, // Using actual IPFS hash
-		WalletAddress:   req.To,
-		PropertyName:    req.PropertyName,
-		PropertyAddress: req.PropertyAddress,
-		Description:     req.Description,
-		Image:           processedImageURL,
-	}
+		// Convert parameters to proper types
+		toAddress := common.HexToAddress(req.To)
+		propertyId := new(big.Int).SetUint64(propertyIdInt)
 
-	ctx := context.Background()
-	if err := db.MongoClient.InsertProperty(ctx, property); err != nil {
-		// Log the error but don't fail the request
-		fmt.Printf("Warning: Failed to store property in database: %v\n", err)
-	}
+		// Encode the function call using ABI (assuming mint function takes to, propertyId, tokenURI)
+		data, err := contractABI.Pack("mint", toAddress, propertyId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
+				Error: "Failed to encode function call: " + err.Error(),
+			})
+			return
+		}
 
-	// Load the contract ABI
-	contractABI, err := loadPropertyABI()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
-			Error: "Failed to load contract ABI: " + err.Error(),
-		})
-		return
-	}
+		// Get chain and contract configuration
+		chain, err := server.GetChain("0g")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
+				Error: "Failed to get chain: " + err.Error(),
+			})
+			return
+		}
 
-	// Convert parameters to proper types
-	toAddress := common.HexToAddress(req.To)
-	propertyId := new(big.Int).SetUint64(propertyIdInt)
+		contractAddress, err := server.GetContract("property")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
+				Error: "Failed to get contract: " + err.Error(),
+			})
+			return
+		}
 
-	// Encode the function call using ABI (assuming mint function takes to, propertyId, tokenURI)
-	data, err := contractABI.Pack("mint", toAddress, propertyId)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
-			Error: "Failed to encode function call: " + err.Error(),
-		})
-		return
-	}
+		// Create the transaction data
 
-	// Get chain and contract configuration
-	chain, err := GetChain("0g")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
-			Error: "Failed to get chain: " + err.Error(),
-		})
-		return
-	}
+		response := MintWithIPFSResponse{
+			IPFSHash:   metadataBlob.Key,
+			TokenURI:   tokenURI,
+			PropertyId: ppId,
+		}
 
-	contractAddress, err := GetContract("property")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
-			Error: "Failed to get contract: " + err.Error(),
-		})
-		return
-	}
+		// Submit the mint through the transaction manager when one is running
+		if server.TxManager != nil {
+			from, err := server.TxManager.DefaultSigner()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
+					Error: "Failed to get signer: " + err.Error(),
+				})
+				return
+			}
 
-	// Create the transaction data
+			// Add debugging information
+			fmt.Printf("DEBUG: Contract address: %s\n", contractAddress)
+			fmt.Printf("DEBUG: Chain ID: %s\n", chain.ChainID)
+			fmt.Printf("DEBUG: RPC URL: %s\n", chain.RPC)
+
+			tx, err := server.TxManager.Send(ctx, from, common.HexToAddress(contractAddress), data)
+			if err != nil {
+				response.Error = "Failed to broadcast transaction: " + err.Error()
+				fmt.Printf("DEBUG: Transaction error: %s\n", err.Error())
+			} else {
+				// Give the transaction a moment to be mined before reporting its status
+				waitCtx, cancel := context.WithTimeout(ctx, server.TxManager.config.ReceiptWait)
+				tx = server.TxManager.WaitForReceipt(waitCtx, tx)
+				cancel()
+
+				response.TransactionHash = tx.Hash
+				response.TransactionStatus = tx.Status
+				response.Receipt = toTransactionReceipt(tx)
+			}
+		}
 
-	response := MintWithIPFSResponse{
-		IPFSHash:   pinataResp.IPFSHash, // Using actual IPFS hash
-		TokenURI:   tokenURI,
-		PropertyId: ppId,
+		c.JSON(http.StatusOK, response)
 	}
+}
 
-	privateKey := os.Getenv(
-		"PRIVATE_KEY",
-	)
-
-	// If broadcast is requested, send the transaction
-	if privateKey != "" {
-		// Remove 0x prefix if present
-		privateKey := strings.TrimPrefix(privateKey, "0x")
-
-		// Parse chain ID
-		chainID, success := new(big.Int).SetString(chain.ChainID, 0)
-		if !success {
-			c.JSON(http.StatusInternalServerError, MintWithIPFSResponse{
-				Error: "Invalid chain ID format",
+func GetProperties(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Check if the database is available
+		if server.Properties == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
 			})
 			return
 		}
 
-		// Add debugging information
-		fmt.Printf("DEBUG: Contract address: %s\n", contractAddress)
-		fmt.Printf("DEBUG: Chain ID: %s\n", chain.ChainID)
-		fmt.Printf("DEBUG: RPC URL: %s\n", chain.RPC)
-
-		// Broadcast transaction
-		txHash, err := broadcastTransaction(
-			chain.RPC,
-			privateKey,
-			common.HexToAddress(contractAddress),
-			data,
-			chainID,
-		)
+		properties, err := server.Properties.GetProperties(context.TODO())
 		if err != nil {
-			response.Error = "Failed to broadcast transaction: " + err.Error()
-			fmt.Printf("DEBUG: Transaction error: %s\n", err.Error())
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Properties not found: " + err.Error(),
+			})
+			return
 		}
-		response.TransactionHash = txHash
-	}
-
-	c.JSON(http.StatusOK, response)
-}
 
-func GetMetadataForListing(c *gin.Context) {
-	// Check if MongoDB client is initialized
-	if db.MongoClient.Client == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Database connection not available",
-		})
-		return
+		c.JSON(http.StatusOK, properties)
 	}
+}
+func GetListingsByPropertyHandler(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Check if the database is available
+		if server.Listings == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
 
-	propertyId := c.Param("property_id")
-	if propertyId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Property ID is required",
-		})
-		return
-	}
+		propertyId := c.Param("property_id")
+		if propertyId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Property ID is required",
+			})
+			return
+		}
 
-	date := c.Param("date")
-	if date == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Date is required",
-		})
-		return
-	}
+		lists, err := server.Listings.GetListingsByProperty(context.TODO(), propertyId)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Listings not found: " + err.Error(),
+			})
+			return
+		}
+		if len(lists) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Listings not found",
+			})
+			return
+		}
 
-	listing, err := db.MongoClient.GetListingByPropertyAndDate(context.TODO(), propertyId, date)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Listing not found: " + err.Error(),
-		})
-		return
+		// Merge in Marketplace state; listings still come back if the chain can't be reached
+		c.JSON(http.StatusOK, server.mergeListingStates(c.Request.Context(), propertyId, lists))
 	}
-
-	http.Redirect(c.Writer, c.Request, "https://pink-improved-swift-480.mypinata.cloud/ipfs/"+listing.IPFSHash, http.StatusFound)
 }
 
-func GetProperties(c *gin.Context) {
-	// Check if MongoDB client is initialized
-	if db.MongoClient.Client == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Database connection not available",
-		})
-		return
-	}
-
-	properties, err := db.MongoClient.GetProperties(context.TODO())
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Properties not found: " + err.Error(),
-		})
-		return
-	}
+// GetSettlementsHandler returns the indexed settlement history for a property, optionally filtered by date.
+// Only confirmed events are returned unless confirmed=false asks for the pending, still reorgable ones.
+func GetSettlementsHandler(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Check if MongoDB client is initialized
+		if server.Settlements == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
 
-	c.JSON(http.StatusOK, properties)
-}
-func GetListingsByPropertyHandler(c *gin.Context) {
-	// Check if MongoDB client is initialized
-	if db.MongoClient.Client == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Database connection not available",
-		})
-		return
-	}
+		propertyId := c.Param("property_id")
+		if propertyId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Property ID is required",
+			})
+			return
+		}
+		date := c.Query("date")
+		confirmed, err := strconv.ParseBool(c.DefaultQuery("confirmed", "true"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "confirmed must be true or false",
+			})
+			return
+		}
 
-	propertyId := c.Param("property_id")
-	if propertyId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Property ID is required",
-		})
-		return
-	}
+		ctx := c.Request.Context()
+		response := gin.H{
+			"property_id": propertyId,
+			"confirmed":   confirmed,
+		}
+		for key, event := range map[string]string{
+			"payments":   "SettlePayment",
+			"securities": "SettleSecurity",
+			"fees":       "SettleFee",
+		} {
+			events, err := server.Settlements.GetSettlementEvents(ctx, event, propertyId, date, confirmed)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to get settlements: " + err.Error(),
+				})
+				return
+			}
+			response[key] = events
+		}
 
-	lists, err := db.MongoClient.GetListingsByProperty(context.TODO(), propertyId)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Listings not found: " + err.Error(),
-		})
-		return
+		c.JSON(http.StatusOK, response)
 	}
-	if len(lists) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Listings not found",
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, lists)
 }
@@ -0,0 +1,171 @@
+package token
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// secondsPerDay converts unix timestamps to the contract's day numbers
+	secondsPerDay = 86400
+	// defaultCalendarDays is the range returned when `to` is omitted
+	defaultCalendarDays = 30
+	// maxCalendarDays bounds a single calendar request
+	maxCalendarDays = 366
+)
+
+// CalendarDay represents a single night on a property's calendar
+type CalendarDay struct {
+	Date            string `json:"date"`
+	Day             string `json:"day"`
+	Status          string `json:"status"`
+	Available       bool   `json:"available"`
+	RentPrice       string `json:"rent_price,omitempty"`
+	RentSecurity    string `json:"rent_security,omitempty"`
+	BookingPrice    string `json:"booking_price,omitempty"`
+	BookingSecurity string `json:"booking_security,omitempty"`
+	IPFSHash        string `json:"ipfs_hash,omitempty"`
+	StateError      string `json:"state_error,omitempty"`
+}
+
+// CalendarResponse represents the response for the calendar endpoint
+type CalendarResponse struct {
+	PropertyID string        `json:"property_id"`
+	From       string        `json:"from"`
+	To         string        `json:"to"`
+	Days       []CalendarDay `json:"days"`
+}
+
+// parseCalendarDay accepts a contract day number, an ISO date (2006-01-02) or an RFC 3339 timestamp
+func parseCalendarDay(value string) (int64, error) {
+	if day, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if day < 0 {
+			return 0, fmt.Errorf("day number must not be negative")
+		}
+		return day, nil
+	}
+
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.Unix() / secondsPerDay, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC().Unix() / secondsPerDay, nil
+	}
+
+	return 0, fmt.Errorf("expected a day number or an ISO date")
+}
+
+// GetPropertyCalendar returns every day in [from, to] with its listing status and prices
+func GetPropertyCalendar(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Check if the database is available
+		if server.Listings == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
+
+		propertyId := c.Param("property_id")
+		if propertyId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Property ID is required",
+			})
+			return
+		}
+
+		from := time.Now().Unix() / secondsPerDay
+		if value := c.Query("from"); value != "" {
+			day, err := parseCalendarDay(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid from: " + err.Error(),
+				})
+				return
+			}
+			from = day
+		}
+
+		to := from + defaultCalendarDays - 1
+		if value := c.Query("to"); value != "" {
+			day, err := parseCalendarDay(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid to: " + err.Error(),
+				})
+				return
+			}
+			to = day
+		}
+
+		if to < from {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid range: to must not be before from",
+			})
+			return
+		}
+		if to-from+1 > maxCalendarDays {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid range: at most %d days can be requested", maxCalendarDays),
+			})
+			return
+		}
+
+		ctx := c.Request.Context()
+
+		listings, err := server.Listings.GetListingsByPropertyInRange(ctx, propertyId, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to get listings: " + err.Error(),
+			})
+			return
+		}
+
+		views := make(map[int64]ListingView, len(listings))
+		for _, view := range server.mergeListingStates(ctx, propertyId, listings) {
+			views[view.Day] = view
+		}
+
+		days := make([]CalendarDay, 0, to-from+1)
+		for day := from; day <= to; day++ {
+			entry := CalendarDay{
+				Date:   strconv.FormatInt(day, 10),
+				Day:    time.Unix(day*secondsPerDay, 0).UTC().Format("2006-01-02"),
+				Status: ListingStatusUnlisted,
+			}
+
+			if view, ok := views[day]; ok {
+				entry.Status = ListingStatusListed
+				entry.IPFSHash = view.IPFSHash
+				entry.StateError = view.StateError
+
+				if state := view.OnChain; state != nil {
+					switch state.Status {
+					case ListingStatusUnlisted, ListingStatusBooked, ListingStatusCompleted:
+						entry.Status = state.Status
+					}
+					entry.Available = state.Active
+					if state.Status != ListingStatusUnlisted {
+						entry.RentPrice = state.RentPrice
+						entry.RentSecurity = state.RentSecurity
+						entry.BookingPrice = state.BookingPrice
+						entry.BookingSecurity = state.BookingSecurity
+					}
+				}
+			}
+
+			days = append(days, entry)
+		}
+
+		c.JSON(http.StatusOK, CalendarResponse{
+			PropertyID: propertyId,
+			From:       strconv.FormatInt(from, 10),
+			To:         strconv.FormatInt(to, 10),
+			Days:       days,
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"rebnb/contracts"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// OwnershipError represents a structured ownership check failure
+type OwnershipError struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	PropertyID string `json:"property_id"`
+	Date       string `json:"date,omitempty"`
+	Owner      string `json:"owner,omitempty"`
+	Caller     string `json:"caller,omitempty"`
+}
+
+// callContract executes a read-only contract call and unpacks its return values
+func callContract(ctx context.Context, client *ethclient.Client, contractABI *abi.ABI, address common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s call: %v", method, err)
+	}
+
+	output, err := client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := contractABI.Unpack(method, output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s result: %v", method, err)
+	}
+
+	return values, nil
+}
+
+// contractCall is a single read-only call in a batch. Result and Err are filled by batchCallContracts.
+type contractCall struct {
+	ABI    *abi.ABI
+	To     common.Address
+	Method string
+	Args   []interface{}
+	Result []interface{}
+	Err    error
+}
+
+// batchCallContracts executes calls as a single JSON-RPC batch of eth_call requests.
+// The returned error covers the batch as a whole; per-call failures such as reverts land in each call's Err.
+func batchCallContracts(ctx context.Context, client *ethclient.Client, calls []*contractCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	elems := make([]rpc.BatchElem, len(calls))
+	outputs := make([]hexutil.Bytes, len(calls))
+	for i, call := range calls {
+		data, err := call.ABI.Pack(call.Method, call.Args...)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s call: %v", call.Method, err)
+		}
+
+		elems[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args: []interface{}{
+				map[string]interface{}{"to": call.To, "data": hexutil.Bytes(data)},
+				"latest",
+			},
+			Result: &outputs[i],
+		}
+	}
+
+	if err := client.Client().BatchCallContext(ctx, elems); err != nil {
+		return fmt.Errorf("batch call failed: %v", err)
+	}
+
+	for i, call := range calls {
+		if elems[i].Error != nil {
+			call.Err = elems[i].Error
+			continue
+		}
+		call.Result, call.Err = call.ABI.Unpack(call.Method, outputs[i])
+	}
+
+	return nil
+}
+
+// callAddress executes a contract call that returns a single address
+func callAddress(ctx context.Context, client *ethclient.Client, contractABI *abi.ABI, address common.Address, method string, args ...interface{}) (common.Address, error) {
+	values, err := callContract(ctx, client, contractABI, address, method, args...)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	result, ok := values[0].(common.Address)
+	if !ok {
+		return common.Address{}, fmt.Errorf("unexpected %s result type %T", method, values[0])
+	}
+
+	return result, nil
+}
+
+// revertErrorCode is the JSON-RPC error code nodes return for reverted calls
+const revertErrorCode = 3
+
+// isRevert reports whether a call error came from the contract reverting rather than the RPC failing.
+// Every JSON-RPC error implements rpc.DataError, so only errors with the revert code, revert data or
+// a revert message count. Transport, rate limit and node errors don't.
+func isRevert(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == revertErrorCode {
+		return true
+	}
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) && dataErr.ErrorData() != nil {
+		return true
+	}
+	return strings.Contains(err.Error(), "execution reverted")
+}
+
+// checkListingOwnership verifies on-chain that caller owns the property and that the date has
+// not been minted yet, mirroring the checks Marketplace.createListing makes. A non-nil
+// OwnershipError is returned with the HTTP status to respond with when a check fails.
+func (s *Server) checkListingOwnership(ctx context.Context, propertyId, date *big.Int, caller string) (*OwnershipError, int, error) {
+	_, client, err := s.getChainClient(ctx, "0g")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	propertyAddress, err := s.GetContract("property")
+	if err != nil {
+		return nil, 0, err
+	}
+	if !common.IsHexAddress(propertyAddress) {
+		return nil, 0, fmt.Errorf("property contract address '%s' is not configured", propertyAddress)
+	}
+
+	propertyABI, err := contracts.LoadPropertyABI()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	owner, err := callAddress(ctx, client, propertyABI, common.HexToAddress(propertyAddress), "ownerOf", propertyId)
+	if err != nil {
+		if isRevert(err) {
+			return &OwnershipError{
+				Error:      "property_not_minted",
+				Message:    "Property token does not exist on-chain",
+				PropertyID: propertyId.String(),
+			}, http.StatusNotFound, nil
+		}
+		return nil, 0, fmt.Errorf("failed to get property owner: %v", err)
+	}
+
+	if !strings.EqualFold(owner.Hex(), caller) {
+		return &OwnershipError{
+			Error:      "not_property_owner",
+			Message:    "Only the owner of the property can create listings for it",
+			PropertyID: propertyId.String(),
+			Owner:      owner.Hex(),
+			Caller:     caller,
+		}, http.StatusForbidden, nil
+	}
+
+	dateToken, err := callAddress(ctx, client, propertyABI, common.HexToAddress(propertyAddress), "date_token", propertyId)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get date token: %v", err)
+	}
+	if dateToken == (common.Address{}) {
+		return &OwnershipError{
+			Error:      "date_token_missing",
+			Message:    "Property has no date token deployed",
+			PropertyID: propertyId.String(),
+		}, http.StatusConflict, nil
+	}
+
+	// Date tokens are ERC-721s, ownerOf reverts until the date is minted by createListing
+	holder, err := callAddress(ctx, client, propertyABI, dateToken, "ownerOf", date)
+	if err == nil {
+		return &OwnershipError{
+			Error:      "date_already_listed",
+			Message:    "A listing already exists for this date",
+			PropertyID: propertyId.String(),
+			Date:       date.String(),
+			Owner:      holder.Hex(),
+			Caller:     caller,
+		}, http.StatusConflict, nil
+	}
+	if !isRevert(err) {
+		return nil, 0, fmt.Errorf("failed to get date owner: %v", err)
+	}
+
+	return nil, 0, nil
+}
@@ -0,0 +1,74 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// rpcErrorServer answers every JSON-RPC request with the given error object, or with an HTTP
+// error when rpcError is empty
+func rpcErrorServer(t *testing.T, status int, rpcError string) *ethclient.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		if rpcError == "" {
+			http.Error(w, "upstream unavailable", status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":%s}`, request.ID, rpcError)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := ethclient.Dial(server.URL)
+	if err != nil {
+		t.Fatalf("failed to dial fake node: %v", err)
+	}
+	t.Cleanup(client.Close)
+
+	return client
+}
+
+func TestIsRevert(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		rpcError string
+		revert   bool
+	}{
+		{"revert code with data", 200, `{"code":3,"message":"execution reverted: ERC721NonexistentToken","data":"0x7e273289"}`, true},
+		{"revert message without data", 200, `{"code":-32000,"message":"execution reverted"}`, true},
+		{"rate limited", 200, `{"code":-32005,"message":"request rate exceeded"}`, false},
+		{"node error", 200, `{"code":-32603,"message":"internal error"}`, false},
+		{"header not found", 200, `{"code":-32000,"message":"header not found"}`, false},
+		{"transport error", http.StatusBadGateway, "", false},
+	}
+
+	to := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := rpcErrorServer(t, tt.status, tt.rpcError)
+
+			_, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &to}, nil)
+			if err == nil {
+				t.Fatal("expected the call to fail")
+			}
+			if got := isRevert(err); got != tt.revert {
+				t.Errorf("isRevert(%v) = %v, want %v", err, got, tt.revert)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package token
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// getEthClient returns a shared client for the given RPC URL, dialing it on first use
+func (s *Server) getEthClient(ctx context.Context, rpcURL string) (*ethclient.Client, error) {
+	s.ethClientsMu.Lock()
+	defer s.ethClientsMu.Unlock()
+
+	if client, ok := s.ethClients[rpcURL]; ok {
+		return client, nil
+	}
+
+	client, err := ethclient.DialContext(ctx, rpcURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to blockchain: %v", err)
+	}
+	if s.ethClients == nil {
+		s.ethClients = make(map[string]*ethclient.Client)
+	}
+	s.ethClients[rpcURL] = client
+
+	return client, nil
+}
+
+// getChainClient resolves a chain by name and returns a shared client for its RPC endpoint
+func (s *Server) getChainClient(ctx context.Context, chainName string) (*Chain, *ethclient.Client, error) {
+	chain, err := s.GetChain(chainName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get chain: %w", err)
+	}
+
+	client, err := s.getEthClient(ctx, chain.RPC)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return chain, client, nil
+}
@@ -0,0 +1,187 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"rebnb/db"
+	"sort"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Priority fee strategies for dynamic-fee transactions
+const (
+	// PriorityFeeSuggested asks the node via eth_maxPriorityFeePerGas
+	PriorityFeeSuggested = "suggested"
+	// PriorityFeeFixed always pays the configured tip
+	PriorityFeeFixed = "fixed"
+	// PriorityFeeHistory pays a percentile of the tips paid in recent blocks
+	PriorityFeeHistory = "fee_history"
+)
+
+// minFeeBump is the least a replacement raises a fee by, so fees that round down to no increase,
+// zero tips in particular, still go up
+var minFeeBump = big.NewInt(1_000_000_000) // 1 gwei
+
+// feeHistoryBlocks is the number of recent blocks sampled by the fee_history strategy
+const feeHistoryBlocks = 10
+
+// PriorityFeeConfig configures how the priority fee of dynamic-fee transactions is chosen
+type PriorityFeeConfig struct {
+	Strategy      string
+	FixedTip      *big.Int
+	Percentile    float64
+	BaseFeeFactor int64 // fee cap is BaseFeeFactor * base fee + tip
+}
+
+// NewPriorityFeeConfigFromEnv creates a new priority fee config from environment variables
+func NewPriorityFeeConfigFromEnv() *PriorityFeeConfig {
+	config := &PriorityFeeConfig{
+		Strategy:      PriorityFeeSuggested,
+		FixedTip:      big.NewInt(1_000_000_000), // 1 gwei
+		Percentile:    50,
+		BaseFeeFactor: 2,
+	}
+
+	switch strategy := os.Getenv("TX_PRIORITY_FEE_STRATEGY"); strategy {
+	case PriorityFeeSuggested, PriorityFeeFixed, PriorityFeeHistory:
+		config.Strategy = strategy
+	}
+
+	// A zero tip leaves transactions for validators to ignore
+	if tip, ok := new(big.Int).SetString(os.Getenv("TX_PRIORITY_FEE_WEI"), 10); ok && tip.Sign() > 0 {
+		config.FixedTip = tip
+	}
+	if p, err := strconv.ParseFloat(os.Getenv("TX_PRIORITY_FEE_PERCENTILE"), 64); err == nil && p >= 0 && p <= 100 {
+		config.Percentile = p
+	}
+	if f, err := strconv.ParseInt(os.Getenv("TX_BASE_FEE_FACTOR"), 10, 64); err == nil && f >= 1 {
+		config.BaseFeeFactor = f
+	}
+
+	return config
+}
+
+// txFees holds the fee fields of a transaction, either legacy or EIP-1559
+type txFees struct {
+	Dynamic  bool
+	GasPrice *big.Int
+	TipCap   *big.Int
+	FeeCap   *big.Int
+}
+
+// TxType returns the chain transaction type these fees are used with
+func (f *txFees) TxType() string {
+	if f.Dynamic {
+		return db.TxTypeDynamicFee
+	}
+	return db.TxTypeLegacy
+}
+
+// bump raises every fee field by the given percentage for a replacement transaction
+func (f *txFees) bump(percent int64) *txFees {
+	if f.Dynamic {
+		return &txFees{Dynamic: true, TipCap: bumpFee(f.TipCap, percent), FeeCap: bumpFee(f.FeeCap, percent)}
+	}
+	return &txFees{GasPrice: bumpFee(f.GasPrice, percent)}
+}
+
+// exceeds reports whether any fee field is higher than the corresponding field of other
+func (f *txFees) exceeds(other *txFees) bool {
+	if f.Dynamic != other.Dynamic {
+		return false
+	}
+	if f.Dynamic {
+		return f.TipCap.Cmp(other.TipCap) > 0 || f.FeeCap.Cmp(other.FeeCap) > 0
+	}
+	return f.GasPrice.Cmp(other.GasPrice) > 0
+}
+
+// max returns the field-wise maximum of two fee sets of the same type
+func (f *txFees) max(other *txFees) *txFees {
+	pick := func(a, b *big.Int) *big.Int {
+		if a.Cmp(b) > 0 {
+			return a
+		}
+		return b
+	}
+
+	if f.Dynamic {
+		return &txFees{Dynamic: true, TipCap: pick(f.TipCap, other.TipCap), FeeCap: pick(f.FeeCap, other.FeeCap)}
+	}
+	return &txFees{GasPrice: pick(f.GasPrice, other.GasPrice)}
+}
+
+// feeSource reads what fee suggestions are based on; an *ethclient.Client is one
+type feeSource interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	ethereum.GasPricer
+	ethereum.GasPricer1559
+	ethereum.FeeHistoryReader
+}
+
+// suggestFees picks EIP-1559 fees when the latest header carries a base fee and falls back to a legacy gas price
+func suggestFees(ctx context.Context, client feeSource, config *PriorityFeeConfig) (*txFees, error) {
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest header: %v", err)
+	}
+
+	// Chains without London have no base fee
+	if header.BaseFee == nil {
+		gasPrice, err := client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get gas price: %v", err)
+		}
+		return &txFees{GasPrice: gasPrice}, nil
+	}
+
+	tip, err := suggestTip(ctx, client, config)
+	if err != nil {
+		return nil, err
+	}
+
+	feeCap := new(big.Int).Mul(header.BaseFee, big.NewInt(config.BaseFeeFactor))
+	feeCap.Add(feeCap, tip)
+
+	return &txFees{Dynamic: true, TipCap: tip, FeeCap: feeCap}, nil
+}
+
+// suggestTip returns the priority fee according to the configured strategy
+func suggestTip(ctx context.Context, client feeSource, config *PriorityFeeConfig) (*big.Int, error) {
+	switch config.Strategy {
+	case PriorityFeeFixed:
+		return new(big.Int).Set(config.FixedTip), nil
+
+	case PriorityFeeHistory:
+		history, err := client.FeeHistory(ctx, feeHistoryBlocks, nil, []float64{config.Percentile})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get fee history: %v", err)
+		}
+
+		var tips []*big.Int
+		for _, reward := range history.Reward {
+			if len(reward) > 0 && reward[0] != nil {
+				tips = append(tips, reward[0])
+			}
+		}
+		if len(tips) == 0 {
+			return new(big.Int).Set(config.FixedTip), nil
+		}
+
+		// Use the median of the per-block percentiles so one outlier block doesn't set the price
+		sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+		return new(big.Int).Set(tips[len(tips)/2]), nil
+
+	default:
+		tip, err := client.SuggestGasTipCap(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get priority fee: %v", err)
+		}
+		return tip, nil
+	}
+}
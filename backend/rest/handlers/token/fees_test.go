@@ -0,0 +1,167 @@
+package token
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+const gwei = 1_000_000_000
+
+// legacyFees and dynamicFees build fee sets from gwei amounts
+func legacyFees(gasPrice int64) *txFees {
+	return &txFees{GasPrice: big.NewInt(gasPrice * gwei)}
+}
+
+func dynamicFees(tip, feeCap int64) *txFees {
+	return &txFees{Dynamic: true, TipCap: big.NewInt(tip * gwei), FeeCap: big.NewInt(feeCap * gwei)}
+}
+
+// sameFees reports whether two fee sets have the same type and fields
+func sameFees(a, b *txFees) bool {
+	if a.Dynamic != b.Dynamic {
+		return false
+	}
+	if a.Dynamic {
+		return a.TipCap.Cmp(b.TipCap) == 0 && a.FeeCap.Cmp(b.FeeCap) == 0
+	}
+	return a.GasPrice.Cmp(b.GasPrice) == 0
+}
+
+func TestFeesBump(t *testing.T) {
+	tests := []struct {
+		name    string
+		fees    *txFees
+		percent int64
+		want    *txFees
+	}{
+		{"legacy", legacyFees(10), 20, legacyFees(12)},
+		{"legacy below the minimum bump", legacyFees(2), 10, legacyFees(3)},
+		{"zero gas price", legacyFees(0), 20, legacyFees(1)},
+		{"dynamic", dynamicFees(10, 50), 20, dynamicFees(12, 60)},
+		{"zero tip", dynamicFees(0, 20), 20, dynamicFees(1, 24)},
+		{"small tip", &txFees{Dynamic: true, TipCap: big.NewInt(3), FeeCap: big.NewInt(100 * gwei)}, 20,
+			&txFees{Dynamic: true, TipCap: big.NewInt(gwei + 3), FeeCap: big.NewInt(120 * gwei)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.fees.bump(test.percent); !sameFees(got, test.want) {
+				t.Errorf("bump(%d) = %+v, want %+v", test.percent, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFeesExceedsAndMax(t *testing.T) {
+	tests := []struct {
+		name    string
+		fees    *txFees
+		other   *txFees
+		exceeds bool
+		max     *txFees
+	}{
+		{"legacy higher", legacyFees(12), legacyFees(10), true, legacyFees(12)},
+		{"legacy equal", legacyFees(10), legacyFees(10), false, legacyFees(10)},
+		{"legacy lower", legacyFees(8), legacyFees(10), false, legacyFees(10)},
+		{"higher tip only", dynamicFees(3, 20), dynamicFees(2, 30), true, dynamicFees(3, 30)},
+		{"higher fee cap only", dynamicFees(1, 40), dynamicFees(2, 30), true, dynamicFees(2, 40)},
+		{"both lower", dynamicFees(1, 20), dynamicFees(2, 30), false, dynamicFees(2, 30)},
+		{"zero tip", dynamicFees(0, 30), dynamicFees(0, 30), false, dynamicFees(0, 30)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.fees.exceeds(test.other); got != test.exceeds {
+				t.Errorf("exceeds = %v, want %v", got, test.exceeds)
+			}
+			if got := test.fees.max(test.other); !sameFees(got, test.max) {
+				t.Errorf("max = %+v, want %+v", got, test.max)
+			}
+		})
+	}
+
+	// Fees of different types never exceed each other
+	if legacyFees(100).exceeds(dynamicFees(1, 1)) || dynamicFees(100, 100).exceeds(legacyFees(1)) {
+		t.Error("fees of different types compared as higher")
+	}
+}
+
+// historyBackend is a fakeBackend whose fee history reports the given tips, one block each
+type historyBackend struct {
+	*fakeBackend
+	tips []*big.Int
+}
+
+func (b *historyBackend) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	history := &ethereum.FeeHistory{}
+	for _, tip := range b.tips {
+		history.Reward = append(history.Reward, []*big.Int{tip})
+	}
+	return history, nil
+}
+
+func TestSuggestFees(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseFee *big.Int
+		tips    []*big.Int
+		config  PriorityFeeConfig
+		want    *txFees
+	}{
+		{
+			name:   "legacy without a base fee",
+			config: PriorityFeeConfig{Strategy: PriorityFeeSuggested, BaseFeeFactor: 2},
+			want:   legacyFees(5),
+		},
+		{
+			name:    "suggested tip",
+			baseFee: big.NewInt(10 * gwei),
+			config:  PriorityFeeConfig{Strategy: PriorityFeeSuggested, BaseFeeFactor: 2},
+			want:    dynamicFees(1, 21),
+		},
+		{
+			name:    "fixed tip",
+			baseFee: big.NewInt(10 * gwei),
+			config:  PriorityFeeConfig{Strategy: PriorityFeeFixed, FixedTip: big.NewInt(3 * gwei), BaseFeeFactor: 3},
+			want:    dynamicFees(3, 33),
+		},
+		{
+			name:    "median of fee history",
+			baseFee: big.NewInt(10 * gwei),
+			tips:    []*big.Int{big.NewInt(9 * gwei), big.NewInt(2 * gwei), big.NewInt(4 * gwei)},
+			config:  PriorityFeeConfig{Strategy: PriorityFeeHistory, FixedTip: big.NewInt(gwei), BaseFeeFactor: 2},
+			want:    dynamicFees(4, 24),
+		},
+		{
+			name:    "empty fee history falls back to the fixed tip",
+			baseFee: big.NewInt(10 * gwei),
+			config:  PriorityFeeConfig{Strategy: PriorityFeeHistory, FixedTip: big.NewInt(2 * gwei), BaseFeeFactor: 2},
+			want:    dynamicFees(2, 22),
+		},
+		{
+			name:    "zero suggested tip",
+			baseFee: big.NewInt(10 * gwei),
+			tips:    []*big.Int{big.NewInt(0)},
+			config:  PriorityFeeConfig{Strategy: PriorityFeeHistory, FixedTip: big.NewInt(gwei), BaseFeeFactor: 2},
+			want:    dynamicFees(0, 20),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := &historyBackend{fakeBackend: newFakeBackend(), tips: test.tips}
+			backend.baseFee = test.baseFee
+
+			got, err := suggestFees(context.Background(), backend, &test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameFees(got, test.want) {
+				t.Errorf("suggestFees = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"rebnb/contracts"
+	"rebnb/db"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Listing statuses derived from Marketplace state
+const (
+	ListingStatusUnlisted  = "unlisted"
+	ListingStatusListed    = "listed"
+	ListingStatusRented    = "rented"
+	ListingStatusBooked    = "booked"
+	ListingStatusCompleted = "completed"
+	ListingStatusInactive  = "inactive"
+)
+
+const (
+	// splitBatchSize is how many listingSplits indexes are probed per batch round
+	splitBatchSize = 8
+	// maxListingSplits bounds the split chain walk for a single date
+	maxListingSplits = 64
+)
+
+// ListingSplit represents one hop of a listing's rent split chain
+type ListingSplit struct {
+	Receiver string `json:"receiver"`
+	Amount   string `json:"amount"`
+}
+
+// ListingChainState represents the Marketplace contract's view of a listing
+type ListingChainState struct {
+	Status          string         `json:"status"`
+	Creator         string         `json:"creator,omitempty"`
+	RentPrice       string         `json:"rent_price"`
+	RentSecurity    string         `json:"rent_security"`
+	BookingPrice    string         `json:"booking_price"`
+	BookingSecurity string         `json:"booking_security"`
+	Active          bool           `json:"active"`
+	Booked          bool           `json:"booked"`
+	BookingReceiver string         `json:"booking_receiver,omitempty"`
+	Booker          string         `json:"booker,omitempty"`
+	Completed       bool           `json:"completed"`
+	Holder          string         `json:"holder,omitempty"`
+	Splits          []ListingSplit `json:"splits"`
+	FetchedAt       time.Time      `json:"fetched_at"`
+}
+
+// ListingView represents a stored listing merged with its on-chain state
+type ListingView struct {
+	db.Listing
+	OnChain    *ListingChainState `json:"onchain,omitempty"`
+	StateError string             `json:"state_error,omitempty"`
+}
+
+// ListingStateCache holds recently fetched on-chain listing state keyed by property and date. A nil
+// cache holds nothing, so every read goes to the chain.
+type ListingStateCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*ListingChainState
+}
+
+// NewListingStateCache returns an empty cache whose entries stay fresh for ttl
+func NewListingStateCache(ttl time.Duration) *ListingStateCache {
+	return &ListingStateCache{
+		ttl:     ttl,
+		entries: make(map[string]*ListingChainState),
+	}
+}
+
+// NewListingStateCacheFromEnv returns a cache with the TTL from LISTING_STATE_TTL, 15s by default
+func NewListingStateCacheFromEnv() *ListingStateCache {
+	ttl := 15 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("LISTING_STATE_TTL")); err == nil && d >= 0 {
+		ttl = d
+	}
+	return NewListingStateCache(ttl)
+}
+
+// TTL returns how long cached state stays fresh
+func (c *ListingStateCache) TTL() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.ttl
+}
+
+func listingStateKey(propertyId, date string) string {
+	return propertyId + "/" + date
+}
+
+// get returns a cached state if it is still fresh
+func (c *ListingStateCache) get(propertyId, date string) *ListingChainState {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok := c.entries[listingStateKey(propertyId, date)]
+	if !ok || time.Since(state.FetchedAt) > c.ttl {
+		return nil
+	}
+	return state
+}
+
+// put stores a state and drops expired entries
+func (c *ListingStateCache) put(propertyId, date string, state *ListingChainState) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.entries {
+		if time.Since(entry.FetchedAt) > c.ttl {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[listingStateKey(propertyId, date)] = state
+}
+
+// listingFetch tracks the batched calls for one listing date
+type listingFetch struct {
+	view      *ListingView
+	date      *big.Int
+	listing   *contractCall
+	booked    *contractCall
+	completed *contractCall
+	active    *contractCall
+	holder    *contractCall
+	splits    []*contractCall
+}
+
+// mergeListingStates attaches on-chain state to each stored listing, serving fresh entries from
+// the cache and fetching the rest with batched eth_calls
+func (s *Server) mergeListingStates(ctx context.Context, propertyIdStr string, listings []db.Listing) []ListingView {
+	views := make([]ListingView, len(listings))
+	cache := s.ListingStates
+
+	var missing []*ListingView
+	for i := range listings {
+		views[i].Listing = listings[i]
+		if state := cache.get(propertyIdStr, listings[i].Date); state != nil {
+			views[i].OnChain = state
+			continue
+		}
+		missing = append(missing, &views[i])
+	}
+
+	if len(missing) == 0 {
+		return views
+	}
+
+	if err := s.fetchListingStates(ctx, propertyIdStr, missing); err != nil {
+		log.Printf("⚠️ Failed to read on-chain listing state for property %s: %v", propertyIdStr, err)
+		for _, view := range missing {
+			if view.StateError == "" {
+				view.StateError = err.Error()
+			}
+		}
+		return views
+	}
+
+	for _, view := range missing {
+		if view.OnChain != nil {
+			cache.put(propertyIdStr, view.Date, view.OnChain)
+		}
+	}
+
+	return views
+}
+
+// fetchListingStates reads listings, listingBooked, listingCompleted, isListingActive, the
+// date-token holder and the split chain for each view
+func (s *Server) fetchListingStates(ctx context.Context, propertyIdStr string, views []*ListingView) error {
+	propertyId, ok := new(big.Int).SetString(propertyIdStr, 10)
+	if !ok {
+		return fmt.Errorf("invalid property ID '%s'", propertyIdStr)
+	}
+
+	_, client, err := s.getChainClient(ctx, "0g")
+	if err != nil {
+		return err
+	}
+
+	marketplaceAddress, err := s.GetContract("marketplace")
+	if err != nil {
+		return err
+	}
+	propertyAddress, err := s.GetContract("property")
+	if err != nil {
+		return err
+	}
+	if !common.IsHexAddress(marketplaceAddress) || !common.IsHexAddress(propertyAddress) {
+		return fmt.Errorf("marketplace and property contract addresses are not configured")
+	}
+	marketplace := common.HexToAddress(marketplaceAddress)
+
+	marketplaceABI, err := contracts.LoadMarketplaceABI()
+	if err != nil {
+		return err
+	}
+	propertyABI, err := contracts.LoadPropertyABI()
+	if err != nil {
+		return err
+	}
+
+	dateToken, err := callAddress(ctx, client, propertyABI, common.HexToAddress(propertyAddress), "date_token", propertyId)
+	if err != nil {
+		return fmt.Errorf("failed to get date token: %v", err)
+	}
+
+	newCall := func(contractABI *abi.ABI, to common.Address, method string, args ...interface{}) *contractCall {
+		return &contractCall{ABI: contractABI, To: to, Method: method, Args: args}
+	}
+
+	var fetches []*listingFetch
+	var calls []*contractCall
+	for _, view := range views {
+		date, ok := new(big.Int).SetString(view.Date, 10)
+		if !ok {
+			view.StateError = "invalid date"
+			continue
+		}
+
+		fetch := &listingFetch{
+			view:      view,
+			date:      date,
+			listing:   newCall(marketplaceABI, marketplace, "listings", propertyId, date),
+			booked:    newCall(marketplaceABI, marketplace, "listingBooked", propertyId, date),
+			completed: newCall(marketplaceABI, marketplace, "listingCompleted", propertyId, date),
+			active:    newCall(marketplaceABI, marketplace, "isListingActive", propertyId, date),
+		}
+		calls = append(calls, fetch.listing, fetch.booked, fetch.completed, fetch.active)
+
+		if dateToken != (common.Address{}) {
+			fetch.holder = newCall(propertyABI, dateToken, "ownerOf", date)
+			calls = append(calls, fetch.holder)
+		}
+
+		fetches = append(fetches, fetch)
+	}
+
+	// The split array length isn't exposed, so probe indexes in rounds until one reverts. The first
+	// round carries the state calls too; later rounds only cover dates whose probed splits all existed.
+	pending := fetches
+	for round := 0; len(pending) > 0; round++ {
+		batch := calls
+		for _, fetch := range pending {
+			for i := 0; i < splitBatchSize; i++ {
+				index := big.NewInt(int64(round*splitBatchSize + i))
+				call := newCall(marketplaceABI, marketplace, "listingSplits", propertyId, fetch.date, index)
+				fetch.splits = append(fetch.splits, call)
+				batch = append(batch, call)
+			}
+		}
+
+		if err := batchCallContracts(ctx, client, batch); err != nil {
+			return err
+		}
+		calls = nil
+
+		var next []*listingFetch
+		for _, fetch := range pending {
+			if fetch.splits[len(fetch.splits)-1].Err == nil && len(fetch.splits) < maxListingSplits {
+				next = append(next, fetch)
+			}
+		}
+		pending = next
+	}
+
+	now := time.Now()
+	for _, fetch := range fetches {
+		state, err := fetch.state(now)
+		if err != nil {
+			fetch.view.StateError = err.Error()
+			continue
+		}
+		fetch.view.OnChain = state
+	}
+
+	return nil
+}
+
+// state assembles the listing's on-chain view from its completed calls
+func (f *listingFetch) state(now time.Time) (*ListingChainState, error) {
+	for _, call := range []*contractCall{f.listing, f.booked, f.completed, f.active} {
+		if call.Err != nil {
+			return nil, fmt.Errorf("%s call failed: %v", call.Method, call.Err)
+		}
+	}
+
+	listing, err := listingFromValues(f.listing.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &ListingChainState{
+		RentPrice:       listing.RentPrice.String(),
+		RentSecurity:    listing.RentSecurity.String(),
+		BookingPrice:    listing.BookingPrice.String(),
+		BookingSecurity: listing.BookingSecurity.String(),
+		Splits:          []ListingSplit{},
+		FetchedAt:       now,
+	}
+
+	if listing.Creator == (common.Address{}) {
+		state.Status = ListingStatusUnlisted
+		return state, nil
+	}
+	state.Creator = listing.Creator.Hex()
+
+	if len(f.booked.Result) == 3 {
+		receiver, _ := f.booked.Result[0].(common.Address)
+		booker, _ := f.booked.Result[1].(common.Address)
+		state.Booked, _ = f.booked.Result[2].(bool)
+		if state.Booked {
+			state.BookingReceiver = receiver.Hex()
+			state.Booker = booker.Hex()
+		}
+	}
+	if len(f.completed.Result) == 1 {
+		state.Completed, _ = f.completed.Result[0].(bool)
+	}
+	if len(f.active.Result) == 1 {
+		state.Active, _ = f.active.Result[0].(bool)
+	}
+
+	if f.holder != nil {
+		if f.holder.Err == nil && len(f.holder.Result) == 1 {
+			if holder, ok := f.holder.Result[0].(common.Address); ok {
+				state.Holder = holder.Hex()
+			}
+		} else if f.holder.Err != nil && !isRevert(f.holder.Err) {
+			return nil, fmt.Errorf("ownerOf call failed: %v", f.holder.Err)
+		}
+	}
+
+	for _, call := range f.splits {
+		if call.Err != nil {
+			if !isRevert(call.Err) {
+				return nil, fmt.Errorf("listingSplits call failed: %v", call.Err)
+			}
+			break
+		}
+		if len(call.Result) != 2 {
+			break
+		}
+		receiver, _ := call.Result[0].(common.Address)
+		amount, _ := call.Result[1].(*big.Int)
+		split := ListingSplit{Receiver: receiver.Hex(), Amount: "0"}
+		if amount != nil {
+			split.Amount = amount.String()
+		}
+		state.Splits = append(state.Splits, split)
+	}
+
+	switch {
+	case state.Completed:
+		state.Status = ListingStatusCompleted
+	case state.Booked:
+		state.Status = ListingStatusBooked
+	case state.Active && len(state.Splits) > 0:
+		state.Status = ListingStatusRented
+	case state.Active:
+		state.Status = ListingStatusListed
+	default:
+		state.Status = ListingStatusInactive
+	}
+
+	return state, nil
+}
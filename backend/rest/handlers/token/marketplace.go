@@ -0,0 +1,300 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"rebnb/contracts"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gin-gonic/gin"
+)
+
+// MarketplaceActionRequest represents the request payload for book, unlock and cancel transactions
+type MarketplaceActionRequest struct {
+	PropertyId string `json:"propertyId" binding:"required"`
+	Date       string `json:"date" binding:"required"`
+}
+
+// RentListingRequest represents the request payload for a rentListing transaction.
+// The prices are the renter's terms for re-listing the date.
+type RentListingRequest struct {
+	PropertyId      string `json:"propertyId" binding:"required"`
+	Date            string `json:"date" binding:"required"`
+	RentPrice       string `json:"rentPrice" binding:"required"`
+	RentSecurity    string `json:"rentSecurity" binding:"required"`
+	BookingPrice    string `json:"bookingPrice" binding:"required"`
+	BookingSecurity string `json:"bookingSecurity" binding:"required"`
+}
+
+// UpdateListingParams mirrors the Marketplace.UpdateListingParams tuple
+type UpdateListingParams struct {
+	RentPrice       *big.Int
+	RentSecurity    *big.Int
+	BookingPrice    *big.Int
+	BookingSecurity *big.Int
+}
+
+// OnChainListing represents a listing as stored by the Marketplace contract
+type OnChainListing struct {
+	Creator         common.Address
+	PropertyID      *big.Int
+	Date            *big.Int
+	RentPrice       *big.Int
+	RentSecurity    *big.Int
+	BookingPrice    *big.Int
+	BookingSecurity *big.Int
+}
+
+// MarketplaceTxnResponse represents the response for the marketplace transaction endpoints
+type MarketplaceTxnResponse struct {
+	Success     bool        `json:"success"`
+	Function    string      `json:"function"`
+	PropertyId  string      `json:"property_id"`
+	Date        string      `json:"date"`
+	Transaction TxnResponse `json:"transaction"`
+}
+
+// BookListing builds the bookListing transaction, paying the booking security
+func BookListing(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		server.handleMarketplaceAction(c, "bookListing", func(listing *OnChainListing) (*big.Int, error) {
+			if listing.BookingPrice.Sign() == 0 {
+				return nil, fmt.Errorf("booking is not available for this listing")
+			}
+			return listing.BookingSecurity, nil
+		})
+	}
+}
+
+// UnlockRoom builds the unlockRoom transaction, paying the booking price
+func UnlockRoom(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		server.handleMarketplaceAction(c, "unlockRoom", func(listing *OnChainListing) (*big.Int, error) {
+			return listing.BookingPrice, nil
+		})
+	}
+}
+
+// CancelBooking builds the cancelBooking transaction, which carries no value
+func CancelBooking(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		server.handleMarketplaceAction(c, "cancelBooking", func(listing *OnChainListing) (*big.Int, error) {
+			return new(big.Int), nil
+		})
+	}
+}
+
+// RentListing builds the rentListing transaction, paying the rent security
+func RentListing(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request RentListingRequest
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request payload: " + err.Error(),
+			})
+			return
+		}
+
+		propertyId, date, ok := parseListingKey(c, request.PropertyId, request.Date)
+		if !ok {
+			return
+		}
+
+		var params UpdateListingParams
+		fields := []struct {
+			name  string
+			value string
+			dest  **big.Int
+		}{
+			{"rentPrice", request.RentPrice, &params.RentPrice},
+			{"rentSecurity", request.RentSecurity, &params.RentSecurity},
+			{"bookingPrice", request.BookingPrice, &params.BookingPrice},
+			{"bookingSecurity", request.BookingSecurity, &params.BookingSecurity},
+		}
+		for _, field := range fields {
+			value, ok := new(big.Int).SetString(field.value, 10)
+			if !ok || value.Sign() < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid " + field.name + ": must be a valid number",
+				})
+				return
+			}
+			*field.dest = value
+		}
+
+		server.buildMarketplaceTxn(c, "rentListing", request.PropertyId, request.Date, propertyId, date,
+			func(listing *OnChainListing) (*big.Int, error) {
+				return listing.RentSecurity, nil
+			}, params)
+	}
+}
+
+// handleMarketplaceAction binds a propertyId/date request and builds the transaction for method
+func (s *Server) handleMarketplaceAction(c *gin.Context, method string, value func(*OnChainListing) (*big.Int, error)) {
+	var request MarketplaceActionRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request payload: " + err.Error(),
+		})
+		return
+	}
+
+	propertyId, date, ok := parseListingKey(c, request.PropertyId, request.Date)
+	if !ok {
+		return
+	}
+
+	s.buildMarketplaceTxn(c, method, request.PropertyId, request.Date, propertyId, date, value)
+}
+
+// parseListingKey parses the propertyId and date, writing a 400 response when either is invalid
+func parseListingKey(c *gin.Context, propertyIdStr, dateStr string) (*big.Int, *big.Int, bool) {
+	propertyId, ok := new(big.Int).SetString(propertyIdStr, 10)
+	if !ok || propertyId.Sign() < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid propertyId: must be a valid number",
+		})
+		return nil, nil, false
+	}
+
+	date, ok := new(big.Int).SetString(dateStr, 10)
+	if !ok || date.Sign() < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid date: must be a valid day number",
+		})
+		return nil, nil, false
+	}
+
+	return propertyId, date, true
+}
+
+// buildMarketplaceTxn reads the listing from chain to price msg.value and responds with the
+// encoded transaction for method. Extra arguments follow propertyId and date in the call.
+func (s *Server) buildMarketplaceTxn(c *gin.Context, method, propertyIdStr, dateStr string, propertyId, date *big.Int, value func(*OnChainListing) (*big.Int, error), extra ...interface{}) {
+	ctx := c.Request.Context()
+
+	contractABI, err := contracts.LoadMarketplaceABI()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load contract ABI: " + err.Error(),
+		})
+		return
+	}
+
+	args := append([]interface{}{propertyId, date}, extra...)
+	data, err := contractABI.Pack(method, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to encode function call: " + err.Error(),
+		})
+		return
+	}
+
+	chain, err := s.GetChain("0g")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get chain configuration: " + err.Error(),
+		})
+		return
+	}
+
+	contract, err := s.GetContract("marketplace")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get contract: " + err.Error(),
+		})
+		return
+	}
+
+	listing, err := s.getOnChainListing(ctx, contract, propertyId, date)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": "Failed to read listing from chain: " + err.Error(),
+		})
+		return
+	}
+	if listing.Creator == (common.Address{}) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Listing not found on-chain",
+		})
+		return
+	}
+
+	amount, err := value(listing)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, MarketplaceTxnResponse{
+		Success:    true,
+		Function:   method,
+		PropertyId: propertyIdStr,
+		Date:       dateStr,
+		Transaction: TxnResponse{
+			Msg: MintTransactionData{
+				ChainId: chain.ChainID,
+				To:      contract,
+				Data:    "0x" + common.Bytes2Hex(data),
+				Value:   hexutil.EncodeBig(amount),
+			},
+		},
+	})
+}
+
+// getOnChainListing reads listings(propertyId, date) from the marketplace contract.
+// A listing that was never created comes back with a zero creator.
+func (s *Server) getOnChainListing(ctx context.Context, marketplace string, propertyId, date *big.Int) (*OnChainListing, error) {
+	if !common.IsHexAddress(marketplace) {
+		return nil, fmt.Errorf("marketplace contract address '%s' is not configured", marketplace)
+	}
+
+	_, client, err := s.getChainClient(ctx, "0g")
+	if err != nil {
+		return nil, err
+	}
+
+	contractABI, err := contracts.LoadMarketplaceABI()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := callContract(ctx, client, contractABI, common.HexToAddress(marketplace), "listings", propertyId, date)
+	if err != nil {
+		return nil, err
+	}
+
+	return listingFromValues(values)
+}
+
+// listingFromValues converts the unpacked outputs of listings(uint256,uint256)
+func listingFromValues(values []interface{}) (*OnChainListing, error) {
+	if len(values) != 7 {
+		return nil, fmt.Errorf("unexpected listings result length %d", len(values))
+	}
+
+	listing := &OnChainListing{}
+	var ok bool
+	if listing.Creator, ok = values[0].(common.Address); !ok {
+		return nil, fmt.Errorf("unexpected creator type %T", values[0])
+	}
+
+	amounts := []**big.Int{
+		&listing.PropertyID, &listing.Date, &listing.RentPrice, &listing.RentSecurity,
+		&listing.BookingPrice, &listing.BookingSecurity,
+	}
+	for i, dest := range amounts {
+		if *dest, ok = values[i+1].(*big.Int); !ok {
+			return nil, fmt.Errorf("unexpected listing field type %T", values[i+1])
+		}
+	}
+
+	return listing, nil
+}
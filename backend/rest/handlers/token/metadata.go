@@ -0,0 +1,385 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"rebnb/blobstore"
+	"rebnb/contracts"
+	"rebnb/db"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// storedMetadataTimeout bounds the fallback read of pinned metadata
+	storedMetadataTimeout = 10 * time.Second
+	// maxStoredMetadataSize bounds the pinned metadata document we are willing to read
+	maxStoredMetadataSize = 1 << 20
+)
+
+// propertyOwner is a cached ownerOf result for a property token
+type propertyOwner struct {
+	owner     string
+	fetchedAt time.Time
+}
+
+// PropertyOwnerCache holds recently read property token owners. A nil cache holds nothing.
+type PropertyOwnerCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]propertyOwner
+}
+
+// NewPropertyOwnerCache returns an empty cache whose entries stay fresh for ttl
+func NewPropertyOwnerCache(ttl time.Duration) *PropertyOwnerCache {
+	return &PropertyOwnerCache{
+		ttl:     ttl,
+		entries: make(map[string]propertyOwner),
+	}
+}
+
+// get returns a cached owner if it is still fresh
+func (c *PropertyOwnerCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.entries[key]
+	if !ok || time.Since(cached.fetchedAt) > c.ttl {
+		return "", false
+	}
+	return cached.owner, true
+}
+
+// put stores an owner and drops expired entries
+func (c *PropertyOwnerCache) put(key, owner string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, entry := range c.entries {
+		if time.Since(entry.fetchedAt) > c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = propertyOwner{owner: owner, fetchedAt: time.Now()}
+}
+
+// GetPropertyMetadata serves ERC-721 metadata for a property token, built from the stored
+// property and its current on-chain owner
+func GetPropertyMetadata(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Check if the database is available
+		if server.Properties == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
+
+		propertyID := c.Param("property_id")
+		propertyId, ok := new(big.Int).SetString(propertyID, 10)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid property ID: must be a valid number",
+			})
+			return
+		}
+
+		ctx := c.Request.Context()
+		property, err := server.Properties.GetPropertyByID(ctx, propertyID)
+		if err != nil {
+			status, message := http.StatusInternalServerError, "Failed to get property: "
+			if errors.Is(err, db.ErrNotFound) {
+				status, message = http.StatusNotFound, "Property not found: "
+			}
+			c.JSON(status, gin.H{
+				"error": message + err.Error(),
+			})
+			return
+		}
+
+		metadata := NFTMetadata{
+			Name:          property.PropertyName,
+			Description:   property.Description,
+			Image:         property.Image,
+			ImageVariants: property.ImageVariants,
+			Attributes: []Attribute{
+				{TraitType: "property_id", Value: property.PropertyID},
+				{TraitType: "property_address", Value: property.PropertyAddress},
+				{TraitType: "date_of_mint", Value: strconv.FormatInt(property.CreatedAt.Unix(), 10), DisplayType: "date"},
+			},
+		}
+
+		// Older properties may predate the fields we store, fall back to the pinned document
+		if metadata.Name == "" {
+			var stored NFTMetadata
+			if err := server.readStoredMetadata(ctx, property.IPFSHash, &stored); err != nil {
+				log.Printf("⚠️ Failed to read stored metadata for property %s: %v", propertyID, err)
+			} else {
+				metadata = stored
+			}
+		}
+
+		owner, err := server.getPropertyOwner(ctx, propertyId)
+		if err != nil {
+			log.Printf("⚠️ Failed to read owner of property %s: %v", propertyID, err)
+		} else if owner != "" {
+			metadata.Attributes = setAttribute(metadata.Attributes, Attribute{TraitType: "owner", Value: owner})
+		}
+
+		serveMetadata(c, metadata, server.ListingStates.TTL())
+	}
+}
+
+// GetListingMetadata serves ERC-721 metadata for a date token, built from the stored listing,
+// its property and the Marketplace's current state for the date
+func GetListingMetadata(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Check if the database is available
+		if server.Properties == nil || server.Listings == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
+
+		propertyID := c.Param("property_id")
+		date := c.Param("date")
+		day, err := strconv.ParseInt(date, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid date: must be a day number",
+			})
+			return
+		}
+
+		ctx := c.Request.Context()
+		listing, err := server.Listings.GetListingByPropertyAndDate(ctx, propertyID, date)
+		if err != nil {
+			status, message := http.StatusInternalServerError, "Failed to get listing: "
+			if errors.Is(err, db.ErrNotFound) {
+				status, message = http.StatusNotFound, "Listing not found: "
+			}
+			c.JSON(status, gin.H{
+				"error": message + err.Error(),
+			})
+			return
+		}
+
+		property, err := server.Properties.GetPropertyByID(ctx, propertyID)
+		if err != nil {
+			status, message := http.StatusInternalServerError, "Failed to get property: "
+			if errors.Is(err, db.ErrNotFound) {
+				status, message = http.StatusNotFound, "Property not found: "
+			}
+			c.JSON(status, gin.H{
+				"error": message + err.Error(),
+			})
+			return
+		}
+
+		dayStart := time.Unix(day*secondsPerDay, 0).UTC()
+		metadata := NFTMetadata{
+			Name:          fmt.Sprintf("%s — %s", property.PropertyName, dayStart.Format("2006-01-02")),
+			Description:   property.Description,
+			Image:         property.Image,
+			ImageVariants: property.ImageVariants,
+			Attributes: []Attribute{
+				{TraitType: "property_id", Value: propertyID},
+				{TraitType: "date", Value: strconv.FormatInt(dayStart.Unix(), 10), DisplayType: "date"},
+			},
+		}
+
+		view := server.mergeListingStates(ctx, propertyID, []db.Listing{*listing})[0]
+		if state := view.OnChain; state != nil {
+			metadata.Attributes = append(metadata.Attributes,
+				Attribute{TraitType: "status", Value: state.Status},
+				Attribute{TraitType: "rent_price", Value: state.RentPrice},
+				Attribute{TraitType: "rent_security", Value: state.RentSecurity},
+				Attribute{TraitType: "booking_price", Value: state.BookingPrice},
+				Attribute{TraitType: "booking_security", Value: state.BookingSecurity},
+			)
+			if state.Holder != "" {
+				metadata.Attributes = append(metadata.Attributes, Attribute{TraitType: "holder", Value: state.Holder})
+			}
+			if state.Booker != "" {
+				metadata.Attributes = append(metadata.Attributes, Attribute{TraitType: "booker", Value: state.Booker})
+			}
+		} else {
+			// Without chain state, report the prices the listing was created with
+			var stored ListingData
+			if err := server.readStoredMetadata(ctx, listing.IPFSHash, &stored); err != nil {
+				log.Printf("⚠️ Failed to read stored metadata for listing %s/%s: %v", propertyID, date, err)
+			} else {
+				metadata.Attributes = append(metadata.Attributes,
+					Attribute{TraitType: "rent_price", Value: stored.RentPrice},
+					Attribute{TraitType: "rent_security", Value: stored.RentSecurity},
+					Attribute{TraitType: "booking_price", Value: stored.BookingPrice},
+					Attribute{TraitType: "booking_security", Value: stored.BookingSecurity},
+				)
+				if metadata.Image == "" {
+					metadata.Image = stored.Image
+				}
+			}
+		}
+
+		serveMetadata(c, metadata, server.ListingStates.TTL())
+	}
+}
+
+// serveMetadata writes metadata as JSON with an ETag over the body, answering 304 when the client's copy is current
+func serveMetadata(c *gin.Context, metadata NFTMetadata, maxAge time.Duration) {
+	body, err := json.Marshal(metadata)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to encode metadata: " + err.Error(),
+		})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	// Live attributes change with chain state, so only cache for as long as we cache that state
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// etagMatches reports whether an If-None-Match header lists the given ETag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// setAttribute replaces the attribute with the same trait type, or appends it
+func setAttribute(attributes []Attribute, attribute Attribute) []Attribute {
+	for i := range attributes {
+		if attributes[i].TraitType == attribute.TraitType {
+			attributes[i] = attribute
+			return attributes
+		}
+	}
+	return append(attributes, attribute)
+}
+
+// getPropertyOwner returns the current owner of a property token, or "" if it isn't minted.
+// Results are cached in PropertyOwners.
+func (s *Server) getPropertyOwner(ctx context.Context, propertyId *big.Int) (string, error) {
+	key := propertyId.String()
+	if owner, ok := s.PropertyOwners.get(key); ok {
+		return owner, nil
+	}
+
+	_, client, err := s.getChainClient(ctx, "0g")
+	if err != nil {
+		return "", err
+	}
+
+	propertyAddress, err := s.GetContract("property")
+	if err != nil {
+		return "", err
+	}
+	if !common.IsHexAddress(propertyAddress) {
+		return "", fmt.Errorf("property contract address '%s' is not configured", propertyAddress)
+	}
+
+	propertyABI, err := contracts.LoadPropertyABI()
+	if err != nil {
+		return "", err
+	}
+
+	owner := ""
+	address, err := callAddress(ctx, client, propertyABI, common.HexToAddress(propertyAddress), "ownerOf", propertyId)
+	if err == nil {
+		owner = address.Hex()
+	} else if !isRevert(err) {
+		return "", fmt.Errorf("failed to get property owner: %v", err)
+	}
+
+	s.PropertyOwners.put(key, owner)
+
+	return owner, nil
+}
+
+// readStoredMetadata decodes the metadata document pinned under key
+func (s *Server) readStoredMetadata(ctx context.Context, key string, v interface{}) error {
+	if s.MetadataStore == nil {
+		return fmt.Errorf("metadata store not configured")
+	}
+	if key == "" {
+		return fmt.Errorf("no stored metadata")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, storedMetadataTimeout)
+	defer cancel()
+
+	// Content-addressed documents are checked against their CID rather than trusted from a gateway
+	backend := s.MetadataStore.Backend()
+	if s.Gateways != nil && (backend == blobstore.BackendPinata || backend == blobstore.BackendKubo) {
+		var buf bytes.Buffer
+		if _, err := s.Gateways.FetchVerified(ctx, key, &limitedWriter{w: &buf, n: maxStoredMetadataSize}); err != nil {
+			return fmt.Errorf("failed to fetch verified metadata: %w", err)
+		}
+		if err := json.Unmarshal(buf.Bytes(), v); err != nil {
+			return fmt.Errorf("failed to decode stored metadata: %v", err)
+		}
+		return nil
+	}
+
+	content, _, err := s.MetadataStore.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	if err := json.NewDecoder(io.LimitReader(content, maxStoredMetadataSize)).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode stored metadata: %v", err)
+	}
+
+	return nil
+}
+
+// limitedWriter fails once more than n bytes are written
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, fmt.Errorf("stored metadata exceeds %d bytes", maxStoredMetadataSize)
+	}
+	l.n -= int64(len(p))
+	return l.w.Write(p)
+}
@@ -0,0 +1,298 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"rebnb/contracts"
+	"rebnb/db"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gin-gonic/gin"
+)
+
+// Receipt wait limits for GetReceiptRequest
+const (
+	defaultReceiptTimeout = 30 * time.Second
+	maxReceiptTimeout     = 2 * time.Minute
+)
+
+// DecodedEvent represents a Marketplace or TokenizedProperty log decoded with the contract ABI
+type DecodedEvent struct {
+	Contract string                 `json:"contract"` // marketplace, property, date_token or unknown
+	Address  string                 `json:"address"`
+	Event    string                 `json:"event"`
+	LogIndex uint                   `json:"log_index"`
+	Args     map[string]interface{} `json:"args"`
+}
+
+// GetReceipt returns the receipt of a transaction along with its decoded contract events.
+// When wait is set the request blocks until the transaction is mined or the timeout passes.
+func GetReceipt(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request GetReceiptRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, GetReceiptResponse{
+				Error: "Invalid request payload: " + err.Error(),
+			})
+			return
+		}
+
+		txHash, err := hexutil.Decode(request.TransactionHash)
+		if err != nil || len(txHash) != common.HashLength {
+			c.JSON(http.StatusBadRequest, GetReceiptResponse{
+				Error: "Invalid transaction hash format",
+			})
+			return
+		}
+
+		if request.ChainName == "" {
+			request.ChainName = "0g"
+		}
+
+		ctx := c.Request.Context()
+		_, client, err := server.getChainClient(ctx, request.ChainName)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, db.ErrNotFound) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, GetReceiptResponse{
+				Error: err.Error(),
+			})
+			return
+		}
+
+		var receipt *types.Receipt
+		if request.Wait {
+			timeout := defaultReceiptTimeout
+			if request.TimeoutSeconds > 0 {
+				timeout = time.Duration(request.TimeoutSeconds) * time.Second
+			}
+			if timeout > maxReceiptTimeout {
+				timeout = maxReceiptTimeout
+			}
+
+			waitCtx, cancel := context.WithTimeout(ctx, timeout)
+			receipt, err = waitForReceipt(waitCtx, client, common.BytesToHash(txHash))
+			cancel()
+		} else {
+			receipt, err = client.TransactionReceipt(ctx, common.BytesToHash(txHash))
+		}
+
+		if err == ethereum.NotFound || err == context.DeadlineExceeded {
+			c.JSON(http.StatusAccepted, GetReceiptResponse{
+				Pending: true,
+				Error:   "Transaction is not mined yet",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, GetReceiptResponse{
+				Error: "Failed to get receipt: " + err.Error(),
+			})
+			return
+		}
+
+		events, err := server.decodeReceiptLogs(ctx, client, receipt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, GetReceiptResponse{
+				Error: "Failed to decode logs: " + err.Error(),
+			})
+			return
+		}
+
+		response := GetReceiptResponse{
+			Receipt: &TransactionReceipt{
+				TransactionHash:  receipt.TxHash.Hex(),
+				BlockNumber:      receipt.BlockNumber.Uint64(),
+				BlockHash:        receipt.BlockHash.Hex(),
+				GasUsed:          receipt.GasUsed,
+				Status:           receipt.Status,
+				TransactionIndex: receipt.TransactionIndex,
+			},
+			Events: events,
+		}
+		if receipt.ContractAddress != (common.Address{}) {
+			response.Receipt.ContractAddress = receipt.ContractAddress.Hex()
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// waitForReceipt polls for a receipt once a second until it is found or the context expires
+func waitForReceipt(ctx context.Context, client *ethclient.Client, txHash common.Hash) (*types.Receipt, error) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		receipt, err := client.TransactionReceipt(ctx, txHash)
+		if err == nil {
+			return receipt, nil
+		}
+		if err != ethereum.NotFound && ctx.Err() == nil {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, context.DeadlineExceeded
+		case <-ticker.C:
+		}
+	}
+}
+
+// dateTokenABI holds the TokenizedPropertyDate getter naming the property a date token belongs to
+const dateTokenABI = `[{"type":"function","name":"property_id","inputs":[],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"}]`
+
+// decodeReceiptLogs decodes every log in a receipt emitted by the Marketplace, the property
+// token or one of its date tokens. Date tokens are recognised by asking the property token for the
+// date token of the property they claim to belong to. Other logs that decode with the ERC-721
+// events of the property ABI are labelled unknown, logs that don't are skipped.
+func (s *Server) decodeReceiptLogs(ctx context.Context, client *ethclient.Client, receipt *types.Receipt) ([]DecodedEvent, error) {
+	marketplaceABI, err := contracts.LoadMarketplaceABI()
+	if err != nil {
+		return nil, err
+	}
+	propertyABI, err := contracts.LoadPropertyABI()
+	if err != nil {
+		return nil, err
+	}
+
+	// Contract addresses may not be configured, in which case they simply never match
+	marketplaceAddress, _ := s.GetContract("marketplace")
+	propertyAddress, _ := s.GetContract("property")
+
+	// Whether each other address is a date token, resolved once per receipt
+	dateTokens := make(map[common.Address]bool)
+
+	events := []DecodedEvent{}
+	for _, vLog := range receipt.Logs {
+		var contract string
+		var contractABI *abi.ABI
+
+		switch {
+		case strings.EqualFold(vLog.Address.Hex(), marketplaceAddress):
+			contract, contractABI = "marketplace", marketplaceABI
+		case strings.EqualFold(vLog.Address.Hex(), propertyAddress):
+			contract, contractABI = "property", propertyABI
+		default:
+			// Date tokens are deployed per property and share the ERC-721 events of the property ABI,
+			// they're told apart from other ERC-721s once decoded
+			contract, contractABI = "unknown", propertyABI
+		}
+
+		name, args, err := decodeLog(contractABI, vLog)
+		if err != nil {
+			continue
+		}
+
+		if contract == "unknown" && common.IsHexAddress(propertyAddress) {
+			isDateToken, resolved := dateTokens[vLog.Address]
+			if !resolved {
+				isDateToken = isPropertyDateToken(ctx, client, propertyABI, common.HexToAddress(propertyAddress), vLog.Address)
+				dateTokens[vLog.Address] = isDateToken
+			}
+			if isDateToken {
+				contract = "date_token"
+			}
+		}
+
+		events = append(events, DecodedEvent{
+			Contract: contract,
+			Address:  vLog.Address.Hex(),
+			Event:    name,
+			LogIndex: vLog.Index,
+			Args:     args,
+		})
+	}
+
+	return events, nil
+}
+
+// isPropertyDateToken reports whether address is the date token the property contract deployed for
+// the property the token names. Any contract can claim a property, so the claim is checked against
+// the property contract. Failed calls count as not a date token.
+func isPropertyDateToken(ctx context.Context, client *ethclient.Client, propertyABI *abi.ABI, propertyAddress, address common.Address) bool {
+	parsed, err := abi.JSON(strings.NewReader(dateTokenABI))
+	if err != nil {
+		return false
+	}
+
+	values, err := callContract(ctx, client, &parsed, address, "property_id")
+	if err != nil {
+		return false
+	}
+	propertyId, ok := values[0].(*big.Int)
+	if !ok {
+		return false
+	}
+
+	dateToken, err := callAddress(ctx, client, propertyABI, propertyAddress, "date_token", propertyId)
+	if err != nil {
+		return false
+	}
+
+	return dateToken == address
+}
+
+// decodeLog unpacks the indexed and non-indexed arguments of a log into readable values
+func decodeLog(contractABI *abi.ABI, vLog *types.Log) (string, map[string]interface{}, error) {
+	if len(vLog.Topics) == 0 {
+		return "", nil, fmt.Errorf("log has no topics")
+	}
+
+	event, err := contractABI.EventByID(vLog.Topics[0])
+	if err != nil {
+		return "", nil, err
+	}
+
+	args := make(map[string]interface{})
+	if err := contractABI.UnpackIntoMap(args, event.Name, vLog.Data); err != nil {
+		return "", nil, fmt.Errorf("failed to unpack data: %w", err)
+	}
+
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(args, indexed, vLog.Topics[1:]); err != nil {
+		return "", nil, fmt.Errorf("failed to parse topics: %w", err)
+	}
+
+	for key, value := range args {
+		args[key] = readableValue(value)
+	}
+
+	return event.Name, args, nil
+}
+
+// readableValue converts ABI values to JSON friendly representations
+func readableValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.String()
+	case common.Address:
+		return v.Hex()
+	case common.Hash:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	case [32]byte:
+		return hexutil.Encode(v[:])
+	default:
+		return v
+	}
+}
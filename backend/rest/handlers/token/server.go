@@ -0,0 +1,41 @@
+package token
+
+import (
+	"rebnb/blobstore"
+	"rebnb/db"
+	"rebnb/fetcher"
+	"rebnb/gateway"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Server holds what the token handlers read and write through, set up by SetupRoutes. Repositories
+// stay nil while the database is unavailable, and tests can point them at a db.MemoryStore.
+type Server struct {
+	Properties   db.PropertyRepository
+	Listings     db.ListingRepository
+	Chains       db.ChainRepository
+	Files        db.FileRepository
+	Images       db.ImageRepository
+	Settlements  db.SettlementRepository
+	Transactions db.TransactionRepository
+
+	// Blob stores used by the mint and listing flows, from IMAGE_STORE and BLOB_STORE
+	ImageStore    blobstore.BlobStore
+	MetadataStore blobstore.BlobStore
+	// Gateways retrieves IPFS content with CID verification
+	Gateways *gateway.Pool
+	// ImageFetcher downloads remote images given by URL
+	ImageFetcher *fetcher.Fetcher
+	// TxManager submits backend-signed transactions, handlers sign without it when it's nil
+	TxManager *TxManager
+	// ListingStates caches on-chain listing state between reads, nil reads the chain every time
+	ListingStates *ListingStateCache
+	// PropertyOwners caches ownerOf reads for property metadata, nil reads the chain every time
+	PropertyOwners *PropertyOwnerCache
+
+	// ethClients holds one RPC connection per endpoint so handlers don't dial on every request
+	ethClientsMu sync.Mutex
+	ethClients   map[string]*ethclient.Client
+}
@@ -0,0 +1,144 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"rebnb/db"
+)
+
+// newTestRouter serves the read-only property handlers from server
+func newTestRouter(t *testing.T, server *Server) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/properties", GetProperties(server))
+	router.GET("/properties/:property_id/calendar", GetPropertyCalendar(server))
+	router.GET("/metadata/:property_id", GetPropertyMetadata(server))
+	router.GET("/metadata/:property_id/:date", GetListingMetadata(server))
+
+	httpServer := httptest.NewServer(router)
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+// getJSON fetches url and decodes its JSON body into v, returning the status
+func getJSON(t *testing.T, url string, v interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("failed to decode %s: %v", url, err)
+	}
+	return resp.StatusCode
+}
+
+func TestHandlersReadMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	if err := store.InsertProperty(ctx, &db.Property{PropertyID: "7", PropertyName: "Cabin"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, date := range []string{"20000", "20002"} {
+		if err := store.InsertListing(ctx, &db.Listing{PropertyID: "7", Date: date, IPFSHash: "bafy-" + date}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// No chain is stored, so on-chain state is reported as unavailable without dialing anything
+	server := newTestRouter(t, &Server{Properties: store, Listings: store, Chains: store})
+
+	var properties []db.Property
+	if status := getJSON(t, server.URL+"/properties", &properties); status != http.StatusOK {
+		t.Fatalf("GET /properties: status %d", status)
+	}
+	if len(properties) != 1 || properties[0].PropertyName != "Cabin" {
+		t.Errorf("GET /properties returned %+v", properties)
+	}
+
+	var calendar CalendarResponse
+	if status := getJSON(t, server.URL+"/properties/7/calendar?from=20000&to=20002", &calendar); status != http.StatusOK {
+		t.Fatalf("GET calendar: status %d", status)
+	}
+	if len(calendar.Days) != 3 {
+		t.Fatalf("calendar has %d days, want 3", len(calendar.Days))
+	}
+	for i, want := range []string{ListingStatusListed, ListingStatusUnlisted, ListingStatusListed} {
+		day := calendar.Days[i]
+		if day.Status != want {
+			t.Errorf("day %s has status %q, want %q", day.Date, day.Status, want)
+		}
+		if want == ListingStatusListed && (day.IPFSHash != "bafy-"+day.Date || day.StateError == "") {
+			t.Errorf("listed day %s = %+v, want its metadata and a state error", day.Date, day)
+		}
+	}
+}
+
+func TestHandlersWithoutDatabase(t *testing.T) {
+	server := newTestRouter(t, &Server{})
+
+	var body map[string]string
+	if status := getJSON(t, server.URL+"/properties", &body); status != http.StatusServiceUnavailable {
+		t.Errorf("GET /properties without repositories: status %d", status)
+	}
+	if status := getJSON(t, server.URL+"/properties/7/calendar", &body); status != http.StatusServiceUnavailable {
+		t.Errorf("GET calendar without repositories: status %d", status)
+	}
+}
+
+// failingStore is a MemoryStore whose property and listing lookups fail with err
+type failingStore struct {
+	*db.MemoryStore
+	err error
+}
+
+func (s *failingStore) GetPropertyByID(ctx context.Context, propertyID string) (*db.Property, error) {
+	return nil, s.err
+}
+
+func (s *failingStore) GetListingByPropertyAndDate(ctx context.Context, propertyID, date string) (*db.Listing, error) {
+	return nil, s.err
+}
+
+func TestMetadataLookupErrors(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	if err := store.InsertListing(ctx, &db.Listing{PropertyID: "7", Date: "20000"}); err != nil {
+		t.Fatal(err)
+	}
+	failing := &failingStore{MemoryStore: db.NewMemoryStore(), err: errors.New("connection reset")}
+
+	tests := []struct {
+		name  string
+		store interface {
+			db.PropertyRepository
+			db.ListingRepository
+		}
+		path   string
+		status int
+	}{
+		{"missing property", store, "/metadata/8", http.StatusNotFound},
+		{"missing listing", store, "/metadata/8/20000", http.StatusNotFound},
+		{"listing without its property", store, "/metadata/7/20000", http.StatusNotFound},
+		{"failed property lookup", failing, "/metadata/7", http.StatusInternalServerError},
+		{"failed listing lookup", failing, "/metadata/7/20000", http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestRouter(t, &Server{Properties: test.store, Listings: test.store})
+			var body map[string]string
+			if status := getJSON(t, server.URL+test.path, &body); status != test.status {
+				t.Errorf("GET %s: status %d, want %d: %v", test.path, status, test.status, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"rebnb/blobstore"
+	"rebnb/db"
+	"rebnb/imaging"
+	"strings"
+	"time"
+)
+
+// putJSON marshals v and stores it in the metadata store. Content stored before is not stored again.
+func (s *Server) putJSON(ctx context.Context, name string, v interface{}) (*blobstore.BlobInfo, error) {
+	if s.MetadataStore == nil {
+		return nil, fmt.Errorf("metadata store not configured")
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if s.Files != nil {
+		existing, err := s.Files.GetFileByContentHash(ctx, s.MetadataStore.Backend(), hash)
+		if err != nil {
+			log.Printf("⚠️  Failed to look up metadata %s: %v", hash, err)
+		} else if existing != nil {
+			return &blobstore.BlobInfo{
+				Key:         existing.Hash,
+				Name:        existing.Name,
+				Size:        existing.Size,
+				ContentType: existing.ContentType,
+				URL:         existing.URL,
+				Backend:     existing.Backend,
+				SHA256:      hash,
+			}, nil
+		}
+	}
+
+	info, err := s.MetadataStore.Put(ctx, name, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	info.SHA256 = hash
+
+	return info, nil
+}
+
+// imageDeletionWait bounds how long an upload waits for the garbage collector to finish deleting
+// the same content, and imageDeletionPoll is how often it checks
+const (
+	imageDeletionWait = 30 * time.Second
+	imageDeletionPoll = 250 * time.Millisecond
+)
+
+// putImage stores an image in the image store under its SHA-256 and returns the URL to reference it by.
+// Content that was stored before is not stored again, the existing URL is returned instead.
+// Either way the image is cataloged for the uploader.
+func (s *Server) putImage(ctx context.Context, ext string, r io.Reader, contentType, uploader string) (string, error) {
+	if s.ImageStore == nil {
+		return "", fmt.Errorf("image store not configured")
+	}
+
+	// Spool to disk while hashing, the hash has to be known before deciding whether to store
+	tmp, err := os.CreateTemp("", "rebnb-image-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %v", err)
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	// The garbage collector may be deleting this very content, in which case it is stored again
+	// once the deletion is finished rather than reusing a blob that's about to disappear
+	deadline := time.Now().Add(imageDeletionWait)
+	for {
+		imageURL, err := s.storeImage(ctx, tmp, hash, size, ext, contentType, uploader)
+		if !errors.Is(err, db.ErrImageDeleting) {
+			return imageURL, err
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("image %s is being deleted, try again later", hash)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(imageDeletionPoll):
+		}
+	}
+}
+
+// storeImage reuses or stores the spooled image with the given hash. It returns ErrImageDeleting
+// while the garbage collector holds the hash.
+func (s *Server) storeImage(ctx context.Context, tmp *os.File, hash string, size int64, ext, contentType, uploader string) (string, error) {
+	if s.Images != nil {
+		existing, err := s.Images.TouchImage(ctx, hash, s.ImageStore.Backend())
+		if errors.Is(err, db.ErrImageDeleting) {
+			return "", err
+		}
+		if err != nil {
+			log.Printf("⚠️  Failed to look up image %s: %v", hash, err)
+		} else if existing != nil {
+			s.catalogBlob(ctx, &blobstore.BlobInfo{
+				Key:         existing.Key,
+				Name:        existing.Key,
+				Size:        existing.Size,
+				ContentType: existing.ContentType,
+				URL:         existing.URL,
+				Backend:     existing.Backend,
+				SHA256:      hash,
+			}, db.FileSourceImage, uploader, "")
+			return existing.URL, nil
+		}
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to rewind image: %v", err)
+	}
+	info, err := s.ImageStore.Put(ctx, hash+imageExt(ext), tmp)
+	if err != nil {
+		return "", err
+	}
+	if info.ContentType == "" {
+		info.ContentType = contentType
+	}
+	info.SHA256 = hash
+
+	if s.Images != nil {
+		err := s.Images.SaveImage(ctx, &db.Image{
+			Hash:        hash,
+			Backend:     info.Backend,
+			Key:         info.Key,
+			URL:         info.URL,
+			Size:        size,
+			ContentType: info.ContentType,
+		})
+		if errors.Is(err, db.ErrImageDeleting) {
+			return "", err
+		}
+		if err != nil {
+			log.Printf("⚠️  Failed to index image %s: %v", hash, err)
+		}
+	}
+	s.catalogBlob(ctx, info, db.FileSourceImage, uploader, "")
+
+	return info.URL, nil
+}
+
+// putImageVariants validates and processes an image, then stores each of its sizes with putImage
+func (s *Server) putImageVariants(ctx context.Context, r io.Reader, declaredType, uploader string) (*db.ImageVariants, error) {
+	result, err := imaging.Process(r, declaredType)
+	if err != nil {
+		return nil, err
+	}
+
+	variants := &db.ImageVariants{}
+	for _, variant := range result.Variants {
+		imageURL, err := s.putImage(ctx, variant.Ext, bytes.NewReader(variant.Data), variant.ContentType, uploader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store %s image: %w", variant.Name, err)
+		}
+
+		switch variant.Name {
+		case imaging.Thumbnail:
+			variants.Thumbnail = imageURL
+		case imaging.Card:
+			variants.Card = imageURL
+		case imaging.Full:
+			variants.Full = imageURL
+		}
+	}
+
+	return variants, nil
+}
+
+// imageExt normalizes a file extension for an image key, dropping anything unusual
+func imageExt(ext string) string {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	if ext == "" || len(ext) > 5 {
+		return ""
+	}
+	for _, r := range ext {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			return ""
+		}
+	}
+	return "." + ext
+}
+
+// imageGCBatch bounds how many images one collection pass removes
+const imageGCBatch = 100
+
+// CollectImages deletes images no property references, once they have gone unused for grace.
+// The grace period covers images uploaded ahead of the mint that will reference them.
+func (s *Server) CollectImages(ctx context.Context, grace time.Duration) (int, error) {
+	if s.ImageStore == nil || s.Images == nil || s.Files == nil {
+		return 0, nil
+	}
+
+	before := time.Now().Add(-grace)
+	images, err := s.Images.ListUnreferencedImages(ctx, before, imageGCBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, image := range images {
+		// Images indexed on another backend belong to an earlier configuration
+		if image.Backend != s.ImageStore.Backend() {
+			continue
+		}
+
+		// Tombstone the index entry first, so a concurrent upload either reuses the image before
+		// the claim, or waits for the deletion to finish and stores the content again
+		claimed, err := s.Images.ClaimUnreferencedImage(ctx, image.Hash, image.Backend, before)
+		if err != nil {
+			return removed, err
+		}
+		if !claimed {
+			continue
+		}
+
+		if err := s.ImageStore.Delete(ctx, image.Key); err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+			log.Printf("⚠️  Failed to delete image %s: %v", image.Key, err)
+			if err := s.Images.ReleaseImageClaim(ctx, image.Hash, image.Backend); err != nil {
+				log.Printf("⚠️  Failed to release image %s: %v", image.Key, err)
+			}
+			continue
+		}
+		if err := s.Files.DeleteFilesByURL(ctx, image.URL); err != nil {
+			log.Printf("⚠️  Failed to uncatalog image %s: %v", image.Key, err)
+		}
+		if err := s.Images.DeleteImage(ctx, image.Hash, image.Backend); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// RunImageGC collects unreferenced images every interval until ctx is done
+func (s *Server) RunImageGC(ctx context.Context, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.CollectImages(ctx, grace)
+			if err != nil {
+				log.Printf("⚠️  Image garbage collection failed: %v", err)
+			} else if removed > 0 {
+				log.Printf("🧹 Removed %d unreferenced images", removed)
+			}
+		}
+	}
+}
+
+// catalogBlob records a stored blob in the file catalog. The blob is already stored,
+// so failures are only logged.
+func (s *Server) catalogBlob(ctx context.Context, info *blobstore.BlobInfo, source, uploader, propertyID string) {
+	if s.Files == nil {
+		return
+	}
+
+	if err := s.Files.SaveFile(ctx, &db.StoredFile{
+		Hash:           info.Key,
+		Backend:        info.Backend,
+		Name:           info.Name,
+		Size:           info.Size,
+		ContentType:    info.ContentType,
+		URL:            info.URL,
+		Source:         source,
+		UploaderWallet: uploader,
+		PropertyID:     propertyID,
+		ContentHash:    info.SHA256,
+	}); err != nil {
+		log.Printf("⚠️  Failed to catalog %s: %v", info.Key, err)
+	}
+}
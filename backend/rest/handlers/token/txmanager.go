@@ -0,0 +1,590 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"rebnb/db"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TxManagerConfig holds transaction manager configuration
+type TxManagerConfig struct {
+	// Chain is the name of the chain, as stored in MongoDB, transactions are submitted to
+	Chain string
+	// Required makes startup fail when the manager can't be started, instead of running without it
+	Required     bool
+	PollInterval time.Duration
+	StuckAfter   time.Duration
+	BumpPercent  int64
+	ReceiptWait  time.Duration
+	PriorityFee  *PriorityFeeConfig
+}
+
+// NewTxManagerConfigFromEnv creates a new transaction manager config from environment variables
+func NewTxManagerConfigFromEnv() *TxManagerConfig {
+	config := &TxManagerConfig{
+		Chain:        "0g",
+		Required:     os.Getenv("TX_MANAGER_REQUIRED") == "true",
+		PollInterval: 5 * time.Second,
+		StuckAfter:   2 * time.Minute,
+		BumpPercent:  20,
+		ReceiptWait:  5 * time.Second,
+		PriorityFee:  NewPriorityFeeConfigFromEnv(),
+	}
+
+	if chain := os.Getenv("TX_CHAIN"); chain != "" {
+		config.Chain = chain
+	}
+	if d, err := time.ParseDuration(os.Getenv("TX_POLL_INTERVAL")); err == nil && d > 0 {
+		config.PollInterval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("TX_STUCK_AFTER")); err == nil && d > 0 {
+		config.StuckAfter = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("TX_RECEIPT_WAIT")); err == nil && d >= 0 {
+		config.ReceiptWait = d
+	}
+	// Nodes reject replacements that raise the fee by less than 10%
+	if p, err := strconv.ParseInt(os.Getenv("TX_FEE_BUMP_PERCENT"), 10, 64); err == nil && p >= 10 {
+		config.BumpPercent = p
+	}
+
+	return config
+}
+
+// signer holds a private key and the next nonce it will use
+type signer struct {
+	mu        sync.Mutex
+	key       *ecdsa.PrivateKey
+	nonce     uint64
+	nonceSet  bool
+	isDefault bool
+}
+
+// txBackend is the chain access the transaction manager needs; an *ethclient.Client is one
+type txBackend interface {
+	feeSource
+	ethereum.GasEstimator
+	ethereum.TransactionSender
+	ethereum.ContractCaller
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	Close()
+}
+
+// TxManager submits transactions for a chain, hands out nonces in order per signer,
+// tracks every submission in MongoDB and replaces transactions that get stuck
+type TxManager struct {
+	config  *TxManagerConfig
+	chain   string
+	chainID *big.Int
+	client  txBackend
+
+	chains       db.ChainRepository
+	transactions db.TransactionRepository
+
+	mu      sync.RWMutex
+	signers map[common.Address]*signer
+	txType  string
+}
+
+// NewTxManager creates a transaction manager for a chain stored in the server's chain repository,
+// the configured chain when chainName is empty. Submissions are tracked in its transaction repository.
+func NewTxManager(ctx context.Context, server *Server, chainName string, config *TxManagerConfig) (*TxManager, error) {
+	if config == nil {
+		config = NewTxManagerConfigFromEnv()
+	}
+	if chainName == "" {
+		chainName = config.Chain
+	}
+	if server.Transactions == nil {
+		return nil, fmt.Errorf("database is not available")
+	}
+
+	chain, err := server.GetChain(chainName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain: %w", err)
+	}
+
+	chainID, ok := new(big.Int).SetString(chain.ChainID, 0)
+	if !ok {
+		return nil, fmt.Errorf("invalid chain ID format: %s", chain.ChainID)
+	}
+
+	client, err := ethclient.DialContext(ctx, chain.RPC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to blockchain: %v", err)
+	}
+
+	return &TxManager{
+		config:       config,
+		chain:        chainName,
+		chainID:      chainID,
+		client:       client,
+		chains:       server.Chains,
+		transactions: server.Transactions,
+		signers:      make(map[common.Address]*signer),
+		txType:       chain.TxType,
+	}, nil
+}
+
+// Close closes the manager's RPC connection
+func (m *TxManager) Close() {
+	m.client.Close()
+}
+
+// AddSigner registers a private key with the manager and returns its address.
+// The first signer added becomes the default signer.
+func (m *TxManager) AddSigner(privateKeyHex string) (common.Address, error) {
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	address := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.signers[address]; !exists {
+		m.signers[address] = &signer{key: privateKey, isDefault: len(m.signers) == 0}
+	}
+
+	return address, nil
+}
+
+// DefaultSigner returns the address of the first registered signer
+func (m *TxManager) DefaultSigner() (common.Address, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for address, s := range m.signers {
+		if s.isDefault {
+			return address, nil
+		}
+	}
+
+	return common.Address{}, fmt.Errorf("no signer registered")
+}
+
+// getSigner looks up a registered signer
+func (m *TxManager) getSigner(address common.Address) (*signer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.signers[address]
+	if !ok {
+		return nil, fmt.Errorf("no signer registered for %s", address.Hex())
+	}
+	return s, nil
+}
+
+// Send builds, signs and broadcasts a transaction from a registered signer and records it in MongoDB
+func (m *TxManager) Send(ctx context.Context, from common.Address, to common.Address, data []byte) (*db.Transaction, error) {
+	return m.SendValue(ctx, from, to, data, nil)
+}
+
+// SendValue is Send for payable calls, transferring value wei along with the call
+func (m *TxManager) SendValue(ctx context.Context, from common.Address, to common.Address, data []byte, value *big.Int) (*db.Transaction, error) {
+	if value == nil {
+		value = big.NewInt(0)
+	}
+
+	s, err := m.getSigner(from)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hold the signer lock until the transaction is accepted so nonces are used in order
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.nonceSet {
+		nonce, err := m.client.PendingNonceAt(ctx, from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get nonce: %v", err)
+		}
+		s.nonce = nonce
+		s.nonceSet = true
+	}
+
+	fees, err := suggestFees(ctx, m.client, m.config.PriorityFee)
+	if err != nil {
+		return nil, err
+	}
+	m.recordTxType(ctx, fees.TxType())
+
+	gasLimit, err := m.client.EstimateGas(ctx, ethereum.CallMsg{
+		From:  from,
+		To:    &to,
+		Data:  data,
+		Value: value,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate gas: %v", err)
+	}
+
+	signedTx, err := broadcastTransaction(ctx, m.client, s.key, s.nonce, to, data, value, gasLimit, fees, m.chainID)
+	if err != nil {
+		// Our view of the nonce may be stale, fetch it again on the next send
+		if isNonceError(err) {
+			s.nonceSet = false
+		}
+		return nil, err
+	}
+	s.nonce++
+
+	record := &db.Transaction{
+		Hash:        signedTx.Hash().Hex(),
+		Chain:       m.chain,
+		From:        from.Hex(),
+		To:          to.Hex(),
+		Nonce:       signedTx.Nonce(),
+		Data:        "0x" + common.Bytes2Hex(data),
+		Value:       signedTx.Value().String(),
+		GasLimit:    signedTx.Gas(),
+		Attempt:     1,
+		Status:      db.TxStatusPending,
+		SubmittedAt: time.Now(),
+	}
+	setRecordFees(record, fees)
+
+	if err := m.transactions.InsertTransaction(ctx, record); err != nil {
+		// The transaction is already on its way, keep going without tracking
+		log.Printf("⚠️  Failed to record transaction %s: %v", record.Hash, err)
+	}
+
+	return record, nil
+}
+
+// WaitForReceipt polls until the transaction is mined or the context expires.
+// It returns the latest known state of the transaction either way.
+func (m *TxManager) WaitForReceipt(ctx context.Context, tx *db.Transaction) *db.Transaction {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := m.checkReceipt(ctx, tx); err != nil {
+			log.Printf("⚠️  Failed to check receipt for %s: %v", tx.Hash, err)
+		}
+		if tx.Status != db.TxStatusPending {
+			return tx
+		}
+
+		select {
+		case <-ctx.Done():
+			return tx
+		case <-ticker.C:
+		}
+	}
+}
+
+// CallContract runs a read-only call against the manager's chain
+func (m *TxManager) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return m.client.CallContract(ctx, msg, blockNumber)
+}
+
+// Transact sends a call from the default signer and waits for it to be mined successfully
+func (m *TxManager) Transact(ctx context.Context, to common.Address, data []byte, value *big.Int) (common.Hash, error) {
+	from, err := m.DefaultSigner()
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	tx, err := m.SendValue(ctx, from, to, data, value)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	tx = m.WaitForReceipt(ctx, tx)
+	switch tx.Status {
+	case db.TxStatusMined:
+		return common.HexToHash(tx.Hash), nil
+	case db.TxStatusPending:
+		return common.HexToHash(tx.Hash), fmt.Errorf("transaction %s not mined yet: %v", tx.Hash, ctx.Err())
+	default:
+		return common.HexToHash(tx.Hash), fmt.Errorf("transaction %s %s", tx.Hash, tx.Status)
+	}
+}
+
+// Run polls pending transactions for receipts and replaces stuck ones until the context is cancelled
+func (m *TxManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.poll(ctx); err != nil {
+				log.Printf("⚠️  Transaction manager: %v", err)
+			}
+		}
+	}
+}
+
+// poll checks every pending transaction once
+func (m *TxManager) poll(ctx context.Context) error {
+	pending, err := m.transactions.GetPendingTransactions(ctx, m.chain)
+	if err != nil {
+		return err
+	}
+
+	// Nonces that were mined during this poll, keyed by sender and nonce
+	settled := make(map[string]bool)
+
+	for i := range pending {
+		tx := &pending[i]
+		key := fmt.Sprintf("%s/%d", tx.From, tx.Nonce)
+		if settled[key] {
+			continue
+		}
+
+		if err := m.checkReceipt(ctx, tx); err != nil {
+			log.Printf("⚠️  Failed to check receipt for %s: %v", tx.Hash, err)
+			continue
+		}
+		if tx.Status != db.TxStatusPending {
+			settled[key] = true
+			continue
+		}
+
+		// Only the latest attempt for a nonce is eligible for replacement
+		if tx.ReplacedBy == "" && time.Since(tx.SubmittedAt) > m.config.StuckAfter {
+			if err := m.replace(ctx, tx); err != nil {
+				log.Printf("⚠️  Failed to replace stuck transaction %s: %v", tx.Hash, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkReceipt fetches the receipt of a transaction and settles its nonce once mined
+func (m *TxManager) checkReceipt(ctx context.Context, tx *db.Transaction) error {
+	receipt, err := m.client.TransactionReceipt(ctx, common.HexToHash(tx.Hash))
+	if errors.Is(err, ethereum.NotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tx.Receipt = &db.TxReceipt{
+		BlockNumber:      receipt.BlockNumber.Uint64(),
+		BlockHash:        receipt.BlockHash.Hex(),
+		GasUsed:          receipt.GasUsed,
+		Status:           receipt.Status,
+		TransactionIndex: receipt.TransactionIndex,
+	}
+	if receipt.ContractAddress != (common.Address{}) {
+		tx.Receipt.ContractAddress = receipt.ContractAddress.Hex()
+	}
+
+	tx.Status = db.TxStatusMined
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		tx.Status = db.TxStatusFailed
+	}
+
+	if err := m.transactions.UpdateTransaction(ctx, tx.Hash, &db.TransactionUpdate{
+		Status:  &tx.Status,
+		Receipt: tx.Receipt,
+	}); err != nil {
+		return err
+	}
+
+	// Any other attempt with the same nonce can no longer be mined
+	return m.transactions.SettleNonce(ctx, tx.Chain, tx.From, tx.Nonce, tx.Hash)
+}
+
+// replace resends a stuck transaction with the same nonce and a higher gas price
+func (m *TxManager) replace(ctx context.Context, tx *db.Transaction) error {
+	s, err := m.getSigner(common.HexToAddress(tx.From))
+	if err != nil {
+		return err
+	}
+
+	current, err := recordFees(tx)
+	if err != nil {
+		return err
+	}
+	bumped := current.bump(m.config.BumpPercent)
+
+	// Follow the market if it moved more than our bump
+	if suggested, err := suggestFees(ctx, m.client, m.config.PriorityFee); err == nil && suggested.exceeds(bumped) {
+		bumped = suggested.max(bumped)
+	}
+
+	to := common.HexToAddress(tx.To)
+	data := common.FromHex(tx.Data)
+	value, ok := new(big.Int).SetString(tx.Value, 10)
+	if !ok {
+		value = big.NewInt(0)
+	}
+
+	// Hold the signer lock like Send does, so a replacement never races a new transaction for the signer
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	signedTx, err := broadcastTransaction(ctx, m.client, s.key, tx.Nonce, to, data, value, tx.GasLimit, bumped, m.chainID)
+	if err != nil {
+		return err
+	}
+
+	replacement := *tx
+	replacement.ID = primitive.NilObjectID
+	replacement.Hash = signedTx.Hash().Hex()
+	setRecordFees(&replacement, bumped)
+	replacement.Attempt = tx.Attempt + 1
+	replacement.SubmittedAt = time.Now()
+
+	if err := m.transactions.InsertTransaction(ctx, &replacement); err != nil {
+		return err
+	}
+
+	log.Printf("🔁 Replaced stuck transaction %s with %s (nonce %d)", tx.Hash, replacement.Hash, tx.Nonce)
+
+	return m.transactions.UpdateTransaction(ctx, tx.Hash, &db.TransactionUpdate{
+		ReplacedBy: &replacement.Hash,
+	})
+}
+
+// recordTxType stores the transaction type used on the chain whenever it changes
+func (m *TxManager) recordTxType(ctx context.Context, txType string) {
+	m.mu.Lock()
+	changed := m.txType != txType
+	m.txType = txType
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	log.Printf("🔍 Chain %s uses %s transactions", m.chain, txType)
+	if m.chains == nil {
+		return
+	}
+	if err := m.chains.UpdateChainTxType(ctx, m.chain, txType); err != nil {
+		log.Printf("⚠️  Failed to record tx type for chain %s: %v", m.chain, err)
+	}
+}
+
+// setRecordFees copies fee fields onto a transaction record
+func setRecordFees(record *db.Transaction, fees *txFees) {
+	record.TxType = fees.TxType()
+	record.GasPrice, record.GasTipCap, record.GasFeeCap = "", "", ""
+
+	if fees.Dynamic {
+		record.GasTipCap = fees.TipCap.String()
+		record.GasFeeCap = fees.FeeCap.String()
+	} else {
+		record.GasPrice = fees.GasPrice.String()
+	}
+}
+
+// recordFees reads the fee fields back from a transaction record
+func recordFees(record *db.Transaction) (*txFees, error) {
+	parse := func(name, value string) (*big.Int, error) {
+		v, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %q", name, value)
+		}
+		return v, nil
+	}
+
+	if record.TxType == db.TxTypeDynamicFee {
+		tip, err := parse("gas tip cap", record.GasTipCap)
+		if err != nil {
+			return nil, err
+		}
+		feeCap, err := parse("gas fee cap", record.GasFeeCap)
+		if err != nil {
+			return nil, err
+		}
+		return &txFees{Dynamic: true, TipCap: tip, FeeCap: feeCap}, nil
+	}
+
+	gasPrice, err := parse("gas price", record.GasPrice)
+	if err != nil {
+		return nil, err
+	}
+	return &txFees{GasPrice: gasPrice}, nil
+}
+
+// bumpFee raises a fee by the given percentage, and by at least minFeeBump
+func bumpFee(fee *big.Int, percent int64) *big.Int {
+	bumped := new(big.Int).Mul(fee, big.NewInt(100+percent))
+	bumped.Div(bumped, big.NewInt(100))
+
+	if least := new(big.Int).Add(fee, minFeeBump); bumped.Cmp(least) < 0 {
+		return least
+	}
+	return bumped
+}
+
+// isNonceError reports whether a send error was caused by a stale nonce
+func isNonceError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "nonce too low") || strings.Contains(msg, "nonce too high") ||
+		strings.Contains(msg, "already known") || strings.Contains(msg, "replacement transaction underpriced")
+}
+
+// toTransactionReceipt converts a stored receipt to the API representation
+func toTransactionReceipt(tx *db.Transaction) *TransactionReceipt {
+	if tx.Receipt == nil {
+		return nil
+	}
+
+	return &TransactionReceipt{
+		TransactionHash:  tx.Hash,
+		BlockNumber:      tx.Receipt.BlockNumber,
+		BlockHash:        tx.Receipt.BlockHash,
+		GasUsed:          tx.Receipt.GasUsed,
+		Status:           tx.Receipt.Status,
+		ContractAddress:  tx.Receipt.ContractAddress,
+		TransactionIndex: tx.Receipt.TransactionIndex,
+	}
+}
+
+// GetTransactionHandler returns the tracked state of a transaction submitted by the backend
+func GetTransactionHandler(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Check if MongoDB client is initialized
+		if server.Transactions == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Database connection not available",
+			})
+			return
+		}
+
+		tx, err := server.Transactions.GetTransactionByHash(c.Request.Context(), c.Param("tx_hash"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Transaction not found: " + err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"transaction": tx,
+			"receipt":     toTransactionReceipt(tx),
+		})
+	}
+}
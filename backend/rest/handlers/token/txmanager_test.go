@@ -0,0 +1,434 @@
+package token
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"rebnb/db"
+)
+
+// fakeBackend is a chain that accepts every transaction unless sendErr says otherwise
+type fakeBackend struct {
+	mu           sync.Mutex
+	baseFee      *big.Int // nil for a chain without London
+	gasPrice     *big.Int
+	tip          *big.Int
+	pendingNonce uint64
+	nonceReads   int
+	sendErr      func(tx *types.Transaction) error
+	sent         []*types.Transaction
+	receipts     map[common.Hash]*types.Receipt
+	receiptReads map[common.Hash]int
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		baseFee:      big.NewInt(10_000_000_000),
+		gasPrice:     big.NewInt(5_000_000_000),
+		tip:          big.NewInt(1_000_000_000),
+		receipts:     make(map[common.Hash]*types.Receipt),
+		receiptReads: make(map[common.Hash]int),
+	}
+}
+
+func (b *fakeBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{Number: big.NewInt(100), BaseFee: b.baseFee}, nil
+}
+
+func (b *fakeBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(b.gasPrice), nil
+}
+
+func (b *fakeBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(b.tip), nil
+}
+
+func (b *fakeBackend) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	return &ethereum.FeeHistory{}, nil
+}
+
+func (b *fakeBackend) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	return 50_000, nil
+}
+
+func (b *fakeBackend) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (b *fakeBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nonceReads++
+	return b.pendingNonce, nil
+}
+
+func (b *fakeBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sendErr != nil {
+		if err := b.sendErr(tx); err != nil {
+			return err
+		}
+	}
+	b.sent = append(b.sent, tx)
+	return nil
+}
+
+func (b *fakeBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.receiptReads[txHash]++
+	if receipt, ok := b.receipts[txHash]; ok {
+		return receipt, nil
+	}
+	// Wrapped like an RPC layer might, so only errors.Is recognizes it
+	return nil, fmt.Errorf("eth_getTransactionReceipt: %w", ethereum.NotFound)
+}
+
+func (b *fakeBackend) Close() {}
+
+// mine gives a sent transaction a successful receipt
+func (b *fakeBackend) mine(hash string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.receipts[common.HexToHash(hash)] = &types.Receipt{
+		Status:      types.ReceiptStatusSuccessful,
+		BlockNumber: big.NewInt(101),
+		GasUsed:     21_000,
+	}
+}
+
+// fakeTransactions is a MemoryStore whose transactions can be made to look older than they are
+type fakeTransactions struct {
+	*db.MemoryStore
+	mu   sync.Mutex
+	aged map[string]time.Duration
+}
+
+func newFakeTransactions() *fakeTransactions {
+	return &fakeTransactions{MemoryStore: db.NewMemoryStore(), aged: make(map[string]time.Duration)}
+}
+
+func (f *fakeTransactions) GetTransactionByHash(ctx context.Context, hash string) (*db.Transaction, error) {
+	tx, err := f.MemoryStore.GetTransactionByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	f.applyAge(tx)
+	return tx, nil
+}
+
+func (f *fakeTransactions) GetPendingTransactions(ctx context.Context, chain string) ([]db.Transaction, error) {
+	txs, err := f.MemoryStore.GetPendingTransactions(ctx, chain)
+	for i := range txs {
+		f.applyAge(&txs[i])
+	}
+	return txs, err
+}
+
+func (f *fakeTransactions) applyAge(tx *db.Transaction) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tx.SubmittedAt = tx.SubmittedAt.Add(-f.aged[tx.Hash])
+}
+
+// byHash returns the stored transaction with a hash
+func (f *fakeTransactions) byHash(t *testing.T, hash string) *db.Transaction {
+	tx, err := f.GetTransactionByHash(context.Background(), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// age moves a stored transaction's submission back in time
+func (f *fakeTransactions) age(hash string, by time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aged[hash] += by
+}
+
+// newTestTxManager returns a manager with one signer sending through backend
+func newTestTxManager(t *testing.T, backend *fakeBackend) (*TxManager, *fakeTransactions, common.Address) {
+	transactions := newFakeTransactions()
+	m := &TxManager{
+		config: &TxManagerConfig{
+			StuckAfter:  time.Minute,
+			BumpPercent: 20,
+			PriorityFee: &PriorityFeeConfig{Strategy: PriorityFeeSuggested, FixedTip: big.NewInt(1), BaseFeeFactor: 2},
+		},
+		chain:        "test",
+		chainID:      big.NewInt(1337),
+		client:       backend,
+		transactions: transactions,
+		signers:      make(map[common.Address]*signer),
+	}
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := m.AddSigner(hex.EncodeToString(crypto.FromECDSA(key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m, transactions, from
+}
+
+var testRecipient = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+func TestTxManagerAssignsNoncesInOrder(t *testing.T) {
+	backend := newFakeBackend()
+	backend.pendingNonce = 5
+	m, _, from := newTestTxManager(t, backend)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Send(context.Background(), from, testRecipient, nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if backend.nonceReads != 1 {
+		t.Errorf("pending nonce read %d times, want once", backend.nonceReads)
+	}
+	// Sends are serialized by the signer lock, so nonces reach the node in order without gaps
+	for i, tx := range backend.sent {
+		if want := uint64(5 + i); tx.Nonce() != want {
+			t.Errorf("transaction %d sent with nonce %d, want %d", i, tx.Nonce(), want)
+		}
+	}
+}
+
+func TestTxManagerRefetchesNonceAfterNonceError(t *testing.T) {
+	backend := newFakeBackend()
+	backend.pendingNonce = 3
+	m, _, from := newTestTxManager(t, backend)
+	ctx := context.Background()
+
+	if _, err := m.Send(ctx, from, testRecipient, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another wallet used the key, so our next nonce is already taken
+	backend.pendingNonce = 7
+	backend.sendErr = func(tx *types.Transaction) error {
+		if tx.Nonce() < 7 {
+			return errors.New("nonce too low")
+		}
+		return nil
+	}
+	if _, err := m.Send(ctx, from, testRecipient, nil); err == nil {
+		t.Fatal("sending with a stale nonce succeeded")
+	}
+
+	tx, err := m.Send(ctx, from, testRecipient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Nonce != 7 || backend.nonceReads != 2 {
+		t.Errorf("resent with nonce %d after %d nonce reads, want nonce 7 after 2", tx.Nonce, backend.nonceReads)
+	}
+}
+
+func TestTxManagerKeepsNonceAfterOtherErrors(t *testing.T) {
+	backend := newFakeBackend()
+	m, _, from := newTestTxManager(t, backend)
+	ctx := context.Background()
+
+	backend.sendErr = func(tx *types.Transaction) error { return errors.New("insufficient funds") }
+	if _, err := m.Send(ctx, from, testRecipient, nil); err == nil {
+		t.Fatal("send succeeded")
+	}
+
+	backend.sendErr = nil
+	tx, err := m.Send(ctx, from, testRecipient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Nonce != 0 || backend.nonceReads != 1 {
+		t.Errorf("sent nonce %d after %d nonce reads, want nonce 0 after 1", tx.Nonce, backend.nonceReads)
+	}
+}
+
+func TestTxManagerReplacesStuckTransaction(t *testing.T) {
+	backend := newFakeBackend()
+	m, transactions, from := newTestTxManager(t, backend)
+	ctx := context.Background()
+
+	original, err := m.Send(ctx, from, testRecipient, []byte{0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 * 10 gwei base fee + 1 gwei tip
+	if original.GasTipCap != "1000000000" || original.GasFeeCap != "21000000000" {
+		t.Fatalf("sent with tip %s and fee cap %s", original.GasTipCap, original.GasFeeCap)
+	}
+
+	// Not stuck yet, a poll only looks for its receipt
+	if err := m.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.sent) != 1 {
+		t.Fatalf("%d transactions sent before the original got stuck", len(backend.sent))
+	}
+
+	transactions.age(original.Hash, 2*time.Minute)
+	if err := m.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.sent) != 2 {
+		t.Fatalf("%d transactions sent, want a replacement", len(backend.sent))
+	}
+
+	replacementTx := backend.sent[1]
+	if replacementTx.Nonce() != original.Nonce {
+		t.Errorf("replacement nonce %d, want %d", replacementTx.Nonce(), original.Nonce)
+	}
+	// The tip is raised by the 1 gwei minimum, the fee cap by 20%
+	if replacementTx.GasTipCap().String() != "2000000000" || replacementTx.GasFeeCap().String() != "25200000000" {
+		t.Errorf("replacement tip %s and fee cap %s", replacementTx.GasTipCap(), replacementTx.GasFeeCap())
+	}
+
+	stuck := transactions.byHash(t, original.Hash)
+	if stuck.ReplacedBy != replacementTx.Hash().Hex() {
+		t.Errorf("original replaced by %q, want %s", stuck.ReplacedBy, replacementTx.Hash().Hex())
+	}
+	replacement := transactions.byHash(t, replacementTx.Hash().Hex())
+	if replacement.Attempt != 2 || replacement.Status != db.TxStatusPending {
+		t.Errorf("replacement recorded as attempt %d %s", replacement.Attempt, replacement.Status)
+	}
+
+	// Only the latest attempt is replaced again
+	transactions.age(replacement.Hash, 2*time.Minute)
+	if err := m.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.sent) != 3 || backend.sent[2].Nonce() != original.Nonce {
+		t.Fatalf("%d transactions sent, want one more replacement", len(backend.sent))
+	}
+
+	// Once the second attempt is mined, the other attempts with its nonce are settled
+	backend.mine(replacement.Hash)
+	if err := m.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for hash, want := range map[string]string{
+		original.Hash:                db.TxStatusReplaced,
+		replacement.Hash:             db.TxStatusMined,
+		backend.sent[2].Hash().Hex(): db.TxStatusReplaced,
+	} {
+		if status := transactions.byHash(t, hash).Status; status != want {
+			t.Errorf("transaction %s is %s, want %s", hash, status, want)
+		}
+	}
+}
+
+func TestTxManagerSkipsSettledNonces(t *testing.T) {
+	backend := newFakeBackend()
+	m, transactions, from := newTestTxManager(t, backend)
+	ctx := context.Background()
+
+	original, err := m.Send(ctx, from, testRecipient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions.age(original.Hash, 2*time.Minute)
+	if err := m.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	replacement := backend.sent[1].Hash()
+
+	// The original wins the race; its replacement must not be checked or replaced again
+	backend.mine(original.Hash)
+	transactions.age(replacement.Hex(), 2*time.Minute)
+	reads := backend.receiptReads[replacement]
+	if err := m.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if backend.receiptReads[replacement] != reads {
+		t.Error("the replacement's receipt was checked after its nonce was mined")
+	}
+	if len(backend.sent) != 2 {
+		t.Errorf("%d transactions sent after the nonce was mined, want 2", len(backend.sent))
+	}
+	if status := transactions.byHash(t, replacement.Hex()).Status; status != db.TxStatusReplaced {
+		t.Errorf("replacement is %s, want %s", status, db.TxStatusReplaced)
+	}
+}
+
+func TestTxManagerReplacesUnderSignerLock(t *testing.T) {
+	backend := newFakeBackend()
+	m, transactions, from := newTestTxManager(t, backend)
+	ctx := context.Background()
+
+	original, err := m.Send(ctx, from, testRecipient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions.age(original.Hash, 2*time.Minute)
+
+	// While a send holds the signer, the replacement waits for it
+	s, err := m.getSigner(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	done := make(chan error)
+	go func() { done <- m.poll(ctx) }()
+
+	select {
+	case <-done:
+		t.Fatal("replacement went ahead while the signer was locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.mu.Unlock()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.sent) != 2 {
+		t.Errorf("%d transactions sent, want the replacement once the signer was released", len(backend.sent))
+	}
+}
+
+func TestTxManagerSendsLegacyTransactionsWithoutBaseFee(t *testing.T) {
+	backend := newFakeBackend()
+	backend.baseFee = nil
+	m, transactions, from := newTestTxManager(t, backend)
+	ctx := context.Background()
+
+	original, err := m.Send(ctx, from, testRecipient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original.TxType != db.TxTypeLegacy || original.GasPrice != "5000000000" {
+		t.Fatalf("sent %s transaction with gas price %q", original.TxType, original.GasPrice)
+	}
+
+	transactions.age(original.Hash, 2*time.Minute)
+	if err := m.poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.sent) != 2 || backend.sent[1].GasPrice().String() != "6000000000" {
+		t.Fatalf("replacement not sent at a 20%% higher gas price")
+	}
+}
@@ -0,0 +1,363 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"rebnb/blobstore"
+	"rebnb/db"
+	"rebnb/rest/handlers/auth"
+	"rebnb/resumable"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Backends uploads can be finished to
+const (
+	TargetZeroG = "0g"
+	TargetIPFS  = "ipfs"
+)
+
+// Headers carrying upload progress, named as in the tus protocol
+const (
+	HeaderUploadOffset = "Upload-Offset"
+	HeaderUploadLength = "Upload-Length"
+)
+
+// finishTimeout bounds handing a finished upload to its backend
+const finishTimeout = 30 * time.Minute
+
+// Server holds the upload store, the backends finished uploads go to and the file catalog they're
+// recorded in. Files stays nil while the database is unavailable.
+type Server struct {
+	Store   *resumable.Store
+	Targets map[string]blobstore.BlobStore
+	Files   db.FileRepository
+}
+
+// CreateRequest represents a request to start an upload
+type CreateRequest struct {
+	Name       string `json:"name" binding:"required"`
+	Size       int64  `json:"size" binding:"required"`
+	Backend    string `json:"backend"`
+	PropertyID string `json:"property_id"`
+	// SHA256 optionally declares the content's hash, checked when the upload is finished
+	SHA256 string `json:"sha256"`
+}
+
+// SessionResponse represents an upload's progress
+type SessionResponse struct {
+	UploadID  string    `json:"upload_id"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	Backend   string    `json:"backend"`
+	Complete  bool      `json:"complete"`
+	SHA256    string    `json:"sha256,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Success   bool      `json:"success"`
+}
+
+// FinishResponse represents a finished upload stored on its backend
+type FinishResponse struct {
+	UploadID    string `json:"upload_id"`
+	Hash        string `json:"hash"`
+	Backend     string `json:"backend"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	SHA256      string `json:"sha256"`
+	URL         string `json:"url"`
+	Message     string `json:"message"`
+	Success     bool   `json:"success"`
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+}
+
+// HandleCreateUpload starts a resumable upload. Its parts are sent with PATCH and it's stored on
+// the chosen backend once finished.
+func HandleCreateUpload(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_request",
+				Message: fmt.Sprintf("Invalid request body: %v", err),
+				Success: false,
+			})
+			return
+		}
+
+		if req.Backend == "" {
+			req.Backend = TargetZeroG
+		}
+		if _, ok := server.Targets[req.Backend]; !ok {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "unsupported_backend",
+				Message: fmt.Sprintf("Backend must be one of: %s", strings.Join(targetNames(server), ", ")),
+				Success: false,
+			})
+			return
+		}
+
+		wallet, _ := auth.WalletFromContext(c)
+		session, err := server.Store.Create(req.Name, req.Size, req.Backend, wallet, c.ClientIP(), req.PropertyID, req.SHA256)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.Header("Location", "/api/v1/uploads/"+session.ID)
+		c.Header(HeaderUploadOffset, "0")
+		c.Header(HeaderUploadLength, strconv.FormatInt(session.Size, 10))
+		c.JSON(http.StatusCreated, sessionResponse(session))
+	}
+}
+
+// HandleGetUpload reports how much of an upload has arrived, so a client can resume from there.
+// HEAD requests get the progress in headers only.
+func HandleGetUpload(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, ok := getSession(c, server)
+		if !ok {
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.Header(HeaderUploadOffset, strconv.FormatInt(session.Offset, 10))
+		c.Header(HeaderUploadLength, strconv.FormatInt(session.Size, 10))
+		if c.Request.Method == http.MethodHead {
+			c.Status(http.StatusOK)
+			return
+		}
+
+		c.JSON(http.StatusOK, sessionResponse(session))
+	}
+}
+
+// HandlePatchUpload appends the request body to an upload. The Upload-Offset header must match
+// the upload's current offset.
+func HandlePatchUpload(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := getSession(c, server); !ok {
+			return
+		}
+
+		offset, err := strconv.ParseInt(c.GetHeader(HeaderUploadOffset), 10, 64)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "offset_required",
+				Message: "Upload-Offset header must be a non-negative integer",
+				Success: false,
+			})
+			return
+		}
+
+		session, err := server.Store.Append(c.Param("upload_id"), offset, c.Request.Body)
+		if session != nil {
+			c.Header(HeaderUploadOffset, strconv.FormatInt(session.Offset, 10))
+			c.Header(HeaderUploadLength, strconv.FormatInt(session.Size, 10))
+		}
+		if err != nil {
+			// The bytes that did arrive are kept, the client resumes from the returned offset
+			if session != nil && !isStoreError(err) {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Error:   "part_interrupted",
+					Message: fmt.Sprintf("Part interrupted at offset %d: %v", session.Offset, err),
+					Success: false,
+				})
+				return
+			}
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, sessionResponse(session))
+	}
+}
+
+// HandleFinishUpload stores a complete upload on its backend, catalogs it and removes the upload.
+// A failed handoff can be retried.
+func HandleFinishUpload(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, ok := getSession(c, server)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+		defer cancel()
+
+		target := server.Targets[session.Backend]
+		var info *blobstore.BlobInfo
+		var putErr error
+		finished, err := server.Store.Finish(session.ID, func(session *resumable.Session, r io.Reader) error {
+			info, putErr = target.Put(ctx, session.Name, r)
+			return putErr
+		})
+		if putErr != nil {
+			c.JSON(http.StatusBadGateway, ErrorResponse{
+				Error:   "upload_failed",
+				Message: fmt.Sprintf("Failed to store upload on %s: %v", session.Backend, putErr),
+				Success: false,
+			})
+			return
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		session = finished
+
+		// Record the upload in the file catalog
+		source := db.FileSourceStorageUpload
+		if session.Backend == TargetIPFS {
+			source = db.FileSourceIPFSUpload
+		}
+		if server.Files != nil {
+			if err := server.Files.SaveFile(ctx, &db.StoredFile{
+				Hash:           info.Key,
+				Backend:        info.Backend,
+				Name:           session.Name,
+				Size:           session.Size,
+				ContentType:    session.ContentType,
+				URL:            info.URL,
+				Source:         source,
+				UploaderWallet: session.Uploader,
+				PropertyID:     session.PropertyID,
+			}); err != nil {
+				log.Printf("⚠️  Failed to catalog upload %s: %v", info.Key, err)
+			}
+		}
+
+		c.JSON(http.StatusOK, FinishResponse{
+			UploadID:    session.ID,
+			Hash:        info.Key,
+			Backend:     info.Backend,
+			Name:        session.Name,
+			Size:        session.Size,
+			ContentType: session.ContentType,
+			SHA256:      session.SHA256,
+			URL:         info.URL,
+			Message:     "Upload stored successfully",
+			Success:     true,
+		})
+	}
+}
+
+// HandleDeleteUpload abandons an upload and discards its parts
+func HandleDeleteUpload(server *Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := getSession(c, server); !ok {
+			return
+		}
+
+		if err := server.Store.Delete(c.Param("upload_id")); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// getSession loads the upload named in the path and checks it belongs to the caller.
+// Uploads started anonymously can be continued by anyone holding their ID.
+func getSession(c *gin.Context, server *Server) (*resumable.Session, bool) {
+	session, err := server.Store.Get(c.Param("upload_id"))
+	if err != nil {
+		respondError(c, err)
+		return nil, false
+	}
+
+	if session.Uploader != "" {
+		if wallet, _ := auth.WalletFromContext(c); !strings.EqualFold(wallet, session.Uploader) {
+			c.JSON(http.StatusForbidden, ErrorResponse{
+				Error:   "not_owner",
+				Message: "Upload was started by another wallet",
+				Success: false,
+			})
+			return nil, false
+		}
+	}
+
+	return session, true
+}
+
+// respondError writes the response for an upload store error
+func respondError(c *gin.Context, err error) {
+	status, code := http.StatusInternalServerError, "upload_error"
+	switch {
+	case errors.Is(err, resumable.ErrNotFound):
+		status, code = http.StatusNotFound, "upload_not_found"
+	case errors.Is(err, resumable.ErrOffsetMismatch):
+		status, code = http.StatusConflict, "offset_mismatch"
+	case errors.Is(err, resumable.ErrTooLarge):
+		status, code = http.StatusRequestEntityTooLarge, "upload_too_large"
+	case errors.Is(err, resumable.ErrIncomplete):
+		status, code = http.StatusConflict, "upload_incomplete"
+	case errors.Is(err, resumable.ErrChecksumMismatch):
+		status, code = http.StatusUnprocessableEntity, "checksum_mismatch"
+	case errors.Is(err, resumable.ErrInvalid):
+		status, code = http.StatusBadRequest, "invalid_request"
+	case errors.Is(err, resumable.ErrQuotaExceeded):
+		status, code = http.StatusTooManyRequests, "quota_exceeded"
+	}
+
+	c.JSON(status, ErrorResponse{
+		Error:   code,
+		Message: err.Error(),
+		Success: false,
+	})
+}
+
+// isStoreError reports whether err comes from the upload store itself rather than the client or a backend
+func isStoreError(err error) bool {
+	for _, known := range []error{
+		resumable.ErrNotFound, resumable.ErrOffsetMismatch, resumable.ErrTooLarge,
+		resumable.ErrIncomplete, resumable.ErrChecksumMismatch, resumable.ErrInvalid,
+		resumable.ErrQuotaExceeded,
+	} {
+		if errors.Is(err, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionResponse converts an upload's progress to its API response
+func sessionResponse(session *resumable.Session) SessionResponse {
+	return SessionResponse{
+		UploadID:  session.ID,
+		Name:      session.Name,
+		Size:      session.Size,
+		Offset:    session.Offset,
+		Backend:   session.Backend,
+		Complete:  session.Complete(),
+		SHA256:    session.SHA256,
+		ExpiresAt: session.ExpiresAt,
+		Success:   true,
+	}
+}
+
+// targetNames lists the configured backends in a stable order
+func targetNames(server *Server) []string {
+	names := make([]string, 0, len(server.Targets))
+	for name := range server.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
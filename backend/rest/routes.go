@@ -3,10 +3,19 @@ package rest
 import (
 	"context"
 	"log"
+	"os"
+	"rebnb/blobstore"
 	"rebnb/db"
+	"rebnb/fetcher"
+	"rebnb/indexer"
 	gstorage "rebnb/rest/handlers/0g-storage"
+	"rebnb/rest/handlers/auth"
 	"rebnb/rest/handlers/ipfs"
 	"rebnb/rest/handlers/token"
+	"rebnb/rest/handlers/uploads"
+	"rebnb/resumable"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,18 +30,16 @@ func SetupRoutes(privateKey string, r *gin.Engine) {
 	}
 	defer storageClient.Close()
 
-	server := &gstorage.Server{Client: storageClient}
-
-	// Initialize IPFS client
-	ipfsClient := ipfs.NewIPFSClient()
-
-	// Initialize MongoDB client
+	// Initialize MongoDB client. Handlers are given its repositories, which stay nil while it's unavailable.
+	txConfig := token.NewTxManagerConfigFromEnv()
 	client, err := db.NewClient(nil) // Uses environment variables
 	if err != nil {
 		log.Printf("⚠️  Failed to initialize MongoDB client: %v", err)
 		log.Println("MongoDB endpoints will be disabled")
-		// Set a default empty client to avoid nil pointer issues
-		db.MongoClient = db.Client{}
+		if txConfig.Required {
+			log.Fatal("❌ Transaction manager is required but needs MongoDB to track transactions")
+		}
+		log.Println("⚠️  Transaction manager disabled: MongoDB is not available")
 	} else {
 		log.Printf("🔍 MongoDB client initialized successfully")
 
@@ -72,6 +79,96 @@ func SetupRoutes(privateKey string, r *gin.Engine) {
 				log.Println("✅ Initial data seeded successfully")
 			}
 		}
+
+		// Start the chain indexer in the background
+		if os.Getenv("INDEXER_ENABLED") != "false" {
+			chainIndexer, err := indexer.New(ctx, nil, client)
+			if err != nil {
+				log.Printf("⚠️  Indexer disabled: %v", err)
+			} else {
+				go chainIndexer.Run(ctx)
+			}
+		}
+	}
+
+	// A nil *db.Client would make non-nil interfaces, so repositories are only set when connected
+	var files db.FileRepository
+	tokenServer := &token.Server{}
+	authServer := &auth.Server{Config: auth.NewConfigFromEnv()}
+	if client != nil {
+		files = client
+		tokenServer.Properties, tokenServer.Listings, tokenServer.Chains = client, client, client
+		tokenServer.Files, tokenServer.Images = client, client
+		tokenServer.Settlements, tokenServer.Transactions = client, client
+		authServer.Sessions = client
+	}
+
+	server := &gstorage.Server{Client: storageClient, Files: files}
+
+	// Initialize IPFS client
+	ipfsClient := ipfs.NewIPFSClient(files)
+	tokenServer.Gateways = ipfsClient.Gateways()
+
+	// Initialize blob stores for images and token/listing metadata
+	imageStore, err := blobstore.New(blobstore.NewConfigFromEnv("IMAGE_STORE", blobstore.BackendLocal, "uploads/images", "/api/v1/images"), storageClient)
+	if err != nil {
+		log.Fatalf("Failed to initialize image store: %v", err)
+	}
+	metadataStore, err := blobstore.New(blobstore.NewConfigFromEnv("BLOB_STORE", blobstore.BackendPinata, "uploads/blobs", "/api/v1/blobs"), storageClient)
+	if err != nil {
+		log.Fatalf("Failed to initialize metadata store: %v", err)
+	}
+	tokenServer.ImageStore = imageStore
+	tokenServer.ImageFetcher = fetcher.New(fetcher.NewConfigFromEnv())
+	tokenServer.MetadataStore = metadataStore
+	tokenServer.ListingStates = token.NewListingStateCacheFromEnv()
+	tokenServer.PropertyOwners = token.NewPropertyOwnerCache(tokenServer.ListingStates.TTL())
+	log.Printf("🔍 Blob stores: images=%s metadata=%s", imageStore.Backend(), metadataStore.Backend())
+
+	// Initialize resumable uploads, finished to 0G or IPFS. 0G uploads always go to 0G, only its gateway
+	// URL comes from the environment.
+	uploadStore, err := resumable.NewStore(resumable.NewConfigFromEnv())
+	if err != nil {
+		log.Fatalf("Failed to initialize upload store: %v", err)
+	}
+	zeroGStore, err := blobstore.New(blobstore.NewConfigFromEnv("", blobstore.BackendZeroG, "", ""), storageClient)
+	if err != nil {
+		log.Fatalf("Failed to initialize 0G upload store: %v", err)
+	}
+	uploadServer := &uploads.Server{
+		Store: uploadStore,
+		Targets: map[string]blobstore.BlobStore{
+			uploads.TargetZeroG: zeroGStore,
+			uploads.TargetIPFS:  ipfsClient.Store(),
+		},
+		Files: files,
+	}
+	go uploadStore.RunCleanup(ctx, time.Hour)
+
+	if client != nil {
+		// Delete stored images no property references
+		imageGCInterval, imageGCGrace := 6*time.Hour, 24*time.Hour
+		if d, err := time.ParseDuration(os.Getenv("IMAGE_GC_INTERVAL")); err == nil && d > 0 {
+			imageGCInterval = d
+		}
+		if d, err := time.ParseDuration(os.Getenv("IMAGE_GC_GRACE")); err == nil && d > 0 {
+			imageGCGrace = d
+		}
+		go tokenServer.RunImageGC(ctx, imageGCInterval, imageGCGrace)
+
+		// Start the transaction manager used to submit backend-signed transactions
+		startTxManager(ctx, privateKey, tokenServer, txConfig, storageClient)
+	}
+
+	// Bind sign-in messages to this site and, unless configured otherwise, the chain transactions go to
+	authConfig := authServer.Config
+	if authConfig.ChainID == "" && tokenServer.Chains != nil {
+		if chain, err := tokenServer.Chains.GetChain(ctx, txConfig.Chain); err == nil {
+			authConfig.ChainID = chain.ChainID
+		}
+	}
+	if err := authConfig.Validate(); err != nil {
+		log.Fatalf("❌ Invalid Sign-In With Ethereum configuration: %v", err)
 	}
 
 	// Initialize Gin router
@@ -81,11 +178,23 @@ func SetupRoutes(privateKey string, r *gin.Engine) {
 		SkipPaths: []string{"/swagger/*"},
 	}))
 
+	// Client IPs key anonymous upload quotas, so forwarded headers are only believed from TRUSTED_PROXIES
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("❌ Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// CORS middleware for CodeSandbox
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, HEAD, OPTIONS, PUT, PATCH, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Upload-Offset")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Location, Upload-Offset, Upload-Length")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -98,35 +207,97 @@ func SetupRoutes(privateKey string, r *gin.Engine) {
 		// 0G Storage endpoints
 		storage := v1.Group("/storage")
 		{
-			storage.POST("/upload", gstorage.HandleUploadFile(server))
+			storage.POST("/upload", auth.OptionalAuth(authServer), gstorage.HandleUploadFile(server))
 			storage.GET("/download/:root_hash", gstorage.HandleGetFile(server))
 			storage.GET("/info/:root_hash", gstorage.HandleGetFileInfo(server))
-			storage.GET("/list", gstorage.HandleListFiles(server))
-			storage.GET("/stats", gstorage.HandleStorageStats(server))
+			storage.GET("/list", auth.RequireAuth(authServer), gstorage.HandleListFiles(server))
+			storage.GET("/stats", auth.RequireAuth(authServer), gstorage.HandleStorageStats(server))
 		}
 
 		// IPFS endpoints
 		ipfsGroup := v1.Group("/ipfs")
 		{
-			ipfsGroup.POST("/upload", ipfs.HandleIPFSUpload(ipfsClient))
+			ipfsGroup.POST("/upload", auth.OptionalAuth(authServer), ipfs.HandleIPFSUpload(ipfsClient))
 			ipfsGroup.GET("/:ipfs_hash", ipfs.HandleIPFSGet(ipfsClient))
 			ipfsGroup.GET("/:ipfs_hash/info", ipfs.HandleIPFSInfo(ipfsClient))
+			ipfsGroup.POST("/:ipfs_hash/pin", auth.RequireAuth(authServer), ipfs.HandleIPFSPin(ipfsClient))
+			ipfsGroup.DELETE("/:ipfs_hash/pin", auth.RequireAuth(authServer), ipfs.HandleIPFSUnpin(ipfsClient))
 			ipfsGroup.GET("/list", ipfs.HandleIPFSList(ipfsClient))
 		}
 
+		// Resumable upload endpoints for large files
+		uploadGroup := v1.Group("/uploads")
+		{
+			uploadGroup.POST("", auth.OptionalAuth(authServer), uploads.HandleCreateUpload(uploadServer))
+			uploadGroup.GET("/:upload_id", auth.OptionalAuth(authServer), uploads.HandleGetUpload(uploadServer))
+			uploadGroup.HEAD("/:upload_id", auth.OptionalAuth(authServer), uploads.HandleGetUpload(uploadServer))
+			uploadGroup.PATCH("/:upload_id", auth.OptionalAuth(authServer), uploads.HandlePatchUpload(uploadServer))
+			uploadGroup.POST("/:upload_id/finish", auth.OptionalAuth(authServer), uploads.HandleFinishUpload(uploadServer))
+			uploadGroup.DELETE("/:upload_id", auth.OptionalAuth(authServer), uploads.HandleDeleteUpload(uploadServer))
+		}
+
 		// Legacy endpoints for backward compatibility
-		v1.POST("/upload", gstorage.HandleUploadFile(server))
+		v1.POST("/upload", auth.OptionalAuth(authServer), gstorage.HandleUploadFile(server))
 		v1.GET("/download/:root_hash", gstorage.HandleGetFile(server))
 
-		v1.POST("/create-property", token.CreateMintMessage)
-		v1.POST("/create-listing", token.CreateListing)
-		v1.GET("/properties", token.GetProperties)
-		v1.GET("/lists/:property_id", token.GetListingsByPropertyHandler)
+		// Sign-In With Ethereum endpoints
+		authGroup := v1.Group("/auth")
+		{
+			authGroup.GET("/nonce", auth.HandleNonce(authServer))
+			authGroup.POST("/verify", auth.HandleVerify(authServer))
+			authGroup.GET("/session", auth.RequireAuth(authServer), auth.HandleSession)
+			authGroup.POST("/logout", auth.RequireAuth(authServer), auth.HandleLogout(authServer))
+		}
 
-		// Image serving endpoint
+		v1.POST("/create-property", auth.RequireAuth(authServer), token.CreateMintMessage(tokenServer))
+		v1.POST("/create-listing", auth.RequireAuth(authServer), token.CreateListing(tokenServer))
+		v1.POST("/book-listing", token.BookListing(tokenServer))
+		v1.POST("/rent-listing", token.RentListing(tokenServer))
+		v1.POST("/unlock-room", token.UnlockRoom(tokenServer))
+		v1.POST("/cancel-booking", token.CancelBooking(tokenServer))
+		v1.GET("/properties", token.GetProperties(tokenServer))
+		v1.GET("/properties/:property_id/calendar", token.GetPropertyCalendar(tokenServer))
+		v1.GET("/lists/:property_id", token.GetListingsByPropertyHandler(tokenServer))
+		v1.GET("/settlements/:property_id", token.GetSettlementsHandler(tokenServer))
+		v1.GET("/transactions/:tx_hash", token.GetTransactionHandler(tokenServer))
+		v1.POST("/receipt", token.GetReceipt(tokenServer))
+
+		// Image and local blob serving endpoints
 		v1.Static("/images", "./uploads/images")
+		v1.Static("/blobs", "./uploads/blobs")
 	}
 
-	r.GET("/metadata/:property_id", token.RedirectToIPFS)
-	r.GET("/metadata/:property_id/:date", token.GetMetadataForListing)
+	r.GET("/metadata/:property_id", token.GetPropertyMetadata(tokenServer))
+	r.GET("/metadata/:property_id/:date", token.GetListingMetadata(tokenServer))
+}
+
+// startTxManager starts the transaction manager for the configured chain. Failing to start it is
+// fatal when TX_MANAGER_REQUIRED is set, and leaves handlers signing without it otherwise.
+func startTxManager(ctx context.Context, privateKey string, tokenServer *token.Server, config *token.TxManagerConfig, storageClient *gstorage.StorageClient) {
+	txManager, err := token.NewTxManager(ctx, tokenServer, "", config)
+	if err == nil {
+		if _, err = txManager.AddSigner(privateKey); err != nil {
+			txManager.Close()
+		}
+	}
+	if err != nil {
+		if config.Required {
+			log.Fatalf("❌ Failed to start transaction manager for chain %s: %v", config.Chain, err)
+		}
+		log.Printf("⚠️  Transaction manager disabled for chain %s: %v", config.Chain, err)
+		return
+	}
+
+	tokenServer.TxManager = txManager
+	go txManager.Run(ctx)
+	log.Printf("🔍 Transaction manager started for chain %s", config.Chain)
+
+	// Pay for 0G uploads through the same manager so flow submissions share its nonces
+	if os.Getenv("ZEROG_FLOW_CONTRACT") != "" {
+		if err := storageClient.EnableFlowSubmission(txManager); err != nil {
+			log.Printf("⚠️  0G flow submission disabled: %v", err)
+		} else {
+			log.Println("🌊 0G flow submission enabled")
+		}
+	}
 }
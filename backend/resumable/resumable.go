@@ -0,0 +1,576 @@
+package resumable
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for unknown, finished or expired uploads
+	ErrNotFound = errors.New("upload not found")
+	// ErrOffsetMismatch is returned when a part doesn't start where the upload left off
+	ErrOffsetMismatch = errors.New("offset does not match upload offset")
+	// ErrTooLarge is returned for uploads over the size limit and parts past the declared size
+	ErrTooLarge = errors.New("upload too large")
+	// ErrIncomplete is returned when finishing an upload that hasn't received all its bytes
+	ErrIncomplete = errors.New("upload is incomplete")
+	// ErrChecksumMismatch is returned when the received content doesn't match the declared checksum
+	ErrChecksumMismatch = errors.New("content does not match checksum")
+	// ErrInvalid is returned for uploads created with a bad name, size or checksum
+	ErrInvalid = errors.New("invalid upload")
+	// ErrQuotaExceeded is returned when an owner's active uploads would exceed their quota
+	ErrQuotaExceeded = errors.New("upload quota exceeded")
+)
+
+// File suffixes for an upload's state and content
+const (
+	stateSuffix = ".json"
+	partSuffix  = ".part"
+)
+
+// copyBufferSize is how much of a part is read before it's written and hashed
+const copyBufferSize = 256 << 10
+
+// Config holds upload store configuration
+type Config struct {
+	Dir      string
+	MaxBytes int64
+	// TTL is how long an upload may go without receiving data before it's removed
+	TTL time.Duration
+	// QuotaBytes bounds the declared size of a wallet's active uploads together, and
+	// AnonymousQuotaBytes those of uploads started anonymously from one IP address
+	QuotaBytes          int64
+	AnonymousQuotaBytes int64
+}
+
+// NewConfigFromEnv creates an upload store config from environment variables
+func NewConfigFromEnv() *Config {
+	config := &Config{
+		Dir:                 "uploads/resumable",
+		MaxBytes:            2 << 30,
+		TTL:                 24 * time.Hour,
+		QuotaBytes:          4 << 30,
+		AnonymousQuotaBytes: 512 << 20,
+	}
+
+	if dir := os.Getenv("UPLOAD_DIR"); dir != "" {
+		config.Dir = dir
+	}
+	if n, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		config.MaxBytes = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("UPLOAD_SESSION_TTL")); err == nil && d > 0 {
+		config.TTL = d
+	}
+	if n, err := strconv.ParseInt(os.Getenv("UPLOAD_QUOTA_BYTES"), 10, 64); err == nil && n > 0 {
+		config.QuotaBytes = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("UPLOAD_ANONYMOUS_QUOTA_BYTES"), 10, 64); err == nil && n > 0 {
+		config.AnonymousQuotaBytes = n
+	}
+
+	return config
+}
+
+// Session is an upload in progress
+type Session struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	Offset     int64  `json:"offset"`
+	Backend    string `json:"backend"`
+	Uploader   string `json:"uploader,omitempty"`
+	PropertyID string `json:"property_id,omitempty"`
+	// Owner is who the upload counts against for quotas: the uploader's wallet, or the client's
+	// IP address for anonymous uploads
+	Owner string `json:"owner,omitempty"`
+	// Checksum is the SHA-256 the client expects the content to have, if it declared one
+	Checksum string `json:"checksum,omitempty"`
+	// SHA256 is the hash of the received content, set once every byte has arrived
+	SHA256 string `json:"sha256,omitempty"`
+	// ContentType is sniffed from the content when the upload is finished
+	ContentType string    `json:"content_type,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Complete reports whether every byte of the upload has arrived
+func (s *Session) Complete() bool {
+	return s.Offset == s.Size
+}
+
+// state is a session as persisted, with the hash of the bytes so far so it can resume after a restart
+type state struct {
+	Session
+	HashState []byte `json:"hash_state"`
+}
+
+// Store keeps uploads on disk, each as a content file growing part by part next to a state file.
+// The content is hashed as it arrives, so finishing an upload doesn't reread it.
+type Store struct {
+	config *Config
+
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+
+	// active indexes the uploads on disk for quota checks
+	quotaMu sync.Mutex
+	active  map[string]activeUpload
+}
+
+// activeUpload is an upload counted against its owner's quota
+type activeUpload struct {
+	owner string
+	size  int64
+}
+
+// sessionLock serializes writes to one upload
+type sessionLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// NewStore opens the upload store, picking up uploads left by earlier runs
+func NewStore(config *Config) (*Store, error) {
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %v", err)
+	}
+
+	s := &Store{config: config, locks: make(map[string]*sessionLock), active: make(map[string]activeUpload)}
+
+	files, err := os.ReadDir(config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload directory: %v", err)
+	}
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), stateSuffix)
+		if !ok {
+			continue
+		}
+		if st, err := s.load(id); err == nil {
+			s.active[id] = activeUpload{owner: st.Owner, size: st.Size}
+		}
+	}
+
+	return s, nil
+}
+
+// quota returns the quota of an owner, anonymous owners are identified by IP address
+func (s *Store) quota(anonymous bool) int64 {
+	if anonymous {
+		return s.config.AnonymousQuotaBytes
+	}
+	return s.config.QuotaBytes
+}
+
+// reserve counts an upload against its owner's quota, failing if the owner's active uploads
+// leave too little room. Uploads that expired since are no longer counted.
+func (s *Store) reserve(id, owner string, size, quota int64) error {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	var used int64
+	for activeID, upload := range s.active {
+		if upload.owner != owner {
+			continue
+		}
+		if _, err := s.load(activeID); errors.Is(err, ErrNotFound) {
+			delete(s.active, activeID)
+			continue
+		}
+		used += upload.size
+	}
+	if quota > 0 && used+size > quota {
+		return fmt.Errorf("%w: %d bytes in active uploads, %d more requested, quota is %d", ErrQuotaExceeded, used, size, quota)
+	}
+
+	s.active[id] = activeUpload{owner: owner, size: size}
+	return nil
+}
+
+// Create starts an upload of size bytes. uploader is the signed-in wallet, if any, and clientIP
+// identifies anonymous uploaders for their quota.
+func (s *Store) Create(name string, size int64, backend, uploader, clientIP, propertyID, checksum string) (*Session, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: size must be positive", ErrInvalid)
+	}
+	if size > s.config.MaxBytes {
+		return nil, fmt.Errorf("%w: %d bytes exceeds %d", ErrTooLarge, size, s.config.MaxBytes)
+	}
+	checksum = strings.ToLower(checksum)
+	if checksum != "" {
+		if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("%w: checksum must be a hex SHA-256", ErrInvalid)
+		}
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate upload ID: %v", err)
+	}
+
+	hashState, err := sha256.New().(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to save hash state: %v", err)
+	}
+
+	owner := strings.ToLower(uploader)
+	if owner == "" {
+		owner = "ip:" + clientIP
+	}
+
+	now := time.Now()
+	st := &state{
+		Session: Session{
+			ID:         hex.EncodeToString(id),
+			Name:       filepath.Base(name),
+			Size:       size,
+			Backend:    backend,
+			Uploader:   uploader,
+			PropertyID: propertyID,
+			Owner:      owner,
+			Checksum:   checksum,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			ExpiresAt:  now.Add(s.config.TTL),
+		},
+		HashState: hashState,
+	}
+
+	if err := s.reserve(st.ID, owner, size, s.quota(uploader == "")); err != nil {
+		return nil, err
+	}
+
+	part, err := os.OpenFile(s.path(st.ID, partSuffix), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		s.remove(st.ID)
+		return nil, fmt.Errorf("failed to create upload file: %v", err)
+	}
+	part.Close()
+
+	if err := s.save(st); err != nil {
+		s.remove(st.ID)
+		return nil, err
+	}
+
+	return &st.Session, nil
+}
+
+// Get returns an upload's progress
+func (s *Store) Get(id string) (*Session, error) {
+	st, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	return &st.Session, nil
+}
+
+// Append writes the part read from r at offset, which must be the upload's current offset. The bytes
+// read before r fails are kept, so a dropped connection only loses what hadn't arrived yet. The
+// returned session reflects what was stored even when an error is returned.
+func (s *Store) Append(id string, offset int64, r io.Reader) (*Session, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	st, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != st.Offset {
+		return &st.Session, fmt.Errorf("%w: expected %d, got %d", ErrOffsetMismatch, st.Offset, offset)
+	}
+
+	hash := sha256.New()
+	if err := hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(st.HashState); err != nil {
+		return nil, fmt.Errorf("failed to restore hash state: %v", err)
+	}
+
+	part, err := os.OpenFile(s.path(id, partSuffix), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %v", err)
+	}
+	defer part.Close()
+
+	// Drop anything written past the saved offset by a part that failed before its state was saved
+	if err := part.Truncate(st.Offset); err != nil {
+		return nil, fmt.Errorf("failed to truncate upload file: %v", err)
+	}
+	if _, err := part.Seek(st.Offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek upload file: %v", err)
+	}
+
+	var readErr error
+	buf := make([]byte, copyBufferSize)
+	for st.Offset < st.Size {
+		chunk := buf
+		if remaining := st.Size - st.Offset; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+
+		n, err := r.Read(chunk)
+		if n > 0 {
+			// A failed write leaves the saved state untouched and the stray bytes are truncated next time
+			if _, err := part.Write(chunk[:n]); err != nil {
+				return nil, fmt.Errorf("failed to write upload file: %v", err)
+			}
+			hash.Write(chunk[:n])
+			st.Offset += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	// Bytes past the declared size are refused, the ones up to it are kept
+	if readErr == nil && st.Complete() {
+		var extra [1]byte
+		if n, _ := io.ReadFull(r, extra[:]); n > 0 {
+			readErr = fmt.Errorf("%w: part extends past the declared size of %d bytes", ErrTooLarge, st.Size)
+		}
+	}
+
+	if err := part.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync upload file: %v", err)
+	}
+
+	if st.HashState, err = hash.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+		return nil, fmt.Errorf("failed to save hash state: %v", err)
+	}
+	if st.Complete() {
+		st.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	}
+	st.UpdatedAt = time.Now()
+	st.ExpiresAt = st.UpdatedAt.Add(s.config.TTL)
+
+	if err := s.save(st); err != nil {
+		return nil, err
+	}
+
+	return &st.Session, readErr
+}
+
+// Finish hands a complete upload's content to deliver and removes the upload once deliver succeeds.
+// If deliver fails the upload is kept, so finishing can be retried.
+func (s *Store) Finish(id string, deliver func(session *Session, r io.Reader) error) (*Session, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	st, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if !st.Complete() {
+		return &st.Session, fmt.Errorf("%w: received %d of %d bytes", ErrIncomplete, st.Offset, st.Size)
+	}
+	if st.Checksum != "" && st.Checksum != st.SHA256 {
+		// Resuming can't fix content that's already wrong, so the upload is dropped
+		s.remove(id)
+		return &st.Session, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, st.Checksum, st.SHA256)
+	}
+
+	part, err := os.Open(s.path(id, partSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %v", err)
+	}
+	defer part.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(part, head)
+	st.ContentType = http.DetectContentType(head[:n])
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek upload file: %v", err)
+	}
+
+	if err := deliver(&st.Session, part); err != nil {
+		return &st.Session, err
+	}
+
+	s.remove(id)
+	return &st.Session, nil
+}
+
+// Delete abandons an upload
+func (s *Store) Delete(id string) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	if _, err := s.load(id); err != nil {
+		return err
+	}
+
+	s.remove(id)
+	return nil
+}
+
+// Cleanup removes uploads that have expired and returns how many it removed
+func (s *Store) Cleanup() (int, error) {
+	files, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read upload directory: %v", err)
+	}
+
+	removed := 0
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), stateSuffix)
+		if !ok {
+			continue
+		}
+
+		unlock := s.lock(id)
+		if _, err := s.load(id); errors.Is(err, ErrNotFound) {
+			s.remove(id)
+			removed++
+		}
+		unlock()
+	}
+
+	return removed, nil
+}
+
+// RunCleanup removes expired uploads every interval until ctx is done
+func (s *Store) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.Cleanup()
+			if err != nil {
+				log.Printf("⚠️  Upload cleanup failed: %v", err)
+			} else if removed > 0 {
+				log.Printf("🧹 Removed %d expired uploads", removed)
+			}
+		}
+	}
+}
+
+// lock takes the lock for one upload and returns the function releasing it
+func (s *Store) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &sessionLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+
+		s.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// load reads an upload's state, treating expired uploads as gone
+func (s *Store) load(id string) (*state, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.path(id, stateSuffix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read upload state: %v", err)
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("failed to decode upload state: %v", err)
+	}
+	if time.Now().After(st.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+
+	return &st, nil
+}
+
+// save writes an upload's state, replacing the previous one atomically
+func (s *Store) save(st *state) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload state: %v", err)
+	}
+
+	path := s.path(st.ID, stateSuffix)
+	tmp, err := os.CreateTemp(s.config.Dir, st.ID+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create upload state: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write upload state: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync upload state: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write upload state: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save upload state: %v", err)
+	}
+
+	return nil
+}
+
+// remove deletes an upload's files and stops counting it against its owner's quota
+func (s *Store) remove(id string) {
+	os.Remove(s.path(id, stateSuffix))
+	os.Remove(s.path(id, partSuffix))
+
+	s.quotaMu.Lock()
+	delete(s.active, id)
+	s.quotaMu.Unlock()
+}
+
+// path returns the file holding an upload's state or content
+func (s *Store) path(id, suffix string) string {
+	return filepath.Join(s.config.Dir, id+suffix)
+}
+
+// validID reports whether id has the form Create generates, so it can't escape the upload directory
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,77 @@
+package resumable
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T, dir string) *Store {
+	store, err := NewStore(&Config{
+		Dir:                 dir,
+		MaxBytes:            100,
+		TTL:                 time.Hour,
+		QuotaBytes:          250,
+		AnonymousQuotaBytes: 150,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestCreateEnforcesQuota(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir)
+
+	// Anonymous uploads share their IP's quota
+	first, err := store.Create("a.bin", 100, "0g", "", "10.0.0.1", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("b.bin", 100, "0g", "", "10.0.0.1", "", ""); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("second anonymous upload from one IP: %v", err)
+	}
+	if _, err := store.Create("b.bin", 100, "0g", "", "10.0.0.2", "", ""); err != nil {
+		t.Errorf("upload from another IP: %v", err)
+	}
+
+	// Abandoning an upload frees its share
+	if err := store.Delete(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("b.bin", 100, "0g", "", "10.0.0.1", "", ""); err != nil {
+		t.Errorf("upload after freeing the quota: %v", err)
+	}
+
+	// A wallet has its own, larger quota wherever it uploads from
+	wallet := "0xAbC0000000000000000000000000000000000001"
+	for i := 0; i < 2; i++ {
+		if _, err := store.Create("w.bin", 100, "0g", wallet, "10.0.0.1", "", ""); err != nil {
+			t.Fatalf("wallet upload %d: %v", i, err)
+		}
+	}
+	if _, err := store.Create("w.bin", 100, "0g", wallet, "10.0.0.3", "", ""); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("wallet upload over quota: %v", err)
+	}
+
+	// Uploads left by an earlier run still count
+	restarted := newTestStore(t, dir)
+	if _, err := restarted.Create("w.bin", 100, "0g", wallet, "10.0.0.3", "", ""); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("wallet upload over quota after restart: %v", err)
+	}
+}
+
+func TestExpiredUploadsFreeQuota(t *testing.T) {
+	store := newTestStore(t, t.TempDir())
+	store.config.TTL = time.Millisecond
+
+	if _, err := store.Create("a.bin", 100, "0g", "", "10.0.0.1", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := store.Create("b.bin", 100, "0g", "", "10.0.0.1", "", ""); err != nil {
+		t.Errorf("upload after the previous one expired: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package zerog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// ErrFileNotFound is returned when the storage node doesn't know a root
+	ErrFileNotFound = errors.New("file not found on 0G storage node")
+)
+
+// pollInterval is how often the client checks the node while waiting on a file
+const pollInterval = time.Second
+
+// UploadResult describes a file stored on 0G Storage
+type UploadResult struct {
+	Root   common.Hash
+	Size   int64
+	TxHash common.Hash
+}
+
+// Client uploads and downloads files through a storage node, submitting them to the flow first when configured
+type Client struct {
+	node *NodeClient
+	flow *Flow
+}
+
+// NewClient creates a storage client. flow may be nil, in which case files are uploaded
+// without a flow submission, which only a stub node accepts.
+func NewClient(node *NodeClient, flow *Flow) *Client {
+	return &Client{node: node, flow: flow}
+}
+
+// SetFlow enables flow submission for later uploads
+func (c *Client) SetFlow(flow *Flow) {
+	c.flow = flow
+}
+
+// Upload computes the file's Merkle root and stores its segments, with proofs, on the node
+func (c *Client) Upload(ctx context.Context, r io.ReaderAt, size int64) (*UploadResult, error) {
+	tree, layout, err := BuildFileTree(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build merkle tree: %w", err)
+	}
+
+	result := &UploadResult{Root: tree.Root(), Size: size}
+
+	info, err := c.node.GetFileInfo(ctx, result.Root)
+	if err != nil {
+		return nil, err
+	}
+	if info != nil && info.Finalized {
+		log.Printf("📦 File %s already stored on 0G", result.Root.Hex())
+		return result, nil
+	}
+
+	if info == nil && c.flow != nil {
+		nodes, err := layout.SubmissionNodes(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build submission: %w", err)
+		}
+
+		result.TxHash, err = c.flow.Submit(ctx, layout, nodes)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("🌊 Submitted %s to the 0G flow in %s", result.Root.Hex(), result.TxHash.Hex())
+
+		if _, err := c.waitForFile(ctx, result.Root, false); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := uint64(0); i < layout.NumSegments(); i++ {
+		segment, err := layout.ReadSegment(r, i)
+		if err != nil {
+			return nil, err
+		}
+		proof, err := tree.Proof(int(i))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.node.UploadSegment(ctx, &SegmentWithProof{
+			Root:     result.Root,
+			Data:     segment[:layout.DataLength(i)],
+			Index:    i,
+			Proof:    *proof,
+			FileSize: uint64(size),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := c.waitForFile(ctx, result.Root, true); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Download streams a file to w, checking every segment's proof against the root
+func (c *Client) Download(ctx context.Context, root common.Hash, w io.Writer) (int64, error) {
+	info, err := c.FileInfo(ctx, root)
+	if err != nil {
+		return 0, err
+	}
+
+	layout, err := NewLayout(int64(info.Tx.Size))
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	for i := uint64(0); i < layout.NumSegments(); i++ {
+		segment, err := c.node.DownloadSegmentWithProof(ctx, root, i)
+		if err != nil {
+			return written, err
+		}
+		if segment == nil {
+			return written, fmt.Errorf("segment %d of %s is not available", i, root.Hex())
+		}
+
+		dataLength := layout.DataLength(i)
+		if int64(len(segment.Data)) < dataLength {
+			return written, fmt.Errorf("segment %d is truncated", i)
+		}
+
+		padded, err := layout.PadSegment(i, segment.Data)
+		if err != nil {
+			return written, err
+		}
+		if err := segment.Proof.Validate(root, SegmentRoot(padded), i, layout.NumSegmentsPadded()); err != nil {
+			return written, fmt.Errorf("segment %d: %w", i, err)
+		}
+
+		n, err := w.Write(segment.Data[:dataLength])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// FileInfo returns the node's view of a file, or ErrFileNotFound
+func (c *Client) FileInfo(ctx context.Context, root common.Hash) (*FileInfo, error) {
+	info, err := c.node.GetFileInfo(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, ErrFileNotFound
+	}
+	return info, nil
+}
+
+// waitForFile polls until the node knows the file, or until it is finalized
+func (c *Client) waitForFile(ctx context.Context, root common.Hash, finalized bool) (*FileInfo, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		info, err := c.node.GetFileInfo(ctx, root)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil && (!finalized || info.Finalized) {
+			return info, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for %s on the storage node: %v", root.Hex(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package zerog
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Flow and market contract ABI, limited to what submission needs
+const flowABI = `[
+	{"inputs":[{"components":[{"internalType":"uint256","name":"length","type":"uint256"},{"internalType":"bytes","name":"tags","type":"bytes"},{"components":[{"internalType":"bytes32","name":"root","type":"bytes32"},{"internalType":"uint256","name":"height","type":"uint256"}],"internalType":"struct SubmissionNode[]","name":"nodes","type":"tuple[]"}],"internalType":"struct Submission","name":"submission","type":"tuple"}],"name":"submit","outputs":[],"stateMutability":"payable","type":"function"},
+	{"inputs":[],"name":"market","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"},
+	{"inputs":[],"name":"pricePerSector","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"}
+]`
+
+// Transactor sends transactions for the flow, typically the backend's transaction manager
+type Transactor interface {
+	ethereum.ContractCaller
+	Transact(ctx context.Context, to common.Address, data []byte, value *big.Int) (common.Hash, error)
+}
+
+// Flow submits file roots to the 0G flow contract so storage nodes accept the file's segments
+type Flow struct {
+	address    common.Address
+	abi        abi.ABI
+	transactor Transactor
+}
+
+// submission mirrors the flow contract's Submission struct
+type submission struct {
+	Length *big.Int
+	Tags   []byte
+	Nodes  []SubmissionNode
+}
+
+// NewFlow creates a flow submitter for the contract at address
+func NewFlow(address common.Address, transactor Transactor) (*Flow, error) {
+	parsed, err := abi.JSON(strings.NewReader(flowABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse flow ABI: %v", err)
+	}
+
+	return &Flow{address: address, abi: parsed, transactor: transactor}, nil
+}
+
+// Submit pays for and submits the file's subtree roots, returning the mined transaction hash
+func (f *Flow) Submit(ctx context.Context, layout Layout, nodes []SubmissionNode) (common.Hash, error) {
+	fee, err := f.fee(ctx, nodes)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	data, err := f.abi.Pack("submit", submission{
+		Length: big.NewInt(layout.Size),
+		Tags:   []byte{},
+		Nodes:  nodes,
+	})
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to pack submission: %v", err)
+	}
+
+	hash, err := f.transactor.Transact(ctx, f.address, data, fee)
+	if err != nil {
+		return hash, fmt.Errorf("failed to submit to flow: %w", err)
+	}
+
+	return hash, nil
+}
+
+// fee returns the storage fee for the submission, one price per 256 byte sector
+func (f *Flow) fee(ctx context.Context, nodes []SubmissionNode) (*big.Int, error) {
+	market, err := f.call(ctx, f.address, "market")
+	if err != nil {
+		return nil, err
+	}
+
+	price, err := f.call(ctx, market[0].(common.Address), "pricePerSector")
+	if err != nil {
+		return nil, err
+	}
+
+	sectors := new(big.Int)
+	for _, node := range nodes {
+		sectors.Add(sectors, new(big.Int).Lsh(big.NewInt(1), uint(node.Height.Uint64())))
+	}
+
+	return sectors.Mul(sectors, price[0].(*big.Int)), nil
+}
+
+// call runs a view method against the flow or market contract
+func (f *Flow) call(ctx context.Context, to common.Address, method string) ([]interface{}, error) {
+	data, err := f.abi.Pack(method)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack %s: %v", method, err)
+	}
+
+	output, err := f.transactor.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %v", method, err)
+	}
+
+	values, err := f.abi.Unpack(method, output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %v", method, err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%s returned no values", method)
+	}
+
+	return values, nil
+}
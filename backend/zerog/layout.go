@@ -0,0 +1,238 @@
+package zerog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/bits"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 0G Storage data layout
+const (
+	ChunkSize        = 256
+	SegmentMaxChunks = 1024
+	SegmentSize      = ChunkSize * SegmentMaxChunks
+)
+
+// emptyChunk pads data out to whole chunks
+var emptyChunk = make([]byte, ChunkSize)
+
+// Layout describes how a file of a given size is split into chunks and segments.
+// Files are padded with zero chunks so the flow can split them into power-of-two subtrees.
+type Layout struct {
+	Size         int64
+	Chunks       uint64
+	PaddedChunks uint64
+	NextPow2     uint64
+}
+
+// NewLayout computes the layout for a file of size bytes
+func NewLayout(size int64) (Layout, error) {
+	if size <= 0 {
+		return Layout{}, fmt.Errorf("file is empty")
+	}
+
+	chunks := uint64((size-1)/ChunkSize + 1)
+	padded, nextPow2 := computePaddedChunks(chunks)
+
+	return Layout{
+		Size:         size,
+		Chunks:       chunks,
+		PaddedChunks: padded,
+		NextPow2:     nextPow2,
+	}, nil
+}
+
+// computePaddedChunks rounds chunks up to a multiple of a sixteenth of the next power of two
+func computePaddedChunks(chunks uint64) (uint64, uint64) {
+	nextPow2 := uint64(1)
+	if chunks > 1 {
+		nextPow2 = 1 << bits.Len64(chunks-1)
+	}
+	if nextPow2 == chunks {
+		return chunks, nextPow2
+	}
+
+	minChunks := uint64(1)
+	if nextPow2 >= 16 {
+		minChunks = nextPow2 / 16
+	}
+
+	return ((chunks-1)/minChunks + 1) * minChunks, nextPow2
+}
+
+// PaddedSize returns the padded file size in bytes
+func (l Layout) PaddedSize() int64 {
+	return int64(l.PaddedChunks) * ChunkSize
+}
+
+// NumSegments returns the number of segments that carry file data
+func (l Layout) NumSegments() uint64 {
+	return uint64((l.Size-1)/SegmentSize + 1)
+}
+
+// NumSegmentsPadded returns the number of segments in the padded file, the leaves of the file tree
+func (l Layout) NumSegmentsPadded() uint64 {
+	return uint64((l.PaddedSize()-1)/SegmentSize + 1)
+}
+
+// SegmentRange returns the byte range [start, end) of a segment in the padded file
+func (l Layout) SegmentRange(index uint64) (int64, int64) {
+	start := int64(index) * SegmentSize
+	end := start + SegmentSize
+	if end > l.PaddedSize() {
+		end = l.PaddedSize()
+	}
+	return start, end
+}
+
+// DataLength returns how many bytes of a segment are file data rather than padding
+func (l Layout) DataLength(index uint64) int64 {
+	start, end := l.SegmentRange(index)
+	if end > l.Size {
+		end = l.Size
+	}
+	if end < start {
+		return 0
+	}
+	return end - start
+}
+
+// PadSegment zero-pads segment data out to the segment's full padded length
+func (l Layout) PadSegment(index uint64, data []byte) ([]byte, error) {
+	start, end := l.SegmentRange(index)
+	length := int(end - start)
+	if len(data) > length {
+		return nil, fmt.Errorf("segment %d has %d bytes, expected at most %d", index, len(data), length)
+	}
+	if len(data) == length {
+		return data, nil
+	}
+
+	padded := make([]byte, length)
+	copy(padded, data)
+	return padded, nil
+}
+
+// ReadSegment reads a segment from r and pads it
+func (l Layout) ReadSegment(r io.ReaderAt, index uint64) ([]byte, error) {
+	start, end := l.SegmentRange(index)
+	return l.readPadded(r, start, end)
+}
+
+// readPadded reads [start, end) of the padded file, filling beyond the data with zeros
+func (l Layout) readPadded(r io.ReaderAt, start, end int64) ([]byte, error) {
+	buf := make([]byte, end-start)
+	if start >= l.Size {
+		return buf, nil
+	}
+
+	dataEnd := end
+	if dataEnd > l.Size {
+		dataEnd = l.Size
+	}
+	if _, err := r.ReadAt(buf[:dataEnd-start], start); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	return buf, nil
+}
+
+// SegmentRoot returns the root of the chunk tree for a segment. A partial final chunk is zero-padded.
+func SegmentRoot(segment []byte) common.Hash {
+	leaves := make([]common.Hash, 0, (len(segment)+ChunkSize-1)/ChunkSize)
+	for offset := 0; offset < len(segment); offset += ChunkSize {
+		end := offset + ChunkSize
+		if end <= len(segment) {
+			leaves = append(leaves, crypto.Keccak256Hash(segment[offset:end]))
+			continue
+		}
+		chunk := make([]byte, ChunkSize)
+		copy(chunk, segment[offset:])
+		leaves = append(leaves, crypto.Keccak256Hash(chunk))
+	}
+	if len(leaves) == 0 {
+		return crypto.Keccak256Hash(emptyChunk)
+	}
+
+	return BuildTree(leaves).Root()
+}
+
+// BuildFileTree computes the segment roots of the padded file and the tree over them.
+// The tree root is the file's root hash on 0G Storage.
+func BuildFileTree(r io.ReaderAt, size int64) (*Tree, Layout, error) {
+	layout, err := NewLayout(size)
+	if err != nil {
+		return nil, Layout{}, err
+	}
+
+	roots := make([]common.Hash, 0, layout.NumSegmentsPadded())
+	for i := uint64(0); i < layout.NumSegmentsPadded(); i++ {
+		segment, err := layout.ReadSegment(r, i)
+		if err != nil {
+			return nil, Layout{}, err
+		}
+		roots = append(roots, SegmentRoot(segment))
+	}
+
+	return BuildTree(roots), layout, nil
+}
+
+// SubmissionNode is one power-of-two subtree of a flow submission
+type SubmissionNode struct {
+	Root   [32]byte
+	Height *big.Int
+}
+
+// SubmissionNodes splits the padded file into the power-of-two subtrees the flow contract expects,
+// largest first, with each subtree's root and height in chunks
+func (l Layout) SubmissionNodes(r io.ReaderAt) ([]SubmissionNode, error) {
+	var nodes []SubmissionNode
+
+	remaining := l.PaddedChunks
+	var offset int64
+	for size := l.NextPow2; remaining > 0 && size > 0; size /= 2 {
+		if remaining < size {
+			continue
+		}
+
+		node, err := l.submissionNode(r, offset, size)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, *node)
+
+		remaining -= size
+		offset += int64(size) * ChunkSize
+	}
+
+	return nodes, nil
+}
+
+// submissionNode computes the root of a subtree of chunks starting at offset
+func (l Layout) submissionNode(r io.ReaderAt, offset int64, chunks uint64) (*SubmissionNode, error) {
+	batch := int64(chunks)
+	if batch > SegmentMaxChunks {
+		batch = SegmentMaxChunks
+	}
+	batch *= ChunkSize
+
+	end := offset + int64(chunks)*ChunkSize
+	var roots []common.Hash
+	for start := offset; start < end; start += batch {
+		segment, err := l.readPadded(r, start, start+batch)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, SegmentRoot(segment))
+	}
+
+	return &SubmissionNode{
+		Root:   BuildTree(roots).Root(),
+		Height: big.NewInt(int64(bits.Len64(chunks) - 1)),
+	}, nil
+}
@@ -0,0 +1,159 @@
+package zerog
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// ErrProofInvalid is returned when a proof doesn't lead from the leaf to the root
+	ErrProofInvalid = errors.New("merkle proof is invalid")
+)
+
+// Proof is a Merkle proof in the format 0G storage nodes exchange. Lemma holds the leaf hash,
+// the sibling hashes from the bottom up and finally the root. Path[i] is true when the node
+// being proven is the left child at that level. A tree with a single leaf has Lemma [root]
+// and an empty Path.
+type Proof struct {
+	Lemma []common.Hash `json:"lemma"`
+	Path  []bool        `json:"path"`
+}
+
+// Tree is a Merkle tree built the way 0G builds it: nodes hash as keccak256(left ++ right),
+// and an odd node at the end of a level is promoted to the next level unchanged.
+type Tree struct {
+	levels [][]common.Hash
+}
+
+// BuildTree builds a tree over the given leaf hashes
+func BuildTree(leaves []common.Hash) *Tree {
+	if len(leaves) == 0 {
+		return &Tree{}
+	}
+
+	level := append([]common.Hash(nil), leaves...)
+	levels := [][]common.Hash{level}
+
+	for len(level) > 1 {
+		next := make([]common.Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, hashPair(level[i], level[i+1]))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+
+	return &Tree{levels: levels}
+}
+
+// Root returns the tree root, or the zero hash for an empty tree
+func (t *Tree) Root() common.Hash {
+	if len(t.levels) == 0 {
+		return common.Hash{}
+	}
+	return t.levels[len(t.levels)-1][0]
+}
+
+// NumLeaves returns the number of leaves
+func (t *Tree) NumLeaves() int {
+	if len(t.levels) == 0 {
+		return 0
+	}
+	return len(t.levels[0])
+}
+
+// Proof returns the proof for the leaf at index
+func (t *Tree) Proof(index int) (*Proof, error) {
+	if index < 0 || index >= t.NumLeaves() {
+		return nil, fmt.Errorf("leaf index %d out of range", index)
+	}
+
+	if t.NumLeaves() == 1 {
+		return &Proof{Lemma: []common.Hash{t.Root()}, Path: []bool{}}, nil
+	}
+
+	proof := &Proof{Lemma: []common.Hash{t.levels[0][index]}}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Lemma = append(proof.Lemma, level[sibling])
+			proof.Path = append(proof.Path, index%2 == 0)
+		}
+		index /= 2
+	}
+	proof.Lemma = append(proof.Lemma, t.Root())
+
+	return proof, nil
+}
+
+// Validate checks that the proof shows leaf at position in a tree of numLeaves leaves with the given root
+func (p *Proof) Validate(root, leaf common.Hash, position, numLeaves uint64) error {
+	if position >= numLeaves {
+		return fmt.Errorf("%w: position %d out of range", ErrProofInvalid, position)
+	}
+
+	if numLeaves == 1 {
+		if len(p.Lemma) != 1 || len(p.Path) != 0 || p.Lemma[0] != root || leaf != root {
+			return fmt.Errorf("%w: single leaf mismatch", ErrProofInvalid)
+		}
+		return nil
+	}
+
+	if len(p.Lemma) != len(p.Path)+2 {
+		return fmt.Errorf("%w: lemma has %d hashes for %d path steps", ErrProofInvalid, len(p.Lemma), len(p.Path))
+	}
+	if p.Lemma[0] != leaf {
+		return fmt.Errorf("%w: leaf hash mismatch", ErrProofInvalid)
+	}
+	if p.Lemma[len(p.Lemma)-1] != root {
+		return fmt.Errorf("%w: root mismatch", ErrProofInvalid)
+	}
+
+	// The path is fully determined by the position, so a proof for another leaf can't pass
+	expected := proofPath(position, numLeaves)
+	if len(expected) != len(p.Path) {
+		return fmt.Errorf("%w: path length mismatch", ErrProofInvalid)
+	}
+	for i := range expected {
+		if expected[i] != p.Path[i] {
+			return fmt.Errorf("%w: position mismatch", ErrProofInvalid)
+		}
+	}
+
+	hash := leaf
+	for i, isLeft := range p.Path {
+		if isLeft {
+			hash = hashPair(hash, p.Lemma[i+1])
+		} else {
+			hash = hashPair(p.Lemma[i+1], hash)
+		}
+	}
+	if hash != root {
+		return fmt.Errorf("%w: computed root mismatch", ErrProofInvalid)
+	}
+
+	return nil
+}
+
+// proofPath returns the sides a leaf takes on its way to the root, skipping levels where it is promoted
+func proofPath(position, numLeaves uint64) []bool {
+	var path []bool
+	for n := numLeaves; n > 1; n = (n + 1) / 2 {
+		if position^1 < n {
+			path = append(path, position%2 == 0)
+		}
+		position /= 2
+	}
+	return path
+}
+
+func hashPair(left, right common.Hash) common.Hash {
+	return crypto.Keccak256Hash(left.Bytes(), right.Bytes())
+}
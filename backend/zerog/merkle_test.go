@@ -0,0 +1,203 @@
+package zerog
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// testData returns size bytes of deterministic pseudo-random data
+func testData(size int64) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(size)).Read(data)
+	return data
+}
+
+// referenceRoot computes a file root straight from the 0G layout rules, without segments: the file
+// is zero-padded to its padded chunk count, every chunk is hashed, and pairs are hashed level by
+// level with an odd last node promoted unchanged
+func referenceRoot(data []byte) common.Hash {
+	layout, err := NewLayout(int64(len(data)))
+	if err != nil {
+		panic(err)
+	}
+
+	padded := make([]byte, layout.PaddedSize())
+	copy(padded, data)
+
+	var level []common.Hash
+	for offset := 0; offset < len(padded); offset += ChunkSize {
+		level = append(level, crypto.Keccak256Hash(padded[offset:offset+ChunkSize]))
+	}
+	for len(level) > 1 {
+		var next []common.Hash
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, crypto.Keccak256Hash(level[i][:], level[i+1][:]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+	}
+
+	return level[0]
+}
+
+func TestComputePaddedChunks(t *testing.T) {
+	tests := []struct {
+		chunks, padded, nextPow2 uint64
+	}{
+		{1, 1, 1},
+		{2, 2, 2},
+		{3, 3, 4},
+		{5, 5, 8},
+		{16, 16, 16},
+		{17, 18, 32},
+		{33, 36, 64},
+		{1025, 1152, 2048},
+		{4097, 4608, 8192},
+	}
+
+	for _, tt := range tests {
+		padded, nextPow2 := computePaddedChunks(tt.chunks)
+		if padded != tt.padded || nextPow2 != tt.nextPow2 {
+			t.Errorf("computePaddedChunks(%d) = (%d, %d), want (%d, %d)", tt.chunks, padded, nextPow2, tt.padded, tt.nextPow2)
+		}
+	}
+}
+
+func TestFileRoot(t *testing.T) {
+	sizes := []int64{
+		1, ChunkSize - 1, ChunkSize, ChunkSize + 1,
+		SegmentSize - 1, SegmentSize, SegmentSize + 1,
+		3*SegmentSize + 1000, 16 * SegmentSize, 17*SegmentSize + 5,
+	}
+
+	for _, size := range sizes {
+		data := testData(size)
+
+		tree, layout, err := BuildFileTree(bytes.NewReader(data), size)
+		if err != nil {
+			t.Fatalf("BuildFileTree(%d): %v", size, err)
+		}
+		if want := referenceRoot(data); tree.Root() != want {
+			t.Errorf("root of %d bytes = %s, want %s", size, tree.Root().Hex(), want.Hex())
+		}
+		if uint64(tree.NumLeaves()) != layout.NumSegmentsPadded() {
+			t.Errorf("tree of %d bytes has %d leaves, want %d", size, tree.NumLeaves(), layout.NumSegmentsPadded())
+		}
+	}
+}
+
+func TestFileRootVectors(t *testing.T) {
+	// A single chunk's root is the hash of the chunk zero-padded to 256 bytes
+	chunk := make([]byte, ChunkSize)
+	chunk[0] = 'a'
+
+	tree, _, err := BuildFileTree(bytes.NewReader([]byte("a")), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := crypto.Keccak256Hash(chunk); tree.Root() != want {
+		t.Errorf("root of \"a\" = %s, want %s", tree.Root().Hex(), want.Hex())
+	}
+
+	// Two chunks hash as a pair, a third is promoted past the first level
+	a, b, c := bytes.Repeat([]byte{1}, ChunkSize), bytes.Repeat([]byte{2}, ChunkSize), bytes.Repeat([]byte{3}, ChunkSize)
+	data := append(append(append([]byte{}, a...), b...), c...)
+
+	tree, _, err = BuildFileTree(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ab := crypto.Keccak256Hash(crypto.Keccak256(a), crypto.Keccak256(b))
+	if want := crypto.Keccak256Hash(ab[:], crypto.Keccak256(c)); tree.Root() != want {
+		t.Errorf("root of three chunks = %s, want %s", tree.Root().Hex(), want.Hex())
+	}
+
+	// Pinned roots, so a change to padding or segmenting can't pass by changing the reference too
+	pinned := map[int64]string{
+		1:                  "0xe19603120abf2686dd6215172f10c2b7e9d2bda971f4b4741dc71989020ea5f2",
+		1000:               "0x59adc41205fa4c47c1e918eecfcf8e44eac048f259fe05ef1ef72924d228fb4a",
+		SegmentSize + 1:    "0x4a22f3741fea3515206a150f665aa09fd5d9ef72bfecdb1649c88ef64305c1b8",
+		17*SegmentSize + 5: "0x2bd7db1531c74e66f380b43ba52ecf6b9a4a261697ad5d63d22b5d66290ddbad",
+	}
+	for size, want := range pinned {
+		tree, _, err := BuildFileTree(bytes.NewReader(testData(size)), size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tree.Root() != common.HexToHash(want) {
+			t.Errorf("root of %d bytes = %s, want %s", size, tree.Root().Hex(), want)
+		}
+	}
+}
+
+func TestSubmissionNodes(t *testing.T) {
+	for _, size := range []int64{1, 5 * ChunkSize, SegmentSize, 17*SegmentSize + 5} {
+		data := testData(size)
+		layout, err := NewLayout(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nodes, err := layout.SubmissionNodes(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("SubmissionNodes(%d): %v", size, err)
+		}
+
+		// The subtrees cover the padded file exactly, largest first
+		var chunks uint64
+		for i, node := range nodes {
+			height := node.Height.Uint64()
+			if i > 0 && height >= nodes[i-1].Height.Uint64() {
+				t.Errorf("size %d: node %d has height %d after %d", size, i, height, nodes[i-1].Height.Uint64())
+			}
+			chunks += 1 << height
+		}
+		if chunks != layout.PaddedChunks {
+			t.Errorf("size %d: nodes cover %d chunks, want %d", size, chunks, layout.PaddedChunks)
+		}
+
+		// A file padded to a power of two is a single subtree with the file's root
+		if layout.PaddedChunks == layout.NextPow2 {
+			tree, _, _ := BuildFileTree(bytes.NewReader(data), size)
+			if len(nodes) != 1 || common.Hash(nodes[0].Root) != tree.Root() {
+				t.Errorf("size %d: expected a single node with the file root", size)
+			}
+		}
+	}
+}
+
+func TestProofs(t *testing.T) {
+	for _, numLeaves := range []int{1, 2, 3, 5, 8, 13} {
+		leaves := make([]common.Hash, numLeaves)
+		for i := range leaves {
+			leaves[i] = crypto.Keccak256Hash([]byte{byte(i)})
+		}
+		tree := BuildTree(leaves)
+
+		for i, leaf := range leaves {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatalf("Proof(%d) of %d leaves: %v", i, numLeaves, err)
+			}
+			if err := proof.Validate(tree.Root(), leaf, uint64(i), uint64(numLeaves)); err != nil {
+				t.Errorf("proof of leaf %d of %d: %v", i, numLeaves, err)
+			}
+
+			// A proof only holds for its own position
+			if numLeaves > 1 {
+				other := uint64((i + 1) % numLeaves)
+				if err := proof.Validate(tree.Root(), leaf, other, uint64(numLeaves)); !errors.Is(err, ErrProofInvalid) {
+					t.Errorf("proof of leaf %d of %d validated at position %d", i, numLeaves, other)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package zerog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// SegmentWithProof is a segment of file data with the proof that places it under the file root
+type SegmentWithProof struct {
+	Root     common.Hash `json:"root"`
+	Data     []byte      `json:"data"`
+	Index    uint64      `json:"index"`
+	Proof    Proof       `json:"proof"`
+	FileSize uint64      `json:"fileSize"`
+}
+
+// FileTx is the flow submission a storage node associates with a file
+type FileTx struct {
+	DataMerkleRoot common.Hash `json:"dataMerkleRoot"`
+	Size           uint64      `json:"size"`
+	Seq            uint64      `json:"seq"`
+}
+
+// FileInfo is a storage node's view of a file
+type FileInfo struct {
+	Tx             FileTx `json:"tx"`
+	Finalized      bool   `json:"finalized"`
+	IsCached       bool   `json:"isCached"`
+	UploadedSegNum uint64 `json:"uploadedSegNum"`
+}
+
+// NodeClient talks to a 0G storage node over its zgs JSON-RPC API
+type NodeClient struct {
+	rpc *rpc.Client
+}
+
+// DialNode connects to a storage node
+func DialNode(ctx context.Context, url string) (*NodeClient, error) {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to storage node: %v", err)
+	}
+	return &NodeClient{rpc: client}, nil
+}
+
+// NewNodeClient wraps an existing RPC client
+func NewNodeClient(client *rpc.Client) *NodeClient {
+	return &NodeClient{rpc: client}
+}
+
+// Close closes the RPC connection
+func (n *NodeClient) Close() {
+	n.rpc.Close()
+}
+
+// GetFileInfo returns the node's view of a file, or nil if the node doesn't know the root
+func (n *NodeClient) GetFileInfo(ctx context.Context, root common.Hash) (*FileInfo, error) {
+	var info *FileInfo
+	if err := n.rpc.CallContext(ctx, &info, "zgs_getFileInfo", root); err != nil {
+		return nil, fmt.Errorf("failed to get file info: %v", err)
+	}
+	return info, nil
+}
+
+// UploadSegment sends one segment with its proof to the node
+func (n *NodeClient) UploadSegment(ctx context.Context, segment *SegmentWithProof) error {
+	var result interface{}
+	if err := n.rpc.CallContext(ctx, &result, "zgs_uploadSegment", segment); err != nil {
+		return fmt.Errorf("failed to upload segment %d: %v", segment.Index, err)
+	}
+	return nil
+}
+
+// DownloadSegmentWithProof fetches one segment and its proof, or nil if the node doesn't have it
+func (n *NodeClient) DownloadSegmentWithProof(ctx context.Context, root common.Hash, index uint64) (*SegmentWithProof, error) {
+	var segment *SegmentWithProof
+	if err := n.rpc.CallContext(ctx, &segment, "zgs_downloadSegmentWithProof", root, index); err != nil {
+		return nil, fmt.Errorf("failed to download segment %d: %v", index, err)
+	}
+	return segment, nil
+}
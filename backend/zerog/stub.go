@@ -0,0 +1,160 @@
+package zerog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// StubNode is an in-memory storage node for local development. It speaks the same zgs RPC
+// methods as a real node and checks segment proofs the same way, but files are registered by
+// their first uploaded segment instead of a flow submission.
+type StubNode struct {
+	mu    sync.Mutex
+	files map[common.Hash]*stubFile
+}
+
+type stubFile struct {
+	layout   Layout
+	seq      uint64
+	segments map[uint64][]byte
+	tree     *Tree
+}
+
+// NewStubNode creates an empty stub node
+func NewStubNode() *StubNode {
+	return &StubNode{files: make(map[common.Hash]*stubFile)}
+}
+
+// Server returns an RPC server exposing the node under the zgs namespace
+func (s *StubNode) Server() (*rpc.Server, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("zgs", &stubService{node: s}); err != nil {
+		return nil, fmt.Errorf("failed to register stub node: %v", err)
+	}
+	return server, nil
+}
+
+// Client returns a node client connected to the stub in process
+func (s *StubNode) Client() (*NodeClient, error) {
+	server, err := s.Server()
+	if err != nil {
+		return nil, err
+	}
+	return NewNodeClient(rpc.DialInProc(server)), nil
+}
+
+// stubService holds the RPC methods so the node's own exported methods aren't registered
+type stubService struct {
+	node *StubNode
+}
+
+// GetFileInfo implements zgs_getFileInfo
+func (svc *stubService) GetFileInfo(ctx context.Context, root common.Hash) (*FileInfo, error) {
+	s := svc.node
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, ok := s.files[root]
+	if !ok {
+		return nil, nil
+	}
+
+	return &FileInfo{
+		Tx: FileTx{
+			DataMerkleRoot: root,
+			Size:           uint64(file.layout.Size),
+			Seq:            file.seq,
+		},
+		Finalized:      file.tree != nil,
+		UploadedSegNum: uint64(len(file.segments)),
+	}, nil
+}
+
+// UploadSegment implements zgs_uploadSegment
+func (svc *stubService) UploadSegment(ctx context.Context, segment SegmentWithProof) error {
+	s := svc.node
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, ok := s.files[segment.Root]
+	if !ok {
+		layout, err := NewLayout(int64(segment.FileSize))
+		if err != nil {
+			return err
+		}
+		file = &stubFile{
+			layout:   layout,
+			seq:      uint64(len(s.files)),
+			segments: make(map[uint64][]byte),
+		}
+	}
+
+	if segment.Index >= file.layout.NumSegments() {
+		return fmt.Errorf("segment index %d out of range", segment.Index)
+	}
+	if int64(len(segment.Data)) != file.layout.DataLength(segment.Index) {
+		return fmt.Errorf("segment %d has %d bytes, expected %d", segment.Index, len(segment.Data), file.layout.DataLength(segment.Index))
+	}
+
+	padded, err := file.layout.PadSegment(segment.Index, segment.Data)
+	if err != nil {
+		return err
+	}
+	if err := segment.Proof.Validate(segment.Root, SegmentRoot(padded), segment.Index, file.layout.NumSegmentsPadded()); err != nil {
+		return err
+	}
+
+	s.files[segment.Root] = file
+	file.segments[segment.Index] = segment.Data
+
+	if file.tree == nil && uint64(len(file.segments)) == file.layout.NumSegments() {
+		file.tree = file.buildTree()
+	}
+
+	return nil
+}
+
+// DownloadSegmentWithProof implements zgs_downloadSegmentWithProof
+func (svc *stubService) DownloadSegmentWithProof(ctx context.Context, root common.Hash, index uint64) (*SegmentWithProof, error) {
+	s := svc.node
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, ok := s.files[root]
+	if !ok || file.tree == nil {
+		return nil, nil
+	}
+
+	data, ok := file.segments[index]
+	if !ok {
+		return nil, nil
+	}
+
+	proof, err := file.tree.Proof(int(index))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SegmentWithProof{
+		Root:     root,
+		Data:     data,
+		Index:    index,
+		Proof:    *proof,
+		FileSize: uint64(file.layout.Size),
+	}, nil
+}
+
+// buildTree rebuilds the file tree once every data segment is present
+func (f *stubFile) buildTree() *Tree {
+	roots := make([]common.Hash, 0, f.layout.NumSegmentsPadded())
+	for i := uint64(0); i < f.layout.NumSegmentsPadded(); i++ {
+		// PadSegment can't fail here, the lengths were checked on upload
+		padded, _ := f.layout.PadSegment(i, f.segments[i])
+		roots = append(roots, SegmentRoot(padded))
+	}
+	return BuildTree(roots)
+}
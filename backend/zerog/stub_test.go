@@ -0,0 +1,109 @@
+package zerog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// newStubClient returns a client uploading to a fresh in-process stub node
+func newStubClient(t *testing.T) (*Client, *NodeClient) {
+	node, err := NewStubNode().Client()
+	if err != nil {
+		t.Fatalf("failed to start stub node: %v", err)
+	}
+	t.Cleanup(node.Close)
+
+	return NewClient(node, nil), node
+}
+
+func TestStubRoundTrip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, size := range []int64{1, ChunkSize + 1, SegmentSize, 3*SegmentSize + 1000} {
+		client, _ := newStubClient(t)
+		data := testData(size)
+
+		result, err := client.Upload(ctx, bytes.NewReader(data), size)
+		if err != nil {
+			t.Fatalf("Upload(%d): %v", size, err)
+		}
+		if want := referenceRoot(data); result.Root != want {
+			t.Errorf("uploaded %d bytes as %s, want %s", size, result.Root.Hex(), want.Hex())
+		}
+
+		info, err := client.FileInfo(ctx, result.Root)
+		if err != nil {
+			t.Fatalf("FileInfo(%d): %v", size, err)
+		}
+		if !info.Finalized || info.Tx.Size != uint64(size) {
+			t.Errorf("file of %d bytes: finalized %v, size %d", size, info.Finalized, info.Tx.Size)
+		}
+
+		var downloaded bytes.Buffer
+		n, err := client.Download(ctx, result.Root, &downloaded)
+		if err != nil {
+			t.Fatalf("Download(%d): %v", size, err)
+		}
+		if n != size || !bytes.Equal(downloaded.Bytes(), data) {
+			t.Errorf("downloaded %d bytes differing from the %d uploaded", n, size)
+		}
+
+		// Uploading the same content again finds it already stored
+		again, err := client.Upload(ctx, bytes.NewReader(data), size)
+		if err != nil || again.Root != result.Root {
+			t.Errorf("re-upload of %d bytes: root %v, err %v", size, again, err)
+		}
+	}
+}
+
+func TestStubRejectsBadSegments(t *testing.T) {
+	ctx := context.Background()
+	_, node := newStubClient(t)
+
+	size := int64(3 * SegmentSize)
+	data := testData(size)
+	tree, layout, err := BuildFileTree(bytes.NewReader(data), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := tree.Proof(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	segment := func(index uint64, data []byte) *SegmentWithProof {
+		return &SegmentWithProof{Root: tree.Root(), Data: data, Index: index, Proof: *proof, FileSize: uint64(size)}
+	}
+	start, end := layout.SegmentRange(1)
+
+	// Tampered data no longer matches the proof
+	tampered := append([]byte(nil), data[start:end]...)
+	tampered[0] ^= 0xff
+	if err := node.UploadSegment(ctx, segment(1, tampered)); err == nil {
+		t.Error("stub accepted a tampered segment")
+	}
+
+	// A valid proof for one index doesn't hold for another
+	if err := node.UploadSegment(ctx, segment(2, data[start:end])); err == nil {
+		t.Error("stub accepted a segment at the wrong index")
+	}
+
+	if err := node.UploadSegment(ctx, segment(1, data[start:end])); err != nil {
+		t.Errorf("stub rejected a valid segment: %v", err)
+	}
+
+	// Until every segment arrives the file isn't downloadable
+	client := NewClient(node, nil)
+	if _, err := client.Download(ctx, tree.Root(), &bytes.Buffer{}); err == nil {
+		t.Error("downloaded a file with missing segments")
+	}
+	if _, err := client.FileInfo(ctx, common.Hash{1}); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("FileInfo of an unknown root: %v", err)
+	}
+}